@@ -0,0 +1,83 @@
+package main
+
+import (
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+// matchAdminRequest checks whether the current request targets the admin API
+// and, if so, captures the request attributes used for authorization.
+func (ctx *httpContext) matchAdminRequest() bool {
+	path, err := proxywasm.GetHttpRequestHeader(":path")
+	if err != nil || !ctx.adminService.Matches(path) {
+		return false
+	}
+
+	method, _ := proxywasm.GetHttpRequestHeader(":method")
+	token, _ := proxywasm.GetHttpRequestHeader(ctx.config.Admin.TokenHeader)
+
+	ctx.isAdminRequest = true
+	ctx.adminRequest = &AdminRequest{
+		Method:   method,
+		Path:     path,
+		Token:    token,
+		SourceIP: ctx.fingerprintService.SourceAddress(),
+	}
+	return true
+}
+
+// handleAdminRequestHeaders answers the admin request immediately, or waits
+// for the request body when one is expected.
+func (ctx *httpContext) handleAdminRequestHeaders(endOfStream bool) types.Action {
+	if !endOfStream && ctx.adminRequest.Method == "POST" {
+		// Hold the request until the body has been received
+		return types.ActionPause
+	}
+	return ctx.sendAdminResponse()
+}
+
+// handleAdminRequestBody buffers the admin request body and replies once
+// the full body has been received.
+func (ctx *httpContext) handleAdminRequestBody(bodySize int, endOfStream bool) types.Action {
+	if bodySize > maxAdminBodySize {
+		ctx.adminRequest = nil
+		return ctx.sendLocalJSON(adminError(413, "request body too large"))
+	}
+
+	if !endOfStream {
+		return types.ActionPause
+	}
+
+	body, err := proxywasm.GetHttpRequestBody(0, bodySize)
+	if err != nil {
+		ctx.logError("failed to read admin request body: %v", err)
+		return ctx.sendLocalJSON(adminError(400, "failed to read request body"))
+	}
+	ctx.adminRequest.Body = body
+
+	return ctx.sendAdminResponse()
+}
+
+// sendAdminResponse routes the admin request and sends the local reply.
+// The request stays paused until the reply is sent, which may happen in a
+// Redis callback.
+func (ctx *httpContext) sendAdminResponse() types.Action {
+	ctx.adminService.Handle(ctx.adminRequest, func(response *AdminResponse) {
+		ctx.sendLocalJSON(response)
+	})
+	return types.ActionPause
+}
+
+// sendLocalJSON sends an admin response as a local JSON reply.
+func (ctx *httpContext) sendLocalJSON(response *AdminResponse) types.Action {
+	headers := [][2]string{
+		{"content-type", "application/json"},
+		{"cache-control", "no-store"},
+	}
+
+	if err := proxywasm.SendHttpResponse(uint32(response.StatusCode), headers, response.Body, -1); err != nil {
+		ctx.logError("failed to send admin response: %v", err)
+	}
+
+	return types.ActionPause
+}
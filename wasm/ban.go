@@ -1,23 +1,125 @@
 package main
 
 import (
+	"strings"
+
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
 )
 
+// checkAllowlist checks the current client against the allowlist and
+// records the matching reason. Returns true if the client is allowlisted.
+func (ctx *httpContext) checkAllowlist() bool {
+	allowlist := ctx.pluginContext.allowlist
+	if allowlist == nil || allowlist.IsEmpty() {
+		return false
+	}
+
+	req := &AllowlistRequest{
+		Fingerprint: ctx.fingerprint,
+		SourceIP:    ctx.fingerprintService.SourceAddress(),
+	}
+	if ua, err := proxywasm.GetHttpRequestHeader("user-agent"); err == nil {
+		req.UserAgent = ua
+	}
+	if header := ctx.config.Allowlist.BypassHeader; header != "" {
+		if token, err := proxywasm.GetHttpRequestHeader(header); err == nil {
+			req.BypassToken = token
+		}
+	}
+
+	ctx.allowlistReason = allowlist.Match(req)
+	if ctx.allowlistReason != "" {
+		ctx.logDebug("client allowlisted (%s), skipping ban check", ctx.allowlistReason)
+		return true
+	}
+	return false
+}
+
+// applyPolicy switches the request to the effective configuration of the
+// first policy matching its host, path and method, and sets the scopes
+// its bans are looked up and issued in.
+func (ctx *httpContext) applyPolicy() {
+	host, _ := proxywasm.GetHttpRequestHeader(":authority")
+	path, _ := proxywasm.GetHttpRequestHeader(":path")
+	method, _ := proxywasm.GetHttpRequestHeader(":method")
+
+	var policy *Policy
+	if policies := ctx.pluginContext.policies; policies != nil && !policies.IsEmpty() {
+		policy = policies.Match(host, path, method)
+	}
+
+	// Path-scoped bans apply to the path prefix of the matching policy,
+	// or else to the first segment of the canonical path, so that
+	// "//api/x" or "/%61pi/x" cannot evade a ban on "/api"
+	pathPrefix := pathScopePrefix(ctx.config.canonicalPath(path))
+	if policy != nil && policy.pathPrefix != "" {
+		pathPrefix = policy.pathPrefix
+	}
+	ctx.banService.SetScopes(NewRequestScopes(strings.ToLower(stripPort(host)), pathPrefix))
+
+	if policy == nil {
+		return
+	}
+
+	ctx.logDebug("request matched policy %s", policy.Name)
+	ctx.pluginContext.metrics.Increment(metricName(metricPolicyMatches, "policy", policy.Name), 1)
+
+	ctx.config = policy.Config
+	ctx.fingerprintService.SetConfig(policy.Config)
+	ctx.banService.SetConfig(policy.Config)
+}
+
+// matchDenylist checks the client address and ASN against the static
+// denylist. The client address is the connection address; X-Forwarded-For
+// is only used behind a trusted proxy, as any client can set it.
+func (ctx *httpContext) matchDenylist() *DenylistRule {
+	denylist := ctx.pluginContext.denylist
+	if denylist == nil || denylist.IsEmpty() {
+		return nil
+	}
+
+	asn := ""
+	if header := ctx.config.Denylist.ASNHeader; header != "" {
+		if value, err := proxywasm.GetHttpRequestHeader(header); err == nil {
+			asn = value
+		}
+	}
+
+	forwardedFor, _ := proxywasm.GetHttpRequestHeader("x-forwarded-for")
+	clientIP := denylist.ClientAddress(ctx.fingerprintService.SourceAddress(), forwardedFor)
+
+	return denylist.Match(clientIP, asn)
+}
+
 // checkBan checks if the current request should be blocked
 // Returns true if the client is banned
 func (ctx *httpContext) checkBan() bool {
-	// 1. Check local cache first using BanService (fastest)
+	// 1. Check the static denylist before any fingerprint lookup
+	if rule := ctx.matchDenylist(); rule != nil {
+		ctx.banService.EnforceDenylist(ctx.fingerprint, rule)
+		ctx.isBanned = true
+		return true
+	}
+
+	// 2. Check local cache using BanService (fastest)
 	result := ctx.banService.CheckBan(ctx.fingerprint)
 	if result.IsBanned {
 		ctx.isBanned = true
+		ctx.banEntry = result.Entry
 		return true
 	}
 
-	// 2. Check Redis asynchronously (if configured)
+	// 3. Check Redis asynchronously (if configured)
+	// The callback may fire synchronously (e.g., circuit open), in which
+	// case the outcome is already known when CheckBanAsync returns.
 	if ctx.fingerprint != "" && ctx.redisClient.IsConfigured() {
+		ids := ctx.banService.BanIDs(ctx.fingerprint)
 		ctx.pendingRedis = true
-		ctx.redisClient.CheckBanAsync(ctx.fingerprint, ctx.handleRedisBanResponse)
+		ctx.redisChecks = len(ids)
+		for _, id := range ids {
+			ctx.redisClient.CheckBanAsync(id, ctx.handleRedisBanResponse)
+		}
+		return ctx.isBanned
 	}
 
 	return false
@@ -26,21 +128,90 @@ func (ctx *httpContext) checkBan() bool {
 // issueBan creates a ban for the current fingerprint based on WAF metadata.
 // Delegates core logic to BanService, handles Redis sync separately.
 func (ctx *httpContext) issueBan() {
+	// Allowlisted clients are never banned
+	if ctx.allowlistReason != "" {
+		ctx.banService.SkipAllowlisted(ctx.fingerprint, ctx.corazaMetadata, ctx.allowlistReason)
+		return
+	}
+
 	// Use BanService for core ban logic (local cache)
-	result := ctx.banService.IssueBan(ctx.fingerprint, ctx.corazaMetadata)
+	ctx.handleIssueResult(ctx.banService.IssueBan(ctx.fingerprint, ctx.corazaMetadata))
+}
+
+// scoreDetection scores the attacks Coraza detected in a request it did
+// not block.
+func (ctx *httpContext) scoreDetection() {
+	// Allowlisted clients are never scored
+	if ctx.allowlistReason != "" {
+		return
+	}
+
+	ctx.handleIssueResult(ctx.banService.ScoreDetection(ctx.fingerprint, ctx.corazaMetadata))
+}
 
-	// Store in Redis asynchronously if ban was issued
+// handleIssueResult stores an issued ban in Redis, or counts a score
+// decision pending on the cluster-wide score.
+func (ctx *httpContext) handleIssueResult(result *BanIssueResult) {
+	if result.Pending {
+		ctx.scoreChecks++
+		return
+	}
+	ctx.syncBan(result)
+}
+
+// syncBan stores an issued ban in Redis asynchronously.
+func (ctx *httpContext) syncBan(result *BanIssueResult) {
 	if result.Issued && result.Entry != nil && ctx.redisClient.IsConfigured() {
 		ctx.redisClient.SetBanAsync(result.Entry, ctx.handleRedisBanSetResponse)
 	}
 }
 
-// handleRedisBanResponse processes the response from Redis ban check
-func (ctx *httpContext) handleRedisBanResponse(banned bool, entry *BanEntry) {
-	ctx.pendingRedis = false
+// handleClusterScore receives the decision of a pending score update,
+// made on the cluster-wide score, and resumes the response held for it.
+func (ctx *httpContext) handleClusterScore(result *BanIssueResult) {
+	ctx.syncBan(result)
 
-	if banned && entry != nil {
-		ctx.logInfo("ban found in Redis for %s", ctx.fingerprint)
+	// A decision delivered before IssueBan returned (e.g., circuit open)
+	// drops the count below zero until the pending result is counted
+	ctx.scoreChecks--
+	if ctx.scoreChecks > 0 || !ctx.responsePaused {
+		return
+	}
+	ctx.responsePaused = false
+
+	if err := proxywasm.ResumeHttpResponse(); err != nil {
+		ctx.logError("failed to resume response: %v", err)
+	}
+}
+
+// recordSignals counts the response toward the request rate and response
+// code signals, and adds the score of the signals it triggers. Responses
+// detected as WAF blocks, including from the status alone, are banned
+// instead and never reach it.
+func (ctx *httpContext) recordSignals(statusCode int) {
+	// Allowlisted clients are never scored
+	if ctx.allowlistReason != "" {
+		return
+	}
+
+	for _, signal := range ctx.signalService.Observe(ctx.fingerprint, statusCode) {
+		ctx.pluginContext.metrics.Increment(metricName(metricSignals, "signal", signal), 1)
+
+		ctx.handleIssueResult(ctx.banService.ScoreSignal(ctx.fingerprint, signal))
+	}
+}
+
+// handleRedisBanResponse processes the response from Redis ban check,
+// one per ban scope. Once all scopes are checked, a ban found in any of
+// them is enforced. ok is false when Redis could not be reached; the
+// redis_failure_mode setting then decides whether the request is allowed
+// or denied.
+func (ctx *httpContext) handleRedisBanResponse(banned bool, entry *BanEntry, ok bool) {
+	switch {
+	case !ok:
+		ctx.redisFailed = true
+	case banned && entry != nil && ctx.banEntry == nil:
+		ctx.logInfo("ban found in Redis for %s", entry.ID())
 
 		// Sync Redis data to local cache using BanService
 		if err := ctx.banService.SyncBanFromRedis(entry); err != nil {
@@ -48,12 +219,37 @@ func (ctx *httpContext) handleRedisBanResponse(banned bool, entry *BanEntry) {
 		}
 
 		ctx.isBanned = true
+		ctx.banEntry = entry
+	}
+
+	// Wait for the checks of the other scopes
+	ctx.redisChecks--
+	if ctx.redisChecks > 0 {
+		return
+	}
+	ctx.pendingRedis = false
+
+	if ctx.redisFailed && !ctx.isBanned {
+		if ctx.config.RedisFailureMode == RedisFailureModeClosed {
+			ctx.logWarn("Redis unavailable, failing closed for %s", ctx.fingerprint)
+			ctx.isBanned = true
+		} else {
+			ctx.logDebug("Redis unavailable, failing open for %s", ctx.fingerprint)
+		}
+	}
+
+	// Callback fired synchronously: OnHttpRequestHeaders handles the outcome
+	if !ctx.requestPaused {
+		return
+	}
+	ctx.requestPaused = false
 
-		// Resume request processing with denial
-		ctx.denyRequest()
+	// Answer locally with denial, unless the request may proceed anyway
+	// (dry run, solved challenge)
+	if ctx.isBanned && ctx.denyRequest() {
+		return
 	}
 
-	// Resume request if it was paused
 	if err := resumeHttpRequest(); err != nil {
 		ctx.logError("failed to resume request: %v", err)
 	}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+)
+
+// challengeRequest serves the challenge page for a challenged ban, or lets
+// the request through when it carries a solved challenge or a valid pass.
+// Returns true if the request was answered with the challenge page.
+func (ctx *httpContext) challengeRequest(challenge *ChallengeService) bool {
+	cookie := ""
+	if header, err := proxywasm.GetHttpRequestHeader("cookie"); err == nil {
+		cookie = parseCookie(header, ctx.config.Challenge.CookieName)
+	}
+
+	switch challenge.Check(ctx.fingerprint, ctx.banEntry, cookie) {
+	case ChallengePassed:
+		ctx.logDebug("challenge pass accepted for %s", ctx.fingerprint)
+		ctx.isBanned = false
+		return false
+	case ChallengeSolved:
+		lift := ctx.config.Challenge.OnSuccess == ChallengeOnSuccessLift
+		ctx.banService.PassChallenge(ctx.banEntry, lift)
+		if !lift {
+			ctx.challengePass = challenge.PassCookie(ctx.fingerprint, ctx.banEntry)
+		}
+		ctx.isBanned = false
+		return false
+	}
+
+	ctx.logInfo("challenging banned fingerprint %s (severity=%s)", ctx.fingerprint, ctx.banEntry.Severity)
+	ctx.pluginContext.metrics.Increment(metricName(metricChallenges, "severity", ctx.banEntry.Severity), 1)
+
+	headers := [][2]string{
+		{"content-type", "text/html; charset=utf-8"},
+		{"cache-control", "no-store"},
+		{"x-ban-reason", "coraza-ban-wasm"},
+	}
+
+	page := challenge.Page(challenge.Nonce(ctx.fingerprint, ctx.banEntry))
+	if err := proxywasm.SendHttpResponse(uint32(ctx.config.BanResponseCode), headers, page, -1); err != nil {
+		ctx.logError("failed to send challenge response: %v", err)
+	}
+
+	return true
+}
+
+// injectChallengePass adds the pass cookie of a solved challenge to the response.
+func (ctx *httpContext) injectChallengePass() {
+	if err := proxywasm.AddHttpResponseHeader("Set-Cookie", ctx.challengePass); err != nil {
+		ctx.logError("failed to inject challenge pass: %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"time"
+)
+
+// =============================================================================
+// Circuit Breaker
+// =============================================================================
+
+// CircuitState is the state of the Redis circuit breaker.
+// Each Envoy worker tracks its own state.
+type CircuitState int
+
+const (
+	// CircuitClosed lets all Redis calls through.
+	CircuitClosed CircuitState = 0
+	// CircuitOpen short-circuits Redis calls after repeated failures.
+	CircuitOpen CircuitState = 1
+	// CircuitHalfOpen allows a single probe to test whether Redis recovered.
+	CircuitHalfOpen CircuitState = 2
+)
+
+// String returns the state name.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker stops calls to a failing dependency after a number of
+// consecutive failures and periodically probes for recovery.
+// Each Envoy worker runs its own VM, so state is tracked per worker.
+type CircuitBreaker struct {
+	threshold     int
+	probeInterval time.Duration
+	failures      int
+	state         CircuitState
+	openedAt      time.Time
+	now           func() time.Time
+	onStateChange func(from, to CircuitState)
+}
+
+// NewCircuitBreaker creates a breaker that opens after threshold consecutive
+// failures and allows a probe every probeInterval while open.
+func NewCircuitBreaker(threshold int, probeInterval time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold:     threshold,
+		probeInterval: probeInterval,
+		state:         CircuitClosed,
+		now:           time.Now,
+	}
+}
+
+// SetOnStateChange registers a callback invoked on every state transition.
+func (b *CircuitBreaker) SetOnStateChange(callback func(from, to CircuitState)) {
+	b.onStateChange = callback
+}
+
+// State returns the current breaker state.
+func (b *CircuitBreaker) State() CircuitState {
+	return b.state
+}
+
+// Allow returns true if a call may be dispatched.
+// Calls are rejected while open and while a half-open probe is in flight.
+func (b *CircuitBreaker) Allow() bool {
+	return b.state == CircuitClosed
+}
+
+// RecordSuccess resets the failure count and closes the breaker.
+func (b *CircuitBreaker) RecordSuccess() {
+	b.failures = 0
+	b.transition(CircuitClosed)
+}
+
+// RecordFailure counts a failure and opens the breaker once the threshold
+// is reached. A failed probe re-opens the breaker immediately.
+func (b *CircuitBreaker) RecordFailure() {
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.threshold {
+		b.openedAt = b.now()
+		b.transition(CircuitOpen)
+	}
+}
+
+// ShouldProbe returns true, and moves to half-open, when the breaker has
+// been open for at least the probe interval. Called periodically from OnTick.
+func (b *CircuitBreaker) ShouldProbe() bool {
+	if b.state != CircuitOpen || b.now().Sub(b.openedAt) < b.probeInterval {
+		return false
+	}
+	b.transition(CircuitHalfOpen)
+	return true
+}
+
+// transition changes state and notifies the state change callback.
+func (b *CircuitBreaker) transition(to CircuitState) {
+	if b.state == to {
+		return
+	}
+	from := b.state
+	b.state = to
+	if b.onStateChange != nil {
+		b.onStateChange(from, to)
+	}
+}
+
+// =============================================================================
+// BreakerRedisClient - RedisClient decorator guarded by a circuit breaker
+// =============================================================================
+
+// BreakerRedisClient wraps a RedisClient and short-circuits calls while the
+// breaker is open, so a Redis outage does not add latency to every request.
+// Calls rejected by the breaker complete synchronously with a failure.
+type BreakerRedisClient struct {
+	client   RedisClient
+	breaker  *CircuitBreaker
+	logger   Logger
+	onReject func(op string)
+}
+
+// NewBreakerRedisClient wraps client with the given circuit breaker.
+func NewBreakerRedisClient(client RedisClient, breaker *CircuitBreaker, logger Logger) *BreakerRedisClient {
+	return &BreakerRedisClient{
+		client:  client,
+		breaker: breaker,
+		logger:  logger,
+	}
+}
+
+// SetOnReject registers a callback invoked with the operation name (as
+// used by MetricsRedisClient) of every call the breaker rejects. Rejected
+// calls never reach the wrapped client, so they are counted here.
+func (c *BreakerRedisClient) SetOnReject(callback func(op string)) {
+	c.onReject = callback
+}
+
+// IsConfigured delegates to the wrapped client.
+func (c *BreakerRedisClient) IsConfigured() bool {
+	return c.client.IsConfigured()
+}
+
+// CheckBanAsync checks a ban unless the breaker is open.
+func (c *BreakerRedisClient) CheckBanAsync(fingerprint string, callback func(bool, *BanEntry, bool)) {
+	if !c.allow("check_ban") {
+		c.logger.Debug("circuit %s, skipping Redis ban check", c.breaker.State())
+		callback(false, nil, false)
+		return
+	}
+
+	c.client.CheckBanAsync(fingerprint, func(banned bool, entry *BanEntry, ok bool) {
+		c.record(ok)
+		callback(banned, entry, ok)
+	})
+}
+
+// SetBanAsync stores a ban unless the breaker is open.
+func (c *BreakerRedisClient) SetBanAsync(entry *BanEntry, callback func(bool)) {
+	if !c.allow("set_ban") {
+		callback(false)
+		return
+	}
+
+	c.client.SetBanAsync(entry, func(success bool) {
+		c.record(success)
+		callback(success)
+	})
+}
+
+// DeleteBanAsync removes a ban unless the breaker is open.
+func (c *BreakerRedisClient) DeleteBanAsync(fingerprint string, callback func(bool, bool)) {
+	if !c.allow("delete_ban") {
+		if callback != nil {
+			callback(false, false)
+		}
+		return
+	}
+	c.client.DeleteBanAsync(fingerprint, func(deleted, ok bool) {
+		c.record(ok)
+		if callback != nil {
+			callback(deleted, ok)
+		}
+	})
+}
+
+// AppendStreamAsync appends to a stream unless the breaker is open.
+func (c *BreakerRedisClient) AppendStreamAsync(stream string, maxLen int, payload string) {
+	if !c.allow("append_stream") {
+		return
+	}
+	c.client.AppendStreamAsync(stream, maxLen, payload)
+}
+
+// IncrScoreAsync increments a score unless the breaker is open.
+func (c *BreakerRedisClient) IncrScoreAsync(fingerprint string, increment, ttl int, callback func(int, bool)) {
+	if !c.allow("incr_score") {
+		callback(0, false)
+		return
+	}
+
+	c.client.IncrScoreAsync(fingerprint, increment, ttl, func(score int, success bool) {
+		c.record(success)
+		callback(score, success)
+	})
+}
+
+// IncrClusterScoreAsync increments a cluster-wide score unless the breaker is open.
+func (c *BreakerRedisClient) IncrClusterScoreAsync(fingerprint string, increment int, decay *ScoreDecay, ttl int, callback func(int, bool)) {
+	if !c.allow("incr_cluster_score") {
+		callback(0, false)
+		return
+	}
+
+	c.client.IncrClusterScoreAsync(fingerprint, increment, decay, ttl, func(score int, success bool) {
+		c.record(success)
+		callback(score, success)
+	})
+}
+
+// IncrOffensesAsync increments an offense count unless the breaker is open.
+func (c *BreakerRedisClient) IncrOffensesAsync(fingerprint string, ttl int, callback func(int, bool)) {
+	if !c.allow("incr_offenses") {
+		callback(0, false)
+		return
+	}
+
+	c.client.IncrOffensesAsync(fingerprint, ttl, func(count int, success bool) {
+		c.record(success)
+		callback(count, success)
+	})
+}
+
+// GetScoreAsync retrieves a score unless the breaker is open.
+// Results are not recorded since "not found" and failure are indistinguishable.
+func (c *BreakerRedisClient) GetScoreAsync(fingerprint string, callback func(int, bool)) {
+	if !c.allow("get_score") {
+		callback(0, false)
+		return
+	}
+	c.client.GetScoreAsync(fingerprint, callback)
+}
+
+// Probe dispatches a health check to Redis if the breaker is due for one.
+// Called from the plugin's OnTick.
+func (c *BreakerRedisClient) Probe() {
+	if !c.breaker.ShouldProbe() {
+		return
+	}
+
+	c.logger.Debug("circuit half-open, probing Redis")
+	c.client.CheckBanAsync("__probe__", func(_ bool, _ *BanEntry, ok bool) {
+		c.record(ok)
+	})
+}
+
+// allow returns true if the breaker lets a call through, and reports the
+// call as rejected otherwise.
+func (c *BreakerRedisClient) allow(op string) bool {
+	if c.breaker.Allow() {
+		return true
+	}
+	if c.onReject != nil {
+		c.onReject(op)
+	}
+	return false
+}
+
+// record updates the breaker with the outcome of a call.
+func (c *BreakerRedisClient) record(ok bool) {
+	if ok {
+		c.breaker.RecordSuccess()
+		return
+	}
+	c.breaker.RecordFailure()
+	if c.breaker.State() == CircuitOpen {
+		c.logger.Warn("Redis circuit open after repeated failures")
+	}
+}
+
+// Compile-time interface verification
+var _ RedisClient = (*BreakerRedisClient)(nil)
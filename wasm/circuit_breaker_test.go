@@ -0,0 +1,143 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestBreaker returns a breaker with a controllable clock.
+func newTestBreaker(threshold int, probe time.Duration) (*CircuitBreaker, *time.Time) {
+	now := time.Unix(1700000000, 0)
+	breaker := NewCircuitBreaker(threshold, probe)
+	breaker.now = func() time.Time { return now }
+	return breaker, &now
+}
+
+func TestCircuitBreaker_OpensAfterThreshold(t *testing.T) {
+	breaker, _ := newTestBreaker(3, time.Second)
+
+	breaker.RecordFailure()
+	breaker.RecordFailure()
+	if !breaker.Allow() {
+		t.Fatal("breaker should stay closed below the threshold")
+	}
+
+	breaker.RecordFailure()
+	if breaker.Allow() || breaker.State() != CircuitOpen {
+		t.Errorf("expected open breaker, got %s", breaker.State())
+	}
+}
+
+func TestCircuitBreaker_SuccessResetsFailures(t *testing.T) {
+	breaker, _ := newTestBreaker(2, time.Second)
+
+	breaker.RecordFailure()
+	breaker.RecordSuccess()
+	breaker.RecordFailure()
+
+	if breaker.State() != CircuitClosed {
+		t.Errorf("non-consecutive failures should not open the breaker, got %s", breaker.State())
+	}
+}
+
+func TestCircuitBreaker_ProbeCycle(t *testing.T) {
+	breaker, now := newTestBreaker(1, 10*time.Second)
+	var transitions []string
+	breaker.SetOnStateChange(func(from, to CircuitState) {
+		transitions = append(transitions, from.String()+"->"+to.String())
+	})
+
+	breaker.RecordFailure()
+	if breaker.ShouldProbe() {
+		t.Error("should not probe before the interval elapsed")
+	}
+
+	*now = now.Add(10 * time.Second)
+	if !breaker.ShouldProbe() {
+		t.Fatal("should probe after the interval elapsed")
+	}
+	if breaker.Allow() {
+		t.Error("half-open breaker should reject regular calls")
+	}
+
+	// Failed probe re-opens immediately
+	breaker.RecordFailure()
+	if breaker.State() != CircuitOpen {
+		t.Errorf("expected open after failed probe, got %s", breaker.State())
+	}
+
+	*now = now.Add(10 * time.Second)
+	breaker.ShouldProbe()
+	breaker.RecordSuccess()
+	if breaker.State() != CircuitClosed {
+		t.Errorf("expected closed after successful probe, got %s", breaker.State())
+	}
+
+	expected := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	if len(transitions) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, transitions)
+	}
+	for i := range expected {
+		if transitions[i] != expected[i] {
+			t.Errorf("transition %d: expected %s, got %s", i, expected[i], transitions[i])
+		}
+	}
+}
+
+func TestBreakerRedisClient_ShortCircuitsWhenOpen(t *testing.T) {
+	redis := NewMockRedisClient(true)
+	redis.Fail = true
+	breaker, _ := newTestBreaker(2, time.Second)
+	client := NewBreakerRedisClient(redis, breaker, NewMockLogger())
+	var rejected []string
+	client.SetOnReject(func(op string) { rejected = append(rejected, op) })
+
+	for i := 0; i < 3; i++ {
+		client.CheckBanAsync("fp", func(banned bool, entry *BanEntry, ok bool) {
+			if ok {
+				t.Error("expected failed check")
+			}
+		})
+	}
+
+	if redis.CheckBanCalls != 2 {
+		t.Errorf("expected 2 dispatched checks before opening, got %d", redis.CheckBanCalls)
+	}
+
+	var scoreOK bool
+	client.IncrScoreAsync("fp", 10, 60, func(score int, success bool) { scoreOK = success })
+	if scoreOK || redis.IncrScoreCalls != 0 {
+		t.Error("IncrScoreAsync should be short-circuited while open")
+	}
+
+	if len(rejected) != 2 || rejected[0] != "check_ban" || rejected[1] != "incr_score" {
+		t.Errorf("expected rejected check_ban and incr_score, got %v", rejected)
+	}
+}
+
+func TestBreakerRedisClient_ProbeRecovers(t *testing.T) {
+	redis := NewMockRedisClient(true)
+	redis.Fail = true
+	breaker, now := newTestBreaker(1, time.Second)
+	client := NewBreakerRedisClient(redis, breaker, NewMockLogger())
+
+	client.CheckBanAsync("fp", func(bool, *BanEntry, bool) {})
+	client.Probe()
+	if redis.CheckBanCalls != 1 {
+		t.Errorf("probe should wait for the interval, got %d calls", redis.CheckBanCalls)
+	}
+
+	redis.Fail = false
+	*now = now.Add(time.Second)
+	client.Probe()
+
+	if breaker.State() != CircuitClosed {
+		t.Errorf("expected closed after successful probe, got %s", breaker.State())
+	}
+
+	var checked bool
+	client.CheckBanAsync("fp", func(_ bool, _ *BanEntry, ok bool) { checked = ok })
+	if !checked {
+		t.Error("checks should be dispatched again after recovery")
+	}
+}
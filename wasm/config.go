@@ -3,6 +3,9 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
@@ -15,6 +18,105 @@ const (
 	FingerprintModeIPOnly  = "ip-only"
 )
 
+// Redis backend constants
+const (
+	RedisBackendWebdis = "webdis"
+	RedisBackendRESP   = "resp"
+)
+
+// Redis failure mode constants
+const (
+	RedisFailureModeOpen   = "open"
+	RedisFailureModeClosed = "closed"
+)
+
+// Challenge success action constants
+const (
+	ChallengeOnSuccessDowngrade = "downgrade"
+	ChallengeOnSuccessLift      = "lift"
+)
+
+// Score source constants
+const (
+	ScoreSourceLocal = "local"
+	ScoreSourceRedis = "redis"
+)
+
+// Score aggregation constants
+const (
+	ScoreAggregationMax      = "max"
+	ScoreAggregationSum      = "sum"
+	ScoreAggregationDistinct = "distinct"
+)
+
+// Score mode constants
+const (
+	ScoreModeRules   = "rules"
+	ScoreModeAnomaly = "anomaly"
+)
+
+// defaultMetadataPaths are the Envoy properties where Coraza builds
+// publish their decision, in the order they are read.
+var defaultMetadataPaths = [][]string{
+	{"metadata", "filter_metadata", "envoy.filters.http.wasm", "coraza"},
+	{"metadata", "filter_metadata", "coraza"},
+	{"metadata", "filter_metadata", "envoy.filters.http.coraza"},
+}
+
+// Metadata source type constants
+const (
+	MetadataSourceFilterMetadata = "filter_metadata"
+	MetadataSourceProperty       = "property"
+	MetadataSourceRequestHeader  = "request_header"
+	MetadataSourceResponseHeader = "response_header"
+)
+
+// Metadata format constants
+const (
+	MetadataFormatAuto   = "auto"
+	MetadataFormatJSON   = "json"
+	MetadataFormatKV     = "kv"
+	MetadataFormatStruct = "struct"
+)
+
+// metadataFields are the CorazaMetadata fields a metadata source may map.
+var metadataFields = []string{
+	"action", "rule_id", "severity", "message", "matched_data", "tags", "rules",
+	"inbound_anomaly_score", "outbound_anomaly_score", "paranoia_level",
+}
+
+// defaultHeaderFields map the metadata fields to the x-coraza-* response
+// headers.
+var defaultHeaderFields = map[string]string{
+	"action":                 "x-coraza-action",
+	"rule_id":                "x-coraza-rule-id",
+	"severity":               "x-coraza-severity",
+	"message":                "x-coraza-message",
+	"inbound_anomaly_score":  "x-coraza-inbound-anomaly-score",
+	"outbound_anomaly_score": "x-coraza-outbound-anomaly-score",
+	"paranoia_level":         "x-coraza-paranoia-level",
+}
+
+// wafActions are the Coraza actions that score_actions may list.
+var wafActions = []string{"block", "deny", "drop", "log", "pass"}
+
+// Enforcement action constants
+const (
+	EnforcementDeny      = "deny"
+	EnforcementRedirect  = "redirect"
+	EnforcementTarpit    = "tarpit"
+	EnforcementRateLimit = "rate_limit"
+	EnforcementLog       = "log"
+)
+
+// Event sink type constants
+const (
+	EventSinkLog         = "log"
+	EventSinkMetrics     = "metrics"
+	EventSinkWebhook     = "webhook"
+	EventSinkRedisStream = "redis_stream"
+)
+
 // Log level constants
 const (
 	LogLevelDebug = "debug"
@@ -26,12 +128,48 @@ const (
 // Default configuration values
 const (
 	DefaultBanTTL         = 600
+	DefaultBanSweep       = 60
+	DefaultEscalationMult = 2
+	DefaultEscalationMax  = 604800
+	DefaultOffenseWindow  = 2592000
+	DefaultChallengeBits  = 16
+	DefaultChallengePass  = 3600
+	DefaultBypassMaxTTL   = 86400
+	DefaultChallengeName  = "__cbw_challenge"
+	DefaultRedirectCode   = 302
+	DefaultTarpitSeconds  = 10
 	DefaultScoreThreshold = 100
 	DefaultScoreDecay     = 60
+	DefaultScoreDecayRate = 1
+	DefaultScoreHalfLife  = 600
 	DefaultScoreTTL       = 3600
+	DefaultSignalWindow   = 60
+	DefaultSignalSeverity = "medium"
+	DefaultAnomalyMaxIncr = 1000
+	DefaultWAFRuleID      = "waf-403"
+	DefaultWAFSeverity    = "medium"
 	DefaultRedisTimeout   = 5000
+	DefaultRedisPath      = "/"
+	DefaultRedisAuth      = "authorization"
+	DefaultAdminPrefix    = "/_coraza-ban"
+	DefaultAdminHeader    = "x-coraza-ban-admin-token"
+	DefaultBreakerFails   = 5
+	DefaultBreakerProbe   = 10000
+	DefaultWebhookPath    = "/"
+	DefaultWebhookSigHdr  = "x-coraza-ban-signature"
+	DefaultWebhookBatch   = 50
+	DefaultWebhookFlush   = 5000
+	DefaultWebhookRetries = 3
+	DefaultWebhookBackoff = 1000
+	DefaultWebhookBuffer  = 1000
+	DefaultEventStream    = "ban-events"
+	DefaultStreamMaxLen   = 10000
 )
 
+// unsafeKeyChars are the characters keys must not contain: Webdis reads
+// keys from URL paths, where they would split or end the path.
+const unsafeKeyChars = "/%?# \t\r\n"
+
 // PluginConfig holds the runtime configuration for the coraza-ban-wasm
 // Envoy WASM filter. It is parsed from JSON during plugin startup.
 //
@@ -49,6 +187,36 @@ type PluginConfig struct {
 	// RedisCluster is the name of the Envoy cluster for Redis HTTP calls
 	RedisCluster string `json:"redis_cluster"`
 
+	// RedisBackend selects the Redis protocol spoken to RedisCluster
+	// "webdis" = Webdis HTTP API with commands in the URL path (default)
+	// "resp" = RESP-framed commands POSTed to a Redis HTTP bridge
+	RedisBackend string `json:"redis_backend"`
+
+	// RedisPath is the HTTP path of the RESP bridge endpoint (default: "/")
+	RedisPath string `json:"redis_path"`
+
+	// RedisAuthHeader is the header carrying Redis credentials (default: "authorization")
+	RedisAuthHeader string `json:"redis_auth_header"`
+
+	// RedisAuthToken is sent in RedisAuthHeader on every Redis call
+	// e.g., "Basic dXNlcjpwYXNz" for Webdis HTTP Basic auth
+	RedisAuthToken string `json:"redis_auth_token"`
+
+	// RedisTimeoutMs is the timeout for each Redis call in milliseconds (default: 5000)
+	RedisTimeoutMs int `json:"redis_timeout_ms"`
+
+	// RedisFailureMode decides what happens when a Redis ban check fails
+	// "open" = allow the request (default)
+	// "closed" = deny the request
+	RedisFailureMode string `json:"redis_failure_mode"`
+
+	// CircuitBreaker stops Redis calls after repeated failures
+	CircuitBreaker CircuitBreakerConfig `json:"circuit_breaker"`
+
+	// KeyPrefix namespaces all ban and score keys, locally and in Redis
+	// e.g., "cbw:prod:gateway-1:" to share one Redis across environments
+	KeyPrefix string `json:"key_prefix"`
+
 	// BanTTLDefault is the default ban TTL in seconds (default: 600)
 	BanTTLDefault int `json:"ban_ttl_default"`
 
@@ -56,26 +224,125 @@ type PluginConfig struct {
 	// e.g., {"critical": 3600, "high": 1800, "medium": 600, "low": 300}
 	BanTTLBySeverity map[string]int `json:"ban_ttl_by_severity"`
 
+	// BanTTLByTag maps rule tags to ban TTLs, overriding BanTTLBySeverity
+	// The longest TTL of the rule's tags applies
+	// e.g., {"attack-sqli": 7200, "attack-rce": 86400}
+	BanTTLByTag map[string]int `json:"ban_ttl_by_tag"`
+
+	// TagsInclude restricts the WAF blocks that count towards bans and
+	// scores to rules with one of these tags (default: every block counts).
+	// Untagged blocks always count
+	// e.g., ["attack-sqli", "attack-xss", "attack-rce"]
+	TagsInclude []string `json:"tags_include"`
+
+	// TagsExclude ignores WAF blocks of rules with one of these tags
+	// e.g., ["attack-protocol", "paranoia-level/4"]
+	TagsExclude []string `json:"tags_exclude"`
+
+	// BanSweepSeconds is how often expired local bans are swept (default: 60)
+	// The sweep reports expiries of clients that never come back.
+	BanSweepSeconds int `json:"ban_sweep_interval_seconds"`
+
+	// BanScopeDefault is where bans apply
+	// "global" = on every host (default)
+	// "host" = on the host of the blocked request
+	// "path" = on the path prefix of the blocked request: the path_prefix of
+	// the matching policy, or else the first path segment (e.g., "/api")
+	BanScopeDefault string `json:"ban_scope_default"`
+
+	// BanScopeBySeverity overrides BanScopeDefault by severity
+	// e.g., {"critical": "global", "medium": "host"}
+	BanScopeBySeverity map[string]string `json:"ban_scope_by_severity"`
+
+	// BanScopeRules overrides the scope by WAF rule ID
+	// e.g., {"930120": "path"}
+	BanScopeRules map[string]string `json:"ban_scope_rules"`
+
+	// CaseInsensitivePaths folds request paths to lower case before they
+	// are matched against policies and path scopes (default: false)
+	// Enable when the upstream routes are case-insensitive, so that
+	// "/API/x" cannot evade a ban on "/api".
+	CaseInsensitivePaths bool `json:"case_insensitive_paths"`
+
+	// Escalation lengthens bans for repeat offenders
+	Escalation EscalationConfig `json:"escalation"`
+
+	// WAFDetection decides which responses are WAF blocks
+	WAFDetection WAFDetectionConfig `json:"waf_detection"`
+
+	// MetadataSources are where Coraza metadata is read from, in order,
+	// replacing waf_detection.metadata_paths and the x-coraza-* headers
+	MetadataSources []MetadataSourceConfig `json:"metadata_sources"`
+
 	// ScoringEnabled enables behavioral scoring instead of immediate banning
 	ScoringEnabled bool `json:"scoring_enabled"`
 
 	// ScoreThreshold is the score threshold that triggers a ban (default: 100)
 	ScoreThreshold int `json:"score_threshold"`
 
-	// ScoreDecaySeconds is how often scores decay by 1 point (default: 60)
+	// ScoreSource is where the score that triggers bans is kept
+	// "local" = the score of this Envoy instance (default)
+	// "redis" = the cluster-wide score, decayed server-side in Redis
+	ScoreSource string `json:"score_source"`
+
+	// ScoreDecayStrategy is the decay curve of scores
+	// "linear" = lose score_decay_rate points per score_decay_seconds (default)
+	// "exponential" = lose half the score per score_decay_half_life_seconds
+	// "step" = drop the score to 0 after score_decay_seconds without activity
+	ScoreDecayStrategy string `json:"score_decay_strategy"`
+
+	// ScoreDecaySeconds is the linear decay interval, or the quiet period
+	// of step decay (default: 60)
 	ScoreDecaySeconds int `json:"score_decay_seconds"`
 
+	// ScoreDecayRate is the number of points lost per linear decay interval (default: 1)
+	ScoreDecayRate int `json:"score_decay_rate"`
+
+	// ScoreDecayHalfLife is the half-life of exponential decay in seconds (default: 600)
+	ScoreDecayHalfLife int `json:"score_decay_half_life_seconds"`
+
 	// ScoreRules maps WAF rule IDs to score increments
 	// e.g., {"930120": 40, "941100": 20}
 	ScoreRules map[string]int `json:"score_rules"`
 
+	// ScoreByTag maps rule tags to score increments
+	// Used when a rule ID is not in ScoreRules; the highest score of the
+	// rule's tags applies
+	// e.g., {"attack-sqli": 60, "attack-protocol": 5}
+	ScoreByTag map[string]int `json:"score_by_tag"`
+
 	// ScoreBySeverity maps severity levels to default score increments
-	// Used when a rule ID is not in ScoreRules
+	// Used when a rule ID is not in ScoreRules and no tag is in ScoreByTag
 	ScoreBySeverity map[string]int `json:"score_by_severity"`
 
+	// ScoreAggregation combines the scores of the rules matched by a request
+	// "max" = the score of the highest scoring rule (default)
+	// "sum" = the sum of the rule scores
+	// "distinct" = the sum of the highest rule score per attack category
+	ScoreAggregation string `json:"score_aggregation"`
+
+	// ScoreMode decides the score increment of WAF detections
+	// "rules" = the scores of the matched rules (default)
+	// "anomaly" = a function of the CRS anomaly score, which also scores
+	// requests Coraza only logged
+	ScoreMode string `json:"score_mode"`
+
+	// AnomalyScoring maps CRS anomaly scores to score increments
+	AnomalyScoring AnomalyScoringConfig `json:"anomaly_scoring"`
+
+	// ScoreActions maps the Coraza actions that add to the score to a
+	// multiplier of their score increment, e.g., {"block": 1, "log": 0.5}
+	// to build reputation from rules in detection-only mode
+	// (default: block, deny and drop; every action in anomaly mode)
+	ScoreActions map[string]float64 `json:"score_actions"`
+
 	// ScoreTTL is the TTL for score entries in Redis (default: 3600)
 	ScoreTTL int `json:"score_ttl"`
 
+	// Signals add score for request rates and response code bursts that
+	// WAF rules do not catch (requires scoring)
+	Signals SignalsConfig `json:"signals"`
+
 	// FingerprintMode controls fingerprint calculation
 	// "full" = JA3 + UA + IP/24 + cookie (default)
 	// "partial" = UA + IP/24 + cookie (no JA3)
@@ -91,9 +358,22 @@ type PluginConfig struct {
 	// BanResponseCode is the HTTP status code for banned requests (default: 403)
 	BanResponseCode int `json:"ban_response_code"`
 
-	// BanResponseBody is the response body for banned requests
+	// BanResponseBody is the plain text response body for banned requests.
+	// It may contain the placeholders of BanResponseTemplates.
 	BanResponseBody string `json:"ban_response_body"`
 
+	// BanResponseTemplates adds HTML and JSON ban responses, selected by
+	// the request Accept header
+	BanResponseTemplates ResponseTemplatesConfig `json:"ban_response_templates"`
+
+	// EnforcementBySeverity chooses how bans of each severity are enforced
+	// e.g., {"low": {"action": "rate_limit", "requests_per_minute": 10}}
+	// Severities without an entry are denied with BanResponseCode/BanResponseBody
+	EnforcementBySeverity map[string]EnforcementConfig `json:"enforcement_by_severity"`
+
+	// Challenge serves a proof-of-work page instead of denying low severity bans
+	Challenge ChallengeConfig `json:"challenge"`
+
 	// LogLevel controls logging verbosity: "debug", "info", "warn", "error"
 	LogLevel string `json:"log_level"`
 
@@ -103,226 +383,1885 @@ type PluginConfig struct {
 	// EventsEnabled controls whether ban events are emitted (default: true)
 	// Set to false to disable event logging for reduced overhead
 	EventsEnabled bool `json:"events_enabled"`
-}
 
-// DefaultConfig returns a PluginConfig with default values
-func DefaultConfig() *PluginConfig {
-	return &PluginConfig{
-		RedisCluster:      "redis_cluster",
-		BanTTLDefault:     DefaultBanTTL,
-		BanTTLBySeverity:  map[string]int{},
-		ScoringEnabled:    false,
-		ScoreThreshold:    DefaultScoreThreshold,
-		ScoreDecaySeconds: DefaultScoreDecay,
-		ScoreRules:        map[string]int{},
-		ScoreBySeverity: map[string]int{
-			"critical": 50,
-			"high":     40,
-			"medium":   20,
-			"low":      10,
-		},
-		ScoreTTL:        DefaultScoreTTL,
-		FingerprintMode: FingerprintModeFull,
-		CookieName:      "__bm",
-		InjectCookie:    false,
-		BanResponseCode: 403,
-		BanResponseBody: "Forbidden",
-		LogLevel:        LogLevelInfo,
-		DryRun:          false,
-		EventsEnabled:   true,
-	}
-}
+	// MetricsEnabled controls whether Envoy stats are recorded (default: true)
+	MetricsEnabled bool `json:"metrics_enabled"`
 
-// ParseConfig parses JSON configuration data into PluginConfig
-func ParseConfig(data []byte) (*PluginConfig, error) {
-	config := DefaultConfig()
+	// EventSinks routes ban events to handlers, each with its own filter.
+	// When empty, events go to the log, to metrics (if metrics_enabled)
+	// and to the webhook (if configured).
+	EventSinks []EventSinkConfig `json:"event_sinks"`
 
-	if len(data) == 0 {
-		proxywasm.LogInfo("No configuration provided, using defaults")
-		return config, nil
-	}
+	// Webhook pushes ban events to an HTTP endpoint (e.g., a SIEM collector)
+	Webhook WebhookConfig `json:"webhook"`
 
-	if err := json.Unmarshal(data, config); err != nil {
-		return nil, err
-	}
+	// Admin configures the built-in admin HTTP API for managing bans
+	Admin AdminConfig `json:"admin"`
 
-	// Validate and set defaults for missing fields
-	config.validate()
+	// Allowlist defines clients that can never be banned
+	Allowlist AllowlistConfig `json:"allowlist"`
 
-	return config, nil
+	// Denylist defines networks that are always banned
+	Denylist DenylistConfig `json:"denylist"`
+
+	// Policies override settings for matching hosts, paths and methods.
+	// The first matching policy applies; other requests use the global settings.
+	Policies []PolicyConfig `json:"policies"`
 }
 
-// validate ensures configuration values are valid
-func (c *PluginConfig) validate() {
-	if c.BanTTLDefault <= 0 {
-		c.BanTTLDefault = DefaultBanTTL
-	}
+// CircuitBreakerConfig controls the Redis circuit breaker.
+// After FailureThreshold consecutive failed Redis calls the breaker opens
+// and Redis is skipped (honoring redis_failure_mode) until a probe sent
+// every ProbeIntervalMs succeeds.
+//
+// Example configuration:
+//
+//	{
+//	  "enabled": true,
+//	  "failure_threshold": 5,
+//	  "probe_interval_ms": 10000
+//	}
+type CircuitBreakerConfig struct {
+	// Enabled turns the circuit breaker on (default: true)
+	Enabled bool `json:"enabled"`
 
-	if c.ScoreThreshold <= 0 {
-		c.ScoreThreshold = DefaultScoreThreshold
-	}
+	// FailureThreshold is the number of consecutive failures that opens the breaker (default: 5)
+	FailureThreshold int `json:"failure_threshold"`
 
-	if c.ScoreDecaySeconds <= 0 {
-		c.ScoreDecaySeconds = DefaultScoreDecay
-	}
+	// ProbeIntervalMs is how often an open breaker probes Redis (default: 10000)
+	ProbeIntervalMs int `json:"probe_interval_ms"`
+}
 
-	if c.ScoreTTL <= 0 {
-		c.ScoreTTL = DefaultScoreTTL
-	}
+// EscalationConfig controls progressive bans for repeat offenders.
+// Each ban issued for a fingerprint counts as an offense; the offense count
+// is kept locally and in Redis and is forgotten WindowSeconds after the
+// last offense. The ban TTL for the nth offense is taken from Ladder, or,
+// without a ladder, the severity TTL multiplied by Multiplier for every
+// repeat offense and capped at MaxTTL.
+//
+// Example configuration (10m, 1h, 24h, then 7d for every further offense):
+//
+//	{
+//	  "enabled": true,
+//	  "ladder": [600, 3600, 86400, 604800],
+//	  "window_seconds": 2592000
+//	}
+type EscalationConfig struct {
+	// Enabled turns escalation on (default: false)
+	Enabled bool `json:"enabled"`
 
-	// Validate fingerprint mode
-	validModes := map[string]bool{
-		FingerprintModeFull:    true,
-		FingerprintModePartial: true,
-		FingerprintModeIPOnly:  true,
-	}
-	if !validModes[c.FingerprintMode] {
-		c.FingerprintMode = FingerprintModeFull
-	}
+	// Ladder lists the ban TTL in seconds for the 1st, 2nd, 3rd... offense.
+	// The last step repeats for further offenses.
+	Ladder []int `json:"ladder"`
 
-	if c.CookieName == "" {
-		c.CookieName = "__bm"
-	}
+	// Multiplier scales the severity TTL per repeat offense without a ladder (default: 2)
+	Multiplier float64 `json:"multiplier"`
 
-	if c.BanResponseCode <= 0 {
-		c.BanResponseCode = 403
-	}
+	// MaxTTL caps multiplier escalation in seconds (default: 604800, 7 days)
+	MaxTTL int `json:"max_ttl"`
 
-	if c.BanResponseBody == "" {
-		c.BanResponseBody = "Forbidden"
-	}
+	// WindowSeconds is how long offenses are remembered (default: 2592000, 30 days)
+	WindowSeconds int `json:"window_seconds"`
+}
 
-	// Validate log level
-	validLogLevels := map[string]bool{
-		LogLevelDebug: true,
-		LogLevelInfo:  true,
-		LogLevelWarn:  true,
-		LogLevelError: true,
-	}
-	if !validLogLevels[c.LogLevel] {
-		c.LogLevel = LogLevelInfo
-	}
+// Signal name constants
+const (
+	SignalRequestRate = "request_rate"
+	SignalNotFound    = "not_found"
+	SignalAuthFailure = "auth_failure"
+	SignalServerError = "server_error"
+)
 
-	// Initialize maps if nil
-	if c.BanTTLBySeverity == nil {
-		c.BanTTLBySeverity = map[string]int{}
-	}
+// signalNames lists the signals in validation order.
+var signalNames = []string{SignalRequestRate, SignalNotFound, SignalAuthFailure, SignalServerError}
 
-	if c.ScoreRules == nil {
-		c.ScoreRules = map[string]int{}
-	}
+// WAFDetectionConfig decides which responses are WAF blocks. Coraza
+// metadata is read from MetadataPaths. Without metadata telling the
+// action, a response with one of StatusCodes is a WAF block when it
+// carries a block header or, with the status fallback, on its status
+// code alone.
+//
+// Example configuration (the upstream also answers 403):
+//
+//	{
+//	  "block_headers": {"x-waf-block": ""},
+//	  "status_codes": [403],
+//	  "status_fallback": false
+//	}
+type WAFDetectionConfig struct {
+	// MetadataPaths are the Envoy property paths of Coraza metadata,
+	// read in order (default: the filter_metadata of common Coraza builds)
+	MetadataPaths [][]string `json:"metadata_paths"`
 
-	if c.ScoreBySeverity == nil {
-		c.ScoreBySeverity = map[string]int{
-			"critical": 50,
-			"high":     40,
-			"medium":   20,
-			"low":      10,
-		}
-	}
-}
+	// BlockHeaders maps response header names to a value the header
+	// contains on WAF blocks; an empty value only requires the header
+	// (default: {"x-waf-block": "", "server": "coraza"})
+	BlockHeaders map[string]string `json:"block_headers"`
 
-// Validate performs comprehensive validation of the configuration.
-// Returns an error if any configuration values are invalid.
-// This is called during plugin startup for fail-fast behavior.
-func (c *PluginConfig) Validate() error {
-	var errors []string
+	// StatusCodes are the status codes of WAF block responses (default: [403])
+	StatusCodes []int `json:"status_codes"`
 
-	// Ban TTL: 1 second to 24 hours
-	if c.BanTTLDefault < 1 || c.BanTTLDefault > 86400 {
-		errors = append(errors, "ban_ttl_default must be between 1-86400 seconds")
-	}
+	// StatusFallback treats StatusCodes as WAF blocks without a block
+	// header (default: true)
+	StatusFallback *bool `json:"status_fallback"`
 
-	// Validate TTL by severity values
-	for severity, ttl := range c.BanTTLBySeverity {
-		if ttl < 1 || ttl > 86400 {
-			errors = append(errors, fmt.Sprintf("ban_ttl_by_severity[%s] must be between 1-86400 seconds", severity))
-		}
-	}
+	// RuleID is the rule of blocks detected without metadata (default: "waf-403")
+	RuleID string `json:"rule_id"`
 
-	// Score threshold: 1 to 10000
-	if c.ScoringEnabled && (c.ScoreThreshold < 1 || c.ScoreThreshold > 10000) {
-		errors = append(errors, "score_threshold must be between 1-10000")
-	}
+	// Severity is the severity of blocks detected without metadata (default: "medium")
+	Severity string `json:"severity"`
+}
 
-	// Score decay: 1 second to 1 hour
-	if c.ScoreDecaySeconds < 1 || c.ScoreDecaySeconds > 3600 {
-		errors = append(errors, "score_decay_seconds must be between 1-3600 seconds")
-	}
+// MetadataSourceConfig is a source of Coraza metadata.
+//
+//	"filter_metadata" = the filter metadata at Path, under metadata.filter_metadata
+//	"property"        = the Envoy property at Path
+//	"request_header"  = a request header
+//	"response_header" = a response header
+//
+// Header sources read the value of Header or, without one, one header per
+// field (as named by Fields). Values are decoded as Format; protobuf
+// Struct values in headers are base64-encoded.
+//
+// Example configuration (a Coraza build publishing "waf" metadata):
+//
+//	{
+//	  "type": "filter_metadata",
+//	  "path": ["envoy.filters.http.coraza", "waf"],
+//	  "format": "struct",
+//	  "fields": {"action": "decision", "rule_id": "matched.id"}
+//	}
+type MetadataSourceConfig struct {
+	// Type is the kind of source
+	Type string `json:"type"`
 
-	// Score TTL: 1 second to 24 hours
-	if c.ScoreTTL < 1 || c.ScoreTTL > 86400 {
-		errors = append(errors, "score_ttl must be between 1-86400 seconds")
-	}
+	// Path is the property path of filter_metadata and property sources
+	Path []string `json:"path"`
 
-	// Validate score rules values
-	for ruleID, score := range c.ScoreRules {
-		if score < 1 || score > 1000 {
-			errors = append(errors, fmt.Sprintf("score_rules[%s] must be between 1-1000", ruleID))
-		}
-	}
+	// Header is the header name of header sources
+	Header string `json:"header"`
 
-	// Validate score by severity values
-	for severity, score := range c.ScoreBySeverity {
-		if score < 1 || score > 1000 {
-			errors = append(errors, fmt.Sprintf("score_by_severity[%s] must be between 1-1000", severity))
-		}
-	}
+	// Format is the encoding of the value: "auto" (default), "json",
+	// "kv" (semicolon-separated key=value) or "struct" (protobuf Struct)
+	Format string `json:"format"`
 
-	// Fingerprint mode validation
-	validModes := map[string]bool{
-		FingerprintModeFull:    true,
-		FingerprintModePartial: true,
-		FingerprintModeIPOnly:  true,
-	}
-	if !validModes[c.FingerprintMode] {
-		errors = append(errors, fmt.Sprintf("fingerprint_mode must be one of: %s, %s, %s",
-			FingerprintModeFull, FingerprintModePartial, FingerprintModeIPOnly))
-	}
+	// Fields maps metadata fields (e.g., "rule_id") to the keys of the
+	// source; nested keys are dot-separated (default: the field name)
+	Fields map[string]string `json:"fields"`
+}
 
-	// Ban response code: 4xx or 5xx
-	if c.BanResponseCode < 400 || c.BanResponseCode > 599 {
-		errors = append(errors, "ban_response_code must be between 400-599")
-	}
+// AnomalyScoringConfig maps the CRS anomaly score of a request, inbound
+// plus outbound, to a score increment:
+//
+//	increment = min(anomaly_score * multiplier, max_increment)
+//
+// Requests with an anomaly score below MinAnomalyScore are not scored.
+type AnomalyScoringConfig struct {
+	// Multiplier scales the anomaly score (default: 1)
+	Multiplier float64 `json:"multiplier"`
 
-	// Log level validation
-	validLogLevels := map[string]bool{
-		LogLevelDebug: true,
-		LogLevelInfo:  true,
-		LogLevelWarn:  true,
-		LogLevelError: true,
-	}
-	if !validLogLevels[c.LogLevel] {
-		errors = append(errors, fmt.Sprintf("log_level must be one of: %s, %s, %s, %s",
-			LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError))
-	}
+	// MinAnomalyScore is the lowest anomaly score that is scored (default: 1)
+	MinAnomalyScore int `json:"min_anomaly_score"`
 
-	// Cookie name validation (if injection is enabled)
-	if c.InjectCookie && c.CookieName == "" {
-		errors = append(errors, "cookie_name is required when inject_cookie is true")
-	}
+	// MaxIncrement caps the score increment of one request (default: 1000)
+	MaxIncrement int `json:"max_increment"`
+}
+
+// SignalsConfig configures the non-WAF signals feeding the behavioral
+// score. Each signal counts events per fingerprint over a sliding window
+// and adds its score when the count reaches its threshold:
+//
+//	"request_rate" = every request
+//	"not_found"    = 404 responses
+//	"auth_failure" = 401 and 403 responses from the upstream
+//	"server_error" = 5xx responses
+//
+// Example configuration (credential stuffing and scraping):
+//
+//	{
+//	  "auth_failure": {"threshold": 10, "window_seconds": 60, "score": 50},
+//	  "not_found": {"threshold": 30, "window_seconds": 60, "score": 30},
+//	  "request_rate": {"threshold": 600, "window_seconds": 60, "score": 20}
+//	}
+type SignalsConfig struct {
+	RequestRate SignalConfig `json:"request_rate"`
+	NotFound    SignalConfig `json:"not_found"`
+	AuthFailure SignalConfig `json:"auth_failure"`
+	ServerError SignalConfig `json:"server_error"`
+}
+
+// SignalConfig configures one signal. A signal without a score is disabled.
+type SignalConfig struct {
+	// Threshold is the number of events in the window that triggers the signal
+	Threshold int `json:"threshold"`
+
+	// WindowSeconds is the length of the sliding window (default: 60)
+	WindowSeconds int `json:"window_seconds"`
+
+	// Score is added to the fingerprint score each time the signal triggers
+	Score int `json:"score"`
+
+	// Severity of bans issued when the signal crosses the score threshold
+	// (default: "medium")
+	Severity string `json:"severity"`
+}
+
+// EnforcementConfig decides how requests of a banned client are answered.
+//
+//	"deny"       = send ResponseCode/ResponseBody
+//	"redirect"   = redirect to RedirectURL
+//	"tarpit"     = hold the request for TarpitSeconds, then deny it
+//	"rate_limit" = let RequestsPerMinute requests through, deny the rest
+//	"log"        = log the request and let it through
+//
+// Example configuration:
+//
+//	{
+//	  "critical": {"action": "tarpit", "tarpit_seconds": 30},
+//	  "high": {"action": "deny", "response_code": 429},
+//	  "medium": {"action": "redirect", "redirect_url": "https://example.com/blocked"},
+//	  "low": {"action": "rate_limit", "requests_per_minute": 10}
+//	}
+type EnforcementConfig struct {
+	// Action is one of "deny" (default), "redirect", "tarpit", "rate_limit", "log"
+	Action string `json:"action"`
+
+	// ResponseCode is the status of denials (default: ban_response_code)
+	// or of redirects (default: 302)
+	ResponseCode int `json:"response_code"`
+
+	// ResponseBody is the body of denials (default: ban_response_body)
+	ResponseBody string `json:"response_body"`
+
+	// RedirectURL is the Location of redirects
+	RedirectURL string `json:"redirect_url"`
+
+	// TarpitSeconds is how long tarpitted requests are held (default: 10)
+	TarpitSeconds int `json:"tarpit_seconds"`
+
+	// RequestsPerMinute is how many requests rate-limited clients may send
+	RequestsPerMinute int `json:"requests_per_minute"`
+}
+
+// ResponseTemplatesConfig holds the HTML and problem+json bodies of ban
+// responses. Each is offered to clients only when set; the plain text
+// body is always offered. Templates may contain these placeholders:
+//
+//	{{status}}      response status code
+//	{{reason}}      ban reason (e.g., "waf-rule", "score-threshold")
+//	{{rule_id}}     WAF rule that caused the ban
+//	{{severity}}    ban severity
+//	{{expires_at}}  ban expiry (RFC 3339)
+//	{{retry_after}} seconds until the ban expires
+//	{{reference}}   support reference derived from the client fingerprint
+//	{{request_id}}  the request's x-request-id header
+//
+// Ban details are empty, and {{retry_after}} is 0, for denylist and
+// fail-closed denials. In the JSON template, placeholders other than
+// {{status}} and {{retry_after}} must be inside string literals.
+//
+// Example configuration:
+//
+//	{
+//	  "html": "<h1>Access denied</h1><p>Reference: {{reference}}</p>",
+//	  "json": "{\"type\": \"about:blank\", \"title\": \"Forbidden\", \"status\": {{status}}, \"reference\": \"{{reference}}\"}"
+//	}
+type ResponseTemplatesConfig struct {
+	// HTML is sent as text/html to clients preferring HTML
+	HTML string `json:"html"`
+
+	// JSON is sent as application/problem+json to clients preferring JSON
+	JSON string `json:"json"`
+}
+
+// ChallengeConfig controls challenge mode. Bans with one of the listed
+// severities are answered with a JavaScript proof-of-work page instead of
+// the ban response; critical bans and the denylist are always denied.
+// A solved challenge either lifts the ban ("lift") or keeps it and lets
+// only the solving client through with a signed pass cookie ("downgrade").
+//
+// Example configuration:
+//
+//	{
+//	  "enabled": true,
+//	  "severities": ["low", "medium"],
+//	  "difficulty": 16,
+//	  "secret": "s3cr3t",
+//	  "on_success": "downgrade"
+//	}
+type ChallengeConfig struct {
+	// Enabled turns challenge mode on (default: false)
+	Enabled bool `json:"enabled"`
+
+	// Severities lists the ban severities that are challenged (default: ["low", "medium"])
+	Severities []string `json:"severities"`
+
+	// Difficulty is the number of leading zero bits the proof of work must find (default: 16)
+	Difficulty int `json:"difficulty"`
+
+	// Secret is the HMAC-SHA256 key used to sign challenges and pass cookies
+	Secret string `json:"secret"`
+
+	// CookieName carries the solution and the pass (default: "__cbw_challenge")
+	CookieName string `json:"cookie_name"`
+
+	// PassTTLSeconds is how long a solved challenge lets a client through (default: 3600)
+	PassTTLSeconds int `json:"pass_ttl_seconds"`
+
+	// OnSuccess is "downgrade" (default) or "lift"
+	OnSuccess string `json:"on_success"`
+}
+
+// EventSinkConfig routes ban events to one handler.
+//
+// Example configuration:
+//
+//	[
+//	  {"type": "log"},
+//	  {"type": "webhook", "event_types": ["issued"], "min_severity": "critical"},
+//	  {"type": "redis_stream", "stream": "ban-events", "max_len": 10000}
+//	]
+type EventSinkConfig struct {
+	// Type is the sink: "log", "metrics", "webhook" or "redis_stream"
+	Type string `json:"type"`
+
+	// EventTypes limits the events sent to this sink; empty sends all types
+	EventTypes []string `json:"event_types"`
+
+	// MinSeverity drops events below this severity ("low", "medium", "high", "critical")
+	MinSeverity string `json:"min_severity"`
+
+	// Stream is the Redis stream key for "redis_stream" sinks (default: "ban-events")
+	Stream string `json:"stream"`
+
+	// MaxLen trims the Redis stream to about this many entries (default: 10000)
+	MaxLen int `json:"max_len"`
+}
+
+// WebhookConfig controls the webhook event sink. Events are buffered per
+// worker and POSTed as JSON batches to an Envoy cluster. The sink is
+// enabled when Cluster is set.
+//
+// Example configuration:
+//
+//	{
+//	  "cluster": "siem",
+//	  "path": "/ingest/coraza-ban",
+//	  "event_types": ["issued", "enforced"],
+//	  "batch_size": 50,
+//	  "flush_interval_ms": 5000,
+//	  "secret": "s3cr3t"
+//	}
+type WebhookConfig struct {
+	// Cluster is the Envoy cluster receiving the webhook calls
+	Cluster string `json:"cluster"`
+
+	// Path is the HTTP path of the webhook endpoint (default: "/")
+	Path string `json:"path"`
+
+	// EventTypes limits the events sent; empty sends all types
+	EventTypes []string `json:"event_types"`
+
+	// BatchSize is the maximum number of events per request (default: 50)
+	// A full batch is sent on the next tick without waiting for the interval.
+	BatchSize int `json:"batch_size"`
+
+	// FlushIntervalMs is how often partial batches are sent (default: 5000)
+	FlushIntervalMs int `json:"flush_interval_ms"`
+
+	// MaxRetries is how many times a failed batch is retried (default: 3)
+	MaxRetries int `json:"max_retries"`
+
+	// RetryBackoffMs is the initial retry delay, doubled on each attempt (default: 1000)
+	RetryBackoffMs int `json:"retry_backoff_ms"`
+
+	// MaxBuffer is the maximum number of queued events; the oldest are
+	// dropped when the endpoint cannot keep up (default: 1000)
+	MaxBuffer int `json:"max_buffer"`
+
+	// TimeoutMs is the timeout of each webhook call (default: 5000)
+	TimeoutMs int `json:"timeout_ms"`
+
+	// Secret is the HMAC-SHA256 key used to sign each request body
+	Secret string `json:"secret"`
+
+	// SignatureHeader carries the request signature (default: "x-coraza-ban-signature")
+	SignatureHeader string `json:"signature_header"`
+}
+
+// AllowlistConfig defines clients that are exempt from ban enforcement
+// and ban issuance, such as uptime probes and partner integrations.
+//
+// Example configuration:
+//
+//	{
+//	  "fingerprints": ["3f2a..."],
+//	  "cidrs": ["10.0.0.0/8", "2001:db8::/32"],
+//	  "user_agents": ["^Pingdom\\.com_bot"],
+//	  "bypass_header": "x-ban-bypass",
+//	  "bypass_secret": "s3cr3t"
+//	}
+type AllowlistConfig struct {
+	// Fingerprints lists exact client fingerprints to allow
+	Fingerprints []string `json:"fingerprints"`
+
+	// CIDRs lists client IP ranges to allow (IPv4 and IPv6)
+	CIDRs []string `json:"cidrs"`
+
+	// UserAgents lists regular expressions matched against the User-Agent header
+	UserAgents []string `json:"user_agents"`
+
+	// BypassHeader is the request header carrying a signed bypass token
+	BypassHeader string `json:"bypass_header"`
+
+	// BypassSecret is the HMAC-SHA256 key used to verify bypass tokens
+	BypassSecret string `json:"bypass_secret"`
+
+	// BypassMaxTTLSeconds is the longest a bypass token may still be valid
+	// for; tokens expiring later are rejected (default: 86400)
+	BypassMaxTTLSeconds int `json:"bypass_max_ttl_seconds"`
+}
+
+// PolicyConfig overrides settings for the requests it matches. A request
+// matches when it matches every configured matcher; at least one is
+// required. Map overrides are merged over the global maps.
+//
+// Example configuration:
+//
+//	{
+//	  "name": "login",
+//	  "hosts": ["app.example.com", "*.example.org"],
+//	  "path_prefix": "/login",
+//	  "methods": ["POST"],
+//	  "score_threshold": 40,
+//	  "ban_ttl_by_severity": {"medium": 3600}
+//	}
+type PolicyConfig struct {
+	// Name identifies the policy in logs and metrics
+	Name string `json:"name"`
+
+	// Hosts matches the request host; "*.example.com" matches subdomains
+	Hosts []string `json:"hosts"`
+
+	// PathPrefix matches the start of the normalized request path, up to
+	// a segment boundary ("/login" does not match "/login-help")
+	PathPrefix string `json:"path_prefix"`
+
+	// PathRegex matches the normalized request path
+	PathRegex string `json:"path_regex"`
+
+	// Methods matches the request method (e.g., ["POST", "PUT"])
+	Methods []string `json:"methods"`
+
+	// ScoreThreshold overrides score_threshold (0 = inherit)
+	ScoreThreshold int `json:"score_threshold"`
+
+	// BanTTLBySeverity overrides ban_ttl_by_severity per severity
+	BanTTLBySeverity map[string]int `json:"ban_ttl_by_severity"`
+
+	// ScoreRules overrides score_rules per rule ID
+	ScoreRules map[string]int `json:"score_rules"`
+
+	// FingerprintMode overrides fingerprint_mode ("" = inherit)
+	FingerprintMode string `json:"fingerprint_mode"`
+
+	// DryRun overrides dry_run (null = inherit)
+	DryRun *bool `json:"dry_run"`
+}
+
+// DenylistConfig defines known-bad networks that are denied without
+// waiting for a WAF trigger. CIDRs are compiled into a prefix trie at
+// plugin start.
+//
+// Example configuration:
+//
+//	{
+//	  "cidrs": [{"cidr": "203.0.113.0/24", "reason": "botnet"}],
+//	  "asns": [{"asn": 64496, "reason": "bulletproof hosting"}],
+//	  "asn_header": "x-client-asn"
+//	}
+type DenylistConfig struct {
+	// CIDRs lists IPv4/IPv6 ranges to deny
+	CIDRs []DenylistCIDR `json:"cidrs"`
+
+	// ASNs lists autonomous system numbers to deny
+	ASNs []DenylistASN `json:"asns"`
+
+	// ASNHeader is the request header carrying the client ASN, typically set
+	// by a CDN or a GeoIP filter (e.g., "x-client-asn")
+	ASNHeader string `json:"asn_header"`
+
+	// TrustedProxies lists the CIDRs of proxies whose X-Forwarded-For header
+	// is trusted (default: none, the connection address is always used)
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+// DenylistCIDR is a denied network range.
+type DenylistCIDR struct {
+	CIDR   string `json:"cidr"`
+	Reason string `json:"reason"`
+}
+
+// DenylistASN is a denied autonomous system.
+type DenylistASN struct {
+	ASN    uint32 `json:"asn"`
+	Reason string `json:"reason"`
+}
+
+// AdminConfig holds the settings for the admin HTTP API.
+// Requests whose path starts with PathPrefix are answered by the filter
+// itself and never reach the upstream.
+//
+// Example configuration:
+//
+//	{
+//	  "enabled": true,
+//	  "path_prefix": "/_coraza-ban",
+//	  "token": "s3cr3t",
+//	  "allowed_cidrs": ["10.0.0.0/8"]
+//	}
+type AdminConfig struct {
+	// Enabled turns the admin API on (default: false)
+	Enabled bool `json:"enabled"`
+
+	// PathPrefix is the path prefix served by the admin API (default: "/_coraza-ban")
+	PathPrefix string `json:"path_prefix"`
+
+	// TokenHeader is the request header carrying the shared secret
+	// (default: "x-coraza-ban-admin-token")
+	TokenHeader string `json:"token_header"`
+
+	// Token is the shared secret required in TokenHeader
+	Token string `json:"token"`
+
+	// AllowedCIDRs restricts access to connections from these source ranges
+	// e.g., ["10.0.0.0/8", "fd00::/8"]
+	AllowedCIDRs []string `json:"allowed_cidrs"`
+}
+
+// DefaultConfig returns a PluginConfig with default values
+func DefaultConfig() *PluginConfig {
+	return &PluginConfig{
+		RedisCluster:       "redis_cluster",
+		RedisBackend:       RedisBackendWebdis,
+		RedisPath:          DefaultRedisPath,
+		RedisAuthHeader:    DefaultRedisAuth,
+		RedisTimeoutMs:     DefaultRedisTimeout,
+		RedisFailureMode:   RedisFailureModeOpen,
+		BanTTLDefault:      DefaultBanTTL,
+		BanTTLBySeverity:   map[string]int{},
+		BanTTLByTag:        map[string]int{},
+		BanSweepSeconds:    DefaultBanSweep,
+		BanScopeDefault:    BanScopeGlobal,
+		ScoringEnabled:     false,
+		ScoreThreshold:     DefaultScoreThreshold,
+		ScoreSource:        ScoreSourceLocal,
+		ScoreAggregation:   ScoreAggregationMax,
+		ScoreMode:          ScoreModeRules,
+		ScoreActions:       map[string]float64{"block": 1, "deny": 1, "drop": 1},
+		ScoreDecayStrategy: ScoreDecayLinear,
+		ScoreDecaySeconds:  DefaultScoreDecay,
+		ScoreDecayRate:     DefaultScoreDecayRate,
+		ScoreDecayHalfLife: DefaultScoreHalfLife,
+		ScoreRules:         map[string]int{},
+		ScoreByTag:         map[string]int{},
+		ScoreBySeverity: map[string]int{
+			"critical": 50,
+			"high":     40,
+			"medium":   20,
+			"low":      10,
+		},
+		AnomalyScoring: AnomalyScoringConfig{
+			Multiplier:      1,
+			MinAnomalyScore: 1,
+			MaxIncrement:    DefaultAnomalyMaxIncr,
+		},
+		WAFDetection: WAFDetectionConfig{
+			MetadataPaths: defaultMetadataPaths,
+			BlockHeaders:  map[string]string{"x-waf-block": "", "server": "coraza"},
+			StatusCodes:   []int{403},
+			RuleID:        DefaultWAFRuleID,
+			Severity:      DefaultWAFSeverity,
+		},
+		ScoreTTL:        DefaultScoreTTL,
+		FingerprintMode: FingerprintModeFull,
+		CookieName:      "__bm",
+		InjectCookie:    false,
+		BanResponseCode: 403,
+		BanResponseBody: "Forbidden",
+		LogLevel:        LogLevelInfo,
+		DryRun:          false,
+		EventsEnabled:   true,
+		MetricsEnabled:  true,
+		Admin: AdminConfig{
+			PathPrefix:  DefaultAdminPrefix,
+			TokenHeader: DefaultAdminHeader,
+		},
+		CircuitBreaker: CircuitBreakerConfig{
+			Enabled:          true,
+			FailureThreshold: DefaultBreakerFails,
+			ProbeIntervalMs:  DefaultBreakerProbe,
+		},
+		Webhook: WebhookConfig{
+			MaxRetries: DefaultWebhookRetries,
+		},
+	}
+}
+
+// ParseConfig parses JSON configuration data into PluginConfig
+func ParseConfig(data []byte) (*PluginConfig, error) {
+	config := DefaultConfig()
+
+	if len(data) == 0 {
+		proxywasm.LogInfo("No configuration provided, using defaults")
+		return config, nil
+	}
+
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+
+	// Validate and set defaults for missing fields
+	config.validate()
+
+	return config, nil
+}
+
+// validate ensures configuration values are valid
+func (c *PluginConfig) validate() {
+	if c.BanTTLDefault <= 0 {
+		c.BanTTLDefault = DefaultBanTTL
+	}
+
+	if c.BanSweepSeconds <= 0 {
+		c.BanSweepSeconds = DefaultBanSweep
+	}
+
+	if c.ScoreThreshold <= 0 {
+		c.ScoreThreshold = DefaultScoreThreshold
+	}
+
+	if c.ScoreSource == "" {
+		c.ScoreSource = ScoreSourceLocal
+	}
+	c.ScoreSource = strings.ToLower(c.ScoreSource)
+
+	if c.ScoreAggregation == "" {
+		c.ScoreAggregation = ScoreAggregationMax
+	}
+	c.ScoreAggregation = strings.ToLower(c.ScoreAggregation)
+
+	if c.ScoreMode == "" {
+		c.ScoreMode = ScoreModeRules
+	}
+	c.ScoreMode = strings.ToLower(c.ScoreMode)
+
+	if c.ScoreActions == nil {
+		c.ScoreActions = map[string]float64{"block": 1, "deny": 1, "drop": 1}
+		if c.ScoreMode == ScoreModeAnomaly {
+			c.ScoreActions["log"] = 1
+			c.ScoreActions["pass"] = 1
+		}
+	} else {
+		actions := make(map[string]float64, len(c.ScoreActions))
+		for action, multiplier := range c.ScoreActions {
+			actions[strings.ToLower(action)] = multiplier
+		}
+		c.ScoreActions = actions
+	}
+
+	if c.ScoreDecayStrategy == "" {
+		c.ScoreDecayStrategy = ScoreDecayLinear
+	}
+	c.ScoreDecayStrategy = strings.ToLower(c.ScoreDecayStrategy)
+
+	if c.ScoreDecaySeconds <= 0 {
+		c.ScoreDecaySeconds = DefaultScoreDecay
+	}
+
+	if c.ScoreDecayRate <= 0 {
+		c.ScoreDecayRate = DefaultScoreDecayRate
+	}
+
+	if c.ScoreDecayHalfLife <= 0 {
+		c.ScoreDecayHalfLife = DefaultScoreHalfLife
+	}
+
+	if c.ScoreTTL <= 0 {
+		c.ScoreTTL = DefaultScoreTTL
+	}
+
+	if c.RedisBackend == "" {
+		c.RedisBackend = RedisBackendWebdis
+	}
+
+	if c.RedisPath == "" {
+		c.RedisPath = DefaultRedisPath
+	}
+
+	if c.RedisAuthHeader == "" {
+		c.RedisAuthHeader = DefaultRedisAuth
+	}
+	c.RedisAuthHeader = strings.ToLower(c.RedisAuthHeader)
+
+	if c.RedisTimeoutMs <= 0 {
+		c.RedisTimeoutMs = DefaultRedisTimeout
+	}
+
+	if c.RedisFailureMode == "" {
+		c.RedisFailureMode = RedisFailureModeOpen
+	}
+
+	if c.CircuitBreaker.FailureThreshold <= 0 {
+		c.CircuitBreaker.FailureThreshold = DefaultBreakerFails
+	}
+
+	if c.CircuitBreaker.ProbeIntervalMs <= 0 {
+		c.CircuitBreaker.ProbeIntervalMs = DefaultBreakerProbe
+	}
+
+	// Validate fingerprint mode
+	validModes := map[string]bool{
+		FingerprintModeFull:    true,
+		FingerprintModePartial: true,
+		FingerprintModeIPOnly:  true,
+	}
+	if !validModes[c.FingerprintMode] {
+		c.FingerprintMode = FingerprintModeFull
+	}
+
+	if c.CookieName == "" {
+		c.CookieName = "__bm"
+	}
+
+	if c.BanResponseCode <= 0 {
+		c.BanResponseCode = 403
+	}
+
+	if c.BanResponseBody == "" {
+		c.BanResponseBody = "Forbidden"
+	}
+
+	// Validate log level
+	validLogLevels := map[string]bool{
+		LogLevelDebug: true,
+		LogLevelInfo:  true,
+		LogLevelWarn:  true,
+		LogLevelError: true,
+	}
+	if !validLogLevels[c.LogLevel] {
+		c.LogLevel = LogLevelInfo
+	}
+
+	// Initialize maps if nil
+	if c.BanTTLBySeverity == nil {
+		c.BanTTLBySeverity = map[string]int{}
+	}
+
+	if c.BanTTLByTag == nil {
+		c.BanTTLByTag = map[string]int{}
+	}
+
+	if c.BanScopeDefault == "" {
+		c.BanScopeDefault = BanScopeGlobal
+	}
+
+	if c.ScoreRules == nil {
+		c.ScoreRules = map[string]int{}
+	}
+
+	if c.ScoreByTag == nil {
+		c.ScoreByTag = map[string]int{}
+	}
+
+	if c.ScoreBySeverity == nil {
+		c.ScoreBySeverity = map[string]int{
+			"critical": 50,
+			"high":     40,
+			"medium":   20,
+			"low":      10,
+		}
+	}
+
+	if c.Admin.PathPrefix == "" {
+		c.Admin.PathPrefix = DefaultAdminPrefix
+	}
+
+	if c.Admin.TokenHeader == "" {
+		c.Admin.TokenHeader = DefaultAdminHeader
+	}
+	c.Admin.TokenHeader = strings.ToLower(c.Admin.TokenHeader)
+	c.Allowlist.BypassHeader = strings.ToLower(c.Allowlist.BypassHeader)
+	if c.Allowlist.BypassMaxTTLSeconds <= 0 {
+		c.Allowlist.BypassMaxTTLSeconds = DefaultBypassMaxTTL
+	}
+	c.Webhook.setDefaults()
+	c.Escalation.setDefaults()
+	c.Signals.setDefaults()
+	c.AnomalyScoring.setDefaults()
+	c.WAFDetection.setDefaults()
+	for i := range c.MetadataSources {
+		c.MetadataSources[i].setDefaults()
+	}
+	c.Challenge.setDefaults()
+	c.setEnforcementDefaults()
+	for i := range c.EventSinks {
+		sink := &c.EventSinks[i]
+		if sink.Type == EventSinkRedisStream && sink.Stream == "" {
+			sink.Stream = DefaultEventStream
+		}
+		if sink.MaxLen <= 0 {
+			sink.MaxLen = DefaultStreamMaxLen
+		}
+	}
+	c.Denylist.ASNHeader = strings.ToLower(c.Denylist.ASNHeader)
+	for i := range c.Policies {
+		c.Policies[i].setDefaults(i)
+	}
+}
+
+// Validate performs comprehensive validation of the configuration.
+// Returns an error if any configuration values are invalid.
+// This is called during plugin startup for fail-fast behavior.
+func (c *PluginConfig) Validate() error {
+	var errors []string
+
+	// Redis backend validation
+	if c.RedisBackend != RedisBackendWebdis && c.RedisBackend != RedisBackendRESP {
+		errors = append(errors, fmt.Sprintf("redis_backend must be one of: %s, %s",
+			RedisBackendWebdis, RedisBackendRESP))
+	}
+	if c.RedisBackend == RedisBackendRESP && !strings.HasPrefix(c.RedisPath, "/") {
+		errors = append(errors, "redis_path must start with /")
+	}
+
+	// Redis timeout: 1ms to 60 seconds
+	if c.RedisTimeoutMs < 1 || c.RedisTimeoutMs > 60000 {
+		errors = append(errors, "redis_timeout_ms must be between 1-60000")
+	}
+
+	if c.RedisFailureMode != RedisFailureModeOpen && c.RedisFailureMode != RedisFailureModeClosed {
+		errors = append(errors, fmt.Sprintf("redis_failure_mode must be one of: %s, %s",
+			RedisFailureModeOpen, RedisFailureModeClosed))
+	}
+
+	// Circuit breaker validation (only when enabled)
+	if c.CircuitBreaker.Enabled {
+		if c.CircuitBreaker.FailureThreshold < 1 || c.CircuitBreaker.FailureThreshold > 1000 {
+			errors = append(errors, "circuit_breaker.failure_threshold must be between 1-1000")
+		}
+		if c.CircuitBreaker.ProbeIntervalMs < 1000 || c.CircuitBreaker.ProbeIntervalMs > 3600000 {
+			errors = append(errors, "circuit_breaker.probe_interval_ms must be between 1000-3600000")
+		}
+	}
+
+	// Key prefix must be safe to embed in Webdis URL paths
+	if strings.ContainsAny(c.KeyPrefix, unsafeKeyChars) {
+		errors = append(errors, "key_prefix must not contain '/', '%', '?', '#' or whitespace")
+	}
+
+	// Ban TTL: 1 second to 24 hours
+	if c.BanTTLDefault < 1 || c.BanTTLDefault > 86400 {
+		errors = append(errors, "ban_ttl_default must be between 1-86400 seconds")
+	}
+
+	// Validate TTL by severity values
+	for severity, ttl := range c.BanTTLBySeverity {
+		if ttl < 1 || ttl > 86400 {
+			errors = append(errors, fmt.Sprintf("ban_ttl_by_severity[%s] must be between 1-86400 seconds", severity))
+		}
+	}
+
+	// Validate TTL by tag values
+	for tag, ttl := range c.BanTTLByTag {
+		if ttl < 1 || ttl > 86400 {
+			errors = append(errors, fmt.Sprintf("ban_ttl_by_tag[%s] must be between 1-86400 seconds", tag))
+		}
+	}
+
+	// Tag filters
+	for _, tag := range c.TagsInclude {
+		if tag == "" {
+			errors = append(errors, "tags_include must not contain empty tags")
+		}
+	}
+	for _, tag := range c.TagsExclude {
+		if tag == "" {
+			errors = append(errors, "tags_exclude must not contain empty tags")
+		}
+	}
+
+	// Ban scope validation
+	if !isBanScope(c.BanScopeDefault) {
+		errors = append(errors, fmt.Sprintf("ban_scope_default must be one of: %s, %s, %s",
+			BanScopeGlobal, BanScopeHost, BanScopePath))
+	}
+	for severity, scope := range c.BanScopeBySeverity {
+		if !isBanScope(scope) {
+			errors = append(errors, fmt.Sprintf("ban_scope_by_severity[%s]: unknown scope %q", severity, scope))
+		}
+	}
+	for ruleID, scope := range c.BanScopeRules {
+		if !isBanScope(scope) {
+			errors = append(errors, fmt.Sprintf("ban_scope_rules[%s]: unknown scope %q", ruleID, scope))
+		}
+	}
+
+	// Ban sweep: 1 second to 1 hour
+	if c.BanSweepSeconds < 1 || c.BanSweepSeconds > 3600 {
+		errors = append(errors, "ban_sweep_interval_seconds must be between 1-3600 seconds")
+	}
+
+	// Score threshold: 1 to 10000
+	if c.ScoringEnabled && (c.ScoreThreshold < 1 || c.ScoreThreshold > 10000) {
+		errors = append(errors, "score_threshold must be between 1-10000")
+	}
+
+	// Score source: the cluster-wide score requires Redis
+	switch c.ScoreSource {
+	case ScoreSourceLocal:
+	case ScoreSourceRedis:
+		if c.RedisCluster == "" {
+			errors = append(errors, "score_source redis requires redis_cluster")
+		}
+	default:
+		errors = append(errors, fmt.Sprintf("score_source must be one of: %s, %s", ScoreSourceLocal, ScoreSourceRedis))
+	}
+
+	switch c.ScoreAggregation {
+	case ScoreAggregationMax, ScoreAggregationSum, ScoreAggregationDistinct:
+	default:
+		errors = append(errors, fmt.Sprintf("score_aggregation must be one of: %s, %s, %s",
+			ScoreAggregationMax, ScoreAggregationSum, ScoreAggregationDistinct))
+	}
+
+	// Score decay: 1 second to 1 hour, or 7 days for the step quiet period
+	switch c.ScoreDecayStrategy {
+	case ScoreDecayStep:
+		if c.ScoreDecaySeconds < 1 || c.ScoreDecaySeconds > 604800 {
+			errors = append(errors, "score_decay_seconds must be between 1-604800 seconds with step decay")
+		}
+	case ScoreDecayLinear, ScoreDecayExponential:
+		if c.ScoreDecaySeconds < 1 || c.ScoreDecaySeconds > 3600 {
+			errors = append(errors, "score_decay_seconds must be between 1-3600 seconds")
+		}
+	default:
+		errors = append(errors, fmt.Sprintf("score_decay_strategy must be one of: %s, %s, %s",
+			ScoreDecayLinear, ScoreDecayExponential, ScoreDecayStep))
+	}
+	if c.ScoreDecayRate < 1 || c.ScoreDecayRate > 1000 {
+		errors = append(errors, "score_decay_rate must be between 1-1000")
+	}
+	if c.ScoreDecayHalfLife < 1 || c.ScoreDecayHalfLife > 604800 {
+		errors = append(errors, "score_decay_half_life_seconds must be between 1-604800 seconds")
+	}
+
+	// Score TTL: 1 second to 24 hours
+	if c.ScoreTTL < 1 || c.ScoreTTL > 86400 {
+		errors = append(errors, "score_ttl must be between 1-86400 seconds")
+	}
+
+	// Validate score rules values
+	for ruleID, score := range c.ScoreRules {
+		if score < 1 || score > 1000 {
+			errors = append(errors, fmt.Sprintf("score_rules[%s] must be between 1-1000", ruleID))
+		}
+	}
+
+	// Validate score by tag values
+	for tag, score := range c.ScoreByTag {
+		if score < 1 || score > 1000 {
+			errors = append(errors, fmt.Sprintf("score_by_tag[%s] must be between 1-1000", tag))
+		}
+	}
+
+	// Validate score by severity values
+	for severity, score := range c.ScoreBySeverity {
+		if score < 1 || score > 1000 {
+			errors = append(errors, fmt.Sprintf("score_by_severity[%s] must be between 1-1000", severity))
+		}
+	}
+
+	// Fingerprint mode validation
+	validModes := map[string]bool{
+		FingerprintModeFull:    true,
+		FingerprintModePartial: true,
+		FingerprintModeIPOnly:  true,
+	}
+	if !validModes[c.FingerprintMode] {
+		errors = append(errors, fmt.Sprintf("fingerprint_mode must be one of: %s, %s, %s",
+			FingerprintModeFull, FingerprintModePartial, FingerprintModeIPOnly))
+	}
+
+	// Ban response code: 4xx or 5xx
+	if c.BanResponseCode < 400 || c.BanResponseCode > 599 {
+		errors = append(errors, "ban_response_code must be between 400-599")
+	}
+
+	// JSON template must render valid JSON
+	if c.BanResponseTemplates.JSON != "" {
+		if err := validateJSONTemplate(c.BanResponseTemplates.JSON); err != nil {
+			errors = append(errors, fmt.Sprintf("ban_response_templates.json: %v", err))
+		}
+	}
+
+	// Log level validation
+	validLogLevels := map[string]bool{
+		LogLevelDebug: true,
+		LogLevelInfo:  true,
+		LogLevelWarn:  true,
+		LogLevelError: true,
+	}
+	if !validLogLevels[c.LogLevel] {
+		errors = append(errors, fmt.Sprintf("log_level must be one of: %s, %s, %s, %s",
+			LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError))
+	}
+
+	// Cookie name validation (if injection is enabled)
+	if c.InjectCookie && c.CookieName == "" {
+		errors = append(errors, "cookie_name is required when inject_cookie is true")
+	}
+
+	// Admin API validation (only when enabled)
+	if c.Admin.Enabled {
+		if !strings.HasPrefix(c.Admin.PathPrefix, "/") {
+			errors = append(errors, "admin.path_prefix must start with /")
+		}
+		if c.Admin.Token == "" && len(c.Admin.AllowedCIDRs) == 0 {
+			errors = append(errors, "admin requires a token or allowed_cidrs when enabled")
+		}
+		if _, err := parsePrefixes(c.Admin.AllowedCIDRs); err != nil {
+			errors = append(errors, fmt.Sprintf("admin.allowed_cidrs: %v", err))
+		}
+	}
+
+	// Allowlist validation
+	if _, err := parsePrefixes(c.Allowlist.CIDRs); err != nil {
+		errors = append(errors, fmt.Sprintf("allowlist.cidrs: %v", err))
+	}
+	for _, pattern := range c.Allowlist.UserAgents {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errors = append(errors, fmt.Sprintf("allowlist.user_agents: invalid regex %q", pattern))
+		}
+	}
+	if c.Allowlist.BypassHeader != "" && c.Allowlist.BypassSecret == "" {
+		errors = append(errors, "allowlist.bypass_secret is required when bypass_header is set")
+	}
+	if c.Allowlist.BypassHeader != "" &&
+		(c.Allowlist.BypassMaxTTLSeconds < 60 || c.Allowlist.BypassMaxTTLSeconds > 2592000) {
+		errors = append(errors, "allowlist.bypass_max_ttl_seconds must be between 60-2592000 seconds")
+	}
+
+	// Denylist validation
+	for _, entry := range c.Denylist.CIDRs {
+		if _, err := parsePrefixes([]string{entry.CIDR}); err != nil {
+			errors = append(errors, fmt.Sprintf("denylist.cidrs: %v", err))
+		}
+	}
+	if _, err := parsePrefixes(c.Denylist.TrustedProxies); err != nil {
+		errors = append(errors, fmt.Sprintf("denylist.trusted_proxies: %v", err))
+	}
+	if len(c.Denylist.ASNs) > 0 && c.Denylist.ASNHeader == "" {
+		errors = append(errors, "denylist.asn_header is required when asns are configured")
+	}
+
+	// Policy validation
+	for i, policy := range c.Policies {
+		errors = append(errors, policy.validate(i)...)
+	}
+
+	// Event sink validation
+	for i, sink := range c.EventSinks {
+		errors = append(errors, c.validateEventSink(i, &sink)...)
+	}
+
+	// Webhook validation (only when enabled)
+	if c.Webhook.Cluster != "" {
+		errors = append(errors, c.Webhook.validate()...)
+	}
+
+	// Escalation validation (only when enabled)
+	if c.Escalation.Enabled {
+		errors = append(errors, c.Escalation.validate()...)
+	}
+
+	// WAF detection validation
+	errors = append(errors, c.WAFDetection.validate()...)
+
+	// Metadata sources validation
+	for i := range c.MetadataSources {
+		errors = append(errors, c.MetadataSources[i].validate(i)...)
+	}
+
+	// Score mode validation
+	switch c.ScoreMode {
+	case ScoreModeRules:
+	case ScoreModeAnomaly:
+		errors = append(errors, c.AnomalyScoring.validate()...)
+	default:
+		errors = append(errors, fmt.Sprintf("score_mode must be one of: %s, %s", ScoreModeRules, ScoreModeAnomaly))
+	}
+
+	// Score actions validation
+	for action, multiplier := range c.ScoreActions {
+		if !slices.Contains(wafActions, action) {
+			errors = append(errors, fmt.Sprintf("score_actions[%s] must be one of: %s", action, strings.Join(wafActions, ", ")))
+		}
+		if multiplier < 0 || multiplier > 10 {
+			errors = append(errors, fmt.Sprintf("score_actions[%s] must be between 0-10", action))
+		}
+	}
+
+	// Signals validation (only when configured)
+	if c.Signals.Enabled() {
+		if !c.ScoringEnabled {
+			errors = append(errors, "signals require scoring_enabled")
+		}
+		errors = append(errors, c.Signals.validate()...)
+	}
+
+	// Enforcement validation
+	for severity, enforcement := range c.EnforcementBySeverity {
+		errors = append(errors, enforcement.validate(severity)...)
+	}
+
+	// Challenge validation (only when enabled)
+	if c.Challenge.Enabled {
+		errors = append(errors, c.Challenge.validate()...)
+	}
 
 	if len(errors) > 0 {
 		return fmt.Errorf("configuration validation failed: %s", strings.Join(errors, "; "))
 	}
-	return nil
+	return nil
+}
+
+// DefaultEventSinks returns the sinks used when event_sinks is not set.
+func (c *PluginConfig) DefaultEventSinks() []EventSinkConfig {
+	sinks := []EventSinkConfig{{Type: EventSinkLog}}
+	if c.MetricsEnabled {
+		sinks = append(sinks, EventSinkConfig{Type: EventSinkMetrics})
+	}
+	if c.Webhook.Cluster != "" {
+		sinks = append(sinks, EventSinkConfig{Type: EventSinkWebhook})
+	}
+	return sinks
+}
+
+// validateEventSink returns the errors of the i-th event sink.
+func (c *PluginConfig) validateEventSink(i int, sink *EventSinkConfig) []string {
+	var errors []string
+	field := fmt.Sprintf("event_sinks[%d]", i)
+
+	switch sink.Type {
+	case EventSinkLog, EventSinkMetrics:
+	case EventSinkWebhook:
+		if c.Webhook.Cluster == "" {
+			errors = append(errors, field+": webhook sink requires webhook.cluster")
+		}
+	case EventSinkRedisStream:
+		if c.RedisCluster == "" {
+			errors = append(errors, field+": redis_stream sink requires redis_cluster")
+		}
+		if sink.Stream == "" || strings.ContainsAny(sink.Stream, unsafeKeyChars) {
+			errors = append(errors, field+": stream must be non-empty without '/', '%', '?', '#' or whitespace")
+		}
+	default:
+		errors = append(errors, fmt.Sprintf("%s: type must be one of: %s, %s, %s, %s", field,
+			EventSinkLog, EventSinkMetrics, EventSinkWebhook, EventSinkRedisStream))
+	}
+
+	for _, eventType := range sink.EventTypes {
+		if !isBanEventType(eventType) {
+			errors = append(errors, fmt.Sprintf("%s: unknown event type %q", field, eventType))
+		}
+	}
+	if sink.MinSeverity != "" && severityRank[strings.ToLower(sink.MinSeverity)] == 0 {
+		errors = append(errors, field+": min_severity must be one of: low, medium, high, critical")
+	}
+
+	return errors
+}
+
+// setDefaults fills in missing webhook settings.
+func (w *WebhookConfig) setDefaults() {
+	if w.Path == "" {
+		w.Path = DefaultWebhookPath
+	}
+	if w.BatchSize <= 0 {
+		w.BatchSize = DefaultWebhookBatch
+	}
+	if w.FlushIntervalMs <= 0 {
+		w.FlushIntervalMs = DefaultWebhookFlush
+	}
+	if w.MaxRetries < 0 {
+		w.MaxRetries = DefaultWebhookRetries
+	}
+	if w.RetryBackoffMs <= 0 {
+		w.RetryBackoffMs = DefaultWebhookBackoff
+	}
+	if w.MaxBuffer <= 0 {
+		w.MaxBuffer = DefaultWebhookBuffer
+	}
+	if w.TimeoutMs <= 0 {
+		w.TimeoutMs = DefaultRedisTimeout
+	}
+	if w.SignatureHeader == "" {
+		w.SignatureHeader = DefaultWebhookSigHdr
+	}
+	w.SignatureHeader = strings.ToLower(w.SignatureHeader)
+}
+
+// validate returns the webhook configuration errors.
+func (w *WebhookConfig) validate() []string {
+	var errors []string
+
+	if !strings.HasPrefix(w.Path, "/") {
+		errors = append(errors, "webhook.path must start with /")
+	}
+	for _, eventType := range w.EventTypes {
+		if !isBanEventType(eventType) {
+			errors = append(errors, fmt.Sprintf("webhook.event_types: unknown event type %q", eventType))
+		}
+	}
+	if w.BatchSize < 1 || w.BatchSize > 1000 {
+		errors = append(errors, "webhook.batch_size must be between 1-1000")
+	}
+	if w.FlushIntervalMs < 100 || w.FlushIntervalMs > 3600000 {
+		errors = append(errors, "webhook.flush_interval_ms must be between 100-3600000")
+	}
+	if w.MaxRetries < 0 || w.MaxRetries > 10 {
+		errors = append(errors, "webhook.max_retries must be between 0-10")
+	}
+	if w.MaxBuffer < w.BatchSize {
+		errors = append(errors, "webhook.max_buffer must be at least batch_size")
+	}
+	if w.TimeoutMs < 1 || w.TimeoutMs > 60000 {
+		errors = append(errors, "webhook.timeout_ms must be between 1-60000")
+	}
+
+	return errors
+}
+
+// setDefaults fills in missing escalation settings.
+func (e *EscalationConfig) setDefaults() {
+	if e.Multiplier <= 0 {
+		e.Multiplier = DefaultEscalationMult
+	}
+	if e.MaxTTL <= 0 {
+		e.MaxTTL = DefaultEscalationMax
+	}
+	if e.WindowSeconds <= 0 {
+		e.WindowSeconds = DefaultOffenseWindow
+	}
+}
+
+// validate returns the escalation configuration errors.
+// Escalated bans may exceed the 24 hour ban_ttl_default limit, up to 30 days.
+func (e *EscalationConfig) validate() []string {
+	var errors []string
+
+	for i, ttl := range e.Ladder {
+		if ttl < 1 || ttl > 2592000 {
+			errors = append(errors, fmt.Sprintf("escalation.ladder[%d] must be between 1-2592000 seconds", i))
+		}
+	}
+	if e.Multiplier < 1 || e.Multiplier > 100 {
+		errors = append(errors, "escalation.multiplier must be between 1-100")
+	}
+	if e.MaxTTL < 1 || e.MaxTTL > 2592000 {
+		errors = append(errors, "escalation.max_ttl must be between 1-2592000 seconds")
+	}
+	if e.WindowSeconds < 60 || e.WindowSeconds > 31536000 {
+		errors = append(errors, "escalation.window_seconds must be between 60-31536000 seconds")
+	}
+
+	return errors
+}
+
+// BanTTL returns the ban TTL for the given offense count, starting from
+// the severity TTL. Returns baseTTL unchanged when escalation is disabled.
+func (e *EscalationConfig) BanTTL(baseTTL, offenses int) int {
+	if !e.Enabled || offenses < 1 {
+		return baseTTL
+	}
+
+	if len(e.Ladder) > 0 {
+		step := offenses - 1
+		if step >= len(e.Ladder) {
+			step = len(e.Ladder) - 1
+		}
+		return e.Ladder[step]
+	}
+
+	ttl, maxTTL := float64(baseTTL), float64(e.MaxTTL)
+	for i := 1; i < offenses && ttl < maxTTL; i++ {
+		ttl *= e.Multiplier
+		if ttl > maxTTL {
+			ttl = maxTTL
+		}
+	}
+	return int(ttl)
+}
+
+// setDefaults names unnamed policies and normalizes hosts and methods.
+func (p *PolicyConfig) setDefaults(index int) {
+	if p.Name == "" {
+		p.Name = fmt.Sprintf("policy-%d", index)
+	}
+	for i, host := range p.Hosts {
+		p.Hosts[i] = strings.ToLower(host)
+	}
+	for i, method := range p.Methods {
+		p.Methods[i] = strings.ToUpper(method)
+	}
+}
+
+// validate returns the errors of the policy at index.
+func (p *PolicyConfig) validate(index int) []string {
+	var errors []string
+	field := fmt.Sprintf("policies[%d]", index)
+
+	if len(p.Hosts) == 0 && p.PathPrefix == "" && p.PathRegex == "" && len(p.Methods) == 0 {
+		errors = append(errors, fmt.Sprintf("%s requires hosts, path_prefix, path_regex or methods", field))
+	}
+	if p.PathPrefix != "" && !strings.HasPrefix(p.PathPrefix, "/") {
+		errors = append(errors, fmt.Sprintf("%s.path_prefix must start with /", field))
+	}
+	if _, err := regexp.Compile(p.PathRegex); err != nil {
+		errors = append(errors, fmt.Sprintf("%s.path_regex: invalid regex %q", field, p.PathRegex))
+	}
+	if p.ScoreThreshold < 0 || p.ScoreThreshold > 10000 {
+		errors = append(errors, fmt.Sprintf("%s.score_threshold must be between 1-10000", field))
+	}
+	for severity, ttl := range p.BanTTLBySeverity {
+		if ttl < 1 || ttl > 86400 {
+			errors = append(errors, fmt.Sprintf("%s.ban_ttl_by_severity[%s] must be between 1-86400 seconds", field, severity))
+		}
+	}
+	for ruleID, score := range p.ScoreRules {
+		if score < 1 || score > 1000 {
+			errors = append(errors, fmt.Sprintf("%s.score_rules[%s] must be between 1-1000", field, ruleID))
+		}
+	}
+	switch p.FingerprintMode {
+	case "", FingerprintModeFull, FingerprintModePartial, FingerprintModeIPOnly:
+	default:
+		errors = append(errors, fmt.Sprintf("%s.fingerprint_mode must be one of: %s, %s, %s", field,
+			FingerprintModeFull, FingerprintModePartial, FingerprintModeIPOnly))
+	}
+
+	return errors
+}
+
+// WithPolicy returns a copy of the configuration with the overrides of
+// a policy applied. The global configuration is left untouched.
+func (c *PluginConfig) WithPolicy(policy *PolicyConfig) *PluginConfig {
+	effective := *c
+
+	if policy.ScoreThreshold > 0 {
+		effective.ScoreThreshold = policy.ScoreThreshold
+	}
+	if len(policy.BanTTLBySeverity) > 0 {
+		effective.BanTTLBySeverity = mergeIntMaps(c.BanTTLBySeverity, policy.BanTTLBySeverity)
+	}
+	if len(policy.ScoreRules) > 0 {
+		effective.ScoreRules = mergeIntMaps(c.ScoreRules, policy.ScoreRules)
+	}
+	if policy.FingerprintMode != "" {
+		effective.FingerprintMode = policy.FingerprintMode
+	}
+	if policy.DryRun != nil {
+		effective.DryRun = *policy.DryRun
+	}
+
+	return &effective
+}
+
+// mergeIntMaps returns a new map with the entries of overrides laid over base.
+func mergeIntMaps(base, overrides map[string]int) map[string]int {
+	merged := make(map[string]int, len(base)+len(overrides))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		merged[key] = value
+	}
+	return merged
+}
+
+// signals returns the signals by name.
+func (s *SignalsConfig) signals() map[string]*SignalConfig {
+	return map[string]*SignalConfig{
+		SignalRequestRate: &s.RequestRate,
+		SignalNotFound:    &s.NotFound,
+		SignalAuthFailure: &s.AuthFailure,
+		SignalServerError: &s.ServerError,
+	}
+}
+
+// Get returns the configuration of a signal, or nil for unknown names.
+func (s *SignalsConfig) Get(name string) *SignalConfig {
+	return s.signals()[name]
+}
+
+// Enabled returns true if any signal is enabled.
+func (s *SignalsConfig) Enabled() bool {
+	for _, signal := range s.signals() {
+		if signal.Enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// Enabled returns true if the signal adds score.
+func (s *SignalConfig) Enabled() bool {
+	return s.Score > 0
+}
+
+// setDefaults fills in missing signal settings.
+func (s *SignalsConfig) setDefaults() {
+	for _, signal := range s.signals() {
+		if signal.WindowSeconds <= 0 {
+			signal.WindowSeconds = DefaultSignalWindow
+		}
+		if signal.Severity == "" {
+			signal.Severity = DefaultSignalSeverity
+		}
+		signal.Severity = strings.ToLower(signal.Severity)
+	}
+}
+
+// setDefaults fills in missing WAF detection settings.
+func (d *WAFDetectionConfig) setDefaults() {
+	if d.MetadataPaths == nil {
+		d.MetadataPaths = defaultMetadataPaths
+	}
+	if d.BlockHeaders == nil {
+		d.BlockHeaders = map[string]string{"x-waf-block": "", "server": "coraza"}
+	} else {
+		headers := make(map[string]string, len(d.BlockHeaders))
+		for name, value := range d.BlockHeaders {
+			headers[strings.ToLower(name)] = value
+		}
+		d.BlockHeaders = headers
+	}
+	if d.StatusCodes == nil {
+		d.StatusCodes = []int{403}
+	}
+	if d.RuleID == "" {
+		d.RuleID = DefaultWAFRuleID
+	}
+	if d.Severity == "" {
+		d.Severity = DefaultWAFSeverity
+	}
+	d.Severity = strings.ToLower(d.Severity)
+}
+
+// validate returns the errors of the WAF detection settings.
+func (d *WAFDetectionConfig) validate() []string {
+	var errors []string
+
+	for _, path := range d.MetadataPaths {
+		if len(path) == 0 || slices.Contains(path, "") {
+			errors = append(errors, "waf_detection.metadata_paths must not contain empty paths or segments")
+			break
+		}
+	}
+	for name := range d.BlockHeaders {
+		if name == "" {
+			errors = append(errors, "waf_detection.block_headers must not contain empty header names")
+		}
+	}
+	for _, code := range d.StatusCodes {
+		if code < 100 || code > 599 {
+			errors = append(errors, fmt.Sprintf("waf_detection.status_codes must be HTTP status codes, got %d", code))
+		}
+	}
+	if severityRank[d.Severity] == 0 {
+		errors = append(errors, "waf_detection.severity must be one of: low, medium, high, critical")
+	}
+
+	return errors
+}
+
+// FallbackEnabled returns true if status codes alone prove a WAF block.
+func (d *WAFDetectionConfig) FallbackEnabled() bool {
+	return d.StatusFallback == nil || *d.StatusFallback
+}
+
+// MarkBlocked marks metadata, or new metadata when nil, as a WAF block
+// detected from the response, with the configured rule and severity
+// where the metadata has none.
+func (d *WAFDetectionConfig) MarkBlocked(metadata *CorazaMetadata) *CorazaMetadata {
+	if metadata == nil {
+		metadata = &CorazaMetadata{}
+	}
+	metadata.Action = "block"
+	if metadata.RuleID == "" && len(metadata.Rules) == 0 {
+		metadata.RuleID = d.RuleID
+	}
+	if metadata.Severity == "" {
+		metadata.Severity = d.Severity
+	}
+	return metadata
+}
+
+// canonicalPath returns the normalized form of a request path that
+// policies and path scopes are matched against.
+func (c *PluginConfig) canonicalPath(path string) string {
+	path = normalizePath(path)
+	if c.CaseInsensitivePaths {
+		path = strings.ToLower(path)
+	}
+	return path
+}
+
+// GetMetadataSources returns the metadata sources: the configured sources,
+// or else the metadata paths of WAF detection followed by the x-coraza-*
+// response headers.
+func (c *PluginConfig) GetMetadataSources() []MetadataSourceConfig {
+	if len(c.MetadataSources) > 0 {
+		return c.MetadataSources
+	}
+
+	sources := make([]MetadataSourceConfig, 0, len(c.WAFDetection.MetadataPaths)+1)
+	for _, path := range c.WAFDetection.MetadataPaths {
+		sources = append(sources, MetadataSourceConfig{
+			Type:   MetadataSourceProperty,
+			Path:   path,
+			Format: MetadataFormatAuto,
+		})
+	}
+	return append(sources, MetadataSourceConfig{
+		Type:   MetadataSourceResponseHeader,
+		Format: MetadataFormatAuto,
+		Fields: defaultHeaderFields,
+	})
+}
+
+// setDefaults fills in missing metadata source settings.
+func (m *MetadataSourceConfig) setDefaults() {
+	m.Type = strings.ToLower(m.Type)
+	if m.Format == "" {
+		m.Format = MetadataFormatAuto
+	}
+	m.Format = strings.ToLower(m.Format)
+	m.Header = strings.ToLower(m.Header)
+
+	// Header names are case-insensitive
+	if m.Type == MetadataSourceRequestHeader || m.Type == MetadataSourceResponseHeader {
+		fields := make(map[string]string, len(m.Fields))
+		for field, header := range m.Fields {
+			fields[field] = strings.ToLower(header)
+		}
+		m.Fields = fields
+	}
+}
+
+// validate returns the errors of the metadata source at index i.
+func (m *MetadataSourceConfig) validate(i int) []string {
+	var errors []string
+	field := fmt.Sprintf("metadata_sources[%d]", i)
+
+	switch m.Type {
+	case MetadataSourceFilterMetadata, MetadataSourceProperty:
+		if len(m.Path) == 0 || slices.Contains(m.Path, "") {
+			errors = append(errors, fmt.Sprintf("%s.path is required for %s sources and must not contain empty segments", field, m.Type))
+		}
+	case MetadataSourceRequestHeader, MetadataSourceResponseHeader:
+		if m.Header == "" && len(m.Fields) == 0 {
+			errors = append(errors, fmt.Sprintf("%s requires header or fields", field))
+		}
+	default:
+		errors = append(errors, fmt.Sprintf("%s.type must be one of: %s, %s, %s, %s", field,
+			MetadataSourceFilterMetadata, MetadataSourceProperty, MetadataSourceRequestHeader, MetadataSourceResponseHeader))
+	}
+
+	switch m.Format {
+	case MetadataFormatAuto, MetadataFormatJSON, MetadataFormatKV, MetadataFormatStruct:
+	default:
+		errors = append(errors, fmt.Sprintf("%s.format must be one of: %s, %s, %s, %s", field,
+			MetadataFormatAuto, MetadataFormatJSON, MetadataFormatKV, MetadataFormatStruct))
+	}
+
+	for name, key := range m.Fields {
+		if !slices.Contains(metadataFields, name) {
+			errors = append(errors, fmt.Sprintf("%s.fields[%s] is not a metadata field", field, name))
+		} else if key == "" {
+			errors = append(errors, fmt.Sprintf("%s.fields[%s] must not be empty", field, name))
+		}
+	}
+
+	return errors
+}
+
+// setDefaults fills in missing anomaly scoring settings.
+func (a *AnomalyScoringConfig) setDefaults() {
+	if a.Multiplier <= 0 {
+		a.Multiplier = 1
+	}
+	if a.MinAnomalyScore <= 0 {
+		a.MinAnomalyScore = 1
+	}
+	if a.MaxIncrement <= 0 {
+		a.MaxIncrement = DefaultAnomalyMaxIncr
+	}
+}
+
+// validate returns the errors of the anomaly scoring settings.
+func (a *AnomalyScoringConfig) validate() []string {
+	var errors []string
+
+	if a.Multiplier > 100 {
+		errors = append(errors, "anomaly_scoring.multiplier must be between 0-100")
+	}
+	if a.MinAnomalyScore > 10000 {
+		errors = append(errors, "anomaly_scoring.min_anomaly_score must be between 1-10000")
+	}
+	if a.MaxIncrement > 1000 {
+		errors = append(errors, "anomaly_scoring.max_increment must be between 1-1000")
+	}
+
+	return errors
+}
+
+// Increment returns the score increment of an anomaly score, or 0 if the
+// anomaly score is below the minimum.
+func (a *AnomalyScoringConfig) Increment(anomalyScore int) int {
+	if anomalyScore < a.MinAnomalyScore {
+		return 0
+	}
+	increment := int(math.Round(float64(anomalyScore) * a.Multiplier))
+	return min(increment, a.MaxIncrement)
+}
+
+// validate returns the errors of the enabled signals.
+func (s *SignalsConfig) validate() []string {
+	var errors []string
+
+	for _, name := range signalNames {
+		signal := s.Get(name)
+		if !signal.Enabled() {
+			continue
+		}
+		field := "signals." + name
+		if signal.Threshold < 1 || signal.Threshold > 100000 {
+			errors = append(errors, fmt.Sprintf("%s.threshold must be between 1-100000", field))
+		}
+		if signal.WindowSeconds < 1 || signal.WindowSeconds > 86400 {
+			errors = append(errors, fmt.Sprintf("%s.window_seconds must be between 1-86400 seconds", field))
+		}
+		if signal.Score > 1000 {
+			errors = append(errors, fmt.Sprintf("%s.score must be between 0-1000", field))
+		}
+		if severityRank[signal.Severity] == 0 {
+			errors = append(errors, fmt.Sprintf("%s.severity must be one of: low, medium, high, critical", field))
+		}
+	}
+
+	return errors
+}
+
+// setEnforcementDefaults lowercases the enforcement severities and fills
+// in missing enforcement settings from the ban response.
+func (c *PluginConfig) setEnforcementDefaults() {
+	enforcements := make(map[string]EnforcementConfig, len(c.EnforcementBySeverity))
+	for severity, enforcement := range c.EnforcementBySeverity {
+		if enforcement.Action == "" {
+			enforcement.Action = EnforcementDeny
+		}
+		if enforcement.ResponseCode <= 0 {
+			if enforcement.Action == EnforcementRedirect {
+				enforcement.ResponseCode = DefaultRedirectCode
+			} else {
+				enforcement.ResponseCode = c.BanResponseCode
+			}
+		}
+		if enforcement.ResponseBody == "" {
+			enforcement.ResponseBody = c.BanResponseBody
+		}
+		if enforcement.Action == EnforcementTarpit && enforcement.TarpitSeconds <= 0 {
+			enforcement.TarpitSeconds = DefaultTarpitSeconds
+		}
+		enforcements[strings.ToLower(severity)] = enforcement
+	}
+	c.EnforcementBySeverity = enforcements
+}
+
+// validate returns the errors of the enforcement for a severity.
+func (e *EnforcementConfig) validate(severity string) []string {
+	var errors []string
+	field := fmt.Sprintf("enforcement_by_severity[%s]", severity)
+
+	if severityRank[severity] == 0 {
+		errors = append(errors, fmt.Sprintf("%s: unknown severity", field))
+	}
+
+	switch e.Action {
+	case EnforcementDeny, EnforcementLog:
+	case EnforcementRedirect:
+		if !strings.HasPrefix(e.RedirectURL, "/") && !strings.HasPrefix(e.RedirectURL, "http://") &&
+			!strings.HasPrefix(e.RedirectURL, "https://") {
+			errors = append(errors, fmt.Sprintf("%s.redirect_url must be a path or an http(s) URL", field))
+		}
+	case EnforcementTarpit:
+		if e.TarpitSeconds < 1 || e.TarpitSeconds > 300 {
+			errors = append(errors, fmt.Sprintf("%s.tarpit_seconds must be between 1-300 seconds", field))
+		}
+	case EnforcementRateLimit:
+		if e.RequestsPerMinute < 1 || e.RequestsPerMinute > 10000 {
+			errors = append(errors, fmt.Sprintf("%s.requests_per_minute must be between 1-10000", field))
+		}
+	default:
+		errors = append(errors, fmt.Sprintf("%s.action must be one of: %s, %s, %s, %s, %s", field,
+			EnforcementDeny, EnforcementRedirect, EnforcementTarpit, EnforcementRateLimit, EnforcementLog))
+	}
+
+	if e.Action == EnforcementRedirect {
+		if e.ResponseCode < 300 || e.ResponseCode > 399 {
+			errors = append(errors, fmt.Sprintf("%s.response_code must be 3xx for redirects", field))
+		}
+	} else if e.ResponseCode < 400 || e.ResponseCode > 599 {
+		errors = append(errors, fmt.Sprintf("%s.response_code must be 4xx or 5xx", field))
+	}
+
+	return errors
+}
+
+// GetEnforcement returns how bans of a severity are enforced. Severities
+// without an entry are denied with the ban response.
+func (c *PluginConfig) GetEnforcement(severity string) *EnforcementConfig {
+	if enforcement, ok := c.EnforcementBySeverity[strings.ToLower(severity)]; ok {
+		return &enforcement
+	}
+	return &EnforcementConfig{
+		Action:       EnforcementDeny,
+		ResponseCode: c.BanResponseCode,
+		ResponseBody: c.BanResponseBody,
+	}
+}
+
+// setDefaults fills in missing challenge settings.
+func (ch *ChallengeConfig) setDefaults() {
+	if len(ch.Severities) == 0 {
+		ch.Severities = []string{"low", "medium"}
+	}
+	if ch.Difficulty <= 0 {
+		ch.Difficulty = DefaultChallengeBits
+	}
+	if ch.CookieName == "" {
+		ch.CookieName = DefaultChallengeName
+	}
+	if ch.PassTTLSeconds <= 0 {
+		ch.PassTTLSeconds = DefaultChallengePass
+	}
+	if ch.OnSuccess == "" {
+		ch.OnSuccess = ChallengeOnSuccessDowngrade
+	}
+}
+
+// validate returns the challenge configuration errors.
+func (ch *ChallengeConfig) validate() []string {
+	var errors []string
+
+	if ch.Secret == "" {
+		errors = append(errors, "challenge.secret is required when challenge is enabled")
+	}
+	for _, severity := range ch.Severities {
+		if severityRank[strings.ToLower(severity)] == 0 {
+			errors = append(errors, fmt.Sprintf("challenge.severities: unknown severity %q", severity))
+		}
+	}
+	if ch.Difficulty < 1 || ch.Difficulty > 32 {
+		errors = append(errors, "challenge.difficulty must be between 1-32")
+	}
+	if strings.ContainsAny(ch.CookieName, "=; \t\r\n") {
+		errors = append(errors, "challenge.cookie_name must not contain '=', ';' or whitespace")
+	}
+	if ch.PassTTLSeconds < 60 || ch.PassTTLSeconds > 86400 {
+		errors = append(errors, "challenge.pass_ttl_seconds must be between 60-86400 seconds")
+	}
+	if ch.OnSuccess != ChallengeOnSuccessDowngrade && ch.OnSuccess != ChallengeOnSuccessLift {
+		errors = append(errors, fmt.Sprintf("challenge.on_success must be one of: %s, %s",
+			ChallengeOnSuccessDowngrade, ChallengeOnSuccessLift))
+	}
+
+	return errors
 }
 
-// GetBanTTL returns the appropriate TTL for a given severity
-func (c *PluginConfig) GetBanTTL(severity string) int {
+// GetBanTTL returns the appropriate TTL for a given severity and rule
+// tags: the longest tag TTL, else the severity TTL, else the default.
+func (c *PluginConfig) GetBanTTL(severity string, tags ...string) int {
+	if ttl, ok := maxTagValue(c.BanTTLByTag, tags); ok {
+		return ttl
+	}
 	if ttl, ok := c.BanTTLBySeverity[severity]; ok {
 		return ttl
 	}
 	return c.BanTTLDefault
 }
 
-// GetScore returns the score increment for a given rule ID and severity
-func (c *PluginConfig) GetScore(ruleID, severity string) int {
+// GetBanScope returns the scope type of a ban for a given rule ID and
+// severity: the rule scope, else the severity scope, else the default.
+func (c *PluginConfig) GetBanScope(ruleID, severity string) string {
+	if scope, ok := c.BanScopeRules[ruleID]; ok {
+		return scope
+	}
+	if scope, ok := c.BanScopeBySeverity[severity]; ok {
+		return scope
+	}
+	return c.BanScopeDefault
+}
+
+// ScopedBans returns true if any ban can be scoped, in which case ban
+// checks must look up the host and path scopes as well.
+func (c *PluginConfig) ScopedBans() bool {
+	if c.BanScopeDefault != BanScopeGlobal {
+		return true
+	}
+	for _, scope := range c.BanScopeBySeverity {
+		if scope != BanScopeGlobal {
+			return true
+		}
+	}
+	for _, scope := range c.BanScopeRules {
+		if scope != BanScopeGlobal {
+			return true
+		}
+	}
+	return false
+}
+
+// isBanScope returns true if scope is a known scope type.
+func isBanScope(scope string) bool {
+	return scope == BanScopeGlobal || scope == BanScopeHost || scope == BanScopePath
+}
+
+// ScoreDecay returns the decay curve of scores.
+func (c *PluginConfig) ScoreDecay() *ScoreDecay {
+	return &ScoreDecay{
+		Strategy:        c.ScoreDecayStrategy,
+		IntervalSeconds: c.ScoreDecaySeconds,
+		Rate:            c.ScoreDecayRate,
+		HalfLifeSeconds: c.ScoreDecayHalfLife,
+	}
+}
+
+// GetScore returns the score increment for a given rule ID, severity and
+// rule tags
+func (c *PluginConfig) GetScore(ruleID, severity string, tags ...string) int {
 	// Check rule-specific score first
 	if score, ok := c.ScoreRules[ruleID]; ok {
 		return score
 	}
 
+	// Then the highest tag-based score
+	if score, ok := maxTagValue(c.ScoreByTag, tags); ok {
+		return score
+	}
+
 	// Fall back to severity-based score
 	if score, ok := c.ScoreBySeverity[severity]; ok {
 		return score
@@ -332,6 +2271,50 @@ func (c *PluginConfig) GetScore(ruleID, severity string) int {
 	return 10
 }
 
+// ActionMultiplier returns the score multiplier of a Coraza action, and
+// false if the action does not add to the score. Metadata without an
+// action (e.g., only an anomaly score) counts as "log".
+func (c *PluginConfig) ActionMultiplier(action string) (float64, bool) {
+	if action == "" {
+		action = "log"
+	}
+	multiplier := c.ScoreActions[strings.ToLower(action)]
+	return multiplier, multiplier > 0
+}
+
+// maxTagValue returns the highest value of the tags found in values.
+func maxTagValue(values map[string]int, tags []string) (int, bool) {
+	highest, found := 0, false
+	for _, tag := range tags {
+		if value, ok := values[tag]; ok && (!found || value > highest) {
+			highest, found = value, true
+		}
+	}
+	return highest, found
+}
+
+// CountsTags returns true if a WAF block of a rule with the given tags
+// counts towards bans and scores: none of its tags is excluded and, when
+// tags_include is set, one of its tags is included. Blocks without tags,
+// such as blocks detected from the response status (waf-403), cannot be
+// filtered by tag and always count.
+func (c *PluginConfig) CountsTags(tags []string) bool {
+	for _, tag := range tags {
+		if slices.Contains(c.TagsExclude, tag) {
+			return false
+		}
+	}
+	if len(c.TagsInclude) == 0 || len(tags) == 0 {
+		return true
+	}
+	for _, tag := range tags {
+		if slices.Contains(c.TagsInclude, tag) {
+			return true
+		}
+	}
+	return false
+}
+
 // logLevelPriority maps log level strings to their priority values.
 // Higher values mean more severe/important messages.
 var logLevelPriority = map[string]int{
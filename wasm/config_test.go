@@ -438,3 +438,857 @@ func TestPluginConfig_Validate_BoundaryScoreThreshold(t *testing.T) {
 		t.Errorf("score threshold 10000 should be valid: %v", err)
 	}
 }
+
+func TestPluginConfig_Validate_AdminRequiresGuard(t *testing.T) {
+	config := DefaultConfig()
+	config.Admin.Enabled = true
+
+	err := config.Validate()
+
+	if err == nil {
+		t.Fatal("expected error when admin has no token or allowed_cidrs")
+	}
+	if !strings.Contains(err.Error(), "admin") {
+		t.Errorf("error should mention admin: %v", err)
+	}
+
+	config.Admin.Token = "secret"
+	if err := config.Validate(); err != nil {
+		t.Errorf("admin with token should be valid: %v", err)
+	}
+}
+
+func TestPluginConfig_Validate_AdminInvalidCIDR(t *testing.T) {
+	config := DefaultConfig()
+	config.Admin.Enabled = true
+	config.Admin.AllowedCIDRs = []string{"10.0.0.0/99"}
+
+	err := config.Validate()
+
+	if err == nil || !strings.Contains(err.Error(), "admin.allowed_cidrs") {
+		t.Errorf("expected admin.allowed_cidrs error, got %v", err)
+	}
+}
+
+func TestPluginConfig_validate_AdminDefaults(t *testing.T) {
+	config := &PluginConfig{}
+	config.Admin.TokenHeader = "X-Admin-Token"
+
+	config.validate()
+
+	if config.Admin.PathPrefix != DefaultAdminPrefix {
+		t.Errorf("expected default path prefix, got %s", config.Admin.PathPrefix)
+	}
+	if config.Admin.TokenHeader != "x-admin-token" {
+		t.Errorf("token header should be lower-cased, got %s", config.Admin.TokenHeader)
+	}
+}
+
+func TestPluginConfig_Validate_Allowlist(t *testing.T) {
+	config := DefaultConfig()
+	config.Allowlist.CIDRs = []string{"10.0.0.0/8", "bogus"}
+	config.Allowlist.UserAgents = []string{"[unclosed"}
+	config.Allowlist.BypassHeader = "x-ban-bypass"
+	config.Allowlist.BypassMaxTTLSeconds = 10
+
+	err := config.Validate()
+
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, field := range []string{"allowlist.cidrs", "allowlist.user_agents", "allowlist.bypass_secret", "allowlist.bypass_max_ttl_seconds"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("error should mention %s: %v", field, err)
+		}
+	}
+}
+
+func TestPluginConfig_Validate_Denylist(t *testing.T) {
+	config := DefaultConfig()
+	config.Denylist.CIDRs = []DenylistCIDR{{CIDR: "203.0.113.0/24"}, {CIDR: "300.0.0.0/8"}}
+	config.Denylist.ASNs = []DenylistASN{{ASN: 64496}}
+
+	err := config.Validate()
+
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	if !strings.Contains(err.Error(), "denylist.cidrs") {
+		t.Errorf("error should mention denylist.cidrs: %v", err)
+	}
+	if !strings.Contains(err.Error(), "denylist.asn_header") {
+		t.Errorf("error should mention denylist.asn_header: %v", err)
+	}
+}
+
+func TestPluginConfig_Validate_RedisBackend(t *testing.T) {
+	config := DefaultConfig()
+	if config.RedisBackend != RedisBackendWebdis {
+		t.Errorf("expected default backend %s, got %s", RedisBackendWebdis, config.RedisBackend)
+	}
+
+	config.RedisBackend = RedisBackendRESP
+	if err := config.Validate(); err != nil {
+		t.Errorf("resp backend should be valid: %v", err)
+	}
+
+	config.RedisBackend = "memcached"
+	err := config.Validate()
+	if err == nil || !strings.Contains(err.Error(), "redis_backend") {
+		t.Errorf("expected redis_backend error, got %v", err)
+	}
+}
+
+func TestPluginConfig_Validate_KeyPrefix(t *testing.T) {
+	config := DefaultConfig()
+	config.KeyPrefix = "cbw:prod:gw1:"
+	if err := config.Validate(); err != nil {
+		t.Errorf("prefix should be valid: %v", err)
+	}
+
+	for _, prefix := range []string{"cbw/prod", "cbw prod", "cbw%2F", "cbw?", "cbw#"} {
+		config.KeyPrefix = prefix
+		err := config.Validate()
+		if err == nil || !strings.Contains(err.Error(), "key_prefix") {
+			t.Errorf("%q: expected key_prefix error, got %v", prefix, err)
+		}
+	}
+}
+
+func TestPluginConfig_Validate_RedisFailureHandling(t *testing.T) {
+	config := DefaultConfig()
+	if config.RedisFailureMode != RedisFailureModeOpen {
+		t.Errorf("expected default failure mode %s, got %s", RedisFailureModeOpen, config.RedisFailureMode)
+	}
+	if !config.CircuitBreaker.Enabled {
+		t.Error("circuit breaker should be enabled by default")
+	}
+
+	config.RedisFailureMode = RedisFailureModeClosed
+	if err := config.Validate(); err != nil {
+		t.Errorf("closed failure mode should be valid: %v", err)
+	}
+
+	config.RedisFailureMode = "sometimes"
+	config.RedisTimeoutMs = 0
+	config.CircuitBreaker.FailureThreshold = 0
+	config.CircuitBreaker.ProbeIntervalMs = 10
+
+	err := config.Validate()
+
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, field := range []string{"redis_failure_mode", "redis_timeout_ms", "failure_threshold", "probe_interval_ms"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("error should mention %s: %v", field, err)
+		}
+	}
+}
+
+func TestPluginConfig_JSONParsing_RedisFailureDefaults(t *testing.T) {
+	config := DefaultConfig()
+	err := json.Unmarshal([]byte(`{"redis_timeout_ms": -1, "circuit_breaker": {"failure_threshold": 0}}`), config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	config.validate()
+
+	if config.RedisTimeoutMs != DefaultRedisTimeout {
+		t.Errorf("expected timeout %d, got %d", DefaultRedisTimeout, config.RedisTimeoutMs)
+	}
+	if config.CircuitBreaker.FailureThreshold != DefaultBreakerFails {
+		t.Errorf("expected threshold %d, got %d", DefaultBreakerFails, config.CircuitBreaker.FailureThreshold)
+	}
+	if !config.CircuitBreaker.Enabled {
+		t.Error("circuit breaker should stay enabled when not set")
+	}
+}
+
+func TestPluginConfig_Validate_Webhook(t *testing.T) {
+	config := DefaultConfig()
+	config.Webhook.Cluster = "siem"
+	config.Webhook.setDefaults()
+	if err := config.Validate(); err != nil {
+		t.Errorf("webhook with defaults should be valid: %v", err)
+	}
+	if config.Webhook.MaxRetries != DefaultWebhookRetries {
+		t.Errorf("expected max_retries=%d, got %d", DefaultWebhookRetries, config.Webhook.MaxRetries)
+	}
+
+	config.Webhook.Path = "ingest"
+	config.Webhook.EventTypes = []string{"issued", "paged"}
+	config.Webhook.BatchSize = 5000
+
+	err := config.Validate()
+
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, field := range []string{"webhook.path", "webhook.event_types", "webhook.batch_size"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("error should mention %s: %v", field, err)
+		}
+	}
+}
+
+func TestPluginConfig_Validate_EventSinks(t *testing.T) {
+	config := DefaultConfig()
+	config.EventSinks = []EventSinkConfig{
+		{Type: EventSinkLog, EventTypes: []string{"issued"}, MinSeverity: "high"},
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("log sink should be valid: %v", err)
+	}
+
+	config.RedisCluster = ""
+	config.EventSinks = []EventSinkConfig{
+		{Type: "pagerduty"},
+		{Type: EventSinkWebhook},
+		{Type: EventSinkRedisStream, Stream: "ban-events"},
+		{Type: EventSinkLog, EventTypes: []string{"paged"}, MinSeverity: "urgent"},
+		{Type: EventSinkRedisStream, Stream: "ban-events?x"},
+	}
+
+	err := config.Validate()
+
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, msg := range []string{
+		"event_sinks[0]: type",
+		"event_sinks[1]: webhook sink requires webhook.cluster",
+		"event_sinks[2]: redis_stream sink requires redis_cluster",
+		"event_sinks[3]: unknown event type",
+		"event_sinks[3]: min_severity",
+		"event_sinks[4]: stream must be non-empty",
+	} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("error should mention %q: %v", msg, err)
+		}
+	}
+}
+
+func TestPluginConfig_DefaultEventSinks(t *testing.T) {
+	config := DefaultConfig()
+	config.Webhook.Cluster = "siem"
+
+	sinks := config.DefaultEventSinks()
+
+	if len(sinks) != 3 || sinks[0].Type != EventSinkLog || sinks[1].Type != EventSinkMetrics || sinks[2].Type != EventSinkWebhook {
+		t.Errorf("unexpected default sinks: %+v", sinks)
+	}
+}
+
+func TestPluginConfig_Validate_BanSweepInterval(t *testing.T) {
+	config := DefaultConfig()
+	config.BanSweepSeconds = 7200
+
+	err := config.Validate()
+	if err == nil || !strings.Contains(err.Error(), "ban_sweep_interval_seconds") {
+		t.Errorf("expected ban_sweep_interval_seconds error, got %v", err)
+	}
+
+	config.BanSweepSeconds = 0
+	config.validate()
+	if config.BanSweepSeconds != DefaultBanSweep {
+		t.Errorf("expected default sweep %d, got %d", DefaultBanSweep, config.BanSweepSeconds)
+	}
+}
+
+func TestEscalationConfig_BanTTL_Ladder(t *testing.T) {
+	escalation := EscalationConfig{Enabled: true, Ladder: []int{600, 3600, 86400, 604800}}
+
+	tests := []struct {
+		offenses int
+		expected int
+	}{
+		{0, 300},
+		{1, 600},
+		{2, 3600},
+		{3, 86400},
+		{4, 604800},
+		{10, 604800},
+	}
+
+	for _, tt := range tests {
+		if got := escalation.BanTTL(300, tt.offenses); got != tt.expected {
+			t.Errorf("BanTTL(300, %d) = %d, want %d", tt.offenses, got, tt.expected)
+		}
+	}
+}
+
+func TestEscalationConfig_BanTTL_Multiplier(t *testing.T) {
+	escalation := EscalationConfig{Enabled: true, Multiplier: 3, MaxTTL: 5000}
+
+	tests := []struct {
+		baseTTL  int
+		offenses int
+		expected int
+	}{
+		{600, 1, 600},
+		{600, 2, 1800},
+		{600, 3, 5000},
+		{600, 8, 5000},
+		{7200, 1, 7200}, // the cap never shortens the severity TTL
+		{7200, 2, 7200},
+	}
+
+	for _, tt := range tests {
+		if got := escalation.BanTTL(tt.baseTTL, tt.offenses); got != tt.expected {
+			t.Errorf("BanTTL(%d, %d) = %d, want %d", tt.baseTTL, tt.offenses, got, tt.expected)
+		}
+	}
+}
+
+func TestEscalationConfig_BanTTL_Disabled(t *testing.T) {
+	escalation := EscalationConfig{Ladder: []int{3600}}
+
+	if got := escalation.BanTTL(600, 5); got != 600 {
+		t.Errorf("expected base TTL when disabled, got %d", got)
+	}
+}
+
+func TestPluginConfig_Validate_Escalation(t *testing.T) {
+	config := DefaultConfig()
+	err := json.Unmarshal([]byte(`{"escalation": {"enabled": true, "ladder": [600, 0], "multiplier": 200}}`), config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config.validate()
+
+	if config.Escalation.WindowSeconds != DefaultOffenseWindow {
+		t.Errorf("expected window %d, got %d", DefaultOffenseWindow, config.Escalation.WindowSeconds)
+	}
+
+	err = config.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, field := range []string{"escalation.ladder[1]", "escalation.multiplier"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("error should mention %s: %v", field, err)
+		}
+	}
+}
+
+func TestPluginConfig_Validate_Challenge(t *testing.T) {
+	config := DefaultConfig()
+	err := json.Unmarshal([]byte(`{"challenge": {"enabled": true, "severities": ["low", "urgent"], "on_success": "allow"}}`), config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config.validate()
+
+	if config.Challenge.Difficulty != DefaultChallengeBits || config.Challenge.CookieName != DefaultChallengeName {
+		t.Errorf("expected challenge defaults, got %+v", config.Challenge)
+	}
+
+	err = config.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, field := range []string{"challenge.secret", "challenge.severities", "challenge.on_success"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("error should mention %s: %v", field, err)
+		}
+	}
+}
+
+func TestPluginConfig_Validate_Enforcement(t *testing.T) {
+	config := DefaultConfig()
+	err := json.Unmarshal([]byte(`{"enforcement_by_severity": {
+		"urgent": {"action": "deny"},
+		"critical": {"action": "block"},
+		"high": {"action": "redirect", "redirect_url": "example.com"},
+		"medium": {"action": "tarpit", "tarpit_seconds": 600},
+		"low": {"action": "rate_limit"}
+	}}`), config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config.validate()
+
+	err = config.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, expected := range []string{
+		"enforcement_by_severity[urgent]: unknown severity",
+		"enforcement_by_severity[critical].action",
+		"enforcement_by_severity[high].redirect_url",
+		"enforcement_by_severity[medium].tarpit_seconds",
+		"enforcement_by_severity[low].requests_per_minute",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("error should mention %s: %v", expected, err)
+		}
+	}
+}
+
+func TestPluginConfig_Validate_ResponseTemplates(t *testing.T) {
+	config := DefaultConfig()
+	config.BanResponseTemplates.JSON = `{"status": {{status}}, "reference": "{{reference}}"}`
+	if err := config.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	config.BanResponseTemplates.JSON = `{"status": {{status}}`
+	err := config.Validate()
+	if err == nil || !strings.Contains(err.Error(), "ban_response_templates.json") {
+		t.Errorf("expected invalid JSON template error, got %v", err)
+	}
+
+	// Placeholders other than numbers must be quoted
+	config.BanResponseTemplates.JSON = `{"status": {{status}}, "rule": {{rule_id}}}`
+	err = config.Validate()
+	if err == nil || !strings.Contains(err.Error(), "{{rule_id}}") {
+		t.Errorf("expected unquoted placeholder error, got %v", err)
+	}
+}
+
+func TestPluginConfig_Validate_Policies(t *testing.T) {
+	config := DefaultConfig()
+	err := json.Unmarshal([]byte(`{"policies": [
+		{"name": "all"},
+		{"path_prefix": "login", "path_regex": "(", "fingerprint_mode": "ja3", "score_rules": {"942100": 0}}
+	]}`), config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config.validate()
+
+	err = config.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, expected := range []string{
+		"policies[0] requires",
+		"policies[1].path_prefix",
+		"policies[1].path_regex",
+		"policies[1].fingerprint_mode",
+		"policies[1].score_rules[942100]",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("error should mention %s: %v", expected, err)
+		}
+	}
+}
+
+func TestPluginConfig_GetBanScope(t *testing.T) {
+	config := DefaultConfig()
+	if config.ScopedBans() {
+		t.Error("default config should not scope bans")
+	}
+
+	config.BanScopeBySeverity = map[string]string{"medium": BanScopeHost}
+	config.BanScopeRules = map[string]string{"930120": BanScopePath}
+
+	if !config.ScopedBans() {
+		t.Error("expected scoped bans")
+	}
+	if scope := config.GetBanScope("930120", "medium"); scope != BanScopePath {
+		t.Errorf("rule scope should win, got %s", scope)
+	}
+	if scope := config.GetBanScope("942100", "medium"); scope != BanScopeHost {
+		t.Errorf("expected severity scope, got %s", scope)
+	}
+	if scope := config.GetBanScope("942100", "critical"); scope != BanScopeGlobal {
+		t.Errorf("expected default scope, got %s", scope)
+	}
+}
+
+func TestPluginConfig_Validate_BanScope(t *testing.T) {
+	config := DefaultConfig()
+	config.BanScopeDefault = "tenant"
+	config.BanScopeBySeverity = map[string]string{"high": "site"}
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, expected := range []string{"ban_scope_default", "ban_scope_by_severity[high]"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("error should mention %s: %v", expected, err)
+		}
+	}
+}
+
+func TestPluginConfig_Validate_Signals(t *testing.T) {
+	config := DefaultConfig()
+	err := json.Unmarshal([]byte(`{"signals": {
+		"request_rate": {"threshold": 600, "score": 20},
+		"not_found": {"score": 30, "severity": "urgent"}
+	}}`), config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config.validate()
+
+	if config.Signals.RequestRate.WindowSeconds != DefaultSignalWindow || config.Signals.RequestRate.Severity != DefaultSignalSeverity {
+		t.Errorf("expected signal defaults, got %+v", config.Signals.RequestRate)
+	}
+
+	err = config.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, expected := range []string{
+		"signals require scoring_enabled",
+		"signals.not_found.threshold",
+		"signals.not_found.severity",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("error should mention %s: %v", expected, err)
+		}
+	}
+
+	config.ScoringEnabled = true
+	config.Signals.NotFound = SignalConfig{}
+	config.validate()
+	if err := config.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPluginConfig_Validate_ScoreDecay(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoreDecayStrategy = "sigmoid"
+	err := config.Validate()
+	if err == nil || !strings.Contains(err.Error(), "score_decay_strategy") {
+		t.Errorf("expected unknown strategy error, got %v", err)
+	}
+
+	// Step decay allows quiet periods longer than an hour
+	config.ScoreDecayStrategy = ScoreDecayStep
+	config.ScoreDecaySeconds = 86400
+	if err := config.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	config.ScoreDecayStrategy = ScoreDecayLinear
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "score_decay_seconds") {
+		t.Errorf("expected score_decay_seconds error, got %v", err)
+	}
+}
+
+func TestPluginConfig_ScoreDecay(t *testing.T) {
+	config := DefaultConfig()
+	err := json.Unmarshal([]byte(`{"score_decay_strategy": "Exponential", "score_decay_half_life_seconds": 1800}`), config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config.validate()
+
+	decay := config.ScoreDecay()
+	if decay.Strategy != ScoreDecayExponential || decay.HalfLifeSeconds != 1800 || decay.Rate != DefaultScoreDecayRate {
+		t.Errorf("unexpected decay: %+v", decay)
+	}
+}
+
+func TestPluginConfig_Validate_ScoreSource(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoreSource = ScoreSourceRedis
+	config.RedisCluster = ""
+	err := config.Validate()
+	if err == nil || !strings.Contains(err.Error(), "redis_cluster") {
+		t.Errorf("expected redis_cluster error, got %v", err)
+	}
+
+	config.RedisCluster = "redis_cluster"
+	if err := config.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	config.ScoreSource = "memcached"
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "score_source") {
+		t.Errorf("expected score_source error, got %v", err)
+	}
+}
+
+func TestPluginConfig_GetScore_ByTag(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoreRules = map[string]int{"942100": 90}
+	config.ScoreByTag = map[string]int{"attack-sqli": 60, "attack-protocol": 5}
+
+	tests := []struct {
+		ruleID   string
+		tags     []string
+		expected int
+	}{
+		{"942100", []string{"attack-sqli"}, 90},                    // Rule-specific takes precedence
+		{"942110", []string{"OWASP_CRS", "attack-sqli"}, 60},       // Tag score
+		{"942110", []string{"attack-protocol", "attack-sqli"}, 60}, // Highest tag score
+		{"920100", []string{"OWASP_CRS"}, 40},                      // Falls back to severity
+	}
+
+	for _, tt := range tests {
+		if score := config.GetScore(tt.ruleID, "high", tt.tags...); score != tt.expected {
+			t.Errorf("GetScore(%s, high, %v) = %d, expected %d", tt.ruleID, tt.tags, score, tt.expected)
+		}
+	}
+}
+
+func TestPluginConfig_GetBanTTL_ByTag(t *testing.T) {
+	config := DefaultConfig()
+	config.BanTTLBySeverity = map[string]int{"critical": 3600}
+	config.BanTTLByTag = map[string]int{"attack-sqli": 7200, "attack-rce": 86400}
+
+	if ttl := config.GetBanTTL("critical", "attack-sqli", "attack-rce"); ttl != 86400 {
+		t.Errorf("expected longest tag TTL 86400, got %d", ttl)
+	}
+	if ttl := config.GetBanTTL("critical", "OWASP_CRS"); ttl != 3600 {
+		t.Errorf("expected severity TTL 3600, got %d", ttl)
+	}
+}
+
+func TestPluginConfig_CountsTags(t *testing.T) {
+	config := DefaultConfig()
+	if !config.CountsTags(nil) {
+		t.Error("every block should count without tag filters")
+	}
+
+	config.TagsInclude = []string{"attack-sqli", "attack-xss"}
+	config.TagsExclude = []string{"paranoia-level/4"}
+
+	tests := []struct {
+		tags     []string
+		expected bool
+	}{
+		{[]string{"OWASP_CRS", "attack-sqli"}, true},
+		{[]string{"attack-sqli", "paranoia-level/4"}, false}, // Exclusion wins
+		{[]string{"attack-protocol"}, false},
+		{nil, true}, // Untagged blocks cannot be filtered by tag
+	}
+
+	for _, tt := range tests {
+		if got := config.CountsTags(tt.tags); got != tt.expected {
+			t.Errorf("CountsTags(%v) = %v, expected %v", tt.tags, got, tt.expected)
+		}
+	}
+}
+
+func TestPluginConfig_Validate_Tags(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoreByTag = map[string]int{"attack-sqli": 0}
+	config.BanTTLByTag = map[string]int{"attack-rce": 100000}
+	config.TagsExclude = []string{""}
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, field := range []string{"score_by_tag", "ban_ttl_by_tag", "tags_exclude"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("expected %s error, got %v", field, err)
+		}
+	}
+}
+
+func TestPluginConfig_Validate_ScoreAggregation(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoreAggregation = "Distinct"
+	config.validate()
+	if config.ScoreAggregation != ScoreAggregationDistinct {
+		t.Errorf("expected normalized aggregation, got %s", config.ScoreAggregation)
+	}
+
+	config.ScoreAggregation = "avg"
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "score_aggregation") {
+		t.Errorf("expected score_aggregation error, got %v", err)
+	}
+}
+
+func TestAnomalyScoringConfig_Increment(t *testing.T) {
+	anomaly := AnomalyScoringConfig{Multiplier: 2.5, MinAnomalyScore: 3, MaxIncrement: 100}
+
+	tests := []struct {
+		anomalyScore int
+		expected     int
+	}{
+		{2, 0},    // Below the minimum
+		{3, 8},    // 7.5 rounded
+		{10, 25},  // Scaled
+		{50, 100}, // Capped
+	}
+
+	for _, tt := range tests {
+		if got := anomaly.Increment(tt.anomalyScore); got != tt.expected {
+			t.Errorf("Increment(%d) = %d, expected %d", tt.anomalyScore, got, tt.expected)
+		}
+	}
+}
+
+func TestPluginConfig_Validate_ScoreMode(t *testing.T) {
+	config := DefaultConfig()
+	err := json.Unmarshal([]byte(`{"score_mode": "Anomaly", "anomaly_scoring": {"multiplier": 0.5}}`), config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config.validate()
+	if config.ScoreMode != ScoreModeAnomaly || config.AnomalyScoring.MaxIncrement != DefaultAnomalyMaxIncr {
+		t.Errorf("unexpected anomaly scoring: %s %+v", config.ScoreMode, config.AnomalyScoring)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	config.AnomalyScoring.MaxIncrement = 5000
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "anomaly_scoring.max_increment") {
+		t.Errorf("expected max_increment error, got %v", err)
+	}
+
+	config.ScoreMode = "crs"
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "score_mode") {
+		t.Errorf("expected score_mode error, got %v", err)
+	}
+}
+
+func TestPluginConfig_ScoreActions(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoreActions = nil
+	config.validate()
+	if _, ok := config.ActionMultiplier("log"); ok {
+		t.Error("logged detections should not score by default in rules mode")
+	}
+	if multiplier, ok := config.ActionMultiplier("Block"); !ok || multiplier != 1 {
+		t.Errorf("expected block multiplier 1, got %v", multiplier)
+	}
+
+	config = DefaultConfig()
+	config.ScoreMode = ScoreModeAnomaly
+	config.ScoreActions = nil
+	config.validate()
+	if _, ok := config.ActionMultiplier(""); !ok {
+		t.Error("metadata without action should count as log in anomaly mode")
+	}
+}
+
+func TestPluginConfig_Validate_ScoreActions(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoreActions = map[string]float64{"LOG": 0.5, "redirect": 1, "block": 20}
+	config.validate()
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	if !strings.Contains(err.Error(), "score_actions[redirect] must be one of") {
+		t.Errorf("expected unknown action error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "score_actions[block] must be between 0-10") {
+		t.Errorf("expected multiplier error, got %v", err)
+	}
+	if strings.Contains(err.Error(), "score_actions[log]") {
+		t.Errorf("expected lowercased log action to be valid, got %v", err)
+	}
+}
+
+func TestWAFDetectionConfig_MarkBlocked(t *testing.T) {
+	config := DefaultConfig()
+	config.WAFDetection.RuleID = "waf-block"
+	config.WAFDetection.Severity = "high"
+
+	metadata := config.WAFDetection.MarkBlocked(nil)
+	if !metadata.IsBlocked() || metadata.RuleID != "waf-block" || metadata.Severity != "high" {
+		t.Errorf("unexpected synthetic metadata: %+v", metadata)
+	}
+
+	// Metadata without action keeps what it has
+	metadata = config.WAFDetection.MarkBlocked(&CorazaMetadata{InboundAnomalyScore: 10, Severity: "critical"})
+	if !metadata.IsBlocked() || metadata.Severity != "critical" || metadata.AnomalyScore() != 10 {
+		t.Errorf("unexpected marked metadata: %+v", metadata)
+	}
+}
+
+func TestPluginConfig_Validate_WAFDetection(t *testing.T) {
+	config := DefaultConfig()
+	err := json.Unmarshal([]byte(`{"waf_detection": {"block_headers": {"X-WAF-Block": ""}, "status_fallback": false}}`), config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config.validate()
+	if _, ok := config.WAFDetection.BlockHeaders["x-waf-block"]; !ok || config.WAFDetection.FallbackEnabled() {
+		t.Errorf("unexpected WAF detection: %+v", config.WAFDetection)
+	}
+	if len(config.WAFDetection.MetadataPaths) != 3 {
+		t.Errorf("expected default metadata paths, got %v", config.WAFDetection.MetadataPaths)
+	}
+
+	config.WAFDetection.StatusCodes = []int{4030}
+	config.WAFDetection.Severity = "urgent"
+	config.WAFDetection.MetadataPaths = [][]string{{"metadata", ""}}
+	err = config.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, field := range []string{"status_codes", "severity", "metadata_paths"} {
+		if !strings.Contains(err.Error(), "waf_detection."+field) {
+			t.Errorf("expected %s error, got %v", field, err)
+		}
+	}
+}
+
+func TestPluginConfig_GetMetadataSources(t *testing.T) {
+	config := DefaultConfig()
+	config.validate()
+
+	// Without metadata_sources, WAF detection paths and x-coraza-* headers
+	sources := config.GetMetadataSources()
+	if len(sources) != len(config.WAFDetection.MetadataPaths)+1 {
+		t.Fatalf("unexpected default sources: %+v", sources)
+	}
+	if sources[0].Type != MetadataSourceProperty || sources[0].Format != MetadataFormatAuto {
+		t.Errorf("unexpected path source: %+v", sources[0])
+	}
+	if last := sources[len(sources)-1]; last.Type != MetadataSourceResponseHeader || last.Fields["rule_id"] != "x-coraza-rule-id" {
+		t.Errorf("unexpected header source: %+v", last)
+	}
+
+	err := json.Unmarshal([]byte(`{"metadata_sources": [
+		{"type": "Response_Header", "fields": {"action": "X-WAF-Action"}}
+	]}`), config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config.validate()
+	sources = config.GetMetadataSources()
+	if len(sources) != 1 || sources[0].Type != MetadataSourceResponseHeader ||
+		sources[0].Format != MetadataFormatAuto || sources[0].Fields["action"] != "x-waf-action" {
+		t.Errorf("unexpected configured sources: %+v", sources)
+	}
+}
+
+func TestPluginConfig_Validate_MetadataSources(t *testing.T) {
+	config := DefaultConfig()
+	config.MetadataSources = []MetadataSourceConfig{
+		{Type: "filter_metadata", Path: []string{"envoy.filters.http.coraza", "waf"}, Format: "struct"},
+		{Type: "request_header", Header: "x-waf-result", Format: "kv"},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		source MetadataSourceConfig
+		field  string
+	}{
+		{"unknown type", MetadataSourceConfig{Type: "cookie"}, "metadata_sources[0].type"},
+		{"missing path", MetadataSourceConfig{Type: "property"}, "metadata_sources[0].path"},
+		{"empty segment", MetadataSourceConfig{Type: "property", Path: []string{"metadata", ""}}, "metadata_sources[0].path"},
+		{"header without name", MetadataSourceConfig{Type: "response_header"}, "requires header or fields"},
+		{"unknown format", MetadataSourceConfig{Type: "response_header", Header: "x-waf", Format: "xml"}, "metadata_sources[0].format"},
+		{"unknown field", MetadataSourceConfig{Type: "response_header", Fields: map[string]string{"score": "x-score"}}, "fields[score]"},
+	}
+
+	for _, tt := range tests {
+		config := DefaultConfig()
+		config.MetadataSources = []MetadataSourceConfig{tt.source}
+		err := config.Validate()
+		if err == nil || !strings.Contains(err.Error(), tt.field) {
+			t.Errorf("%s: expected %s error, got %v", tt.name, tt.field, err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"time"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+)
+
+// maxTarpitRequests caps the requests a worker holds in the tarpit, so that
+// a flood of banned requests cannot hold an unbounded number of streams.
+const maxTarpitRequests = 1000
+
+// enforceBan answers the request of a banned client with the enforcement
+// of its ban severity. Returns false if the request may proceed instead
+// (log, rate limit not reached).
+func (ctx *httpContext) enforceBan() bool {
+	decision := ctx.enforcementService.Decide(ctx.fingerprint, ctx.banEntry)
+	ctx.enforcement = decision.EnforcementConfig
+
+	result := "deny"
+	if decision.Allow {
+		result = "allow"
+	}
+	ctx.pluginContext.metrics.Increment(metricName(metricEnforcements, "action", decision.Action, "result", result), 1)
+
+	if decision.Allow {
+		ctx.logInfo("letting banned fingerprint %s through (enforcement=%s)", ctx.fingerprint, decision.Action)
+		return false
+	}
+
+	switch decision.Action {
+	case EnforcementRedirect:
+		ctx.logInfo("redirecting banned fingerprint %s to %s", ctx.fingerprint, decision.RedirectURL)
+		ctx.sendBanResponse(decision.ResponseCode, [][2]string{{"location", decision.RedirectURL}}, "")
+	case EnforcementTarpit:
+		if !ctx.pluginContext.holdTarpit(ctx, time.Duration(decision.TarpitSeconds)*time.Second) {
+			ctx.logWarn("tarpit full, denying request for banned fingerprint %s", ctx.fingerprint)
+			ctx.sendDenial(decision.ResponseCode, decision.ResponseBody)
+			break
+		}
+		ctx.logInfo("tarpitting banned fingerprint %s for %ds", ctx.fingerprint, decision.TarpitSeconds)
+	default:
+		ctx.logInfo("denying request for banned fingerprint %s", ctx.fingerprint)
+		ctx.sendDenial(decision.ResponseCode, decision.ResponseBody)
+	}
+
+	return true
+}
+
+// sendDenial answers the request with the ban response negotiated from
+// the Accept header. text is the plain text template.
+func (ctx *httpContext) sendDenial(code int, text string) {
+	data := &BanResponseData{
+		Status:      code,
+		Entry:       ctx.banEntry,
+		Fingerprint: ctx.fingerprint,
+	}
+	if requestID, err := proxywasm.GetHttpRequestHeader("x-request-id"); err == nil {
+		data.RequestID = requestID
+	}
+
+	accept, _ := proxywasm.GetHttpRequestHeader("accept")
+	headers, body := ctx.pluginContext.responses.Render(accept, text, data)
+	ctx.sendBanResponse(code, headers, string(body))
+}
+
+// sendBanResponse answers the request locally.
+func (ctx *httpContext) sendBanResponse(code int, headers [][2]string, body string) {
+	headers = append(headers, [2]string{"x-ban-reason", "coraza-ban-wasm"})
+
+	if err := proxywasm.SendHttpResponse(uint32(code), headers, []byte(body), -1); err != nil {
+		ctx.logError("failed to send deny response: %v", err)
+	}
+}
+
+// holdTarpit keeps a request paused until OnTick releases it with a denial.
+// Tarpit delays have the granularity of the plugin tick. Returns false,
+// without holding the request, when maxTarpitRequests are already held.
+func (ctx *pluginContext) holdTarpit(httpCtx *httpContext, delay time.Duration) bool {
+	if len(ctx.tarpit) >= maxTarpitRequests {
+		return false
+	}
+	httpCtx.tarpitUntil = time.Now().Add(delay)
+	ctx.tarpit[httpCtx.contextID] = httpCtx
+	return true
+}
+
+// dropTarpit forgets a tarpitted request whose stream ended early,
+// e.g., because the client gave up.
+func (ctx *pluginContext) dropTarpit(contextID uint32) {
+	delete(ctx.tarpit, contextID)
+}
+
+// releaseTarpit denies the tarpitted requests whose delay is over.
+func (ctx *pluginContext) releaseTarpit(now time.Time) {
+	for contextID, httpCtx := range ctx.tarpit {
+		if now.Before(httpCtx.tarpitUntil) {
+			continue
+		}
+		delete(ctx.tarpit, contextID)
+
+		if err := proxywasm.SetEffectiveContext(contextID); err != nil {
+			ctx.logger.Error("failed to release tarpitted request %d: %v", contextID, err)
+			continue
+		}
+		httpCtx.sendDenial(httpCtx.enforcement.ResponseCode, httpCtx.enforcement.ResponseBody)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+// maxStreamBuffer caps the events a stream sink queues between flushes.
+const maxStreamBuffer = 1000
+
+// maxStreamFlush caps the appends a stream sink dispatches per flush, so
+// that a burst of events does not fire a thousand Redis calls in one tick.
+const maxStreamFlush = 100
+
+// =============================================================================
+// Redis Stream Event Handler
+// =============================================================================
+
+// RedisStreamEventHandler appends ban events as JSON to a Redis stream so
+// that several consumers (SIEM, alerting, dashboards) can read them with
+// consumer groups.
+//
+// Like WebhookEventHandler, the handler is shared by all requests of a
+// worker and only dispatches from Flush, called from the plugin's OnTick:
+// Redis calls dispatched from a request context are cancelled by Envoy
+// when the request completes.
+type RedisStreamEventHandler struct {
+	client RedisClient
+	stream string
+	maxLen int
+	logger Logger
+	buffer []string
+}
+
+// NewRedisStreamEventHandler creates a handler appending to stream.
+func NewRedisStreamEventHandler(client RedisClient, stream string, maxLen int, logger Logger) *RedisStreamEventHandler {
+	return &RedisStreamEventHandler{
+		client: client,
+		stream: stream,
+		maxLen: maxLen,
+		logger: logger,
+	}
+}
+
+// OnBanEvent queues the event for the next flush.
+func (h *RedisStreamEventHandler) OnBanEvent(event *BanEvent) {
+	payload, err := event.ToJSON()
+	if err != nil {
+		h.logger.Error("failed to serialize ban event: %v", err)
+		return
+	}
+
+	h.buffer = append(h.buffer, string(payload))
+	if overflow := len(h.buffer) - maxStreamBuffer; overflow > 0 {
+		h.logger.Warn("stream %s buffer full, dropping %d oldest events", h.stream, overflow)
+		h.buffer = h.buffer[overflow:]
+	}
+}
+
+// Flush appends up to maxStreamFlush queued events to the stream, oldest
+// first. The rest stay queued for the next flush.
+func (h *RedisStreamEventHandler) Flush() {
+	count := len(h.buffer)
+	if count > maxStreamFlush {
+		count = maxStreamFlush
+	}
+
+	for _, payload := range h.buffer[:count] {
+		h.client.AppendStreamAsync(h.stream, h.maxLen, payload)
+	}
+	h.buffer = h.buffer[count:]
+	if len(h.buffer) == 0 {
+		h.buffer = nil
+	}
+}
+
+// Pending returns the number of queued events not yet appended.
+func (h *RedisStreamEventHandler) Pending() int {
+	return len(h.buffer)
+}
+
+// NewRedisStreamEventHandlers creates the shared handlers of the
+// redis_stream sinks, one per stream.
+func NewRedisStreamEventHandlers(config *PluginConfig, client RedisClient, logger Logger) map[string]*RedisStreamEventHandler {
+	streams := make(map[string]*RedisStreamEventHandler)
+	for _, sink := range config.EventSinks {
+		if sink.Type == EventSinkRedisStream && streams[sink.Stream] == nil {
+			streams[sink.Stream] = NewRedisStreamEventHandler(client, sink.Stream, sink.MaxLen, logger)
+		}
+	}
+	return streams
+}
+
+// =============================================================================
+// Event Sink Routing
+// =============================================================================
+
+// EventSinkHandlers holds the shared handlers event sinks can route to.
+// Webhook is nil when no webhook is configured; Streams holds the
+// handlers of the redis_stream sinks by stream.
+type EventSinkHandlers struct {
+	Logger  Logger
+	Metrics MetricsRecorder
+	Webhook *WebhookEventHandler
+	Streams map[string]*RedisStreamEventHandler
+}
+
+// NewEventSinkHandler builds the event handler for the configured sinks.
+// Each sink is wrapped with its own event type and severity filter.
+// Falls back to DefaultEventSinks when event_sinks is not set, and
+// returns a NoopEventHandler when events are disabled.
+func NewEventSinkHandler(config *PluginConfig, deps *EventSinkHandlers) EventHandler {
+	if !config.EventsEnabled {
+		return NewNoopEventHandler()
+	}
+
+	sinks := config.EventSinks
+	if len(sinks) == 0 {
+		sinks = config.DefaultEventSinks()
+	}
+
+	handlers := make([]EventHandler, 0, len(sinks))
+	for _, sink := range sinks {
+		var handler EventHandler
+		switch sink.Type {
+		case EventSinkLog:
+			handler = NewLoggingEventHandler(deps.Logger)
+		case EventSinkMetrics:
+			handler = NewMetricsEventHandler(deps.Metrics)
+		case EventSinkWebhook:
+			if deps.Webhook == nil {
+				continue
+			}
+			handler = deps.Webhook
+		case EventSinkRedisStream:
+			stream := deps.Streams[sink.Stream]
+			if stream == nil {
+				continue
+			}
+			handler = stream
+		default:
+			continue
+		}
+
+		if len(sink.EventTypes) > 0 || sink.MinSeverity != "" {
+			handler = NewFilteredEventHandler(handler, NewEventFilter(sink.EventTypes, sink.MinSeverity))
+		}
+		handlers = append(handlers, handler)
+	}
+
+	if len(handlers) == 1 {
+		return handlers[0]
+	}
+	return NewMultiEventHandler(handlers...)
+}
+
+// =============================================================================
+// Compile-Time Interface Verification
+// =============================================================================
+
+var _ EventHandler = (*RedisStreamEventHandler)(nil)
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestSinkHandlers(config *PluginConfig) (*EventSinkHandlers, *MockMetricsRecorder, *MockRedisClient) {
+	metrics := NewMockMetricsRecorder()
+	redis := NewMockRedisClient(true)
+	return &EventSinkHandlers{
+		Logger:  NewMockLogger(),
+		Metrics: metrics,
+		Streams: NewRedisStreamEventHandlers(config, redis, NewMockLogger()),
+	}, metrics, redis
+}
+
+func TestRedisStreamEventHandler_OnBanEvent(t *testing.T) {
+	redis := NewMockRedisClient(true)
+	handler := NewRedisStreamEventHandler(redis, "ban-events", 100, NewMockLogger())
+
+	handler.OnBanEvent(NewBanEvent(BanEventIssued, "fp", "930120", "critical", "local"))
+
+	// Events are only appended on flush, from the plugin context
+	if len(redis.Streams["ban-events"]) != 0 || handler.Pending() != 1 {
+		t.Fatal("expected the event to be buffered until flush")
+	}
+	handler.Flush()
+
+	entries := redis.Streams["ban-events"]
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 stream entry, got %d", len(entries))
+	}
+	if !strings.Contains(entries[0], `"fingerprint":"fp"`) {
+		t.Errorf("stream entry should contain the event JSON: %s", entries[0])
+	}
+}
+
+func TestRedisStreamEventHandler_BufferFull(t *testing.T) {
+	redis := NewMockRedisClient(true)
+	handler := NewRedisStreamEventHandler(redis, "ban-events", 100, NewMockLogger())
+
+	for i := 0; i < maxStreamBuffer+5; i++ {
+		handler.OnBanEvent(NewBanEvent(BanEventIssued, "fp", "930120", "critical", "local"))
+	}
+	if handler.Pending() != maxStreamBuffer {
+		t.Errorf("expected buffer capped at %d, got %d", maxStreamBuffer, handler.Pending())
+	}
+
+	// Each flush appends at most maxStreamFlush events and keeps the rest
+	handler.Flush()
+	if len(redis.Streams["ban-events"]) != maxStreamFlush || handler.Pending() != maxStreamBuffer-maxStreamFlush {
+		t.Errorf("expected %d appended events, got %d", maxStreamFlush, len(redis.Streams["ban-events"]))
+	}
+
+	for handler.Pending() > 0 {
+		handler.Flush()
+	}
+	if len(redis.Streams["ban-events"]) != maxStreamBuffer {
+		t.Errorf("expected %d appended events, got %d", maxStreamBuffer, len(redis.Streams["ban-events"]))
+	}
+}
+
+func TestNewEventSinkHandler_Defaults(t *testing.T) {
+	config := DefaultConfig()
+	deps, metrics, _ := newTestSinkHandlers(config)
+
+	handler := NewEventSinkHandler(config, deps)
+	handler.OnBanEvent(NewBanEvent(BanEventIssued, "fp", "930120", "high", "local"))
+
+	if metrics.Counters["coraza_ban.bans_issued_total.severity.high"] != 1 {
+		t.Errorf("default sinks should include metrics, got %v", metrics.Counters)
+	}
+}
+
+func TestNewEventSinkHandler_EventsDisabled(t *testing.T) {
+	config := DefaultConfig()
+	config.EventsEnabled = false
+	deps, _, _ := newTestSinkHandlers(config)
+
+	if _, ok := NewEventSinkHandler(config, deps).(*NoopEventHandler); !ok {
+		t.Error("expected NoopEventHandler when events are disabled")
+	}
+}
+
+func TestNewEventSinkHandler_PerSinkFilters(t *testing.T) {
+	config := DefaultConfig()
+	config.RedisCluster = "redis"
+	config.EventSinks = []EventSinkConfig{
+		{Type: EventSinkMetrics},
+		{Type: EventSinkRedisStream, Stream: "critical-bans", MaxLen: 100, EventTypes: []string{"issued"}, MinSeverity: "critical"},
+		{Type: EventSinkWebhook}, // skipped: no webhook configured
+	}
+	deps, metrics, redis := newTestSinkHandlers(config)
+
+	handler := NewEventSinkHandler(config, deps)
+	handler.OnBanEvent(NewBanEvent(BanEventIssued, "fp1", "930120", "critical", "local"))
+	handler.OnBanEvent(NewBanEvent(BanEventIssued, "fp2", "941100", "medium", "local"))
+	handler.OnBanEvent(NewBanEvent(BanEventEnforced, "fp1", "930120", "critical", "local"))
+	deps.Streams["critical-bans"].Flush()
+
+	if len(redis.Streams["critical-bans"]) != 1 {
+		t.Errorf("expected only the critical issued ban in the stream, got %d", len(redis.Streams["critical-bans"]))
+	}
+	if metrics.Counters["coraza_ban.bans_issued_total.severity.medium"] != 1 {
+		t.Error("unfiltered metrics sink should receive all events")
+	}
+}
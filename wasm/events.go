@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"strings"
 	"time"
 )
 
@@ -20,16 +22,54 @@ const (
 	BanEventExpired BanEventType = "expired"
 	// BanEventScoreUpdated is emitted when a score is updated (scoring mode).
 	BanEventScoreUpdated BanEventType = "score_updated"
+	// BanEventAllowlisted is emitted when a ban is skipped because the client is allowlisted.
+	BanEventAllowlisted BanEventType = "allowlisted"
+	// BanEventLifted is emitted when a ban is removed manually before it expires.
+	BanEventLifted BanEventType = "lifted"
+	// BanEventChallengePassed is emitted when a banned client solves a challenge.
+	BanEventChallengePassed BanEventType = "challenge_passed"
 )
 
+// banEventTypes lists all known event types.
+var banEventTypes = []BanEventType{
+	BanEventIssued,
+	BanEventEnforced,
+	BanEventExpired,
+	BanEventScoreUpdated,
+	BanEventAllowlisted,
+	BanEventLifted,
+	BanEventChallengePassed,
+}
+
+// isBanEventType returns true if name is a known event type.
+func isBanEventType(name string) bool {
+	for _, eventType := range banEventTypes {
+		if string(eventType) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// severityRank orders WAF severities for minimum-severity filtering.
+// Unknown or empty severities rank 0.
+var severityRank = map[string]int{
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
 // BanEvent represents a ban-related event for observability.
 // Events are emitted during ban lifecycle operations for monitoring,
-// alerting, and future webhook integration.
+// alerting, and webhook delivery.
 type BanEvent struct {
 	// Type of the event
 	Type BanEventType `json:"type"`
 	// Fingerprint of the client
 	Fingerprint string `json:"fingerprint"`
+	// Scope of the ban (empty for global bans)
+	Scope string `json:"scope,omitempty"`
 	// RuleID that triggered the event (if applicable)
 	RuleID string `json:"rule_id,omitempty"`
 	// Severity of the triggering rule
@@ -44,6 +84,12 @@ type BanEvent struct {
 	Threshold int `json:"threshold,omitempty"`
 	// TTL of the ban in seconds
 	TTL int `json:"ttl,omitempty"`
+	// Reason gives additional context (e.g., which allowlist entry matched)
+	Reason string `json:"reason,omitempty"`
+	// Duration is how long the ban was active in seconds (expired, lifted)
+	Duration int `json:"duration,omitempty"`
+	// Offenses is how many times the client has been banned, with escalation
+	Offenses int `json:"offenses,omitempty"`
 }
 
 // NewBanEvent creates a new ban event with the current timestamp.
@@ -58,6 +104,31 @@ func NewBanEvent(eventType BanEventType, fingerprint, ruleID, severity, source s
 	}
 }
 
+// NewBanEndEvent creates an expired or lifted event for a ban that ended.
+// The event carries the original rule, severity and TTL of the ban and the
+// time it was actually active, which is shorter than the TTL when lifted.
+func NewBanEndEvent(eventType BanEventType, entry *BanEntry, source string) *BanEvent {
+	event := NewBanEvent(eventType, entry.Fingerprint, entry.RuleID, entry.Severity, source)
+	event.Scope = entry.Scope
+	event.TTL = entry.TTL
+	event.Reason = entry.Reason
+	event.Offenses = entry.Offenses
+
+	end := event.Timestamp
+	if entry.ExpiresAt > 0 && end > entry.ExpiresAt {
+		end = entry.ExpiresAt
+	}
+	if entry.CreatedAt > 0 && end > entry.CreatedAt {
+		event.Duration = int(end - entry.CreatedAt)
+	}
+	return event
+}
+
+// ToJSON serializes the event to JSON.
+func (e *BanEvent) ToJSON() ([]byte, error) {
+	return json.Marshal(e)
+}
+
 // =============================================================================
 // Event Handler Interface
 // =============================================================================
@@ -69,6 +140,56 @@ type EventHandler interface {
 	OnBanEvent(event *BanEvent)
 }
 
+// =============================================================================
+// Event Filter
+// =============================================================================
+
+// EventFilter selects events by type and minimum severity.
+type EventFilter struct {
+	types       map[BanEventType]bool // nil accepts all event types
+	minSeverity int                   // 0 accepts all severities
+}
+
+// NewEventFilter creates a filter. An empty types list accepts all event
+// types; an empty minSeverity accepts all severities. When minSeverity is
+// set, events without a known severity (e.g., expired) are rejected.
+func NewEventFilter(types []string, minSeverity string) *EventFilter {
+	filter := &EventFilter{minSeverity: severityRank[strings.ToLower(minSeverity)]}
+	if len(types) > 0 {
+		filter.types = make(map[BanEventType]bool, len(types))
+		for _, eventType := range types {
+			filter.types[BanEventType(eventType)] = true
+		}
+	}
+	return filter
+}
+
+// Allows returns true if the event passes the filter.
+func (f *EventFilter) Allows(event *BanEvent) bool {
+	if f.types != nil && !f.types[event.Type] {
+		return false
+	}
+	return severityRank[strings.ToLower(event.Severity)] >= f.minSeverity
+}
+
+// FilteredEventHandler forwards only the events accepted by its filter.
+type FilteredEventHandler struct {
+	handler EventHandler
+	filter  *EventFilter
+}
+
+// NewFilteredEventHandler wraps handler with filter.
+func NewFilteredEventHandler(handler EventHandler, filter *EventFilter) *FilteredEventHandler {
+	return &FilteredEventHandler{handler: handler, filter: filter}
+}
+
+// OnBanEvent forwards the event if the filter allows it.
+func (h *FilteredEventHandler) OnBanEvent(event *BanEvent) {
+	if h.filter.Allows(event) {
+		h.handler.OnBanEvent(event)
+	}
+}
+
 // =============================================================================
 // Logging Event Handler (Default Implementation)
 // =============================================================================
@@ -96,15 +217,45 @@ func (h *LoggingEventHandler) OnBanEvent(event *BanEvent) {
 	case BanEventScoreUpdated:
 		h.logger.Info("ban_event: type=%s fingerprint=%s rule=%s score=%d/%d source=%s",
 			event.Type, event.Fingerprint, event.RuleID, event.Score, event.Threshold, event.Source)
+	case BanEventAllowlisted:
+		h.logger.Info("ban_event: type=%s fingerprint=%s rule=%s reason=%s source=%s",
+			event.Type, event.Fingerprint, event.RuleID, event.Reason, event.Source)
 	case BanEventExpired:
-		h.logger.Debug("ban_event: type=%s fingerprint=%s source=%s",
-			event.Type, event.Fingerprint, event.Source)
+		h.logger.Debug("ban_event: type=%s fingerprint=%s rule=%s severity=%s ttl=%d duration=%d source=%s",
+			event.Type, event.Fingerprint, event.RuleID, event.Severity, event.TTL, event.Duration, event.Source)
+	case BanEventChallengePassed:
+		h.logger.Info("ban_event: type=%s fingerprint=%s rule=%s severity=%s action=%s",
+			event.Type, event.Fingerprint, event.RuleID, event.Severity, event.Reason)
+	case BanEventLifted:
+		h.logger.Info("ban_event: type=%s fingerprint=%s rule=%s severity=%s ttl=%d duration=%d source=%s",
+			event.Type, event.Fingerprint, event.RuleID, event.Severity, event.TTL, event.Duration, event.Source)
 	default:
 		h.logger.Debug("ban_event: type=%s fingerprint=%s source=%s",
 			event.Type, event.Fingerprint, event.Source)
 	}
 }
 
+// =============================================================================
+// Multi Event Handler
+// =============================================================================
+
+// MultiEventHandler fans each event out to several handlers in order.
+type MultiEventHandler struct {
+	handlers []EventHandler
+}
+
+// NewMultiEventHandler creates a handler that forwards to all given handlers.
+func NewMultiEventHandler(handlers ...EventHandler) *MultiEventHandler {
+	return &MultiEventHandler{handlers: handlers}
+}
+
+// OnBanEvent forwards the event to every handler.
+func (h *MultiEventHandler) OnBanEvent(event *BanEvent) {
+	for _, handler := range h.handlers {
+		handler.OnBanEvent(event)
+	}
+}
+
 // =============================================================================
 // Noop Event Handler (For Testing/Disabled Events)
 // =============================================================================
@@ -129,5 +280,7 @@ func (h *NoopEventHandler) OnBanEvent(event *BanEvent) {
 
 var (
 	_ EventHandler = (*LoggingEventHandler)(nil)
+	_ EventHandler = (*MultiEventHandler)(nil)
+	_ EventHandler = (*FilteredEventHandler)(nil)
 	_ EventHandler = (*NoopEventHandler)(nil)
 )
@@ -99,6 +99,20 @@ func TestLoggingEventHandler_OnBanEvent_Expired(t *testing.T) {
 	}
 }
 
+func TestLoggingEventHandler_OnBanEvent_Allowlisted(t *testing.T) {
+	logger := NewMockLogger()
+	handler := NewLoggingEventHandler(logger)
+
+	event := NewBanEvent(BanEventAllowlisted, "test-fp", "rule-123", "high", "local")
+	event.Reason = "user_agent"
+
+	handler.OnBanEvent(event)
+
+	if len(logger.InfoMessages) != 1 {
+		t.Errorf("expected 1 info message, got %d", len(logger.InfoMessages))
+	}
+}
+
 func TestLoggingEventHandler_OnBanEvent_UnknownType(t *testing.T) {
 	logger := NewMockLogger()
 	handler := NewLoggingEventHandler(logger)
@@ -123,6 +137,64 @@ func TestNoopEventHandler_OnBanEvent(t *testing.T) {
 	// No way to verify no-op, but should not panic
 }
 
+func TestMultiEventHandler_OnBanEvent(t *testing.T) {
+	first := NewMockEventHandler()
+	second := NewMockEventHandler()
+	handler := NewMultiEventHandler(first, second)
+
+	handler.OnBanEvent(NewBanEvent(BanEventIssued, "test-fp", "rule-123", "high", "local"))
+
+	if len(first.Events) != 1 || len(second.Events) != 1 {
+		t.Errorf("expected event forwarded to both handlers, got %d and %d",
+			len(first.Events), len(second.Events))
+	}
+}
+
+func TestEventFilter_Allows(t *testing.T) {
+	issuedCritical := NewBanEvent(BanEventIssued, "fp", "930120", "critical", "local")
+	issuedLow := NewBanEvent(BanEventIssued, "fp", "930120", "low", "local")
+	enforced := NewBanEvent(BanEventEnforced, "fp", "930120", "critical", "local")
+	expired := NewBanEvent(BanEventExpired, "fp", "", "", "local")
+
+	tests := []struct {
+		name        string
+		types       []string
+		minSeverity string
+		event       *BanEvent
+		expected    bool
+	}{
+		{"no filter", nil, "", expired, true},
+		{"type match", []string{"issued"}, "", issuedLow, true},
+		{"type mismatch", []string{"issued"}, "", enforced, false},
+		{"severity above min", nil, "high", issuedCritical, true},
+		{"severity below min", nil, "high", issuedLow, false},
+		{"no severity with min", nil, "low", expired, false},
+		{"type and severity", []string{"issued"}, "CRITICAL", issuedCritical, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := NewEventFilter(tt.types, tt.minSeverity)
+			if got := filter.Allows(tt.event); got != tt.expected {
+				t.Errorf("Allows() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilteredEventHandler_OnBanEvent(t *testing.T) {
+	inner := NewMockEventHandler()
+	handler := NewFilteredEventHandler(inner, NewEventFilter([]string{"issued"}, "critical"))
+
+	handler.OnBanEvent(NewBanEvent(BanEventIssued, "fp", "930120", "critical", "local"))
+	handler.OnBanEvent(NewBanEvent(BanEventIssued, "fp", "930120", "high", "local"))
+	handler.OnBanEvent(NewBanEvent(BanEventEnforced, "fp", "930120", "critical", "local"))
+
+	if len(inner.Events) != 1 {
+		t.Errorf("expected 1 forwarded event, got %d", len(inner.Events))
+	}
+}
+
 func TestBanEventType_Constants(t *testing.T) {
 	// Verify event type constants
 	if BanEventIssued != "issued" {
@@ -137,4 +209,41 @@ func TestBanEventType_Constants(t *testing.T) {
 	if BanEventScoreUpdated != "score_updated" {
 		t.Error("BanEventScoreUpdated should be 'score_updated'")
 	}
+	if BanEventAllowlisted != "allowlisted" {
+		t.Error("BanEventAllowlisted should be 'allowlisted'")
+	}
+}
+
+func TestNewBanEndEvent_Expired(t *testing.T) {
+	entry := NewBanEntry("test-fp", "waf-rule", "930120", "critical", 300)
+	// Ban expired 100 seconds ago, before the event was created
+	entry.CreatedAt -= 400
+	entry.ExpiresAt -= 400
+
+	event := NewBanEndEvent(BanEventExpired, entry, "local")
+
+	if event.Type != BanEventExpired || event.Source != "local" {
+		t.Errorf("unexpected event type/source: %s/%s", event.Type, event.Source)
+	}
+	if event.RuleID != "930120" || event.Severity != "critical" || event.Reason != "waf-rule" {
+		t.Errorf("original ban details not carried: %+v", event)
+	}
+	if event.TTL != 300 {
+		t.Errorf("expected ttl 300, got %d", event.TTL)
+	}
+	// Duration is capped at the ban's expiry, not the detection time
+	if event.Duration != 300 {
+		t.Errorf("expected duration 300, got %d", event.Duration)
+	}
+}
+
+func TestLoggingEventHandler_OnBanEvent_Lifted(t *testing.T) {
+	logger := NewMockLogger()
+	handler := NewLoggingEventHandler(logger)
+
+	handler.OnBanEvent(NewBanEvent(BanEventLifted, "test-fp", "930120", "high", "local"))
+
+	if len(logger.InfoMessages) != 1 {
+		t.Errorf("expected 1 info message, got %d", len(logger.InfoMessages))
+	}
 }
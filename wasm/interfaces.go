@@ -8,16 +8,25 @@ package main
 
 // BanStore defines the interface for ban storage operations.
 // Implementations include local shared-data cache and Redis.
+// Bans are stored under their ID (see BanID), which is the fingerprint
+// for global bans.
 type BanStore interface {
-	// CheckBan checks if a fingerprint is banned.
+	// CheckBan checks if a ban ID is banned.
 	// Returns the ban entry and true if banned, nil and false otherwise.
-	CheckBan(fingerprint string) (*BanEntry, bool)
+	CheckBan(id string) (*BanEntry, bool)
 
-	// SetBan stores a ban entry.
+	// SetBan stores a ban entry under its ID.
 	SetBan(entry *BanEntry) error
 
 	// DeleteBan removes a ban entry.
-	DeleteBan(fingerprint string) error
+	DeleteBan(id string) error
+
+	// ListBans returns all active (non-expired) ban entries.
+	ListBans() ([]*BanEntry, error)
+
+	// SweepExpired removes all expired ban entries.
+	// Returns the number of entries removed.
+	SweepExpired() int
 }
 
 // ScoreStore defines the interface for behavioral score storage operations.
@@ -30,9 +39,54 @@ type ScoreStore interface {
 	// SetScore stores a score entry.
 	SetScore(entry *ScoreEntry) error
 
-	// IncrScore atomically increments a score.
-	// Returns the new score value.
-	IncrScore(fingerprint string, increment int) (int, error)
+	// IncrScore atomically increments a score and records the rule hits
+	// adding to it. Returns the new score value.
+	IncrScore(fingerprint string, increment int, hits []RuleHit) (int, error)
+}
+
+// OffenseStore defines the interface for repeat offender tracking.
+// Offense counts drive progressive ban escalation.
+type OffenseStore interface {
+	// GetOffenses returns the offense count within the escalation window.
+	GetOffenses(fingerprint string) (int, error)
+
+	// IncrOffenses records a new offense and returns the offense count,
+	// including this one.
+	IncrOffenses(fingerprint string) (int, error)
+
+	// SyncOffenses raises the offense count to count if it is lower,
+	// e.g., with offenses recorded by other instances in Redis.
+	SyncOffenses(fingerprint string, count int) error
+}
+
+// RateStore defines the interface for counting the requests of banned
+// clients that are rate-limited instead of denied.
+type RateStore interface {
+	// IncrRequests records a request and returns the number of requests
+	// in the current one-minute window, including this one.
+	IncrRequests(fingerprint string) (int, error)
+}
+
+// SignalStore defines the interface for counting the signal events of a
+// fingerprint over a sliding window.
+type SignalStore interface {
+	// IncrSignal records an event and returns the event count over the
+	// last windowSeconds, including this one.
+	IncrSignal(fingerprint, signal string, windowSeconds int) (int, error)
+
+	// ResetSignal forgets the counted events once the signal triggered.
+	ResetSignal(fingerprint, signal string) error
+
+	// SweepExpired removes the signal entries whose events no longer
+	// count. Returns the number of entries removed.
+	SweepExpired() int
+}
+
+// NonceStore defines the interface for recording redeemed challenge nonces.
+type NonceStore interface {
+	// UseNonce records a nonce of a fingerprint until expiresAt. Returns
+	// false if the nonce was already used.
+	UseNonce(fingerprint, nonce string, expiresAt int64) (bool, error)
 }
 
 // MetadataExtractor defines the interface for WAF metadata extraction.
@@ -59,23 +113,42 @@ type FingerprintCalculator interface {
 // All operations are non-blocking and use callbacks for results.
 // This interface enables dependency injection and facilitates unit testing.
 type RedisClient interface {
-	// CheckBanAsync checks if a fingerprint is banned in Redis.
-	// Callback receives (isBanned, entry) - entry may be nil if not banned.
-	CheckBanAsync(fingerprint string, callback func(bool, *BanEntry))
+	// CheckBanAsync checks if a ban ID (see BanID) is banned in Redis.
+	// Callback receives (isBanned, entry, ok) - entry may be nil if not banned,
+	// ok is false if Redis could not be queried (timeout, error reply, etc.).
+	CheckBanAsync(id string, callback func(bool, *BanEntry, bool))
 
-	// SetBanAsync stores a ban entry in Redis.
+	// SetBanAsync stores a ban entry in Redis under its ID.
 	// Callback receives success status.
 	SetBanAsync(entry *BanEntry, callback func(bool))
 
 	// DeleteBanAsync removes a ban from Redis.
+	// Callback receives (deleted, ok) - deleted is false if no ban existed,
+	// ok is false if Redis could not be queried. A nil callback makes the
+	// call fire-and-forget.
+	DeleteBanAsync(id string, callback func(bool, bool))
+
+	// AppendStreamAsync appends an entry with a single "event" field to a
+	// Redis stream (XADD), trimming it to approximately maxLen entries.
 	// Fire-and-forget, no callback needed.
-	DeleteBanAsync(fingerprint string)
+	AppendStreamAsync(stream string, maxLen int, payload string)
 
 	// IncrScoreAsync atomically increments a score in Redis.
 	// Callback receives (newScore, success).
 	// TTL is applied to set/refresh the key expiration.
 	IncrScoreAsync(fingerprint string, increment, ttl int, callback func(int, bool))
 
+	// IncrClusterScoreAsync atomically decays a fingerprint's cluster-wide
+	// score along the decay curve and adds an increment, server-side.
+	// Callback receives (newScore, success).
+	// TTL is applied to set/refresh the key expiration.
+	IncrClusterScoreAsync(fingerprint string, increment int, decay *ScoreDecay, ttl int, callback func(int, bool))
+
+	// IncrOffensesAsync atomically increments a fingerprint's offense count.
+	// Callback receives (newCount, success).
+	// TTL is applied to set/refresh the key expiration.
+	IncrOffensesAsync(fingerprint string, ttl int, callback func(int, bool))
+
 	// GetScoreAsync retrieves a score from Redis.
 	// Callback receives (score, found).
 	GetScoreAsync(fingerprint string, callback func(int, bool))
@@ -84,6 +157,39 @@ type RedisClient interface {
 	IsConfigured() bool
 }
 
+// RedisTransport sends RESP-framed commands to a Redis bridge.
+// The body holds one or more pipelined commands; the callback receives
+// the concatenated RESP replies, or ok=false on transport failure.
+// This interface allows RESPClient to be tested with an in-process backend.
+type RedisTransport interface {
+	Send(body []byte, callback func(reply []byte, ok bool)) error
+}
+
+// WebhookTransport posts a batch of events to the webhook endpoint.
+// The callback receives ok=true when the endpoint answered with a 2xx status.
+// This interface allows WebhookEventHandler to be tested without Envoy.
+type WebhookTransport interface {
+	Send(headers [][2]string, body []byte, callback func(ok bool)) error
+}
+
+// =============================================================================
+// Metrics Interface
+// =============================================================================
+
+// MetricsRecorder records plugin metrics.
+// Names are full stat names including encoded labels (see metricName).
+// This allows metric output to be captured in tests.
+type MetricsRecorder interface {
+	// Increment adds delta to a counter.
+	Increment(name string, delta uint64)
+
+	// AddGauge adds delta (which may be negative) to a gauge.
+	AddGauge(name string, delta int64)
+
+	// Record records a histogram sample.
+	Record(name string, value uint64)
+}
+
 // =============================================================================
 // Logger Interface
 // =============================================================================
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"time"
+
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
 )
@@ -37,9 +39,29 @@ type pluginContext struct {
 	logger      Logger
 	banStore    BanStore
 	scoreStore  ScoreStore
+	offenses    OffenseStore
+	rates       RateStore
+	signals     SignalStore
 	redisClient RedisClient
+	allowlist   *AllowlistService
+	denylist    *DenylistService
+	policies    *PolicyService
+	breaker     *BreakerRedisClient // nil when the circuit breaker is disabled
+	metrics     MetricsRecorder
+	webhook     *WebhookEventHandler // nil when no webhook is configured
+	streams     map[string]*RedisStreamEventHandler
+	challenge   *ChallengeService // nil when challenge mode is disabled
+	responses   *ResponseRenderer // ban response templates
+	events      EventHandler      // plugin-level events (expiries)
+	lastSweep   time.Time
+	tarpit      map[uint32]*httpContext // requests held by the tarpit enforcement
 }
 
+// pluginTickPeriod is how often OnTick runs background work (ms).
+// Each task tracks its own interval (breaker probes, webhook flushes,
+// expired ban sweeps, tarpit releases).
+const pluginTickPeriod = 1000
+
 // OnPluginStart is called when the plugin starts
 func (ctx *pluginContext) OnPluginStart(pluginConfigurationSize int) types.OnPluginStartStatus {
 	// Read plugin configuration
@@ -66,19 +88,101 @@ func (ctx *pluginContext) OnPluginStart(pluginConfigurationSize int) types.OnPlu
 
 	// Initialize shared services (created once, shared across all requests)
 	ctx.logger = NewPluginLogger(config, 0) // Context 0 for plugin-level logging
-	ctx.banStore = NewLocalBanStore(ctx.logger)
-	ctx.scoreStore = NewLocalScoreStore(ctx.logger, config.ScoreDecaySeconds)
+	if config.MetricsEnabled {
+		ctx.metrics = NewProxyMetricsRecorder()
+	} else {
+		ctx.metrics = NewNoopMetricsRecorder()
+	}
+	keys := NewKeyspace(config.KeyPrefix)
+	banStore := NewLocalBanStore(ctx.logger, keys)
+	banStore.SetOnExpire(ctx.onBanExpired("local"))
+	ctx.banStore = banStore
+	ctx.scoreStore = NewLocalScoreStore(ctx.logger, keys, config.ScoreDecay())
+	ctx.offenses = NewLocalOffenseStore(ctx.logger, keys, config.Escalation.WindowSeconds)
+	ctx.rates = NewLocalRateStore(ctx.logger, keys)
+	ctx.signals = NewLocalSignalStore(ctx.logger, keys)
+	ctx.tarpit = make(map[uint32]*httpContext)
+
+	ctx.allowlist, err = NewAllowlistService(&config.Allowlist)
+	if err != nil {
+		proxywasm.LogCriticalf("coraza-ban-wasm: failed to compile allowlist: %v", err)
+		return types.OnPluginStartStatusFailed
+	}
+
+	ctx.denylist, err = NewDenylistService(&config.Denylist)
+	if err != nil {
+		proxywasm.LogCriticalf("coraza-ban-wasm: failed to compile denylist: %v", err)
+		return types.OnPluginStartStatusFailed
+	}
+
+	ctx.policies, err = NewPolicyService(config)
+	if err != nil {
+		proxywasm.LogCriticalf("coraza-ban-wasm: failed to compile policies: %v", err)
+		return types.OnPluginStartStatusFailed
+	}
+
+	ctx.responses = NewResponseRenderer(&config.BanResponseTemplates)
+
+	if config.Challenge.Enabled {
+		ctx.challenge = NewChallengeService(&config.Challenge, NewLocalNonceStore(ctx.logger, keys))
+	}
 
 	// Create appropriate Redis client based on configuration
-	if config.RedisCluster != "" {
-		ctx.redisClient = NewWebdisClient(config.RedisCluster, uint32(DefaultRedisTimeout), ctx.logger)
-	} else {
+	timeout := uint32(config.RedisTimeoutMs)
+	switch {
+	case config.RedisCluster == "":
 		ctx.redisClient = NewNoopRedisClient()
+	case config.RedisBackend == RedisBackendRESP:
+		transport := NewHTTPRedisTransport(config.RedisCluster, config.RedisPath, timeout)
+		transport.SetAuth(config.RedisAuthHeader, config.RedisAuthToken)
+		resp := NewRESPClient(transport, keys, ctx.logger)
+		resp.SetOnExpire(ctx.onBanExpired("redis"))
+		ctx.redisClient = resp
+	default:
+		webdis := NewWebdisClient(config.RedisCluster, timeout, keys, ctx.logger)
+		webdis.SetAuth(config.RedisAuthHeader, config.RedisAuthToken)
+		webdis.SetOnExpire(ctx.onBanExpired("redis"))
+		ctx.redisClient = webdis
+	}
+
+	if config.RedisCluster != "" && config.MetricsEnabled {
+		ctx.redisClient = NewMetricsRedisClient(ctx.redisClient, ctx.metrics)
+	}
+
+	// Guard Redis with a circuit breaker probed from OnTick
+	if config.RedisCluster != "" && config.CircuitBreaker.Enabled {
+		ctx.startCircuitBreaker()
+	}
+
+	// Webhook events are buffered per worker and flushed from OnTick
+	if config.Webhook.Cluster != "" {
+		transport := NewHTTPWebhookTransport(config.Webhook.Cluster, config.Webhook.Path, uint32(config.Webhook.TimeoutMs))
+		ctx.webhook = NewWebhookEventHandler(&config.Webhook, transport, ctx.logger)
+	}
+
+	// Stream events are buffered per worker and flushed from OnTick too
+	ctx.streams = NewRedisStreamEventHandlers(config, ctx.redisClient, ctx.logger)
+
+	// Expiries are detected by the shared store and Redis client rather
+	// than a request, so they are routed through a plugin-level handler
+	ctx.events = NewEventSinkHandler(config, &EventSinkHandlers{
+		Logger:  ctx.logger,
+		Metrics: ctx.metrics,
+		Webhook: ctx.webhook,
+		Streams: ctx.streams,
+	})
+
+	ctx.lastSweep = time.Now()
+	if err := proxywasm.SetTickPeriodMilliSeconds(pluginTickPeriod); err != nil {
+		proxywasm.LogCriticalf("coraza-ban-wasm: failed to set tick period: %v", err)
+		return types.OnPluginStartStatusFailed
 	}
 
 	proxywasm.LogInfof("coraza-ban-wasm: plugin started with config - "+
-		"redis_cluster=%s, ban_ttl=%d, scoring=%v, fingerprint_mode=%s, dry_run=%v",
+		"redis_cluster=%s, redis_backend=%s, redis_failure_mode=%s, ban_ttl=%d, scoring=%v, fingerprint_mode=%s, dry_run=%v",
 		config.RedisCluster,
+		config.RedisBackend,
+		config.RedisFailureMode,
 		config.BanTTLDefault,
 		config.ScoringEnabled,
 		config.FingerprintMode,
@@ -88,6 +192,75 @@ func (ctx *pluginContext) OnPluginStart(pluginConfigurationSize int) types.OnPlu
 	return types.OnPluginStartStatusOK
 }
 
+// startCircuitBreaker wraps the Redis client with a circuit breaker.
+// The redis_circuit_open gauge counts workers whose breaker is not closed.
+// Calls the breaker rejects never reach the metrics wrapper underneath, so
+// they are counted as redis_calls_total with result "rejected".
+func (ctx *pluginContext) startCircuitBreaker() {
+	breaker := NewCircuitBreaker(
+		ctx.config.CircuitBreaker.FailureThreshold,
+		time.Duration(ctx.config.CircuitBreaker.ProbeIntervalMs)*time.Millisecond,
+	)
+
+	gauge := metricName(metricCircuitOpen)
+	breaker.SetOnStateChange(func(from, to CircuitState) {
+		ctx.logger.Info("Redis circuit %s -> %s", from, to)
+		switch {
+		case from == CircuitClosed:
+			ctx.metrics.AddGauge(gauge, 1)
+		case to == CircuitClosed:
+			ctx.metrics.AddGauge(gauge, -1)
+		}
+	})
+
+	ctx.breaker = NewBreakerRedisClient(ctx.redisClient, breaker, ctx.logger)
+	ctx.breaker.SetOnReject(func(op string) {
+		ctx.metrics.Increment(metricName(metricRedisCalls, "op", op, "result", "rejected"), 1)
+	})
+	ctx.redisClient = ctx.breaker
+}
+
+// onBanExpired returns the expiry callback for a store or Redis client.
+// The plugin-level event handler is looked up when a ban expires, since
+// it is created after the stores.
+func (ctx *pluginContext) onBanExpired(source string) func(*BanEntry) {
+	return func(entry *BanEntry) {
+		if ctx.events != nil {
+			ctx.events.OnBanEvent(NewBanEndEvent(BanEventExpired, entry, source))
+		}
+	}
+}
+
+// OnTick probes Redis when the circuit breaker is due for a probe,
+// sweeps expired local bans and signal entries, releases tarpitted
+// requests and flushes buffered webhook and stream events.
+func (ctx *pluginContext) OnTick() {
+	if ctx.breaker != nil {
+		ctx.breaker.Probe()
+	}
+
+	now := time.Now()
+	interval := time.Duration(ctx.config.BanSweepSeconds) * time.Second
+	if now.Sub(ctx.lastSweep) >= interval {
+		ctx.lastSweep = now
+		if expired := ctx.banStore.SweepExpired(); expired > 0 {
+			ctx.logger.Debug("swept %d expired bans", expired)
+		}
+		if swept := ctx.signals.SweepExpired(); swept > 0 {
+			ctx.logger.Debug("swept %d expired signal entries", swept)
+		}
+	}
+
+	ctx.releaseTarpit(now)
+
+	if ctx.webhook != nil {
+		ctx.webhook.Flush()
+	}
+	for _, stream := range ctx.streams {
+		stream.Flush()
+	}
+}
+
 // NewHttpContext creates a new HTTP context for each request
 func (ctx *pluginContext) NewHttpContext(contextID uint32) types.HttpContext {
 	// Create per-request logger with context ID for tracing
@@ -95,18 +268,37 @@ func (ctx *pluginContext) NewHttpContext(contextID uint32) types.HttpContext {
 
 	// Use shared stores and redis client from pluginContext
 	// Only create per-request services that need request-specific state
-	return &httpContext{
+	httpCtx := &httpContext{
 		contextID:          contextID,
 		pluginContext:      ctx,
 		config:             ctx.config,
 		logger:             logger,
-		banStore:           ctx.banStore,    // Shared
-		scoreStore:         ctx.scoreStore,  // Shared
+		banStore:           ctx.banStore,   // Shared
+		scoreStore:         ctx.scoreStore, // Shared
 		fingerprintService: NewFingerprintService(ctx.config, logger),
-		metadataService:    NewMetadataService(logger),
+		metadataService:    NewMetadataService(ctx.config, logger),
 		banService:         NewBanService(ctx.config, logger, ctx.banStore, ctx.scoreStore, ctx.redisClient),
+		enforcementService: NewEnforcementService(ctx.config, logger, ctx.rates),
+		signalService:      NewSignalService(ctx.config, logger, ctx.signals),
 		redisClient:        ctx.redisClient, // Shared
 	}
+
+	httpCtx.banService.SetOffenseStore(ctx.offenses) // Shared
+	httpCtx.banService.SetClusterScoreHandler(httpCtx.handleClusterScore)
+
+	// Route ban events to the configured sinks
+	httpCtx.banService.SetEventHandler(NewEventSinkHandler(ctx.config, &EventSinkHandlers{
+		Logger:  logger,
+		Metrics: ctx.metrics,
+		Webhook: ctx.webhook, // Shared
+		Streams: ctx.streams, // Shared
+	}))
+
+	if ctx.config.Admin.Enabled {
+		httpCtx.adminService = NewAdminService(ctx.config, logger, ctx.banStore, httpCtx.banService, ctx.redisClient)
+	}
+
+	return httpCtx
 }
 
 // httpContext handles individual HTTP requests
@@ -114,7 +306,7 @@ type httpContext struct {
 	types.DefaultHttpContext
 	contextID     uint32
 	pluginContext *pluginContext
-	config        *PluginConfig
+	config        *PluginConfig // effective configuration of the matching policy
 
 	// Services
 	logger             Logger
@@ -123,6 +315,9 @@ type httpContext struct {
 	fingerprintService *FingerprintService
 	metadataService    *MetadataService
 	banService         *BanService
+	enforcementService *EnforcementService
+	signalService      *SignalService
+	adminService       *AdminService // nil when the admin API is disabled
 	redisClient        RedisClient
 
 	// Request state
@@ -132,15 +327,35 @@ type httpContext struct {
 	cookieValue     string
 	ja3Fingerprint  string
 	isBanned        bool
+	banEntry        *BanEntry          // nil for denylist and fail-closed denials
+	enforcement     *EnforcementConfig // enforcement applied to a banned request
+	tarpitUntil     time.Time          // when a tarpitted request is denied
 	pendingRedis    bool
+	redisChecks     int  // Redis ban checks in flight, one per ban scope
+	redisFailed     bool // a Redis ban check failed
+	requestPaused   bool
+	scoreChecks     int  // cluster-wide score updates in flight
+	responsePaused  bool // response held for the cluster-wide score
 	corazaMetadata  *CorazaMetadata
 	generatedCookie string
+	challengePass   string // Set-Cookie value after a solved challenge
+	allowlistReason string
+	isAdminRequest  bool
+	adminRequest    *AdminRequest
 }
 
 // OnHttpRequestHeaders is called when request headers are received
 func (ctx *httpContext) OnHttpRequestHeaders(numHeaders int, endOfStream bool) types.Action {
 	ctx.logDebug("processing request headers")
 
+	// Admin API requests are answered locally and skip ban processing
+	if ctx.adminService != nil && ctx.matchAdminRequest() {
+		return ctx.handleAdminRequestHeaders(endOfStream)
+	}
+
+	// Apply the settings of the matching policy before fingerprinting
+	ctx.applyPolicy()
+
 	// Calculate client fingerprint using the service
 	result := ctx.fingerprintService.CalculateWithDetails()
 	ctx.fingerprint = result.Fingerprint
@@ -149,20 +364,39 @@ func (ctx *httpContext) OnHttpRequestHeaders(numHeaders int, endOfStream bool) t
 	ctx.ja3Fingerprint = result.JA3Fingerprint
 	ctx.cookieValue = result.CookieValue
 	ctx.generatedCookie = result.GeneratedCookie
+	ctx.recordFingerprintMetrics()
+
+	// Allowlisted clients skip ban enforcement entirely
+	if ctx.checkAllowlist() {
+		return types.ActionContinue
+	}
 
 	// Check if client is banned
 	if ctx.checkBan() {
-		return ctx.denyRequest()
+		// Tarpitted requests stay paused until OnTick denies them
+		if ctx.denyRequest() && !ctx.tarpitUntil.IsZero() {
+			return types.ActionPause
+		}
+		return types.ActionContinue
 	}
 
 	// If we need to check Redis asynchronously, pause the request
 	if ctx.pendingRedis {
+		ctx.requestPaused = true
 		return types.ActionPause
 	}
 
 	return types.ActionContinue
 }
 
+// OnHttpRequestBody is called when request body data is received
+func (ctx *httpContext) OnHttpRequestBody(bodySize int, endOfStream bool) types.Action {
+	if ctx.isAdminRequest {
+		return ctx.handleAdminRequestBody(bodySize, endOfStream)
+	}
+	return types.ActionContinue
+}
+
 // OnHttpResponseHeaders is called when response headers are received
 func (ctx *httpContext) OnHttpResponseHeaders(numHeaders int, endOfStream bool) types.Action {
 	// Skip if we already denied this request (client was banned)
@@ -171,6 +405,11 @@ func (ctx *httpContext) OnHttpResponseHeaders(numHeaders int, endOfStream bool)
 		return types.ActionContinue
 	}
 
+	// Skip admin API replies so their status codes never trigger bans
+	if ctx.isAdminRequest {
+		return types.ActionContinue
+	}
+
 	statusCode := ctx.metadataService.GetStatusCode()
 	ctx.logDebug("processing response headers, status=%d", statusCode)
 
@@ -187,16 +426,22 @@ func (ctx *httpContext) OnHttpResponseHeaders(numHeaders int, endOfStream bool)
 
 		// Issue ban for this fingerprint
 		ctx.issueBan()
-	} else if statusCode == 403 && ctx.fingerprint != "" {
-		// Fallback: if we got 403 but no metadata, assume it's a WAF block
-		// This is safe because Coraza WAF is the only downstream filter that returns 403
-		ctx.logInfo("WAF block detected (403 fallback), issuing ban for fingerprint=%s", ctx.fingerprint)
-		ctx.corazaMetadata = &CorazaMetadata{
-			Action:   "block",
-			Severity: "medium",
-			RuleID:   "waf-403",
-		}
+	} else if (ctx.corazaMetadata == nil || ctx.corazaMetadata.Action == "") && ctx.fingerprint != "" &&
+		ctx.metadataService.IsBlockedResponse(statusCode) {
+		// Without metadata telling the action, detect the block from the
+		// response status and headers (see waf_detection)
+		ctx.logInfo("WAF block detected from response (status=%d), issuing ban for fingerprint=%s",
+			statusCode, ctx.fingerprint)
+		ctx.corazaMetadata = ctx.config.WAFDetection.MarkBlocked(ctx.corazaMetadata)
 		ctx.issueBan()
+	} else {
+		// Score attacks Coraza detected without blocking
+		if ctx.corazaMetadata != nil {
+			ctx.scoreDetection()
+		}
+
+		// Count non-WAF signals (request rate, response code bursts)
+		ctx.recordSignals(statusCode)
 	}
 
 	// Inject tracking cookie if configured
@@ -204,38 +449,53 @@ func (ctx *httpContext) OnHttpResponseHeaders(numHeaders int, endOfStream bool)
 		ctx.injectCookie()
 	}
 
+	if ctx.challengePass != "" {
+		ctx.injectChallengePass()
+	}
+
+	// Hold the response until the cluster-wide score decided on a ban,
+	// so the Redis call is not cancelled with the stream
+	if ctx.scoreChecks > 0 {
+		ctx.responsePaused = true
+		return types.ActionPause
+	}
+
 	return types.ActionContinue
 }
 
 // OnHttpStreamDone is called when the HTTP stream is complete
 func (ctx *httpContext) OnHttpStreamDone() {
+	if !ctx.tarpitUntil.IsZero() {
+		ctx.pluginContext.dropTarpit(ctx.contextID)
+	}
 	ctx.logDebug("request completed")
 }
 
-// denyRequest sends a 403 Forbidden response
-func (ctx *httpContext) denyRequest() types.Action {
+// denyRequest enforces the ban of the client, or serves a challenge page
+// for bans that are challenged. Returns false if the request may proceed
+// instead (dry run, solved challenge, log or rate limit enforcement).
+func (ctx *httpContext) denyRequest() bool {
 	if ctx.config.DryRun {
 		ctx.logInfo("DRY RUN: would deny request for fingerprint %s", ctx.fingerprint)
-		return types.ActionContinue
+		ctx.pluginContext.metrics.Increment(metricName(metricDryRunDeny), 1)
+		return false
 	}
 
-	ctx.logInfo("denying request for banned fingerprint %s", ctx.fingerprint)
-
-	headers := [][2]string{
-		{"content-type", "text/plain"},
-		{"x-ban-reason", "coraza-ban-wasm"},
+	if challenge := ctx.pluginContext.challenge; challenge != nil && challenge.Applies(ctx.banEntry) {
+		return ctx.challengeRequest(challenge)
 	}
 
-	if err := proxywasm.SendHttpResponse(
-		uint32(ctx.config.BanResponseCode),
-		headers,
-		[]byte(ctx.config.BanResponseBody),
-		-1,
-	); err != nil {
-		ctx.logError("failed to send deny response: %v", err)
-	}
+	return ctx.enforceBan()
+}
 
-	return types.ActionContinue
+// recordFingerprintMetrics counts fingerprints by mode and tracks how often
+// full mode has to do without a JA3 fingerprint.
+func (ctx *httpContext) recordFingerprintMetrics() {
+	metrics := ctx.pluginContext.metrics
+	metrics.Increment(metricName(metricFingerprints, "mode", ctx.config.FingerprintMode), 1)
+	if ctx.config.FingerprintMode == FingerprintModeFull && ctx.ja3Fingerprint == "" {
+		metrics.Increment(metricName(metricJA3Missing), 1)
+	}
 }
 
 // injectCookie adds the tracking cookie to the response
@@ -255,6 +515,10 @@ func (ctx *httpContext) logInfo(format string, args ...interface{}) {
 	ctx.logger.Info(format, args...)
 }
 
+func (ctx *httpContext) logWarn(format string, args ...interface{}) {
+	ctx.logger.Warn(format, args...)
+}
+
 func (ctx *httpContext) logError(format string, args ...interface{}) {
 	ctx.logger.Error(format, args...)
 }
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+)
+
+// =============================================================================
+// Metric Names
+// =============================================================================
+// Metrics are exposed through Envoy stats. Labels are encoded in the stat
+// name as ".<label>.<value>" segments so that Envoy stats_tags can extract
+// them for Prometheus, e.g. "coraza_ban.bans_issued_total.severity.high".
+
+const metricPrefix = "coraza_ban."
+
+const (
+	metricBansIssued      = "bans_issued_total"
+	metricBansEnforced    = "bans_enforced_total"
+	metricBansAllowlisted = "bans_allowlisted_total"
+	metricBansExpired     = "bans_expired_total"
+	metricBansLifted      = "bans_lifted_total"
+	metricBanDuration     = "ban_duration_seconds"
+	metricChallenges      = "challenges_served_total"
+	metricChallengePassed = "challenges_passed_total"
+	metricEnforcements    = "enforcements_total"
+	metricPolicyMatches   = "policy_matches_total"
+	metricScoreUpdates    = "score_updates_total"
+	metricSignals         = "signals_triggered_total"
+	metricRedisCalls      = "redis_calls_total"
+	metricRedisLatency    = "redis_latency_ms"
+	metricDryRunDeny      = "dry_run_would_deny_total"
+	metricFingerprints    = "fingerprints_total"
+	metricJA3Missing      = "fingerprint_ja3_missing_total"
+	metricCircuitOpen     = "redis_circuit_open"
+)
+
+// metricName builds a stat name from a base name and label/value pairs.
+// e.g., metricName("redis_calls_total", "op", "get", "result", "ok")
+// -> "coraza_ban.redis_calls_total.op.get.result.ok"
+func metricName(name string, labels ...string) string {
+	var b strings.Builder
+	b.WriteString(metricPrefix)
+	b.WriteString(name)
+	for _, label := range labels {
+		b.WriteByte('.')
+		b.WriteString(metricLabel(label))
+	}
+	return b.String()
+}
+
+// metricLabel sanitizes a label value so it cannot add stat name segments.
+func metricLabel(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		default:
+			return '_'
+		}
+	}, value)
+}
+
+// =============================================================================
+// Proxy Metrics Recorder
+// =============================================================================
+
+// ProxyMetricsRecorder implements MetricsRecorder with proxy-wasm stats.
+// Metrics are defined lazily on first use and cached, since label values
+// (severities, sources) are only known at runtime.
+type ProxyMetricsRecorder struct {
+	counters   map[string]proxywasm.MetricCounter
+	gauges     map[string]proxywasm.MetricGauge
+	histograms map[string]proxywasm.MetricHistogram
+}
+
+// NewProxyMetricsRecorder creates a recorder backed by Envoy stats.
+func NewProxyMetricsRecorder() *ProxyMetricsRecorder {
+	return &ProxyMetricsRecorder{
+		counters:   make(map[string]proxywasm.MetricCounter),
+		gauges:     make(map[string]proxywasm.MetricGauge),
+		histograms: make(map[string]proxywasm.MetricHistogram),
+	}
+}
+
+// Increment adds delta to a counter.
+func (r *ProxyMetricsRecorder) Increment(name string, delta uint64) {
+	counter, ok := r.counters[name]
+	if !ok {
+		counter = proxywasm.DefineCounterMetric(name)
+		r.counters[name] = counter
+	}
+	counter.Increment(delta)
+}
+
+// AddGauge adds delta (which may be negative) to a gauge.
+func (r *ProxyMetricsRecorder) AddGauge(name string, delta int64) {
+	gauge, ok := r.gauges[name]
+	if !ok {
+		gauge = proxywasm.DefineGaugeMetric(name)
+		r.gauges[name] = gauge
+	}
+	gauge.Add(delta)
+}
+
+// Record records a histogram sample.
+func (r *ProxyMetricsRecorder) Record(name string, value uint64) {
+	histogram, ok := r.histograms[name]
+	if !ok {
+		histogram = proxywasm.DefineHistogramMetric(name)
+		r.histograms[name] = histogram
+	}
+	histogram.Record(value)
+}
+
+// =============================================================================
+// Noop Metrics Recorder
+// =============================================================================
+
+// NoopMetricsRecorder discards all metrics.
+// Use this when metrics are disabled.
+type NoopMetricsRecorder struct{}
+
+// NewNoopMetricsRecorder creates a new no-op metrics recorder.
+func NewNoopMetricsRecorder() *NoopMetricsRecorder {
+	return &NoopMetricsRecorder{}
+}
+
+// Increment does nothing.
+func (r *NoopMetricsRecorder) Increment(name string, delta uint64) {}
+
+// AddGauge does nothing.
+func (r *NoopMetricsRecorder) AddGauge(name string, delta int64) {}
+
+// Record does nothing.
+func (r *NoopMetricsRecorder) Record(name string, value uint64) {}
+
+// =============================================================================
+// Metrics Event Handler
+// =============================================================================
+
+// MetricsEventHandler turns ban events into Envoy stats.
+type MetricsEventHandler struct {
+	metrics MetricsRecorder
+}
+
+// NewMetricsEventHandler creates a new metrics event handler.
+func NewMetricsEventHandler(metrics MetricsRecorder) *MetricsEventHandler {
+	return &MetricsEventHandler{metrics: metrics}
+}
+
+// OnBanEvent increments the counter matching the event type.
+func (h *MetricsEventHandler) OnBanEvent(event *BanEvent) {
+	switch event.Type {
+	case BanEventIssued:
+		h.metrics.Increment(metricName(metricBansIssued, "severity", event.Severity), 1)
+	case BanEventEnforced:
+		h.metrics.Increment(metricName(metricBansEnforced, "source", event.Source), 1)
+	case BanEventScoreUpdated:
+		h.metrics.Increment(metricName(metricScoreUpdates), 1)
+	case BanEventAllowlisted:
+		h.metrics.Increment(metricName(metricBansAllowlisted, "reason", event.Reason), 1)
+	case BanEventExpired:
+		h.metrics.Increment(metricName(metricBansExpired, "source", event.Source), 1)
+		h.metrics.Record(metricName(metricBanDuration, "end", "expired"), uint64(event.Duration))
+	case BanEventChallengePassed:
+		h.metrics.Increment(metricName(metricChallengePassed, "action", event.Reason), 1)
+	case BanEventLifted:
+		h.metrics.Increment(metricName(metricBansLifted), 1)
+		h.metrics.Record(metricName(metricBanDuration, "end", "lifted"), uint64(event.Duration))
+	}
+}
+
+// =============================================================================
+// MetricsRedisClient - RedisClient decorator recording call metrics
+// =============================================================================
+
+// MetricsRedisClient wraps a RedisClient and records the outcome and
+// latency of every call. Latency is measured from dispatch to callback.
+type MetricsRedisClient struct {
+	client  RedisClient
+	metrics MetricsRecorder
+	now     func() time.Time
+}
+
+// NewMetricsRedisClient wraps client with call metrics.
+func NewMetricsRedisClient(client RedisClient, metrics MetricsRecorder) *MetricsRedisClient {
+	return &MetricsRedisClient{
+		client:  client,
+		metrics: metrics,
+		now:     time.Now,
+	}
+}
+
+// IsConfigured delegates to the wrapped client.
+func (c *MetricsRedisClient) IsConfigured() bool {
+	return c.client.IsConfigured()
+}
+
+// CheckBanAsync checks a ban and records the call.
+func (c *MetricsRedisClient) CheckBanAsync(fingerprint string, callback func(bool, *BanEntry, bool)) {
+	start := c.now()
+	c.client.CheckBanAsync(fingerprint, func(banned bool, entry *BanEntry, ok bool) {
+		c.record("check_ban", start, callResult(ok))
+		callback(banned, entry, ok)
+	})
+}
+
+// SetBanAsync stores a ban and records the call.
+func (c *MetricsRedisClient) SetBanAsync(entry *BanEntry, callback func(bool)) {
+	start := c.now()
+	c.client.SetBanAsync(entry, func(success bool) {
+		c.record("set_ban", start, callResult(success))
+		callback(success)
+	})
+}
+
+// DeleteBanAsync removes a ban and records the call.
+func (c *MetricsRedisClient) DeleteBanAsync(fingerprint string, callback func(bool, bool)) {
+	start := c.now()
+	c.client.DeleteBanAsync(fingerprint, func(deleted, ok bool) {
+		c.record("delete_ban", start, callResult(ok))
+		if callback != nil {
+			callback(deleted, ok)
+		}
+	})
+}
+
+// AppendStreamAsync appends to a stream. Fire-and-forget, so only the dispatch is counted.
+func (c *MetricsRedisClient) AppendStreamAsync(stream string, maxLen int, payload string) {
+	c.metrics.Increment(metricName(metricRedisCalls, "op", "append_stream", "result", "dispatched"), 1)
+	c.client.AppendStreamAsync(stream, maxLen, payload)
+}
+
+// IncrScoreAsync increments a score and records the call.
+func (c *MetricsRedisClient) IncrScoreAsync(fingerprint string, increment, ttl int, callback func(int, bool)) {
+	start := c.now()
+	c.client.IncrScoreAsync(fingerprint, increment, ttl, func(score int, success bool) {
+		c.record("incr_score", start, callResult(success))
+		callback(score, success)
+	})
+}
+
+// IncrClusterScoreAsync increments a cluster-wide score and records the call.
+func (c *MetricsRedisClient) IncrClusterScoreAsync(fingerprint string, increment int, decay *ScoreDecay, ttl int, callback func(int, bool)) {
+	start := c.now()
+	c.client.IncrClusterScoreAsync(fingerprint, increment, decay, ttl, func(score int, success bool) {
+		c.record("incr_cluster_score", start, callResult(success))
+		callback(score, success)
+	})
+}
+
+// IncrOffensesAsync increments an offense count and records the call.
+func (c *MetricsRedisClient) IncrOffensesAsync(fingerprint string, ttl int, callback func(int, bool)) {
+	start := c.now()
+	c.client.IncrOffensesAsync(fingerprint, ttl, func(count int, success bool) {
+		c.record("incr_offenses", start, callResult(success))
+		callback(count, success)
+	})
+}
+
+// GetScoreAsync retrieves a score and records the call.
+// The wrapped client cannot tell a missing score from a failure, so the
+// result is reported as "found" or "miss".
+func (c *MetricsRedisClient) GetScoreAsync(fingerprint string, callback func(int, bool)) {
+	start := c.now()
+	c.client.GetScoreAsync(fingerprint, func(score int, found bool) {
+		result := "found"
+		if !found {
+			result = "miss"
+		}
+		c.record("get_score", start, result)
+		callback(score, found)
+	})
+}
+
+// record counts a completed call and its latency.
+func (c *MetricsRedisClient) record(op string, start time.Time, result string) {
+	c.metrics.Increment(metricName(metricRedisCalls, "op", op, "result", result), 1)
+
+	latency := c.now().Sub(start).Milliseconds()
+	if latency < 0 {
+		latency = 0
+	}
+	c.metrics.Record(metricName(metricRedisLatency, "op", op), uint64(latency))
+}
+
+// callResult maps a call outcome to its result label.
+func callResult(ok bool) string {
+	if ok {
+		return "ok"
+	}
+	return "error"
+}
+
+// =============================================================================
+// Compile-Time Interface Verification
+// =============================================================================
+
+var (
+	_ MetricsRecorder = (*ProxyMetricsRecorder)(nil)
+	_ MetricsRecorder = (*NoopMetricsRecorder)(nil)
+	_ EventHandler    = (*MetricsEventHandler)(nil)
+	_ RedisClient     = (*MetricsRedisClient)(nil)
+)
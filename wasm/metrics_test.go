@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMetricName(t *testing.T) {
+	tests := []struct {
+		name     string
+		labels   []string
+		expected string
+	}{
+		{"score_updates_total", nil, "coraza_ban.score_updates_total"},
+		{"bans_issued_total", []string{"severity", "high"}, "coraza_ban.bans_issued_total.severity.high"},
+		{"bans_issued_total", []string{"severity", ""}, "coraza_ban.bans_issued_total.severity.none"},
+		{"bans_allowlisted_total", []string{"reason", "User Agent.v2"}, "coraza_ban.bans_allowlisted_total.reason.user_agent_v2"},
+	}
+
+	for _, tt := range tests {
+		if got := metricName(tt.name, tt.labels...); got != tt.expected {
+			t.Errorf("metricName(%s, %v) = %s, want %s", tt.name, tt.labels, got, tt.expected)
+		}
+	}
+}
+
+func TestMetricsEventHandler_OnBanEvent(t *testing.T) {
+	metrics := NewMockMetricsRecorder()
+	handler := NewMetricsEventHandler(metrics)
+
+	handler.OnBanEvent(NewBanEvent(BanEventIssued, "fp", "930120", "critical", "local"))
+	handler.OnBanEvent(NewBanEvent(BanEventIssued, "fp", "930120", "critical", "local"))
+	handler.OnBanEvent(NewBanEvent(BanEventEnforced, "fp", "930120", "critical", "redis"))
+	handler.OnBanEvent(NewBanEvent(BanEventScoreUpdated, "fp", "930120", "critical", "local"))
+	handler.OnBanEvent(NewBanEvent(BanEventExpired, "fp", "", "", "local"))
+	handler.OnBanEvent(NewBanEvent(BanEventLifted, "fp", "", "", "local"))
+
+	expected := map[string]uint64{
+		"coraza_ban.bans_issued_total.severity.critical": 2,
+		"coraza_ban.bans_enforced_total.source.redis":    1,
+		"coraza_ban.score_updates_total":                 1,
+		"coraza_ban.bans_expired_total.source.local":     1,
+		"coraza_ban.bans_lifted_total":                   1,
+	}
+	for name, value := range expected {
+		if metrics.Counters[name] != value {
+			t.Errorf("expected %s=%d, got %d", name, value, metrics.Counters[name])
+		}
+	}
+	if len(metrics.Counters) != len(expected) {
+		t.Errorf("unexpected counters: %v", metrics.Counters)
+	}
+}
+
+func TestMetricsEventHandler_RecordsBanDuration(t *testing.T) {
+	metrics := NewMockMetricsRecorder()
+	handler := NewMetricsEventHandler(metrics)
+
+	entry := NewBanEntry("fp", "waf-rule", "930120", "high", 600)
+	entry.CreatedAt -= 900
+	entry.ExpiresAt -= 900
+	handler.OnBanEvent(NewBanEndEvent(BanEventExpired, entry, "local"))
+
+	samples := metrics.Histograms["coraza_ban.ban_duration_seconds.end.expired"]
+	if len(samples) != 1 || samples[0] != 600 {
+		t.Errorf("expected one 600s duration sample, got %v", samples)
+	}
+}
+
+func TestMetricsRedisClient_RecordsCalls(t *testing.T) {
+	redis := NewMockRedisClient(true)
+	metrics := NewMockMetricsRecorder()
+	client := NewMetricsRedisClient(redis, metrics)
+
+	now := time.Unix(1700000000, 0)
+	client.now = func() time.Time {
+		now = now.Add(15 * time.Millisecond)
+		return now
+	}
+
+	client.CheckBanAsync("fp", func(bool, *BanEntry, bool) {})
+	redis.Fail = true
+	client.SetBanAsync(NewBanEntry("fp", "reason", "rule", "high", 60), func(bool) {})
+	client.GetScoreAsync("unknown", func(int, bool) {})
+
+	expected := map[string]uint64{
+		"coraza_ban.redis_calls_total.op.check_ban.result.ok":   1,
+		"coraza_ban.redis_calls_total.op.set_ban.result.error":  1,
+		"coraza_ban.redis_calls_total.op.get_score.result.miss": 1,
+	}
+	for name, value := range expected {
+		if metrics.Counters[name] != value {
+			t.Errorf("expected %s=%d, got %d", name, value, metrics.Counters[name])
+		}
+	}
+
+	latency := metrics.Histograms["coraza_ban.redis_latency_ms.op.check_ban"]
+	if len(latency) != 1 || latency[0] != 15 {
+		t.Errorf("expected check_ban latency [15], got %v", latency)
+	}
+}
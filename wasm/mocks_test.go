@@ -1,5 +1,11 @@
 package main
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 // =============================================================================
 // Mock Implementations for Unit Testing
 // =============================================================================
@@ -62,7 +68,7 @@ func (s *MockBanStore) SetBan(entry *BanEntry) error {
 	if s.SetBanErr != nil {
 		return s.SetBanErr
 	}
-	s.Bans[entry.Fingerprint] = entry
+	s.Bans[entry.ID()] = entry
 	return nil
 }
 
@@ -71,11 +77,31 @@ func (s *MockBanStore) DeleteBan(fingerprint string) error {
 	return nil
 }
 
+func (s *MockBanStore) SweepExpired() int {
+	expired := 0
+	for fingerprint, entry := range s.Bans {
+		if entry.IsExpired() {
+			delete(s.Bans, fingerprint)
+			expired++
+		}
+	}
+	return expired
+}
+
+func (s *MockBanStore) ListBans() ([]*BanEntry, error) {
+	entries := make([]*BanEntry, 0, len(s.Bans))
+	for _, entry := range s.Bans {
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
 // MockScoreStore implements ScoreStore interface for testing.
 type MockScoreStore struct {
-	Scores      map[string]*ScoreEntry
+	Scores       map[string]*ScoreEntry
 	IncrScoreErr error
 	IncrCalls    int
+	Decay        *ScoreDecay // nil disables decay
 }
 
 func NewMockScoreStore() *MockScoreStore {
@@ -94,7 +120,7 @@ func (s *MockScoreStore) SetScore(entry *ScoreEntry) error {
 	return nil
 }
 
-func (s *MockScoreStore) IncrScore(fingerprint string, increment int) (int, error) {
+func (s *MockScoreStore) IncrScore(fingerprint string, increment int, hits []RuleHit) (int, error) {
 	s.IncrCalls++
 	if s.IncrScoreErr != nil {
 		return 0, s.IncrScoreErr
@@ -105,15 +131,119 @@ func (s *MockScoreStore) IncrScore(fingerprint string, increment int) (int, erro
 		entry = NewScoreEntry(fingerprint)
 		s.Scores[fingerprint] = entry
 	}
+	entry.RecordHits(hits)
+	if s.Decay != nil {
+		entry.Incr(increment, s.Decay)
+		return entry.Score, nil
+	}
 	entry.Score += increment
 	return entry.Score, nil
 }
 
+// MockOffenseStore implements OffenseStore interface for testing.
+type MockOffenseStore struct {
+	Counts map[string]int
+}
+
+func NewMockOffenseStore() *MockOffenseStore {
+	return &MockOffenseStore{
+		Counts: make(map[string]int),
+	}
+}
+
+func (s *MockOffenseStore) GetOffenses(fingerprint string) (int, error) {
+	return s.Counts[fingerprint], nil
+}
+
+func (s *MockOffenseStore) IncrOffenses(fingerprint string) (int, error) {
+	s.Counts[fingerprint]++
+	return s.Counts[fingerprint], nil
+}
+
+func (s *MockOffenseStore) SyncOffenses(fingerprint string, count int) error {
+	if s.Counts[fingerprint] < count {
+		s.Counts[fingerprint] = count
+	}
+	return nil
+}
+
+// MockRateStore implements RateStore interface for testing.
+type MockRateStore struct {
+	Counts map[string]int
+}
+
+func NewMockRateStore() *MockRateStore {
+	return &MockRateStore{
+		Counts: make(map[string]int),
+	}
+}
+
+func (s *MockRateStore) IncrRequests(fingerprint string) (int, error) {
+	s.Counts[fingerprint]++
+	return s.Counts[fingerprint], nil
+}
+
+// MockNonceStore implements NonceStore interface for testing.
+// Nonces are recorded without expiry.
+type MockNonceStore struct {
+	Used map[string]bool
+	Err  error
+}
+
+func NewMockNonceStore() *MockNonceStore {
+	return &MockNonceStore{
+		Used: make(map[string]bool),
+	}
+}
+
+func (s *MockNonceStore) UseNonce(fingerprint, nonce string, expiresAt int64) (bool, error) {
+	if s.Err != nil {
+		return false, s.Err
+	}
+	key := fingerprint + "|" + nonce
+	if s.Used[key] {
+		return false, nil
+	}
+	s.Used[key] = true
+	return true, nil
+}
+
+// MockSignalStore implements SignalStore interface for testing.
+// Counts are kept per signal and fingerprint without a window.
+type MockSignalStore struct {
+	Counts map[string]int
+}
+
+func NewMockSignalStore() *MockSignalStore {
+	return &MockSignalStore{
+		Counts: make(map[string]int),
+	}
+}
+
+func (s *MockSignalStore) IncrSignal(fingerprint, signal string, windowSeconds int) (int, error) {
+	key := SignalKey(signal, fingerprint)
+	s.Counts[key]++
+	return s.Counts[key], nil
+}
+
+func (s *MockSignalStore) ResetSignal(fingerprint, signal string) error {
+	delete(s.Counts, SignalKey(signal, fingerprint))
+	return nil
+}
+
+func (s *MockSignalStore) SweepExpired() int {
+	return 0
+}
+
 // MockRedisClient implements RedisClient interface for testing.
 type MockRedisClient struct {
 	Configured     bool
+	Fail           bool // simulate Redis failures
 	BannedEntries  map[string]*BanEntry
 	Scores         map[string]int
+	Streams        map[string][]string
+	Offenses       map[string]int
+	ClusterScores  map[string]int
 	CheckBanCalls  int
 	SetBanCalls    int
 	IncrScoreCalls int
@@ -131,33 +261,202 @@ func (c *MockRedisClient) IsConfigured() bool {
 	return c.Configured
 }
 
-func (c *MockRedisClient) CheckBanAsync(fingerprint string, callback func(bool, *BanEntry)) {
+func (c *MockRedisClient) CheckBanAsync(fingerprint string, callback func(bool, *BanEntry, bool)) {
 	c.CheckBanCalls++
+	if c.Fail {
+		callback(false, nil, false)
+		return
+	}
 	entry, found := c.BannedEntries[fingerprint]
-	callback(found, entry)
+	callback(found, entry, true)
 }
 
 func (c *MockRedisClient) SetBanAsync(entry *BanEntry, callback func(bool)) {
 	c.SetBanCalls++
-	c.BannedEntries[entry.Fingerprint] = entry
+	if c.Fail {
+		callback(false)
+		return
+	}
+	c.BannedEntries[entry.ID()] = entry
 	callback(true)
 }
 
-func (c *MockRedisClient) DeleteBanAsync(fingerprint string) {
+func (c *MockRedisClient) DeleteBanAsync(fingerprint string, callback func(bool, bool)) {
+	if callback == nil {
+		callback = func(bool, bool) {}
+	}
+	if c.Fail {
+		callback(false, false)
+		return
+	}
+	_, found := c.BannedEntries[fingerprint]
 	delete(c.BannedEntries, fingerprint)
+	callback(found, true)
+}
+
+func (c *MockRedisClient) AppendStreamAsync(stream string, maxLen int, payload string) {
+	if c.Streams == nil {
+		c.Streams = make(map[string][]string)
+	}
+	c.Streams[stream] = append(c.Streams[stream], payload)
 }
 
 func (c *MockRedisClient) IncrScoreAsync(fingerprint string, increment, ttl int, callback func(int, bool)) {
 	c.IncrScoreCalls++
+	if c.Fail {
+		callback(0, false)
+		return
+	}
 	c.Scores[fingerprint] += increment
 	callback(c.Scores[fingerprint], true)
 }
 
+func (c *MockRedisClient) IncrClusterScoreAsync(fingerprint string, increment int, decay *ScoreDecay, ttl int, callback func(int, bool)) {
+	if c.Fail {
+		callback(0, false)
+		return
+	}
+	if c.ClusterScores == nil {
+		c.ClusterScores = make(map[string]int)
+	}
+	c.ClusterScores[fingerprint] += increment
+	callback(c.ClusterScores[fingerprint], true)
+}
+
+func (c *MockRedisClient) IncrOffensesAsync(fingerprint string, ttl int, callback func(int, bool)) {
+	if c.Fail {
+		callback(0, false)
+		return
+	}
+	if c.Offenses == nil {
+		c.Offenses = make(map[string]int)
+	}
+	c.Offenses[fingerprint]++
+	callback(c.Offenses[fingerprint], true)
+}
+
 func (c *MockRedisClient) GetScoreAsync(fingerprint string, callback func(int, bool)) {
 	score, found := c.Scores[fingerprint]
 	callback(score, found)
 }
 
+// FakeRESPBackend implements RedisTransport with an in-process key-value
+// store that executes RESP commands, standing in for a Redis HTTP bridge.
+type FakeRESPBackend struct {
+	Data     map[string]string
+	TTLs     map[string]int
+	Streams  map[string][]string
+	Scripts  map[string]bool // SHA1 digests of the cached scripts
+	Commands [][]string
+	Fail     bool // simulate transport failure
+}
+
+func NewFakeRESPBackend() *FakeRESPBackend {
+	return &FakeRESPBackend{
+		Data:    make(map[string]string),
+		TTLs:    make(map[string]int),
+		Streams: make(map[string][]string),
+		Scripts: make(map[string]bool),
+	}
+}
+
+func (b *FakeRESPBackend) Send(body []byte, callback func([]byte, bool)) error {
+	if b.Fail {
+		callback(nil, false)
+		return nil
+	}
+
+	commands, err := parseRESPReplies(body)
+	if err != nil {
+		return err
+	}
+
+	var reply []byte
+	for _, cmd := range commands {
+		args := make([]string, 0, len(cmd.Array))
+		for _, arg := range cmd.Array {
+			args = append(args, arg.Str)
+		}
+		b.Commands = append(b.Commands, args)
+		reply = append(reply, b.execute(args)...)
+	}
+
+	callback(reply, true)
+	return nil
+}
+
+func (b *FakeRESPBackend) execute(args []string) []byte {
+	if len(args) == 0 {
+		return []byte("-ERR empty command\r\n")
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		value, found := b.Data[args[1]]
+		if !found {
+			return []byte("$-1\r\n")
+		}
+		return []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(value), value))
+	case "SET":
+		b.Data[args[1]] = args[2]
+		if len(args) == 5 && strings.ToUpper(args[3]) == "EX" {
+			b.TTLs[args[1]], _ = strconv.Atoi(args[4])
+		}
+		return []byte("+OK\r\n")
+	case "XADD":
+		b.Streams[args[1]] = append(b.Streams[args[1]], args[len(args)-1])
+		return []byte("+1700000000000-0\r\n")
+	case "DEL":
+		_, found := b.Data[args[1]]
+		delete(b.Data, args[1])
+		delete(b.TTLs, args[1])
+		if found {
+			return []byte(":1\r\n")
+		}
+		return []byte(":0\r\n")
+	case "INCRBY":
+		current, _ := strconv.Atoi(b.Data[args[1]])
+		increment, err := strconv.Atoi(args[2])
+		if err != nil {
+			return []byte("-ERR value is not an integer\r\n")
+		}
+		current += increment
+		b.Data[args[1]] = strconv.Itoa(current)
+		return []byte(fmt.Sprintf(":%d\r\n", current))
+	case "EVAL", "EVALSHA":
+		// Emulates clusterScoreScript with the Go decay it mirrors
+		if strings.ToUpper(args[0]) == "EVAL" {
+			b.Scripts[scriptSHA(args[1])] = true
+		} else if !b.Scripts[args[1]] {
+			return []byte("-NOSCRIPT No matching script. Please use EVAL.\r\n")
+		}
+		key, argv := args[3], args[4:]
+		increment, _ := strconv.Atoi(argv[0])
+		decay := &ScoreDecay{Strategy: argv[2]}
+		decay.IntervalSeconds, _ = strconv.Atoi(argv[3])
+		decay.Rate, _ = strconv.Atoi(argv[4])
+		decay.HalfLifeSeconds, _ = strconv.Atoi(argv[5])
+
+		entry, err := ScoreEntryFromJSON([]byte(b.Data[key]))
+		if err != nil {
+			entry = NewScoreEntry(key)
+		}
+		entry.Incr(increment, decay)
+		data, _ := entry.ToJSON()
+		b.Data[key] = string(data)
+		b.TTLs[key], _ = strconv.Atoi(argv[6])
+		return []byte(fmt.Sprintf(":%d\r\n", entry.Score))
+	case "EXPIRE":
+		if _, found := b.Data[args[1]]; !found {
+			return []byte(":0\r\n")
+		}
+		b.TTLs[args[1]], _ = strconv.Atoi(args[2])
+		return []byte(":1\r\n")
+	}
+
+	return []byte("-ERR unknown command '" + args[0] + "'\r\n")
+}
+
 // MockEventHandler implements EventHandler interface for testing.
 type MockEventHandler struct {
 	Events []*BanEvent
@@ -173,14 +472,74 @@ func (h *MockEventHandler) OnBanEvent(event *BanEvent) {
 	h.Events = append(h.Events, event)
 }
 
+// MockMetricsRecorder implements MetricsRecorder interface for testing.
+type MockMetricsRecorder struct {
+	Counters   map[string]uint64
+	Gauges     map[string]int64
+	Histograms map[string][]uint64
+}
+
+func NewMockMetricsRecorder() *MockMetricsRecorder {
+	return &MockMetricsRecorder{
+		Counters:   make(map[string]uint64),
+		Gauges:     make(map[string]int64),
+		Histograms: make(map[string][]uint64),
+	}
+}
+
+func (r *MockMetricsRecorder) Increment(name string, delta uint64) {
+	r.Counters[name] += delta
+}
+
+func (r *MockMetricsRecorder) AddGauge(name string, delta int64) {
+	r.Gauges[name] += delta
+}
+
+func (r *MockMetricsRecorder) Record(name string, value uint64) {
+	r.Histograms[name] = append(r.Histograms[name], value)
+}
+
+// MockWebhookTransport implements WebhookTransport interface for testing.
+// Callbacks are held until Complete is called, like an async HTTP call.
+type MockWebhookTransport struct {
+	Requests  [][]byte
+	Headers   [][][2]string
+	Err       error
+	callbacks []func(bool)
+}
+
+func (t *MockWebhookTransport) Send(headers [][2]string, body []byte, callback func(bool)) error {
+	if t.Err != nil {
+		return t.Err
+	}
+	t.Requests = append(t.Requests, body)
+	t.Headers = append(t.Headers, headers)
+	t.callbacks = append(t.callbacks, callback)
+	return nil
+}
+
+// Complete delivers the outcome of the oldest pending request.
+func (t *MockWebhookTransport) Complete(ok bool) {
+	callback := t.callbacks[0]
+	t.callbacks = t.callbacks[1:]
+	callback(ok)
+}
+
 // =============================================================================
 // Compile-Time Interface Verification for Mocks
 // =============================================================================
 
 var (
-	_ Logger       = (*MockLogger)(nil)
-	_ BanStore     = (*MockBanStore)(nil)
-	_ ScoreStore   = (*MockScoreStore)(nil)
-	_ RedisClient  = (*MockRedisClient)(nil)
-	_ EventHandler = (*MockEventHandler)(nil)
+	_ Logger           = (*MockLogger)(nil)
+	_ BanStore         = (*MockBanStore)(nil)
+	_ ScoreStore       = (*MockScoreStore)(nil)
+	_ OffenseStore     = (*MockOffenseStore)(nil)
+	_ RateStore        = (*MockRateStore)(nil)
+	_ SignalStore      = (*MockSignalStore)(nil)
+	_ NonceStore       = (*MockNonceStore)(nil)
+	_ RedisClient      = (*MockRedisClient)(nil)
+	_ EventHandler     = (*MockEventHandler)(nil)
+	_ RedisTransport   = (*FakeRESPBackend)(nil)
+	_ MetricsRecorder  = (*MockMetricsRecorder)(nil)
+	_ WebhookTransport = (*MockWebhookTransport)(nil)
 )
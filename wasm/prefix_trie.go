@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/netip"
+)
+
+// =============================================================================
+// Prefix Trie
+// =============================================================================
+
+// prefixTrie is a binary radix trie for longest-prefix matching of IP
+// addresses. IPv4 and IPv6 prefixes are kept in separate trees so that a
+// lookup costs at most 32 or 128 steps regardless of the number of entries.
+type prefixTrie struct {
+	v4   *trieNode
+	v6   *trieNode
+	size int
+}
+
+// trieNode is a single bit position in the trie.
+type trieNode struct {
+	children [2]*trieNode
+	rule     *DenylistRule // non-nil if a prefix terminates here
+}
+
+// newPrefixTrie creates an empty prefix trie.
+func newPrefixTrie() *prefixTrie {
+	return &prefixTrie{
+		v4: &trieNode{},
+		v6: &trieNode{},
+	}
+}
+
+// Insert adds a prefix to the trie. Inserting the same prefix twice
+// replaces the previous rule.
+func (t *prefixTrie) Insert(prefix netip.Prefix, rule *DenylistRule) {
+	prefix = prefix.Masked()
+	addr := prefix.Addr()
+
+	node := t.root(addr)
+	bytes := addr.AsSlice()
+	for i := 0; i < prefix.Bits(); i++ {
+		bit := bitAt(bytes, i)
+		if node.children[bit] == nil {
+			node.children[bit] = &trieNode{}
+		}
+		node = node.children[bit]
+	}
+
+	if node.rule == nil {
+		t.size++
+	}
+	node.rule = rule
+}
+
+// Lookup returns the rule of the longest prefix containing addr,
+// or nil if no prefix matches.
+func (t *prefixTrie) Lookup(addr netip.Addr) *DenylistRule {
+	addr = addr.Unmap()
+	node := t.root(addr)
+	bytes := addr.AsSlice()
+
+	match := node.rule
+	for i := 0; i < addr.BitLen(); i++ {
+		node = node.children[bitAt(bytes, i)]
+		if node == nil {
+			break
+		}
+		if node.rule != nil {
+			match = node.rule
+		}
+	}
+	return match
+}
+
+// Len returns the number of prefixes stored in the trie.
+func (t *prefixTrie) Len() int {
+	return t.size
+}
+
+// root returns the tree for the address family of addr.
+func (t *prefixTrie) root(addr netip.Addr) *trieNode {
+	if addr.Is4() {
+		return t.v4
+	}
+	return t.v6
+}
+
+// bitAt returns the i-th most significant bit of bytes.
+func bitAt(bytes []byte, i int) int {
+	return int(bytes[i/8]>>(7-uint(i%8))) & 1
+}
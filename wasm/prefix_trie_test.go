@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestPrefixTrie_LongestMatch(t *testing.T) {
+	trie := newPrefixTrie()
+	trie.Insert(netip.MustParsePrefix("10.0.0.0/8"), &DenylistRule{Reason: "wide"})
+	trie.Insert(netip.MustParsePrefix("10.1.0.0/16"), &DenylistRule{Reason: "narrow"})
+	trie.Insert(netip.MustParsePrefix("2001:db8::/32"), &DenylistRule{Reason: "v6"})
+
+	tests := []struct {
+		addr     string
+		expected string
+	}{
+		{"10.2.3.4", "wide"},
+		{"10.1.3.4", "narrow"},
+		{"::ffff:10.1.3.4", "narrow"},
+		{"2001:db8:1::1", "v6"},
+		{"11.0.0.1", ""},
+		{"2001:db9::1", ""},
+	}
+
+	for _, tt := range tests {
+		rule := trie.Lookup(netip.MustParseAddr(tt.addr))
+		got := ""
+		if rule != nil {
+			got = rule.Reason
+		}
+		if got != tt.expected {
+			t.Errorf("Lookup(%s) = %q, expected %q", tt.addr, got, tt.expected)
+		}
+	}
+}
+
+func TestPrefixTrie_HostAndDefaultRoutes(t *testing.T) {
+	trie := newPrefixTrie()
+	trie.Insert(netip.MustParsePrefix("192.0.2.1/32"), &DenylistRule{Reason: "host"})
+
+	if rule := trie.Lookup(netip.MustParseAddr("192.0.2.1")); rule == nil || rule.Reason != "host" {
+		t.Error("expected /32 to match its host")
+	}
+	if rule := trie.Lookup(netip.MustParseAddr("192.0.2.2")); rule != nil {
+		t.Error("/32 should not match neighbouring host")
+	}
+
+	trie.Insert(netip.MustParsePrefix("0.0.0.0/0"), &DenylistRule{Reason: "default"})
+	if rule := trie.Lookup(netip.MustParseAddr("198.51.100.7")); rule == nil || rule.Reason != "default" {
+		t.Error("expected /0 to match any IPv4 address")
+	}
+	if rule := trie.Lookup(netip.MustParseAddr("2001:db8::1")); rule != nil {
+		t.Error("IPv4 /0 should not match IPv6 addresses")
+	}
+}
+
+func TestPrefixTrie_Len(t *testing.T) {
+	trie := newPrefixTrie()
+	trie.Insert(netip.MustParsePrefix("10.0.0.0/8"), &DenylistRule{})
+	trie.Insert(netip.MustParsePrefix("10.0.0.0/8"), &DenylistRule{})
+	trie.Insert(netip.MustParsePrefix("10.1.2.3/8"), &DenylistRule{}) // masks to 10.0.0.0/8
+	trie.Insert(netip.MustParsePrefix("fd00::/8"), &DenylistRule{})
+
+	if trie.Len() != 2 {
+		t.Errorf("expected 2 prefixes, got %d", trie.Len())
+	}
+}
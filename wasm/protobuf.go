@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// =============================================================================
+// Protobuf Struct Codec
+// =============================================================================
+// Minimal decoder of the protobuf wire format of google.protobuf.Struct,
+// the encoding Envoy uses for filter metadata returned by GetProperty.
+// Values are decoded to what encoding/json produces for the same JSON
+// document: map[string]any, []any, float64, string, bool and nil.
+
+// Protobuf wire types.
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// maxMetadataDepth caps the nesting of structs and lists in decoded
+// metadata, so that a crafted message cannot exhaust the stack.
+const maxMetadataDepth = 32
+
+// errProtoTruncated is returned when the message is truncated.
+var errProtoTruncated = errors.New("truncated protobuf message")
+
+// errProtoTooDeep is returned when the message nests structs and lists
+// deeper than maxMetadataDepth.
+var errProtoTooDeep = errors.New("protobuf message nested too deeply")
+
+// protoReader reads the fields of a protobuf message.
+type protoReader struct {
+	data []byte
+	pos  int
+}
+
+// done returns true when every field has been read.
+func (r *protoReader) done() bool {
+	return r.pos >= len(r.data)
+}
+
+// varint reads a base 128 varint.
+func (r *protoReader) varint() (uint64, error) {
+	value, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		return 0, errProtoTruncated
+	}
+	r.pos += n
+	return value, nil
+}
+
+// field reads the number and wire type of the next field.
+func (r *protoReader) field() (int, int, error) {
+	key, err := r.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(key >> 3), int(key & 7), nil
+}
+
+// bytes reads a length-delimited value.
+func (r *protoReader) bytes() ([]byte, error) {
+	length, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(len(r.data)-r.pos) {
+		return nil, errProtoTruncated
+	}
+	value := r.data[r.pos : r.pos+int(length)]
+	r.pos += int(length)
+	return value, nil
+}
+
+// fixed64 reads a little-endian 64-bit value.
+func (r *protoReader) fixed64() (uint64, error) {
+	if len(r.data)-r.pos < 8 {
+		return 0, errProtoTruncated
+	}
+	value := binary.LittleEndian.Uint64(r.data[r.pos:])
+	r.pos += 8
+	return value, nil
+}
+
+// skip skips the value of a field of unknown number.
+func (r *protoReader) skip(wireType int) error {
+	var err error
+	switch wireType {
+	case protoVarint:
+		_, err = r.varint()
+	case protoFixed64:
+		_, err = r.fixed64()
+	case protoBytes:
+		_, err = r.bytes()
+	case protoFixed32:
+		if len(r.data)-r.pos < 4 {
+			return errProtoTruncated
+		}
+		r.pos += 4
+	default:
+		return fmt.Errorf("unsupported protobuf wire type %d", wireType)
+	}
+	return err
+}
+
+// decodeStruct decodes a google.protobuf.Struct:
+//
+//	message Struct { map<string, Value> fields = 1; }
+func decodeStruct(data []byte) (map[string]any, error) {
+	return decodeNestedStruct(data, 1)
+}
+
+// decodeNestedStruct decodes a Struct at the given nesting depth.
+func decodeNestedStruct(data []byte, depth int) (map[string]any, error) {
+	if depth > maxMetadataDepth {
+		return nil, errProtoTooDeep
+	}
+
+	values := make(map[string]any)
+	r := &protoReader{data: data}
+
+	for !r.done() {
+		number, wireType, err := r.field()
+		if err != nil {
+			return nil, err
+		}
+		if number != 1 || wireType != protoBytes {
+			if err := r.skip(wireType); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		entry, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		key, value, err := decodeStructEntry(entry, depth)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+
+	return values, nil
+}
+
+// decodeStructEntry decodes a map entry of Struct fields:
+//
+//	message FieldsEntry { string key = 1; Value value = 2; }
+func decodeStructEntry(data []byte, depth int) (string, any, error) {
+	var key string
+	var value any
+	r := &protoReader{data: data}
+
+	for !r.done() {
+		number, wireType, err := r.field()
+		if err != nil {
+			return "", nil, err
+		}
+		if wireType != protoBytes || (number != 1 && number != 2) {
+			if err := r.skip(wireType); err != nil {
+				return "", nil, err
+			}
+			continue
+		}
+
+		field, err := r.bytes()
+		if err != nil {
+			return "", nil, err
+		}
+		if number == 1 {
+			key = string(field)
+		} else if value, err = decodeValue(field, depth); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return key, value, nil
+}
+
+// decodeValue decodes a google.protobuf.Value:
+//
+//	message Value {
+//	  oneof kind {
+//	    NullValue null_value = 1;
+//	    double number_value = 2;
+//	    string string_value = 3;
+//	    bool bool_value = 4;
+//	    Struct struct_value = 5;
+//	    ListValue list_value = 6;
+//	  }
+//	}
+//
+// depth is the nesting depth of the struct or list holding the value.
+func decodeValue(data []byte, depth int) (any, error) {
+	var value any
+	r := &protoReader{data: data}
+
+	for !r.done() {
+		number, wireType, err := r.field()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case number == 1 && wireType == protoVarint:
+			_, err = r.varint()
+			value = nil
+		case number == 2 && wireType == protoFixed64:
+			var bits uint64
+			bits, err = r.fixed64()
+			value = math.Float64frombits(bits)
+		case number == 3 && wireType == protoBytes:
+			var field []byte
+			field, err = r.bytes()
+			value = string(field)
+		case number == 4 && wireType == protoVarint:
+			var flag uint64
+			flag, err = r.varint()
+			value = flag != 0
+		case number == 5 && wireType == protoBytes:
+			var field []byte
+			if field, err = r.bytes(); err == nil {
+				value, err = decodeNestedStruct(field, depth+1)
+			}
+		case number == 6 && wireType == protoBytes:
+			var field []byte
+			if field, err = r.bytes(); err == nil {
+				value, err = decodeList(field, depth+1)
+			}
+		default:
+			err = r.skip(wireType)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return value, nil
+}
+
+// decodeList decodes a google.protobuf.ListValue:
+//
+//	message ListValue { repeated Value values = 1; }
+func decodeList(data []byte, depth int) ([]any, error) {
+	if depth > maxMetadataDepth {
+		return nil, errProtoTooDeep
+	}
+
+	values := []any{}
+	r := &protoReader{data: data}
+
+	for !r.done() {
+		number, wireType, err := r.field()
+		if err != nil {
+			return nil, err
+		}
+		if number != 1 || wireType != protoBytes {
+			if err := r.skip(wireType); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		field, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		value, err := decodeValue(field, depth)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
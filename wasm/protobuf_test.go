@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// encodeTestStruct encodes values as a google.protobuf.Struct.
+func encodeTestStruct(values map[string]any) []byte {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var data []byte
+	for _, key := range keys {
+		entry := appendTestBytes(nil, 1, []byte(key))
+		entry = appendTestBytes(entry, 2, encodeTestValue(values[key]))
+		data = appendTestBytes(data, 1, entry)
+	}
+	return data
+}
+
+// encodeTestValue encodes a value as a google.protobuf.Value.
+func encodeTestValue(value any) []byte {
+	switch v := value.(type) {
+	case nil:
+		return []byte{1<<3 | protoVarint, 0}
+	case float64:
+		data := []byte{2<<3 | protoFixed64}
+		return binary.LittleEndian.AppendUint64(data, math.Float64bits(v))
+	case string:
+		return appendTestBytes(nil, 3, []byte(v))
+	case bool:
+		if v {
+			return []byte{4<<3 | protoVarint, 1}
+		}
+		return []byte{4<<3 | protoVarint, 0}
+	case map[string]any:
+		return appendTestBytes(nil, 5, encodeTestStruct(v))
+	case []any:
+		var list []byte
+		for _, item := range v {
+			list = appendTestBytes(list, 1, encodeTestValue(item))
+		}
+		return appendTestBytes(nil, 6, list)
+	}
+	panic("unsupported test value")
+}
+
+// appendTestBytes appends a length-delimited field.
+func appendTestBytes(data []byte, number int, value []byte) []byte {
+	data = binary.AppendUvarint(data, uint64(number<<3|protoBytes))
+	data = binary.AppendUvarint(data, uint64(len(value)))
+	return append(data, value...)
+}
+
+func TestDecodeStruct(t *testing.T) {
+	expected := map[string]any{
+		"action":  "block",
+		"score":   float64(10),
+		"blocked": true,
+		"missing": nil,
+		"tags":    []any{"attack-sqli", "OWASP_CRS"},
+		"rule":    map[string]any{"id": "942100", "severity": "critical"},
+	}
+
+	values, err := decodeStruct(encodeTestStruct(expected))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("decodeStruct = %v, expected %v", values, expected)
+	}
+}
+
+func TestDecodeStruct_UnknownFields(t *testing.T) {
+	// A varint field 2 and a fixed32 field 3 precede the entry
+	data := []byte{2<<3 | protoVarint, 150, 1, 3<<3 | protoFixed32, 0, 0, 0, 0}
+	data = append(data, encodeTestStruct(map[string]any{"action": "block"})...)
+
+	values, err := decodeStruct(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if values["action"] != "block" {
+		t.Errorf("unexpected values: %v", values)
+	}
+}
+
+func TestDecodeStruct_Truncated(t *testing.T) {
+	data := encodeTestStruct(map[string]any{"action": "block"})
+
+	if _, err := decodeStruct(data[:len(data)-2]); err == nil {
+		t.Error("expected error for truncated message")
+	}
+	if _, err := decodeStruct([]byte("action=block")); err == nil {
+		t.Error("expected error for text")
+	}
+}
+
+func TestDecodeStruct_Depth(t *testing.T) {
+	// nested returns a struct holding depth levels of alternating structs
+	// and lists
+	nested := func(depth int) map[string]any {
+		var value any = "block"
+		for level := depth; level > 1; level-- {
+			if level%2 == 0 {
+				value = []any{value}
+			} else {
+				value = map[string]any{"inner": value}
+			}
+		}
+		return map[string]any{"action": value}
+	}
+
+	if _, err := decodeStruct(encodeTestStruct(nested(maxMetadataDepth))); err != nil {
+		t.Errorf("unexpected error at the depth limit: %v", err)
+	}
+	if _, err := decodeStruct(encodeTestStruct(nested(maxMetadataDepth + 1))); err != errProtoTooDeep {
+		t.Errorf("expected errProtoTooDeep past the depth limit, got %v", err)
+	}
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
 )
 
 // Redis HTTP API integration helpers
-// Used by WebdisClient for async HTTP-based Redis operations.
+// Used by WebdisClient for async HTTP-based Redis operations, and by both
+// clients for server-side scripts.
 
 // getHttpCallResponseStatus extracts the :status from HTTP call response headers.
 // This is a helper function used by WebdisClient to check response status.
@@ -21,3 +27,83 @@ func getHttpCallResponseStatus() string {
 	}
 	return ""
 }
+
+// clusterScoreScript decays a cluster-wide score and adds an increment
+// atomically in Redis. It mirrors ScoreDecay.Decay and ScoreEntry.Incr so
+// that the cluster-wide score decays like a local one. The score and the
+// time of its last update are kept in a hash.
+//
+//	KEYS[1] = cluster score key
+//	ARGV    = increment, now, strategy, interval, rate, half-life, ttl
+const clusterScoreScript = `
+local score = tonumber(redis.call('HGET', KEYS[1], 'score')) or 0
+local now = tonumber(ARGV[2])
+local updated = tonumber(redis.call('HGET', KEYS[1], 'updated')) or now
+local strategy, interval, rate, halflife = ARGV[3], tonumber(ARGV[4]), tonumber(ARGV[5]), tonumber(ARGV[6])
+local elapsed = now - updated
+if elapsed > 0 then
+  if score <= 0 then
+    score, updated = 0, now
+  elseif strategy == 'exponential' then
+    local exact = score * 2 ^ (-elapsed / halflife)
+    local decayed = math.ceil(exact)
+    if exact < 0.5 then
+      score, updated = 0, now
+    elseif decayed < score then
+      updated = updated + math.floor(halflife * math.log(score / decayed) / math.log(2))
+      score = decayed
+    end
+  elseif strategy == 'step' then
+    if elapsed >= interval then
+      score, updated = 0, now
+    end
+  else
+    local intervals = math.floor(elapsed / interval)
+    if intervals > 0 then
+      score = score - intervals * rate
+      if score <= 0 then
+        score, updated = 0, now
+      else
+        updated = updated + intervals * interval
+      end
+    end
+  end
+end
+score = score + tonumber(ARGV[1])
+if strategy == 'step' then
+  updated = now
+end
+redis.call('HSET', KEYS[1], 'score', score, 'updated', updated)
+redis.call('EXPIRE', KEYS[1], ARGV[7])
+return score
+`
+
+// clusterScoreSHA is the SHA1 digest Redis caches clusterScoreScript
+// under. Clients call the script with EVALSHA and send it with EVAL, which
+// loads it into the script cache, only when Redis answers NOSCRIPT (e.g.,
+// on the first call or after a restart).
+var clusterScoreSHA = scriptSHA(clusterScoreScript)
+
+// scriptSHA returns the SHA1 digest of a Lua script, as used by EVALSHA.
+func scriptSHA(script string) string {
+	sum := sha1.Sum([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+// isNoScript returns true if a Redis error means the script is not cached.
+func isNoScript(message string) bool {
+	return strings.HasPrefix(message, "NOSCRIPT")
+}
+
+// clusterScoreArgs returns the ARGV of clusterScoreScript.
+func clusterScoreArgs(increment int, decay *ScoreDecay, ttl int, now int64) []string {
+	return []string{
+		strconv.Itoa(increment),
+		strconv.FormatInt(now, 10),
+		decay.Strategy,
+		strconv.Itoa(decay.IntervalSeconds),
+		strconv.Itoa(decay.Rate),
+		strconv.Itoa(decay.HalfLifeSeconds),
+		strconv.Itoa(ttl),
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
 )
@@ -15,41 +17,66 @@ import (
 // WebdisClient implements RedisClient using HTTP calls to Webdis.
 // It uses proxywasm.DispatchHttpCall for async operations.
 type WebdisClient struct {
-	cluster string
-	timeout uint32
-	logger  Logger
+	cluster    string
+	timeout    uint32
+	keys       *Keyspace
+	authHeader [2]string
+	logger     Logger
+	onExpire   func(*BanEntry)
 }
 
 // NewWebdisClient creates a new Webdis-based Redis client.
-func NewWebdisClient(cluster string, timeout uint32, logger Logger) *WebdisClient {
+func NewWebdisClient(cluster string, timeout uint32, keys *Keyspace, logger Logger) *WebdisClient {
 	return &WebdisClient{
 		cluster: cluster,
 		timeout: timeout,
+		keys:    keys,
 		logger:  logger,
 	}
 }
 
+// SetAuth configures a credential header sent with every Webdis call
+// (e.g., "authorization" with an HTTP Basic value for Webdis ACLs).
+func (c *WebdisClient) SetAuth(header, token string) {
+	c.authHeader = [2]string{header, token}
+}
+
+// SetOnExpire registers a callback invoked when a ban read from Redis has
+// expired and is deleted.
+func (c *WebdisClient) SetOnExpire(callback func(*BanEntry)) {
+	c.onExpire = callback
+}
+
+// requestHeaders builds the headers for a Webdis command path.
+func (c *WebdisClient) requestHeaders(path string) [][2]string {
+	headers := [][2]string{
+		{":method", "GET"}, // webdis uses GET for all commands
+		{":path", path},
+		{":authority", c.cluster},
+		{"accept", "application/json"},
+	}
+	if c.authHeader[1] != "" {
+		headers = append(headers, c.authHeader)
+	}
+	return headers
+}
+
 // IsConfigured returns true if Redis cluster is configured.
 func (c *WebdisClient) IsConfigured() bool {
 	return c.cluster != ""
 }
 
 // CheckBanAsync checks if a fingerprint is banned in Redis asynchronously.
-func (c *WebdisClient) CheckBanAsync(fingerprint string, callback func(bool, *BanEntry)) {
+func (c *WebdisClient) CheckBanAsync(fingerprint string, callback func(bool, *BanEntry, bool)) {
 	if !c.IsConfigured() {
-		callback(false, nil)
+		callback(false, nil, true)
 		return
 	}
 
-	key := BanKey(fingerprint)
+	key := c.keys.Ban(fingerprint)
 	path := fmt.Sprintf("/GET/%s", key)
 
-	headers := [][2]string{
-		{":method", "GET"},
-		{":path", path},
-		{":authority", c.cluster},
-		{"accept", "application/json"},
-	}
+	headers := c.requestHeaders(path)
 
 	_, err := proxywasm.DispatchHttpCall(
 		c.cluster,
@@ -64,17 +91,17 @@ func (c *WebdisClient) CheckBanAsync(fingerprint string, callback func(bool, *Ba
 
 	if err != nil {
 		c.logger.Error("failed to dispatch Redis ban check: %v", err)
-		callback(false, nil)
+		callback(false, nil, false)
 	}
 }
 
 // handleCheckBanResponse processes the response from Redis ban check.
-func (c *WebdisClient) handleCheckBanResponse(fingerprint string, bodySize int, callback func(bool, *BanEntry)) {
+func (c *WebdisClient) handleCheckBanResponse(fingerprint string, bodySize int, callback func(bool, *BanEntry, bool)) {
 	// Get response body
 	body, err := proxywasm.GetHttpCallResponseBody(0, bodySize)
 	if err != nil {
 		c.logger.Error("failed to get Redis response body: %v", err)
-		callback(false, nil)
+		callback(false, nil, false)
 		return
 	}
 
@@ -82,13 +109,13 @@ func (c *WebdisClient) handleCheckBanResponse(fingerprint string, bodySize int,
 	status := getHttpCallResponseStatus()
 	if status != "200" {
 		c.logger.Debug("Redis returned non-200 status: %s", status)
-		callback(false, nil)
+		callback(false, nil, false)
 		return
 	}
 
 	// Parse response
 	entry, found := c.parseRedisBanResponse(body, fingerprint)
-	callback(found, entry)
+	callback(found, entry, true)
 }
 
 // parseRedisBanResponse parses the Redis GET response.
@@ -132,7 +159,10 @@ func (c *WebdisClient) parseRedisBanResponse(body []byte, fingerprint string) (*
 	if entry.IsExpired() {
 		c.logger.Debug("ban from Redis is expired")
 		// Delete expired entry from Redis
-		c.DeleteBanAsync(fingerprint)
+		c.DeleteBanAsync(fingerprint, nil)
+		if c.onExpire != nil {
+			c.onExpire(entry)
+		}
 		return nil, false
 	}
 
@@ -154,17 +184,12 @@ func (c *WebdisClient) SetBanAsync(entry *BanEntry, callback func(bool)) {
 		return
 	}
 
-	key := BanKey(entry.Fingerprint)
+	key := c.keys.Ban(entry.ID())
 	// Use SETEX to set with TTL, URL-encode the JSON to handle special characters
 	encodedJSON := url.PathEscape(string(entryJSON))
 	path := fmt.Sprintf("/SETEX/%s/%d/%s", key, entry.TTL, encodedJSON)
 
-	headers := [][2]string{
-		{":method", "GET"}, // webdis uses GET for all commands
-		{":path", path},
-		{":authority", c.cluster},
-		{"accept", "application/json"},
-	}
+	headers := c.requestHeaders(path)
 
 	_, err = proxywasm.DispatchHttpCall(
 		c.cluster,
@@ -184,21 +209,16 @@ func (c *WebdisClient) SetBanAsync(entry *BanEntry, callback func(bool)) {
 	}
 }
 
-// DeleteBanAsync removes a ban from Redis asynchronously (fire-and-forget).
-func (c *WebdisClient) DeleteBanAsync(fingerprint string) {
+// AppendStreamAsync appends an event to a Redis stream (fire-and-forget).
+func (c *WebdisClient) AppendStreamAsync(stream string, maxLen int, payload string) {
 	if !c.IsConfigured() {
 		return
 	}
 
-	key := BanKey(fingerprint)
-	path := fmt.Sprintf("/DEL/%s", key)
+	key := c.keys.Stream(stream)
+	path := fmt.Sprintf("/XADD/%s/MAXLEN/~/%d/*/event/%s", key, maxLen, url.PathEscape(payload))
 
-	headers := [][2]string{
-		{":method", "GET"},
-		{":path", path},
-		{":authority", c.cluster},
-		{"accept", "application/json"},
-	}
+	headers := c.requestHeaders(path)
 
 	_, err := proxywasm.DispatchHttpCall(
 		c.cluster,
@@ -208,13 +228,75 @@ func (c *WebdisClient) DeleteBanAsync(fingerprint string) {
 		c.timeout,
 		func(numHeaders, bodySize, numTrailers int) {
 			// Fire and forget
-			c.logger.Debug("ban deleted from Redis for %s", fingerprint)
+			if status := getHttpCallResponseStatus(); status != "200" {
+				c.logger.Debug("Redis stream append returned status %s", status)
+			}
+		},
+	)
+
+	if err != nil {
+		c.logger.Error("failed to dispatch Redis stream append: %v", err)
+	}
+}
+
+// DeleteBanAsync removes a ban from Redis asynchronously.
+func (c *WebdisClient) DeleteBanAsync(fingerprint string, callback func(bool, bool)) {
+	if callback == nil {
+		callback = func(bool, bool) {}
+	}
+	if !c.IsConfigured() {
+		callback(false, true)
+		return
+	}
+
+	key := c.keys.Ban(fingerprint)
+	path := fmt.Sprintf("/DEL/%s", key)
+
+	headers := c.requestHeaders(path)
+
+	_, err := proxywasm.DispatchHttpCall(
+		c.cluster,
+		headers,
+		nil,
+		nil,
+		c.timeout,
+		func(numHeaders, bodySize, numTrailers int) {
+			c.handleDeleteResponse(fingerprint, bodySize, callback)
 		},
 	)
 
 	if err != nil {
 		c.logger.Error("failed to dispatch Redis ban delete: %v", err)
+		callback(false, false)
+	}
+}
+
+// handleDeleteResponse processes a DEL response.
+func (c *WebdisClient) handleDeleteResponse(fingerprint string, bodySize int, callback func(bool, bool)) {
+	body, err := proxywasm.GetHttpCallResponseBody(0, bodySize)
+	if err != nil || getHttpCallResponseStatus() != "200" {
+		c.logger.Debug("Redis ban delete failed for %s", fingerprint)
+		callback(false, false)
+		return
+	}
+
+	// Parse response: {"DEL": <number of deleted keys>}
+	var response map[string]interface{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		c.logger.Error("failed to parse Redis DEL response: %v", err)
+		callback(false, false)
+		return
+	}
+
+	deleted, ok := response["DEL"].(float64)
+	if !ok {
+		c.logger.Error("unexpected Redis DEL response: %s", body)
+		callback(false, false)
+		return
 	}
+
+	c.logger.Debug("ban deleted from Redis for %s", fingerprint)
+	callback(deleted > 0, true)
 }
 
 // IncrScoreAsync atomically increments a score in Redis and sets TTL.
@@ -225,16 +307,119 @@ func (c *WebdisClient) IncrScoreAsync(fingerprint string, increment, ttl int, ca
 		return
 	}
 
-	key := ScoreKey(fingerprint)
+	c.incrAsync(c.keys.Score(fingerprint), increment, ttl, callback)
+}
+
+// IncrClusterScoreAsync decays and increments a cluster-wide score with
+// EVALSHA, falling back to EVAL when the script is not cached yet. With
+// EVAL, the script travels URL-encoded in the command path.
+func (c *WebdisClient) IncrClusterScoreAsync(fingerprint string, increment int, decay *ScoreDecay, ttl int, callback func(int, bool)) {
+	if !c.IsConfigured() {
+		callback(0, false) // Not configured, no cluster-wide score
+		return
+	}
+
+	args := clusterScoreArgs(increment, decay, ttl, time.Now().Unix())
+	for i, arg := range args {
+		args[i] = url.PathEscape(arg)
+	}
+	keysAndArgs := "1/" + c.keys.ClusterScore(fingerprint) + "/" + strings.Join(args, "/")
+
+	c.evalAsync("EVALSHA", "/EVALSHA/"+clusterScoreSHA+"/"+keysAndArgs, func(score int, ok, noScript bool) {
+		if noScript {
+			c.evalAsync("EVAL", "/EVAL/"+url.PathEscape(clusterScoreScript)+"/"+keysAndArgs,
+				func(score int, ok, _ bool) { callback(score, ok) })
+			return
+		}
+		callback(score, ok)
+	})
+}
+
+// evalAsync dispatches an EVAL or EVALSHA command path with an integer
+// reply. The callback reports whether Redis answered NOSCRIPT.
+func (c *WebdisClient) evalAsync(command, path string, callback func(int, bool, bool)) {
+	headers := c.requestHeaders(path)
+
+	_, err := proxywasm.DispatchHttpCall(
+		c.cluster,
+		headers,
+		nil,
+		nil,
+		c.timeout,
+		func(numHeaders, bodySize, numTrailers int) {
+			c.handleEvalResponse(command, bodySize, callback)
+		},
+	)
+
+	if err != nil {
+		c.logger.Error("failed to dispatch Redis cluster score: %v", err)
+		callback(0, false, false)
+	}
+}
+
+// handleEvalResponse processes an EVAL or EVALSHA response with an integer
+// reply. Webdis reports Redis errors as {"<command>": [false, "<error>"]}.
+func (c *WebdisClient) handleEvalResponse(command string, bodySize int, callback func(int, bool, bool)) {
+	body, err := proxywasm.GetHttpCallResponseBody(0, bodySize)
+	if err != nil {
+		c.logger.Error("failed to get Redis %s response body: %v", command, err)
+		callback(0, false, false)
+		return
+	}
+
+	status := getHttpCallResponseStatus()
+	if status != "200" {
+		c.logger.Debug("Redis %s returned non-200 status: %s", command, status)
+		callback(0, false, false)
+		return
+	}
+
+	// Parse response: {"EVALSHA": <number>}
+	var response map[string]interface{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		c.logger.Error("failed to parse Redis %s response: %v", command, err)
+		callback(0, false, false)
+		return
+	}
+
+	switch value := response[command].(type) {
+	case float64:
+		callback(int(value), true, false)
+	case []interface{}:
+		message := ""
+		if len(value) > 0 {
+			message, _ = value[len(value)-1].(string)
+		}
+		if isNoScript(message) {
+			c.logger.Debug("cluster score script not cached in Redis, sending it")
+			callback(0, false, true)
+			return
+		}
+		c.logger.Error("Redis %s returned error: %s", command, message)
+		callback(0, false, false)
+	default:
+		c.logger.Error("unexpected Redis %s response: %s", command, body)
+		callback(0, false, false)
+	}
+}
+
+// IncrOffensesAsync atomically increments an offense count in Redis and
+// sets TTL, so offenses are forgotten after the escalation window.
+func (c *WebdisClient) IncrOffensesAsync(fingerprint string, ttl int, callback func(int, bool)) {
+	if !c.IsConfigured() {
+		callback(0, false) // Offenses are not tracked without Redis
+		return
+	}
+
+	c.incrAsync(c.keys.Offense(fingerprint), 1, ttl, callback)
+}
+
+// incrAsync increments a counter key with INCRBY and refreshes its TTL.
+func (c *WebdisClient) incrAsync(key string, increment, ttl int, callback func(int, bool)) {
 	// Use INCRBY to atomically increment
 	path := fmt.Sprintf("/INCRBY/%s/%d", key, increment)
 
-	headers := [][2]string{
-		{":method", "GET"},
-		{":path", path},
-		{":authority", c.cluster},
-		{"accept", "application/json"},
-	}
+	headers := c.requestHeaders(path)
 
 	_, err := proxywasm.DispatchHttpCall(
 		c.cluster,
@@ -243,18 +428,18 @@ func (c *WebdisClient) IncrScoreAsync(fingerprint string, increment, ttl int, ca
 		nil,
 		c.timeout,
 		func(numHeaders, bodySize, numTrailers int) {
-			c.handleIncrScoreResponse(fingerprint, bodySize, ttl, callback)
+			c.handleIncrResponse(key, bodySize, ttl, callback)
 		},
 	)
 
 	if err != nil {
-		c.logger.Error("failed to dispatch Redis score incr: %v", err)
+		c.logger.Error("failed to dispatch Redis incr: %v", err)
 		callback(0, false)
 	}
 }
 
-// handleIncrScoreResponse processes the INCRBY response and sets TTL.
-func (c *WebdisClient) handleIncrScoreResponse(fingerprint string, bodySize, ttl int, callback func(int, bool)) {
+// handleIncrResponse processes the INCRBY response and sets TTL.
+func (c *WebdisClient) handleIncrResponse(key string, bodySize, ttl int, callback func(int, bool)) {
 	body, err := proxywasm.GetHttpCallResponseBody(0, bodySize)
 	if err != nil {
 		c.logger.Error("failed to get Redis INCRBY response body: %v", err)
@@ -298,22 +483,16 @@ func (c *WebdisClient) handleIncrScoreResponse(fingerprint string, bodySize, ttl
 	}
 
 	// Set TTL on the key (fire-and-forget)
-	c.setScoreTTL(fingerprint, ttl)
+	c.setKeyTTL(key, ttl)
 
 	callback(newScore, true)
 }
 
-// setScoreTTL sets the TTL on a score key (fire-and-forget).
-func (c *WebdisClient) setScoreTTL(fingerprint string, ttl int) {
-	key := ScoreKey(fingerprint)
+// setKeyTTL sets the TTL on a counter key (fire-and-forget).
+func (c *WebdisClient) setKeyTTL(key string, ttl int) {
 	path := fmt.Sprintf("/EXPIRE/%s/%d", key, ttl)
 
-	headers := [][2]string{
-		{":method", "GET"},
-		{":path", path},
-		{":authority", c.cluster},
-		{"accept", "application/json"},
-	}
+	headers := c.requestHeaders(path)
 
 	_, err := proxywasm.DispatchHttpCall(
 		c.cluster,
@@ -323,7 +502,7 @@ func (c *WebdisClient) setScoreTTL(fingerprint string, ttl int) {
 		c.timeout,
 		func(numHeaders, bodySize, numTrailers int) {
 			// Fire and forget
-			c.logger.Debug("score TTL set for %s", fingerprint)
+			c.logger.Debug("TTL set for %s", key)
 		},
 	)
 
@@ -339,15 +518,10 @@ func (c *WebdisClient) GetScoreAsync(fingerprint string, callback func(int, bool
 		return
 	}
 
-	key := ScoreKey(fingerprint)
+	key := c.keys.Score(fingerprint)
 	path := fmt.Sprintf("/GET/%s", key)
 
-	headers := [][2]string{
-		{":method", "GET"},
-		{":path", path},
-		{":authority", c.cluster},
-		{"accept", "application/json"},
-	}
+	headers := c.requestHeaders(path)
 
 	_, err := proxywasm.DispatchHttpCall(
 		c.cluster,
@@ -437,8 +611,8 @@ func (c *NoopRedisClient) IsConfigured() bool {
 }
 
 // CheckBanAsync immediately calls the callback with not-banned result.
-func (c *NoopRedisClient) CheckBanAsync(fingerprint string, callback func(bool, *BanEntry)) {
-	callback(false, nil) // Always not found
+func (c *NoopRedisClient) CheckBanAsync(fingerprint string, callback func(bool, *BanEntry, bool)) {
+	callback(false, nil, true) // Always not found
 }
 
 // SetBanAsync immediately calls the callback with success.
@@ -446,8 +620,15 @@ func (c *NoopRedisClient) SetBanAsync(entry *BanEntry, callback func(bool)) {
 	callback(true) // Always succeeds
 }
 
-// DeleteBanAsync does nothing.
-func (c *NoopRedisClient) DeleteBanAsync(fingerprint string) {
+// DeleteBanAsync reports that no ban existed.
+func (c *NoopRedisClient) DeleteBanAsync(fingerprint string, callback func(bool, bool)) {
+	if callback != nil {
+		callback(false, true)
+	}
+}
+
+// AppendStreamAsync does nothing.
+func (c *NoopRedisClient) AppendStreamAsync(stream string, maxLen int, payload string) {
 	// No-op
 }
 
@@ -456,6 +637,16 @@ func (c *NoopRedisClient) IncrScoreAsync(fingerprint string, increment, ttl int,
 	callback(0, false) // Not configured, score not tracked in Redis
 }
 
+// IncrClusterScoreAsync immediately calls the callback with failure.
+func (c *NoopRedisClient) IncrClusterScoreAsync(fingerprint string, increment int, decay *ScoreDecay, ttl int, callback func(int, bool)) {
+	callback(0, false) // Not configured, no cluster-wide score
+}
+
+// IncrOffensesAsync immediately calls the callback with zero count.
+func (c *NoopRedisClient) IncrOffensesAsync(fingerprint string, ttl int, callback func(int, bool)) {
+	callback(0, false) // Not configured, offenses not tracked in Redis
+}
+
 // GetScoreAsync immediately calls the callback with not-found result.
 func (c *NoopRedisClient) GetScoreAsync(fingerprint string, callback func(int, bool)) {
 	callback(0, false) // Always not found
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+)
+
+// =============================================================================
+// RESPClient - Redis client speaking RESP over an HTTP bridge
+// =============================================================================
+
+// RESPClient implements RedisClient by POSTing RESP-framed commands to a
+// Redis HTTP bridge. Unlike WebdisClient, values travel in the request
+// body rather than the URL path, so no URL encoding or path length limits
+// apply. Commands that belong together (INCRBY + EXPIRE) are pipelined in
+// a single request.
+type RESPClient struct {
+	transport RedisTransport
+	keys      *Keyspace
+	logger    Logger
+	onExpire  func(*BanEntry)
+}
+
+// NewRESPClient creates a new RESP client using the given transport.
+func NewRESPClient(transport RedisTransport, keys *Keyspace, logger Logger) *RESPClient {
+	return &RESPClient{
+		transport: transport,
+		keys:      keys,
+		logger:    logger,
+	}
+}
+
+// SetOnExpire registers a callback invoked when a ban read from Redis has
+// expired and is deleted.
+func (c *RESPClient) SetOnExpire(callback func(*BanEntry)) {
+	c.onExpire = callback
+}
+
+// IsConfigured returns true if a transport is available.
+func (c *RESPClient) IsConfigured() bool {
+	return c.transport != nil
+}
+
+// CheckBanAsync checks if a fingerprint is banned in Redis asynchronously.
+func (c *RESPClient) CheckBanAsync(fingerprint string, callback func(bool, *BanEntry, bool)) {
+	if !c.IsConfigured() {
+		callback(false, nil, true)
+		return
+	}
+
+	c.do("GET", encodeRESPCommand("GET", c.keys.Ban(fingerprint)), func(reply respValue, ok bool) {
+		if !ok {
+			callback(false, nil, false)
+			return
+		}
+		if reply.Nil || reply.Type != respBulkString {
+			callback(false, nil, true)
+			return
+		}
+
+		entry, err := BanEntryFromJSON([]byte(reply.Str))
+		if err != nil {
+			c.logger.Error("failed to parse ban entry from Redis: %v", err)
+			callback(false, nil, true)
+			return
+		}
+
+		if entry.IsExpired() {
+			c.logger.Debug("ban from Redis is expired")
+			c.DeleteBanAsync(fingerprint, nil)
+			if c.onExpire != nil {
+				c.onExpire(entry)
+			}
+			callback(false, nil, true)
+			return
+		}
+
+		callback(true, entry, true)
+	})
+}
+
+// SetBanAsync stores a ban entry in Redis with its TTL.
+func (c *RESPClient) SetBanAsync(entry *BanEntry, callback func(bool)) {
+	if !c.IsConfigured() {
+		callback(true) // Treat as success when not configured
+		return
+	}
+
+	entryJSON, err := entry.ToJSON()
+	if err != nil {
+		c.logger.Error("failed to serialize ban entry: %v", err)
+		callback(false)
+		return
+	}
+
+	body := encodeRESPCommand("SET", c.keys.Ban(entry.ID()), string(entryJSON), "EX", strconv.Itoa(entry.TTL))
+	c.do("SET", body, func(reply respValue, ok bool) {
+		callback(ok && reply.Type == respSimpleString && reply.Str == "OK")
+	})
+}
+
+// DeleteBanAsync removes a ban from Redis.
+func (c *RESPClient) DeleteBanAsync(fingerprint string, callback func(bool, bool)) {
+	if callback == nil {
+		callback = func(bool, bool) {}
+	}
+	if !c.IsConfigured() {
+		callback(false, true)
+		return
+	}
+
+	c.do("DEL", encodeRESPCommand("DEL", c.keys.Ban(fingerprint)), func(reply respValue, ok bool) {
+		if !ok || reply.Type != respInteger {
+			callback(false, false)
+			return
+		}
+		c.logger.Debug("ban deleted from Redis for %s", fingerprint)
+		callback(reply.Int > 0, true)
+	})
+}
+
+// AppendStreamAsync appends an event to a Redis stream (fire-and-forget).
+func (c *RESPClient) AppendStreamAsync(stream string, maxLen int, payload string) {
+	if !c.IsConfigured() {
+		return
+	}
+
+	body := encodeRESPCommand("XADD", c.keys.Stream(stream), "MAXLEN", "~", strconv.Itoa(maxLen), "*", "event", payload)
+	c.do("XADD", body, func(reply respValue, ok bool) {})
+}
+
+// IncrScoreAsync atomically increments a score and refreshes its TTL.
+// INCRBY and EXPIRE are pipelined in a single request.
+func (c *RESPClient) IncrScoreAsync(fingerprint string, increment, ttl int, callback func(int, bool)) {
+	if !c.IsConfigured() {
+		callback(0, true) // Treat as success when not configured
+		return
+	}
+
+	c.incrAsync(c.keys.Score(fingerprint), increment, ttl, callback)
+}
+
+// IncrClusterScoreAsync decays and increments a cluster-wide score with
+// EVALSHA, falling back to EVAL when the script is not cached yet.
+func (c *RESPClient) IncrClusterScoreAsync(fingerprint string, increment int, decay *ScoreDecay, ttl int, callback func(int, bool)) {
+	if !c.IsConfigured() {
+		callback(0, false) // Not configured, no cluster-wide score
+		return
+	}
+
+	keysAndArgs := append([]string{"1", c.keys.ClusterScore(fingerprint)},
+		clusterScoreArgs(increment, decay, ttl, time.Now().Unix())...)
+
+	handle := func(reply respValue, ok bool) {
+		if !ok {
+			callback(0, false)
+			return
+		}
+		score, ok := reply.AsInt()
+		callback(score, ok)
+	}
+
+	evalsha := encodeRESPCommand(append([]string{"EVALSHA", clusterScoreSHA}, keysAndArgs...)...)
+	c.do("EVALSHA", evalsha, func(reply respValue, ok bool) {
+		if !ok && reply.IsError() && isNoScript(reply.Str) {
+			eval := encodeRESPCommand(append([]string{"EVAL", clusterScoreScript}, keysAndArgs...)...)
+			c.do("EVAL", eval, handle)
+			return
+		}
+		handle(reply, ok)
+	})
+}
+
+// IncrOffensesAsync atomically increments an offense count and refreshes
+// its TTL, so offenses are forgotten after the escalation window.
+func (c *RESPClient) IncrOffensesAsync(fingerprint string, ttl int, callback func(int, bool)) {
+	if !c.IsConfigured() {
+		callback(0, false) // Offenses are not tracked without Redis
+		return
+	}
+
+	c.incrAsync(c.keys.Offense(fingerprint), 1, ttl, callback)
+}
+
+// incrAsync increments a counter key with INCRBY and refreshes its TTL
+// in the same pipeline.
+func (c *RESPClient) incrAsync(key string, increment, ttl int, callback func(int, bool)) {
+	body := append(
+		encodeRESPCommand("INCRBY", key, strconv.Itoa(increment)),
+		encodeRESPCommand("EXPIRE", key, strconv.Itoa(ttl))...,
+	)
+
+	c.do("INCRBY", body, func(reply respValue, ok bool) {
+		if !ok {
+			callback(0, false)
+			return
+		}
+		count, ok := reply.AsInt()
+		callback(count, ok)
+	})
+}
+
+// GetScoreAsync retrieves a score from Redis.
+func (c *RESPClient) GetScoreAsync(fingerprint string, callback func(int, bool)) {
+	if !c.IsConfigured() {
+		callback(0, false)
+		return
+	}
+
+	c.do("GET", encodeRESPCommand("GET", c.keys.Score(fingerprint)), func(reply respValue, ok bool) {
+		if !ok {
+			callback(0, false)
+			return
+		}
+		callback(reply.AsInt())
+	})
+}
+
+// do sends a command body and delivers the first reply to the callback.
+// Transport failures, malformed replies and Redis errors yield ok=false.
+func (c *RESPClient) do(op string, body []byte, callback func(respValue, bool)) {
+	err := c.transport.Send(body, func(data []byte, ok bool) {
+		if !ok {
+			c.logger.Debug("Redis %s request failed", op)
+			callback(respValue{}, false)
+			return
+		}
+
+		replies, err := parseRESPReplies(data)
+		if err != nil || len(replies) == 0 {
+			c.logger.Error("failed to parse Redis %s reply: %v", op, err)
+			callback(respValue{}, false)
+			return
+		}
+
+		if replies[0].IsError() {
+			c.logger.Error("Redis %s returned error: %s", op, replies[0].Str)
+			callback(replies[0], false)
+			return
+		}
+
+		callback(replies[0], true)
+	})
+
+	if err != nil {
+		c.logger.Error("failed to dispatch Redis %s: %v", op, err)
+		callback(respValue{}, false)
+	}
+}
+
+// =============================================================================
+// HTTP Redis Transport
+// =============================================================================
+
+// HTTPRedisTransport implements RedisTransport by POSTing RESP bodies to an
+// Envoy cluster using proxywasm.DispatchHttpCall.
+type HTTPRedisTransport struct {
+	cluster    string
+	path       string
+	timeout    uint32
+	authHeader [2]string
+}
+
+// NewHTTPRedisTransport creates a transport for the given cluster and path.
+func NewHTTPRedisTransport(cluster, path string, timeout uint32) *HTTPRedisTransport {
+	return &HTTPRedisTransport{
+		cluster: cluster,
+		path:    path,
+		timeout: timeout,
+	}
+}
+
+// SetAuth configures a credential header sent with every request.
+func (t *HTTPRedisTransport) SetAuth(header, token string) {
+	t.authHeader = [2]string{header, token}
+}
+
+// Send dispatches the RESP body and passes the reply body to the callback.
+func (t *HTTPRedisTransport) Send(body []byte, callback func([]byte, bool)) error {
+	headers := [][2]string{
+		{":method", "POST"},
+		{":path", t.path},
+		{":authority", t.cluster},
+		{"content-type", "application/x-redis-resp"},
+	}
+	if t.authHeader[1] != "" {
+		headers = append(headers, t.authHeader)
+	}
+
+	_, err := proxywasm.DispatchHttpCall(
+		t.cluster,
+		headers,
+		body,
+		nil,
+		t.timeout,
+		func(numHeaders, bodySize, numTrailers int) {
+			if getHttpCallResponseStatus() != "200" {
+				callback(nil, false)
+				return
+			}
+			reply, err := proxywasm.GetHttpCallResponseBody(0, bodySize)
+			if err != nil {
+				callback(nil, false)
+				return
+			}
+			callback(reply, true)
+		},
+	)
+	return err
+}
+
+// =============================================================================
+// Compile-Time Interface Verification
+// =============================================================================
+
+var (
+	_ RedisClient    = (*RESPClient)(nil)
+	_ RedisTransport = (*HTTPRedisTransport)(nil)
+)
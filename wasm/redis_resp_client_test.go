@@ -0,0 +1,206 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRESPClient_SetAndCheckBan(t *testing.T) {
+	backend := NewFakeRESPBackend()
+	client := NewRESPClient(backend, NewKeyspace(""), NewMockLogger())
+
+	entry := NewBanEntry("fp-1", "reason", "rule-1", "high", 600)
+
+	stored := false
+	client.SetBanAsync(entry, func(success bool) { stored = success })
+	if !stored {
+		t.Fatal("expected SetBanAsync to succeed")
+	}
+	if backend.TTLs[BanKey("fp-1")] != 600 {
+		t.Errorf("expected TTL 600, got %d", backend.TTLs[BanKey("fp-1")])
+	}
+
+	var banned bool
+	var found *BanEntry
+	client.CheckBanAsync("fp-1", func(b bool, e *BanEntry, ok bool) { banned, found = b, e })
+	if !banned || found == nil || found.RuleID != "rule-1" {
+		t.Errorf("expected ban to be found, got banned=%v entry=%+v", banned, found)
+	}
+}
+
+func TestRESPClient_CheckBan_NotFound(t *testing.T) {
+	client := NewRESPClient(NewFakeRESPBackend(), NewKeyspace(""), NewMockLogger())
+
+	banned := true
+	client.CheckBanAsync("missing", func(b bool, e *BanEntry, ok bool) { banned = b })
+
+	if banned {
+		t.Error("expected not banned")
+	}
+}
+
+func TestRESPClient_CheckBan_ExpiredDeleted(t *testing.T) {
+	backend := NewFakeRESPBackend()
+	client := NewRESPClient(backend, NewKeyspace(""), NewMockLogger())
+
+	entry := NewBanEntry("fp-1", "reason", "rule-1", "high", 600)
+	entry.ExpiresAt = entry.CreatedAt - 10
+	data, _ := entry.ToJSON()
+	backend.Data[BanKey("fp-1")] = string(data)
+
+	banned := true
+	client.CheckBanAsync("fp-1", func(b bool, e *BanEntry, ok bool) { banned = b })
+
+	if banned {
+		t.Error("expired ban should not be reported")
+	}
+	if _, found := backend.Data[BanKey("fp-1")]; found {
+		t.Error("expired ban should be deleted")
+	}
+}
+
+func TestRESPClient_DeleteBan(t *testing.T) {
+	backend := NewFakeRESPBackend()
+	client := NewRESPClient(backend, NewKeyspace(""), NewMockLogger())
+	backend.Data[BanKey("fp-1")] = "{}"
+
+	var deleted, ok bool
+	client.DeleteBanAsync("fp-1", func(d, success bool) { deleted, ok = d, success })
+
+	if _, found := backend.Data[BanKey("fp-1")]; found {
+		t.Error("ban should be deleted")
+	}
+	if !deleted || !ok {
+		t.Errorf("expected deleted=true ok=true, got %v %v", deleted, ok)
+	}
+
+	client.DeleteBanAsync("fp-1", func(d, success bool) { deleted, ok = d, success })
+	if deleted || !ok {
+		t.Errorf("expected deleted=false ok=true for a missing ban, got %v %v", deleted, ok)
+	}
+}
+
+func TestRESPClient_IncrScore_Pipelined(t *testing.T) {
+	backend := NewFakeRESPBackend()
+	client := NewRESPClient(backend, NewKeyspace(""), NewMockLogger())
+
+	var score int
+	var ok bool
+	client.IncrScoreAsync("fp-1", 20, 3600, func(s int, success bool) { score, ok = s, success })
+	client.IncrScoreAsync("fp-1", 15, 3600, func(s int, success bool) { score, ok = s, success })
+
+	if !ok || score != 35 {
+		t.Errorf("expected score 35, got %d (ok=%v)", score, ok)
+	}
+	if backend.TTLs[ScoreKey("fp-1")] != 3600 {
+		t.Errorf("expected TTL 3600, got %d", backend.TTLs[ScoreKey("fp-1")])
+	}
+	if len(backend.Commands) != 4 {
+		t.Errorf("expected INCRBY+EXPIRE per call (4 commands), got %d", len(backend.Commands))
+	}
+
+	var got int
+	var found bool
+	client.GetScoreAsync("fp-1", func(s int, f bool) { got, found = s, f })
+	if !found || got != 35 {
+		t.Errorf("expected GetScoreAsync to return 35, got %d (found=%v)", got, found)
+	}
+}
+
+func TestRESPClient_IncrClusterScore(t *testing.T) {
+	backend := NewFakeRESPBackend()
+	client := NewRESPClient(backend, NewKeyspace("cbw:"), NewMockLogger())
+	decay := &ScoreDecay{Strategy: ScoreDecayLinear, IntervalSeconds: 60, Rate: 1}
+
+	var score int
+	var ok bool
+	client.IncrClusterScoreAsync("fp-1", 20, decay, 3600, func(s int, success bool) { score, ok = s, success })
+	client.IncrClusterScoreAsync("fp-1", 15, decay, 3600, func(s int, success bool) { score, ok = s, success })
+
+	if !ok || score != 35 {
+		t.Errorf("expected score 35, got %d (ok=%v)", score, ok)
+	}
+
+	// The script is sent once, after EVALSHA misses the script cache
+	commands := make([]string, 0, len(backend.Commands))
+	for _, cmd := range backend.Commands {
+		commands = append(commands, cmd[0])
+	}
+	if strings.Join(commands, " ") != "EVALSHA EVAL EVALSHA" {
+		t.Errorf("expected EVALSHA EVAL EVALSHA, got %v", commands)
+	}
+	cmd := backend.Commands[2]
+	if cmd[1] != clusterScoreSHA || cmd[2] != "1" || cmd[3] != "cbw:cluster-score:fp-1" {
+		t.Errorf("unexpected command: %s %v", cmd[0], cmd[1:4])
+	}
+	if backend.TTLs["cbw:cluster-score:fp-1"] != 3600 {
+		t.Errorf("expected TTL 3600, got %d", backend.TTLs["cbw:cluster-score:fp-1"])
+	}
+}
+
+func TestRESPClient_IncrOffenses(t *testing.T) {
+	backend := NewFakeRESPBackend()
+	client := NewRESPClient(backend, NewKeyspace("gw1:"), NewMockLogger())
+
+	var count int
+	var ok bool
+	client.IncrOffensesAsync("fp-1", 86400, func(c int, success bool) { count, ok = c, success })
+	client.IncrOffensesAsync("fp-1", 86400, func(c int, success bool) { count, ok = c, success })
+
+	if !ok || count != 2 {
+		t.Errorf("expected offense count 2, got %d (ok=%v)", count, ok)
+	}
+	if backend.TTLs["gw1:"+OffenseKey("fp-1")] != 86400 {
+		t.Errorf("expected TTL 86400, got %d", backend.TTLs["gw1:"+OffenseKey("fp-1")])
+	}
+}
+
+func TestRESPClient_TransportFailure(t *testing.T) {
+	backend := NewFakeRESPBackend()
+	backend.Fail = true
+	logger := NewMockLogger()
+	client := NewRESPClient(backend, NewKeyspace(""), logger)
+
+	stored := true
+	client.SetBanAsync(NewBanEntry("fp-1", "r", "rule", "high", 60), func(s bool) { stored = s })
+	if stored {
+		t.Error("expected SetBanAsync to fail")
+	}
+
+	ok := true
+	client.IncrScoreAsync("fp-1", 1, 60, func(s int, success bool) { ok = success })
+	if ok {
+		t.Error("expected IncrScoreAsync to fail")
+	}
+}
+
+func TestRESPClient_GetScore_NonNumeric(t *testing.T) {
+	backend := NewFakeRESPBackend()
+	client := NewRESPClient(backend, NewKeyspace(""), NewMockLogger())
+	backend.Data[ScoreKey("fp-1")] = "not-a-number"
+
+	ok := true
+	client.GetScoreAsync("fp-1", func(s int, found bool) { ok = found })
+
+	if ok {
+		t.Error("non-numeric score should not be reported as found")
+	}
+}
+
+func TestRESPClient_KeyPrefix(t *testing.T) {
+	backend := NewFakeRESPBackend()
+	client := NewRESPClient(backend, NewKeyspace("cbw:staging:"), NewMockLogger())
+
+	client.SetBanAsync(NewBanEntry("fp-1", "r", "rule", "high", 60), func(bool) {})
+	client.IncrScoreAsync("fp-1", 5, 60, func(int, bool) {})
+
+	if _, found := backend.Data["cbw:staging:ban:fp-1"]; !found {
+		t.Error("ban key should be namespaced")
+	}
+	if _, found := backend.Data["cbw:staging:score:fp-1"]; !found {
+		t.Error("score key should be namespaced")
+	}
+	if _, found := backend.Data[BanKey("fp-1")]; found {
+		t.Error("unprefixed key should not be written")
+	}
+}
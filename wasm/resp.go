@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// =============================================================================
+// RESP Codec
+// =============================================================================
+// Minimal implementation of the Redis serialization protocol (RESP2), used
+// by RESPClient to frame commands and parse replies exchanged with a Redis
+// HTTP bridge.
+
+// RESP reply type markers.
+const (
+	respSimpleString = '+'
+	respError        = '-'
+	respInteger      = ':'
+	respBulkString   = '$'
+	respArray        = '*'
+)
+
+// errRESPIncomplete is returned when the reply is truncated.
+var errRESPIncomplete = errors.New("incomplete RESP reply")
+
+// respValue is a decoded RESP reply.
+type respValue struct {
+	Type  byte
+	Str   string // simple string, error message or bulk string
+	Int   int64
+	Array []respValue
+	Nil   bool // null bulk string or null array
+}
+
+// IsError returns true if the reply is a Redis error.
+func (v respValue) IsError() bool {
+	return v.Type == respError
+}
+
+// AsInt returns the reply as an integer.
+// Bulk strings holding a number (e.g., from GET) are converted.
+func (v respValue) AsInt() (int, bool) {
+	switch v.Type {
+	case respInteger:
+		return int(v.Int), true
+	case respBulkString, respSimpleString:
+		if v.Nil {
+			return 0, false
+		}
+		n, err := strconv.Atoi(v.Str)
+		if err != nil {
+			return 0, false
+		}
+		return n, true
+	}
+	return 0, false
+}
+
+// encodeRESPCommand frames a command as a RESP array of bulk strings.
+// e.g., encodeRESPCommand("GET", "ban:abc") -> "*2\r\n$3\r\nGET\r\n$7\r\nban:abc\r\n"
+func encodeRESPCommand(args ...string) []byte {
+	var b strings.Builder
+	b.WriteString("*")
+	b.WriteString(strconv.Itoa(len(args)))
+	b.WriteString("\r\n")
+	for _, arg := range args {
+		b.WriteString("$")
+		b.WriteString(strconv.Itoa(len(arg)))
+		b.WriteString("\r\n")
+		b.WriteString(arg)
+		b.WriteString("\r\n")
+	}
+	return []byte(b.String())
+}
+
+// parseRESPReplies decodes all replies contained in data, in order.
+// Pipelined commands produce one reply each.
+func parseRESPReplies(data []byte) ([]respValue, error) {
+	var replies []respValue
+	for len(data) > 0 {
+		value, rest, err := parseRESPValue(data)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, value)
+		data = rest
+	}
+	return replies, nil
+}
+
+// parseRESPValue decodes a single reply and returns the remaining bytes.
+func parseRESPValue(data []byte) (respValue, []byte, error) {
+	line, rest, err := readRESPLine(data)
+	if err != nil {
+		return respValue{}, nil, err
+	}
+	if len(line) == 0 {
+		return respValue{}, nil, errors.New("empty RESP line")
+	}
+
+	value := respValue{Type: line[0]}
+	payload := string(line[1:])
+
+	switch value.Type {
+	case respSimpleString, respError:
+		value.Str = payload
+		return value, rest, nil
+
+	case respInteger:
+		n, err := strconv.ParseInt(payload, 10, 64)
+		if err != nil {
+			return respValue{}, nil, fmt.Errorf("invalid RESP integer %q", payload)
+		}
+		value.Int = n
+		return value, rest, nil
+
+	case respBulkString:
+		size, err := strconv.Atoi(payload)
+		if err != nil {
+			return respValue{}, nil, fmt.Errorf("invalid RESP bulk length %q", payload)
+		}
+		if size < 0 {
+			value.Nil = true
+			return value, rest, nil
+		}
+		if size > len(rest)-2 {
+			return respValue{}, nil, errRESPIncomplete
+		}
+		if string(rest[size:size+2]) != "\r\n" {
+			return respValue{}, nil, errors.New("RESP bulk string not terminated by CRLF")
+		}
+		value.Str = string(rest[:size])
+		return value, rest[size+2:], nil
+
+	case respArray:
+		count, err := strconv.Atoi(payload)
+		if err != nil {
+			return respValue{}, nil, fmt.Errorf("invalid RESP array length %q", payload)
+		}
+		if count < 0 {
+			value.Nil = true
+			return value, rest, nil
+		}
+		// Every item takes at least 3 bytes ("+\r\n"), which bounds the
+		// length a malformed reply can make us allocate
+		if count > len(rest)/3 {
+			return respValue{}, nil, errRESPIncomplete
+		}
+		value.Array = make([]respValue, 0, count)
+		for i := 0; i < count; i++ {
+			var item respValue
+			item, rest, err = parseRESPValue(rest)
+			if err != nil {
+				return respValue{}, nil, err
+			}
+			value.Array = append(value.Array, item)
+		}
+		return value, rest, nil
+	}
+
+	return respValue{}, nil, fmt.Errorf("unknown RESP type %q", value.Type)
+}
+
+// readRESPLine returns the bytes up to the next CRLF and the remainder.
+func readRESPLine(data []byte) ([]byte, []byte, error) {
+	for i := 0; i+1 < len(data); i++ {
+		if data[i] == '\r' && data[i+1] == '\n' {
+			return data[:i], data[i+2:], nil
+		}
+	}
+	return nil, nil, errRESPIncomplete
+}
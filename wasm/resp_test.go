@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEncodeRESPCommand(t *testing.T) {
+	result := string(encodeRESPCommand("SET", "ban:abc", "{\"a\":1}"))
+	expected := "*3\r\n$3\r\nSET\r\n$7\r\nban:abc\r\n$7\r\n{\"a\":1}\r\n"
+
+	if result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestParseRESPReplies_Types(t *testing.T) {
+	data := []byte("+OK\r\n-ERR boom\r\n:42\r\n$5\r\nhello\r\n$-1\r\n*2\r\n:1\r\n$1\r\nx\r\n")
+
+	replies, err := parseRESPReplies(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(replies) != 6 {
+		t.Fatalf("expected 6 replies, got %d", len(replies))
+	}
+
+	if replies[0].Type != respSimpleString || replies[0].Str != "OK" {
+		t.Errorf("unexpected simple string: %+v", replies[0])
+	}
+	if !replies[1].IsError() || replies[1].Str != "ERR boom" {
+		t.Errorf("unexpected error reply: %+v", replies[1])
+	}
+	if n, ok := replies[2].AsInt(); !ok || n != 42 {
+		t.Errorf("unexpected integer: %+v", replies[2])
+	}
+	if replies[3].Str != "hello" {
+		t.Errorf("unexpected bulk string: %+v", replies[3])
+	}
+	if !replies[4].Nil {
+		t.Error("expected null bulk string")
+	}
+	if len(replies[5].Array) != 2 || replies[5].Array[1].Str != "x" {
+		t.Errorf("unexpected array: %+v", replies[5])
+	}
+}
+
+func TestParseRESPReplies_BinarySafeBulk(t *testing.T) {
+	replies, err := parseRESPReplies([]byte("$4\r\na\r\nb\r\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if replies[0].Str != "a\r\nb" {
+		t.Errorf("bulk string should preserve CRLF, got %q", replies[0].Str)
+	}
+}
+
+func TestParseRESPReplies_Invalid(t *testing.T) {
+	inputs := []string{
+		"+OK",                             // missing CRLF
+		"$10\r\nshort\r\n",                // truncated bulk
+		":abc\r\n",                        // bad integer
+		"?what\r\n",                       // unknown type
+		"*2\r\n:1\r\n",                    // truncated array
+		"*2147483647\r\n:1\r\n",           // oversized array length
+		"$9223372036854775807\r\nabc\r\n", // oversized bulk length
+		"$3\r\nabcde\r\n",                 // bulk longer than its length
+	}
+
+	for _, input := range inputs {
+		if _, err := parseRESPReplies([]byte(input)); err == nil {
+			t.Errorf("expected error for %q", input)
+		}
+	}
+}
+
+func TestRESPValue_AsInt(t *testing.T) {
+	if n, ok := (respValue{Type: respBulkString, Str: "17"}).AsInt(); !ok || n != 17 {
+		t.Errorf("bulk numeric string should convert, got %d/%v", n, ok)
+	}
+	if _, ok := (respValue{Type: respBulkString, Nil: true}).AsInt(); ok {
+		t.Error("null bulk should not convert")
+	}
+	if _, ok := (respValue{Type: respBulkString, Str: "abc"}).AsInt(); ok {
+		t.Error("non-numeric bulk should not convert")
+	}
+}
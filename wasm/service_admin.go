@@ -0,0 +1,366 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// =============================================================================
+// Admin Service
+// =============================================================================
+
+// AdminRequest holds the parts of an admin API request needed for routing
+// and authorization.
+type AdminRequest struct {
+	Method   string
+	Path     string
+	Token    string
+	SourceIP string
+	Body     []byte
+}
+
+// AdminResponse is the local reply sent for an admin API request.
+type AdminResponse struct {
+	StatusCode int
+	Body       []byte
+}
+
+// ManualBanRequest is the JSON body accepted by POST {prefix}/bans.
+type ManualBanRequest struct {
+	Fingerprint string `json:"fingerprint"`
+	Reason      string `json:"reason"`
+	Severity    string `json:"severity"`
+	TTL         int    `json:"ttl"`
+}
+
+// AdminBan is a ban as returned by the admin API, with the ID used to
+// inspect or lift it (see BanID).
+type AdminBan struct {
+	ID string `json:"id"`
+	*BanEntry
+}
+
+// newAdminBan wraps a ban entry for the admin API.
+func newAdminBan(entry *BanEntry) *AdminBan {
+	return &AdminBan{ID: entry.ID(), BanEntry: entry}
+}
+
+// maxAdminBodySize limits the request body accepted by the admin API.
+const maxAdminBodySize = 64 * 1024
+
+// AdminService serves the admin HTTP API for inspecting and managing bans.
+//
+// Routes (relative to the configured path prefix):
+//
+//	GET    /bans       list active bans in the local store, optionally
+//	                   filtered by support reference (?reference=)
+//	GET    /bans/{id}  inspect a ban, locally or in Redis
+//	DELETE /bans/{id}  lift a ban locally and in Redis
+//	POST   /bans       issue a manual ban
+//
+// The ID of a global ban is the client fingerprint; scoped bans have
+// their own IDs, listed by GET /bans. A fingerprint only reaches its
+// global ban: scoped bans need their full ID, returned in the 404 body.
+//
+// Access requires every configured guard to pass: the shared-secret token
+// header and/or a source address inside the allowed CIDRs.
+type AdminService struct {
+	config          *PluginConfig
+	logger          Logger
+	banStore        BanStore
+	banService      *BanService
+	redisClient     RedisClient
+	allowedPrefixes []netip.Prefix
+}
+
+// NewAdminService creates a new admin service.
+// Invalid CIDRs are rejected by PluginConfig.Validate at startup.
+func NewAdminService(config *PluginConfig, logger Logger, banStore BanStore, banService *BanService, redisClient RedisClient) *AdminService {
+	prefixes, _ := parsePrefixes(config.Admin.AllowedCIDRs)
+
+	if redisClient == nil {
+		redisClient = NewNoopRedisClient()
+	}
+
+	return &AdminService{
+		config:          config,
+		logger:          logger,
+		banStore:        banStore,
+		banService:      banService,
+		redisClient:     redisClient,
+		allowedPrefixes: prefixes,
+	}
+}
+
+// Matches returns true if the request path belongs to the admin API.
+func (s *AdminService) Matches(path string) bool {
+	prefix := s.config.Admin.PathPrefix
+	path = stripQuery(path)
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// Handle authorizes and routes an admin API request, passing the response
+// to respond. Responses that wait for Redis are passed later, from the
+// Redis callback.
+func (s *AdminService) Handle(req *AdminRequest, respond func(*AdminResponse)) {
+	if response := s.route(req, respond); response != nil {
+		respond(response)
+	}
+}
+
+// route handles an admin API request. Returns nil when the response is
+// passed to respond later.
+func (s *AdminService) route(req *AdminRequest, respond func(*AdminResponse)) *AdminResponse {
+	if !s.authorize(req) {
+		s.logger.Warn("admin request denied: method=%s path=%s source=%s", req.Method, req.Path, req.SourceIP)
+		return adminError(403, "forbidden")
+	}
+
+	route := strings.TrimPrefix(stripQuery(req.Path), s.config.Admin.PathPrefix)
+	route = strings.TrimSuffix(route, "/")
+
+	switch {
+	case route == "/bans":
+		switch req.Method {
+		case "GET":
+			return s.listBans(queryParam(req.Path, "reference"))
+		case "POST":
+			return s.createBan(req.Body)
+		}
+		return adminError(405, "method not allowed")
+
+	case strings.HasPrefix(route, "/bans/"):
+		id := strings.TrimPrefix(route, "/bans/")
+		if id == "" || strings.Contains(id, "/") {
+			return adminError(404, "not found")
+		}
+		switch req.Method {
+		case "GET":
+			return s.getBan(id, respond)
+		case "DELETE":
+			return s.deleteBan(id, respond)
+		}
+		return adminError(405, "method not allowed")
+	}
+
+	return adminError(404, "not found")
+}
+
+// authorize checks the request against the configured guards.
+func (s *AdminService) authorize(req *AdminRequest) bool {
+	if s.config.Admin.Token == "" && len(s.allowedPrefixes) == 0 {
+		return false
+	}
+
+	if s.config.Admin.Token != "" &&
+		subtle.ConstantTimeCompare([]byte(req.Token), []byte(s.config.Admin.Token)) != 1 {
+		return false
+	}
+
+	if len(s.allowedPrefixes) > 0 && !prefixesContain(s.allowedPrefixes, req.SourceIP) {
+		return false
+	}
+
+	return true
+}
+
+// listBans returns all active bans from the local store. Each instance
+// only lists the bans it issued or enforced. A non-empty reference keeps
+// the bans whose fingerprint starts with it (see supportReference).
+func (s *AdminService) listBans(reference string) *AdminResponse {
+	entries, err := s.banStore.ListBans()
+	if err != nil {
+		s.logger.Error("failed to list bans: %v", err)
+		return adminError(500, "failed to list bans")
+	}
+
+	bans := make([]*AdminBan, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.HasPrefix(BanIDFingerprint(entry.ID()), reference) {
+			continue
+		}
+		bans = append(bans, newAdminBan(entry))
+	}
+
+	return adminJSON(200, map[string]interface{}{
+		"bans":  bans,
+		"count": len(bans),
+	})
+}
+
+// getBan returns a single ban from the local store. A ban found only in
+// Redis (issued by another instance) is answered from the Redis callback.
+func (s *AdminService) getBan(id string, respond func(*AdminResponse)) *AdminResponse {
+	if entry, found := s.banStore.CheckBan(id); found {
+		return adminJSON(200, newAdminBan(entry))
+	}
+
+	if !s.redisClient.IsConfigured() {
+		return s.banNotFound(id)
+	}
+
+	s.redisClient.CheckBanAsync(id, func(banned bool, entry *BanEntry, ok bool) {
+		switch {
+		case !ok:
+			respond(adminError(502, "failed to check ban in Redis"))
+		case !banned || entry == nil:
+			respond(s.banNotFound(id))
+		default:
+			respond(adminJSON(200, newAdminBan(entry)))
+		}
+	})
+	return nil
+}
+
+// deleteBan lifts a ban in the local store and in Redis. A ban found
+// only in Redis (issued by another instance) is answered once Redis
+// reports whether it existed, so unknown IDs get a 404.
+func (s *AdminService) deleteBan(id string, respond func(*AdminResponse)) *AdminResponse {
+	found, err := s.banService.LiftBan(id)
+	if err != nil {
+		s.logger.Error("failed to lift ban for %s: %v", id, err)
+		return adminError(500, "failed to lift ban")
+	}
+
+	if !s.redisClient.IsConfigured() {
+		if !found {
+			return s.banNotFound(id)
+		}
+		return liftedResponse(id)
+	}
+
+	if found {
+		s.redisClient.DeleteBanAsync(id, nil)
+		return liftedResponse(id)
+	}
+
+	s.redisClient.DeleteBanAsync(id, func(deleted, ok bool) {
+		switch {
+		case !ok:
+			respond(adminError(502, "failed to lift ban in Redis"))
+		case !deleted:
+			respond(s.banNotFound(id))
+		default:
+			s.banService.LiftRemoteBan(id)
+			respond(liftedResponse(id))
+		}
+	})
+	return nil
+}
+
+// banNotFound is the response to an unknown ban ID. For a fingerprint,
+// it lists the IDs of the scoped bans of that fingerprint in the local
+// store, which are only reached by their full ID.
+func (s *AdminService) banNotFound(id string) *AdminResponse {
+	if BanIDFingerprint(id) != id {
+		return adminError(404, "ban not found")
+	}
+
+	entries, err := s.banStore.ListBans()
+	if err != nil {
+		s.logger.Error("failed to list bans: %v", err)
+		return adminError(404, "ban not found")
+	}
+
+	var scopedIDs []string
+	for _, entry := range entries {
+		if entry.Scope != "" && BanIDFingerprint(entry.ID()) == id {
+			scopedIDs = append(scopedIDs, entry.ID())
+		}
+	}
+	if len(scopedIDs) == 0 {
+		return adminError(404, "ban not found")
+	}
+
+	return adminJSON(404, map[string]interface{}{
+		"error":      "ban not found",
+		"scoped_ids": scopedIDs,
+	})
+}
+
+// liftedResponse is the response to a lifted ban.
+func liftedResponse(id string) *AdminResponse {
+	return adminJSON(200, map[string]interface{}{
+		"id":          id,
+		"fingerprint": BanIDFingerprint(id),
+		"lifted":      true,
+	})
+}
+
+// createBan issues a manual ban from a JSON request body.
+func (s *AdminService) createBan(body []byte) *AdminResponse {
+	var req ManualBanRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return adminError(400, "invalid JSON body")
+	}
+
+	if req.Fingerprint == "" {
+		return adminError(400, "fingerprint is required")
+	}
+	if req.Reason == "" {
+		req.Reason = "manual"
+	}
+	if req.Severity == "" {
+		req.Severity = "high"
+	}
+	if req.TTL == 0 {
+		req.TTL = s.config.GetBanTTL(req.Severity)
+	}
+	if req.TTL < 1 || req.TTL > 86400 {
+		return adminError(400, "ttl must be between 1-86400 seconds")
+	}
+
+	result := s.banService.IssueManualBan(req.Fingerprint, req.Reason, req.Severity, req.TTL)
+	if !result.Issued {
+		return adminError(500, "failed to issue ban")
+	}
+
+	if s.redisClient.IsConfigured() {
+		s.redisClient.SetBanAsync(result.Entry, func(success bool) {
+			if !success {
+				s.logger.Error("failed to store manual ban in Redis for %s", req.Fingerprint)
+			}
+		})
+	}
+
+	return adminJSON(201, newAdminBan(result.Entry))
+}
+
+// adminJSON serializes a value into a JSON admin response.
+func adminJSON(statusCode int, value interface{}) *AdminResponse {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return adminError(500, "failed to serialize response")
+	}
+	return &AdminResponse{StatusCode: statusCode, Body: body}
+}
+
+// adminError builds a JSON error response.
+func adminError(statusCode int, message string) *AdminResponse {
+	body, _ := json.Marshal(map[string]string{"error": message})
+	return &AdminResponse{StatusCode: statusCode, Body: body}
+}
+
+// queryParam returns the value of a query parameter of a request path.
+func queryParam(path, name string) string {
+	idx := strings.IndexByte(path, '?')
+	if idx < 0 {
+		return ""
+	}
+	values, err := url.ParseQuery(path[idx+1:])
+	if err != nil {
+		return ""
+	}
+	return values.Get(name)
+}
+
+// stripQuery removes the query string from a request path.
+func stripQuery(path string) string {
+	if idx := strings.IndexByte(path, '?'); idx >= 0 {
+		return path[:idx]
+	}
+	return path
+}
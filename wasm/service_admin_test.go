@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func newTestAdminService(config *PluginConfig) (*AdminService, *MockBanStore, *MockRedisClient, *MockEventHandler) {
+	logger := NewMockLogger()
+	banStore := NewMockBanStore()
+	scoreStore := NewMockScoreStore()
+	redisClient := NewMockRedisClient(true)
+	eventHandler := NewMockEventHandler()
+
+	banService := NewBanService(config, logger, banStore, scoreStore, redisClient)
+	banService.SetEventHandler(eventHandler)
+
+	return NewAdminService(config, logger, banStore, banService, redisClient), banStore, redisClient, eventHandler
+}
+
+// handleAdmin returns the response of an admin request.
+func handleAdmin(service *AdminService, req *AdminRequest) *AdminResponse {
+	var response *AdminResponse
+	service.Handle(req, func(r *AdminResponse) { response = r })
+	return response
+}
+
+func newTestAdminConfig() *PluginConfig {
+	config := DefaultConfig()
+	config.Admin.Enabled = true
+	config.Admin.Token = "secret"
+	return config
+}
+
+func TestAdminService_Matches(t *testing.T) {
+	service, _, _, _ := newTestAdminService(newTestAdminConfig())
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"/_coraza-ban", true},
+		{"/_coraza-ban/bans", true},
+		{"/_coraza-ban/bans?limit=10", true},
+		{"/_coraza-banned", false},
+		{"/api/bans", false},
+	}
+
+	for _, tt := range tests {
+		if result := service.Matches(tt.path); result != tt.expected {
+			t.Errorf("Matches(%q) = %v, expected %v", tt.path, result, tt.expected)
+		}
+	}
+}
+
+func TestAdminService_Handle_InvalidToken(t *testing.T) {
+	service, _, _, _ := newTestAdminService(newTestAdminConfig())
+
+	resp := handleAdmin(service, &AdminRequest{Method: "GET", Path: "/_coraza-ban/bans", Token: "wrong"})
+
+	if resp.StatusCode != 403 {
+		t.Errorf("expected 403, got %d", resp.StatusCode)
+	}
+}
+
+func TestAdminService_Handle_CIDRGuard(t *testing.T) {
+	config := newTestAdminConfig()
+	config.Admin.Token = ""
+	config.Admin.AllowedCIDRs = []string{"10.0.0.0/8", "fd00::/8"}
+	service, _, _, _ := newTestAdminService(config)
+
+	tests := []struct {
+		sourceIP string
+		expected int
+	}{
+		{"10.1.2.3", 200},
+		{"fd00::1", 200},
+		{"192.168.1.1", 403},
+		{"", 403},
+	}
+
+	for _, tt := range tests {
+		resp := handleAdmin(service, &AdminRequest{Method: "GET", Path: "/_coraza-ban/bans", SourceIP: tt.sourceIP})
+		if resp.StatusCode != tt.expected {
+			t.Errorf("source %q: expected %d, got %d", tt.sourceIP, tt.expected, resp.StatusCode)
+		}
+	}
+}
+
+func TestAdminService_Handle_TokenAndCIDRBothRequired(t *testing.T) {
+	config := newTestAdminConfig()
+	config.Admin.AllowedCIDRs = []string{"10.0.0.0/8"}
+	service, _, _, _ := newTestAdminService(config)
+
+	resp := handleAdmin(service, &AdminRequest{Method: "GET", Path: "/_coraza-ban/bans", Token: "secret", SourceIP: "192.168.1.1"})
+
+	if resp.StatusCode != 403 {
+		t.Errorf("expected 403 when source is outside allowed CIDRs, got %d", resp.StatusCode)
+	}
+}
+
+func TestAdminService_Handle_ListBans(t *testing.T) {
+	service, banStore, _, _ := newTestAdminService(newTestAdminConfig())
+	banStore.Bans["fp-1"] = NewBanEntry("fp-1", "reason", "rule-1", "high", 600)
+	banStore.Bans["fp-2"] = NewBanEntry("fp-2", "reason", "rule-2", "low", 600)
+
+	resp := handleAdmin(service, &AdminRequest{Method: "GET", Path: "/_coraza-ban/bans", Token: "secret"})
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Bans  []*BanEntry `json:"bans"`
+		Count int         `json:"count"`
+	}
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if body.Count != 2 || len(body.Bans) != 2 {
+		t.Errorf("expected 2 bans, got count=%d len=%d", body.Count, len(body.Bans))
+	}
+
+	resp = handleAdmin(service, &AdminRequest{Method: "GET", Path: "/_coraza-ban/bans?reference=fp-2", Token: "secret"})
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if body.Count != 1 || len(body.Bans) != 1 || body.Bans[0].RuleID != "rule-2" {
+		t.Errorf("expected the ban of the reference, got %+v", body.Bans)
+	}
+}
+
+func TestAdminService_Handle_GetBan(t *testing.T) {
+	service, banStore, _, _ := newTestAdminService(newTestAdminConfig())
+	banStore.Bans["fp-1"] = NewBanEntry("fp-1", "reason", "rule-1", "high", 600)
+
+	resp := handleAdmin(service, &AdminRequest{Method: "GET", Path: "/_coraza-ban/bans/fp-1", Token: "secret"})
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	entry, err := BanEntryFromJSON(resp.Body)
+	if err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if entry.RuleID != "rule-1" {
+		t.Errorf("expected rule-1, got %s", entry.RuleID)
+	}
+
+	resp = handleAdmin(service, &AdminRequest{Method: "GET", Path: "/_coraza-ban/bans/unknown", Token: "secret"})
+	if resp.StatusCode != 404 {
+		t.Errorf("expected 404 for unknown ban, got %d", resp.StatusCode)
+	}
+}
+
+func TestAdminService_Handle_GetBan_RedisOnly(t *testing.T) {
+	service, _, redisClient, _ := newTestAdminService(newTestAdminConfig())
+	redisClient.BannedEntries["fp-2"] = NewBanEntry("fp-2", "reason", "rule-2", "high", 600)
+
+	resp := handleAdmin(service, &AdminRequest{Method: "GET", Path: "/_coraza-ban/bans/fp-2", Token: "secret"})
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	entry, err := BanEntryFromJSON(resp.Body)
+	if err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if entry.RuleID != "rule-2" {
+		t.Errorf("expected rule-2, got %s", entry.RuleID)
+	}
+
+	redisClient.Fail = true
+	resp = handleAdmin(service, &AdminRequest{Method: "GET", Path: "/_coraza-ban/bans/fp-3", Token: "secret"})
+	if resp.StatusCode != 502 {
+		t.Errorf("expected 502 when Redis fails, got %d", resp.StatusCode)
+	}
+}
+
+func TestAdminService_Handle_DeleteBan(t *testing.T) {
+	service, banStore, redisClient, _ := newTestAdminService(newTestAdminConfig())
+	entry := NewBanEntry("fp-1", "reason", "rule-1", "high", 600)
+	banStore.Bans["fp-1"] = entry
+	redisClient.BannedEntries["fp-1"] = entry
+
+	resp := handleAdmin(service, &AdminRequest{Method: "DELETE", Path: "/_coraza-ban/bans/fp-1", Token: "secret"})
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if _, found := banStore.Bans["fp-1"]; found {
+		t.Error("ban should be removed from local store")
+	}
+	if _, found := redisClient.BannedEntries["fp-1"]; found {
+		t.Error("ban should be removed from Redis")
+	}
+}
+
+func TestAdminService_Handle_DeleteBan_RedisOnly(t *testing.T) {
+	service, _, redisClient, eventHandler := newTestAdminService(newTestAdminConfig())
+	redisClient.BannedEntries["fp-2"] = NewBanEntry("fp-2", "reason", "rule-1", "high", 600)
+
+	resp := handleAdmin(service, &AdminRequest{Method: "DELETE", Path: "/_coraza-ban/bans/fp-2", Token: "secret"})
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if len(eventHandler.Events) != 1 || eventHandler.Events[0].Type != BanEventLifted {
+		t.Errorf("expected 1 lifted event, got %+v", eventHandler.Events)
+	}
+
+	// An ID that never existed is not found, and nothing is emitted
+	resp = handleAdmin(service, &AdminRequest{Method: "DELETE", Path: "/_coraza-ban/bans/unknown", Token: "secret"})
+	if resp.StatusCode != 404 {
+		t.Errorf("expected 404 for unknown ban, got %d", resp.StatusCode)
+	}
+	if len(eventHandler.Events) != 1 {
+		t.Errorf("expected no event for unknown ban, got %+v", eventHandler.Events)
+	}
+
+	redisClient.Fail = true
+	resp = handleAdmin(service, &AdminRequest{Method: "DELETE", Path: "/_coraza-ban/bans/fp-3", Token: "secret"})
+	if resp.StatusCode != 502 {
+		t.Errorf("expected 502 when Redis fails, got %d", resp.StatusCode)
+	}
+}
+
+func TestAdminService_Handle_CreateBan(t *testing.T) {
+	service, banStore, redisClient, eventHandler := newTestAdminService(newTestAdminConfig())
+
+	body := []byte(`{"fingerprint":"fp-1","reason":"abuse report","ttl":120}`)
+	resp := handleAdmin(service, &AdminRequest{Method: "POST", Path: "/_coraza-ban/bans", Token: "secret", Body: body})
+
+	if resp.StatusCode != 201 {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+
+	stored, found := banStore.Bans["fp-1"]
+	if !found {
+		t.Fatal("ban not stored locally")
+	}
+	if stored.Reason != "abuse report" || stored.TTL != 120 || stored.RuleID != "manual" {
+		t.Errorf("unexpected ban entry: %+v", stored)
+	}
+	if redisClient.SetBanCalls != 1 {
+		t.Errorf("expected 1 SetBanAsync call, got %d", redisClient.SetBanCalls)
+	}
+	if len(eventHandler.Events) != 1 || eventHandler.Events[0].Source != "admin" {
+		t.Errorf("expected 1 admin issued event, got %+v", eventHandler.Events)
+	}
+}
+
+func TestAdminService_Handle_CreateBan_Invalid(t *testing.T) {
+	service, _, _, _ := newTestAdminService(newTestAdminConfig())
+
+	bodies := []string{
+		`not json`,
+		`{"reason":"missing fingerprint"}`,
+		`{"fingerprint":"fp-1","ttl":-5}`,
+	}
+
+	for _, body := range bodies {
+		resp := handleAdmin(service, &AdminRequest{Method: "POST", Path: "/_coraza-ban/bans", Token: "secret", Body: []byte(body)})
+		if resp.StatusCode != 400 {
+			t.Errorf("body %q: expected 400, got %d", body, resp.StatusCode)
+		}
+	}
+}
+
+func TestAdminService_Handle_UnknownRoutes(t *testing.T) {
+	service, _, _, _ := newTestAdminService(newTestAdminConfig())
+
+	tests := []struct {
+		method   string
+		path     string
+		expected int
+	}{
+		{"GET", "/_coraza-ban/unknown", 404},
+		{"PUT", "/_coraza-ban/bans", 405},
+		{"POST", "/_coraza-ban/bans/fp-1", 405},
+	}
+
+	for _, tt := range tests {
+		resp := handleAdmin(service, &AdminRequest{Method: tt.method, Path: tt.path, Token: "secret"})
+		if resp.StatusCode != tt.expected {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.path, tt.expected, resp.StatusCode)
+		}
+	}
+}
+
+func TestAdminService_Handle_ScopedBan(t *testing.T) {
+	service, banStore, _, _ := newTestAdminService(newTestAdminConfig())
+	entry := NewBanEntry("fp-1", "reason", "rule-1", "high", 600)
+	entry.Scope = "host:a.example.com"
+	banStore.Bans[entry.ID()] = entry
+
+	resp := handleAdmin(service, &AdminRequest{Method: "GET", Path: "/_coraza-ban/bans", Token: "secret"})
+	var body struct {
+		Bans []*AdminBan `json:"bans"`
+	}
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if len(body.Bans) != 1 || body.Bans[0].ID != entry.ID() || body.Bans[0].Scope != entry.Scope {
+		t.Fatalf("expected the scoped ban with its ID, got %+v", body.Bans)
+	}
+
+	// The fingerprint alone only reaches the global ban
+	resp = handleAdmin(service, &AdminRequest{Method: "DELETE", Path: "/_coraza-ban/bans/fp-1", Token: "secret"})
+	if resp.StatusCode != 404 {
+		t.Fatalf("expected 404 for the fingerprint, got %d", resp.StatusCode)
+	}
+	var notFound struct {
+		ScopedIDs []string `json:"scoped_ids"`
+	}
+	if err := json.Unmarshal(resp.Body, &notFound); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if len(notFound.ScopedIDs) != 1 || notFound.ScopedIDs[0] != entry.ID() {
+		t.Errorf("expected the scoped ban ID in the 404 body, got %+v", notFound.ScopedIDs)
+	}
+
+	resp = handleAdmin(service, &AdminRequest{Method: "DELETE", Path: "/_coraza-ban/bans/" + entry.ID(), Token: "secret"})
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if _, found := banStore.Bans[entry.ID()]; found {
+		t.Error("scoped ban should be removed from local store")
+	}
+}
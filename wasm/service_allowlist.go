@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// Allowlist Service
+// =============================================================================
+
+// AllowlistRequest holds the client attributes checked against the allowlist.
+// SourceIP is the downstream connection address; forwarding headers are
+// not trusted, as any client can set them.
+type AllowlistRequest struct {
+	Fingerprint string
+	SourceIP    string
+	UserAgent   string
+	BypassToken string
+}
+
+// AllowlistService decides whether a client is exempt from banning.
+// Patterns and prefixes are compiled once at plugin start and the service
+// is shared by all requests.
+type AllowlistService struct {
+	fingerprints map[string]bool
+	prefixes     []netip.Prefix
+	userAgents   []*regexp.Regexp
+	bypassSecret []byte
+	bypassMaxTTL int64
+}
+
+// NewAllowlistService compiles the allowlist configuration.
+// Returns an error if a CIDR or User-Agent pattern is invalid.
+func NewAllowlistService(config *AllowlistConfig) (*AllowlistService, error) {
+	prefixes, err := parsePrefixes(config.CIDRs)
+	if err != nil {
+		return nil, err
+	}
+
+	userAgents := make([]*regexp.Regexp, 0, len(config.UserAgents))
+	for _, pattern := range config.UserAgents {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		userAgents = append(userAgents, re)
+	}
+
+	fingerprints := make(map[string]bool, len(config.Fingerprints))
+	for _, fp := range config.Fingerprints {
+		fingerprints[fp] = true
+	}
+
+	var bypassSecret []byte
+	if config.BypassHeader != "" {
+		bypassSecret = []byte(config.BypassSecret)
+	}
+
+	bypassMaxTTL := config.BypassMaxTTLSeconds
+	if bypassMaxTTL <= 0 {
+		bypassMaxTTL = DefaultBypassMaxTTL
+	}
+
+	return &AllowlistService{
+		fingerprints: fingerprints,
+		prefixes:     prefixes,
+		userAgents:   userAgents,
+		bypassSecret: bypassSecret,
+		bypassMaxTTL: int64(bypassMaxTTL),
+	}, nil
+}
+
+// IsEmpty returns true if no allowlist entries are configured.
+func (s *AllowlistService) IsEmpty() bool {
+	return len(s.fingerprints) == 0 && len(s.prefixes) == 0 &&
+		len(s.userAgents) == 0 && len(s.bypassSecret) == 0
+}
+
+// Match returns the reason a client is allowlisted, or "" if it is not.
+func (s *AllowlistService) Match(req *AllowlistRequest) string {
+	if req.Fingerprint != "" && s.fingerprints[req.Fingerprint] {
+		return "fingerprint"
+	}
+
+	if req.SourceIP != "" && prefixesContain(s.prefixes, req.SourceIP) {
+		return "cidr"
+	}
+
+	if req.UserAgent != "" {
+		for _, re := range s.userAgents {
+			if re.MatchString(req.UserAgent) {
+				return "user_agent"
+			}
+		}
+	}
+
+	if req.BypassToken != "" && s.verifyBypassToken(req.BypassToken) {
+		return "bypass_header"
+	}
+
+	return ""
+}
+
+// verifyBypassToken checks a bypass token of the form "<expiry>.<signature>",
+// where expiry is a Unix timestamp and signature is the hex-encoded
+// HMAC-SHA256 of the expiry string using the configured secret. Tokens
+// expiring more than bypass_max_ttl_seconds from now are rejected, so a
+// leaked token cannot be valid for years.
+func (s *AllowlistService) verifyBypassToken(token string) bool {
+	if len(s.bypassSecret) == 0 {
+		return false
+	}
+
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	expiry, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return false
+	}
+	now := time.Now().Unix()
+	if now > expiry || expiry-now > s.bypassMaxTTL {
+		return false
+	}
+
+	signature, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal(signature, signBypassToken(s.bypassSecret, parts[0]))
+}
+
+// signBypassToken computes the HMAC-SHA256 signature for a bypass token expiry.
+func signBypassToken(secret []byte, expiry string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(expiry))
+	return mac.Sum(nil)
+}
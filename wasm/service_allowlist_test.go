@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNewAllowlistService_InvalidConfig(t *testing.T) {
+	if _, err := NewAllowlistService(&AllowlistConfig{CIDRs: []string{"bad"}}); err == nil {
+		t.Error("expected error for invalid CIDR")
+	}
+	if _, err := NewAllowlistService(&AllowlistConfig{UserAgents: []string{"("}}); err == nil {
+		t.Error("expected error for invalid regex")
+	}
+}
+
+func TestAllowlistService_IsEmpty(t *testing.T) {
+	service, _ := NewAllowlistService(&AllowlistConfig{})
+	if !service.IsEmpty() {
+		t.Error("empty config should produce empty allowlist")
+	}
+
+	service, _ = NewAllowlistService(&AllowlistConfig{Fingerprints: []string{"fp"}})
+	if service.IsEmpty() {
+		t.Error("allowlist with fingerprints should not be empty")
+	}
+}
+
+func TestAllowlistService_Match(t *testing.T) {
+	service, err := NewAllowlistService(&AllowlistConfig{
+		Fingerprints: []string{"trusted-fp"},
+		CIDRs:        []string{"10.0.0.0/8", "2001:db8::/32"},
+		UserAgents:   []string{"^Pingdom", "UptimeRobot/"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		req      *AllowlistRequest
+		expected string
+	}{
+		{"fingerprint", &AllowlistRequest{Fingerprint: "trusted-fp"}, "fingerprint"},
+		{"ipv4 cidr", &AllowlistRequest{SourceIP: "10.20.30.40"}, "cidr"},
+		{"ipv6 cidr", &AllowlistRequest{SourceIP: "2001:db8::42"}, "cidr"},
+		{"user agent prefix", &AllowlistRequest{UserAgent: "Pingdom.com_bot_version_1.4"}, "user_agent"},
+		{"user agent substring", &AllowlistRequest{UserAgent: "Mozilla/5.0 (compatible; UptimeRobot/2.0)"}, "user_agent"},
+		{"no match", &AllowlistRequest{Fingerprint: "other", SourceIP: "192.168.1.1", UserAgent: "curl/8.0"}, ""},
+	}
+
+	for _, tt := range tests {
+		if result := service.Match(tt.req); result != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, result)
+		}
+	}
+}
+
+func TestAllowlistService_Match_BypassToken(t *testing.T) {
+	secret := "s3cr3t"
+	service, _ := NewAllowlistService(&AllowlistConfig{
+		BypassHeader: "x-ban-bypass",
+		BypassSecret: secret,
+	})
+
+	makeToken := func(key string, expiry int64) string {
+		exp := strconv.FormatInt(expiry, 10)
+		return exp + "." + hex.EncodeToString(signBypassToken([]byte(key), exp))
+	}
+
+	future := time.Now().Add(time.Hour).Unix()
+	past := time.Now().Add(-time.Hour).Unix()
+	distant := time.Now().Add(DefaultBypassMaxTTL*time.Second + time.Hour).Unix()
+
+	tests := []struct {
+		name     string
+		token    string
+		expected string
+	}{
+		{"valid", makeToken(secret, future), "bypass_header"},
+		{"expired", makeToken(secret, past), ""},
+		{"beyond max ttl", makeToken(secret, distant), ""},
+		{"wrong secret", makeToken("other", future), ""},
+		{"malformed", "not-a-token", ""},
+		{"bad hex", strconv.FormatInt(future, 10) + ".zz", ""},
+	}
+
+	for _, tt := range tests {
+		if result := service.Match(&AllowlistRequest{BypassToken: tt.token}); result != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, result)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"math"
+	"time"
 )
 
 // =============================================================================
@@ -16,9 +18,10 @@ type BanCheckResult struct {
 
 // BanIssueResult contains the result of a ban issue operation.
 type BanIssueResult struct {
-	Issued bool
-	Entry  *BanEntry
-	Score  int // Current score (for score-based bans)
+	Issued  bool
+	Entry   *BanEntry
+	Score   int  // Current score (for score-based bans)
+	Pending bool // decided when the cluster-wide score arrives
 }
 
 // BanService orchestrates ban checking and issuance operations.
@@ -32,6 +35,10 @@ type BanService struct {
 	scoreStore   ScoreStore
 	redisClient  RedisClient
 	eventHandler EventHandler
+	offenseStore OffenseStore   // nil disables offense tracking
+	scopes       *RequestScopes // nil restricts bans to the global scope
+
+	onClusterScore func(*BanIssueResult) // receives pending score decisions
 }
 
 // NewBanService creates a new ban service.
@@ -68,6 +75,42 @@ func (s *BanService) SetEventHandler(handler EventHandler) {
 	}
 }
 
+// SetConfig replaces the configuration, e.g., with the effective
+// configuration of the policy matching the request.
+func (s *BanService) SetConfig(config *PluginConfig) {
+	s.config = config
+}
+
+// SetClusterScoreHandler sets the function receiving the decisions of
+// pending score updates, made once the cluster-wide score arrives. It may
+// be called before IssueBan returns, e.g., when Redis is unavailable.
+func (s *BanService) SetClusterScoreHandler(handler func(*BanIssueResult)) {
+	s.onClusterScore = handler
+}
+
+// SetScopes sets the host and path scopes of the request, used to scope
+// issued bans and to look up scoped bans.
+func (s *BanService) SetScopes(scopes *RequestScopes) {
+	s.scopes = scopes
+}
+
+// BanIDs returns the IDs of every ban that applies to a fingerprint on
+// this request: the global ban and, when bans can be scoped, the host and
+// path bans.
+func (s *BanService) BanIDs(fingerprint string) []string {
+	ids := []string{fingerprint}
+	if s.scopes != nil && s.config.ScopedBans() {
+		ids = append(ids, BanID(fingerprint, s.scopes.Host), BanID(fingerprint, s.scopes.Path))
+	}
+	return ids
+}
+
+// SetOffenseStore sets the store used to count repeat offenses for ban
+// escalation. Offenses are only counted when escalation is enabled.
+func (s *BanService) SetOffenseStore(store OffenseStore) {
+	s.offenseStore = store
+}
+
 // CheckBan checks if a fingerprint is banned in the local store.
 // Returns the ban check result. Redis check should be handled separately.
 func (s *BanService) CheckBan(fingerprint string) *BanCheckResult {
@@ -76,12 +119,18 @@ func (s *BanService) CheckBan(fingerprint string) *BanCheckResult {
 		return &BanCheckResult{IsBanned: false}
 	}
 
-	if entry, found := s.banStore.CheckBan(fingerprint); found {
+	for _, id := range s.BanIDs(fingerprint) {
+		entry, found := s.banStore.CheckBan(id)
+		if !found {
+			continue
+		}
+
 		s.logger.Info("ban found in local cache for %s (rule=%s, expires=%d)",
-			fingerprint, entry.RuleID, entry.ExpiresAt)
+			id, entry.RuleID, entry.ExpiresAt)
 
 		// Emit enforced event
 		event := NewBanEvent(BanEventEnforced, fingerprint, entry.RuleID, entry.Severity, "local")
+		event.Scope = entry.Scope
 		s.eventHandler.OnBanEvent(event)
 
 		return &BanCheckResult{IsBanned: true, Entry: entry}
@@ -90,6 +139,18 @@ func (s *BanService) CheckBan(fingerprint string) *BanCheckResult {
 	return &BanCheckResult{IsBanned: false}
 }
 
+// EnforceDenylist logs and emits the enforcement of the static denylist
+// against a client. Nothing is stored since the denylist itself is the
+// source of truth.
+func (s *BanService) EnforceDenylist(fingerprint string, rule *DenylistRule) {
+	s.logger.Info("client matched denylist %s (reason=%s), fingerprint=%s",
+		rule.Match, rule.Reason, fingerprint)
+
+	event := NewBanEvent(BanEventEnforced, fingerprint, "denylist", "critical", "denylist")
+	event.Reason = rule.Match
+	s.eventHandler.OnBanEvent(event)
+}
+
 // IssueBan creates a ban for a fingerprint based on WAF metadata.
 // It handles both direct bans and score-based bans.
 func (s *BanService) IssueBan(fingerprint string, metadata *CorazaMetadata) *BanIssueResult {
@@ -103,65 +164,245 @@ func (s *BanService) IssueBan(fingerprint string, metadata *CorazaMetadata) *Ban
 		return &BanIssueResult{Issued: false}
 	}
 
-	// Get severity and rule info with defaults
-	severity := metadata.Severity
-	if severity == "" {
-		severity = "medium"
-	}
-
-	ruleID := metadata.RuleID
-	if ruleID == "" {
-		ruleID = "unknown"
+	// Score the matched rules, skipping rules filtered out by their tags
+	match := s.matchRules(metadata.MatchedRules())
+	if match == nil {
+		s.logger.Info("WAF block ignored by tag filters: fingerprint=%s, rule=%s, tags=%v",
+			fingerprint, metadata.RuleID, metadata.Tags)
+		return &BanIssueResult{Issued: false}
 	}
 
 	// Check if scoring is enabled
 	if s.config.ScoringEnabled {
-		return s.issueScoreBasedBan(fingerprint, ruleID, severity)
+		return s.scoreMatch(fingerprint, metadata, match)
 	}
 
 	// Direct ban (no scoring)
-	return s.issueDirectBan(fingerprint, ruleID, severity)
+	return s.issueDirectBan(fingerprint, match)
+}
+
+// ScoreDetection adds the score of a request the WAF detected attacks in
+// but did not block (e.g., rules in detection-only mode), and bans the
+// fingerprint if the score threshold is exceeded. Detections only add to
+// the score when their action is in score_actions.
+func (s *BanService) ScoreDetection(fingerprint string, metadata *CorazaMetadata) *BanIssueResult {
+	if fingerprint == "" || metadata == nil || !s.config.ScoringEnabled || !metadata.HasDetection() {
+		return &BanIssueResult{Issued: false}
+	}
+
+	match := s.matchRules(metadata.MatchedRules())
+	if match == nil {
+		return &BanIssueResult{Issued: false}
+	}
+
+	s.logger.Debug("WAF detection: fingerprint=%s, action=%s, rule=%s, anomaly_score=%d, paranoia_level=%d",
+		fingerprint, metadata.Action, match.rule.RuleID, metadata.AnomalyScore(), metadata.ParanoiaLevel)
+
+	return s.scoreMatch(fingerprint, metadata, match)
+}
+
+// scoreMatch adds the score of a match, scaled by the multiplier of the
+// WAF action. The anomaly score mode replaces the rule scores with the
+// anomaly score increment.
+func (s *BanService) scoreMatch(fingerprint string, metadata *CorazaMetadata, match *ruleMatch) *BanIssueResult {
+	multiplier, ok := s.config.ActionMultiplier(metadata.Action)
+	if !ok {
+		s.logger.Debug("WAF action %q does not add to the score", metadata.Action)
+		return &BanIssueResult{Issued: false}
+	}
+
+	if increment, ok := s.anomalyIncrement(metadata); ok {
+		match.increment = increment
+	}
+	match.increment = int(math.Round(float64(match.increment) * multiplier))
+	if match.increment <= 0 {
+		return &BanIssueResult{Issued: false}
+	}
+
+	return s.addScore(fingerprint, match)
+}
+
+// anomalyIncrement returns the score increment of the CRS anomaly score
+// of a request. Returns false unless the anomaly score mode is used and
+// the metadata carries an anomaly score.
+func (s *BanService) anomalyIncrement(metadata *CorazaMetadata) (int, bool) {
+	if s.config.ScoreMode != ScoreModeAnomaly || metadata.AnomalyScore() <= 0 {
+		return 0, false
+	}
+	return s.config.AnomalyScoring.Increment(metadata.AnomalyScore()), true
+}
+
+// ruleMatch is a scored WAF decision.
+type ruleMatch struct {
+	rule      MatchedRule // highest scoring rule, which the ban reports
+	ruleIDs   []string    // every counted rule, when there are several
+	increment int         // score increment of the counted rules
+	hits      []RuleHit   // hit of every counted rule
+}
+
+// matchRules scores the matched rules that count (see CountsTags),
+// combined by the score aggregation. Returns nil if no rule counts.
+func (s *BanService) matchRules(rules []MatchedRule) *ruleMatch {
+	match := &ruleMatch{}
+	now := time.Now().Unix()
+	best := -1
+	categories := make(map[string]int)
+
+	for _, rule := range rules {
+		if !s.config.CountsTags(rule.Tags) {
+			continue
+		}
+
+		// Apply defaults for rules without ID or severity
+		if rule.RuleID == "" {
+			rule.RuleID = "unknown"
+		}
+		if rule.Severity == "" {
+			rule.Severity = "medium"
+		}
+
+		score := s.config.GetScore(rule.RuleID, rule.Severity, rule.Tags...)
+		if score > best {
+			match.rule, best = rule, score
+		}
+		if category := rule.Category(); score > categories[category] {
+			categories[category] = score
+		}
+
+		match.ruleIDs = append(match.ruleIDs, rule.RuleID)
+		match.hits = append(match.hits, RuleHit{
+			RuleID:    rule.RuleID,
+			Severity:  rule.Severity,
+			Score:     score,
+			Timestamp: now,
+		})
+
+		if s.config.ScoreAggregation == ScoreAggregationSum {
+			match.increment += score
+		}
+	}
+
+	if best < 0 {
+		return nil
+	}
+
+	switch s.config.ScoreAggregation {
+	case ScoreAggregationMax:
+		match.increment = best
+	case ScoreAggregationDistinct:
+		for _, score := range categories {
+			match.increment += score
+		}
+	}
+
+	if len(match.ruleIDs) == 1 {
+		match.ruleIDs = nil
+	}
+	return match
+}
+
+// SkipAllowlisted records that a WAF block did not result in a ban
+// because the client matched the allowlist.
+func (s *BanService) SkipAllowlisted(fingerprint string, metadata *CorazaMetadata, reason string) {
+	ruleID, severity := "", ""
+	if metadata != nil {
+		ruleID, severity = metadata.RuleID, metadata.Severity
+	}
+
+	s.logger.Info("ban skipped for allowlisted client: fingerprint=%s, rule=%s, reason=%s",
+		fingerprint, ruleID, reason)
+
+	event := NewBanEvent(BanEventAllowlisted, fingerprint, ruleID, severity, "local")
+	event.Reason = reason
+	s.eventHandler.OnBanEvent(event)
 }
 
 // issueDirectBan creates an immediate ban without scoring.
-func (s *BanService) issueDirectBan(fingerprint, ruleID, severity string) *BanIssueResult {
-	ttl := s.config.GetBanTTL(severity)
+// The ban reports the highest scoring rule of the match.
+func (s *BanService) issueDirectBan(fingerprint string, match *ruleMatch) *BanIssueResult {
+	ruleID, severity := match.rule.RuleID, match.rule.Severity
+	ttl, offenses := s.banTTL(fingerprint, severity, match.rule.Tags)
 	reason := fmt.Sprintf("waf-rule:%s", ruleID)
 
 	entry := NewBanEntry(fingerprint, reason, ruleID, severity, ttl)
+	entry.Scope = s.banScope(ruleID, severity)
+	entry.Tags = match.rule.Tags
+	entry.Rules = match.ruleIDs
+	entry.Offenses = offenses
 
 	if err := s.banStore.SetBan(entry); err != nil {
 		s.logger.Error("failed to store ban in local cache: %v", err)
 		return &BanIssueResult{Issued: false}
 	}
 
-	s.logger.Info("ban issued: fingerprint=%s, rule=%s, severity=%s, ttl=%d",
-		fingerprint, ruleID, severity, ttl)
+	s.logger.Info("ban issued: fingerprint=%s, rule=%s, severity=%s, ttl=%d, offenses=%d, scope=%s",
+		fingerprint, ruleID, severity, ttl, offenses, entry.Scope)
 
 	// Emit issued event
 	event := NewBanEvent(BanEventIssued, fingerprint, ruleID, severity, "local")
+	event.Scope = entry.Scope
 	event.TTL = ttl
+	event.Offenses = offenses
 	s.eventHandler.OnBanEvent(event)
 
+	s.recordOffense(entry)
+
 	return &BanIssueResult{Issued: true, Entry: entry}
 }
 
-// issueScoreBasedBan updates the score and bans if threshold exceeded.
-// Scores are synchronized to Redis for multi-instance consistency.
-func (s *BanService) issueScoreBasedBan(fingerprint, ruleID, severity string) *BanIssueResult {
-	// Get score increment for this rule
-	scoreIncrement := s.config.GetScore(ruleID, severity)
+// ScoreSignal adds the score of a triggered signal and bans the
+// fingerprint if the score threshold is exceeded. The signal is recorded
+// as the rule ID of the score and the ban (see SignalRuleID).
+func (s *BanService) ScoreSignal(fingerprint, signal string) *BanIssueResult {
+	config := s.config.Signals.Get(signal)
+	if fingerprint == "" || config == nil || !s.config.ScoringEnabled {
+		return &BanIssueResult{Issued: false}
+	}
+	rule := MatchedRule{RuleID: SignalRuleID(signal), Severity: config.Severity}
+	return s.addScore(fingerprint, &ruleMatch{
+		rule:      rule,
+		increment: config.Score,
+		hits:      []RuleHit{{RuleID: rule.RuleID, Severity: rule.Severity, Score: config.Score, Timestamp: time.Now().Unix()}},
+	})
+}
 
+// addScore adds the score of a match and bans if threshold exceeded.
+// With the local score source, the local score decides and its change is
+// synchronized to Redis. With the Redis score source, the cluster-wide
+// score decides once Redis answers: the result is pending and the
+// decision is delivered to the cluster score handler (see
+// SetClusterScoreHandler). The local score is then only a fallback for
+// when Redis is unavailable.
+func (s *BanService) addScore(fingerprint string, match *ruleMatch) *BanIssueResult {
 	// Update score using the local score store (primary, synchronous)
-	newScore, err := s.scoreStore.IncrScore(fingerprint, scoreIncrement)
+	newScore, err := s.scoreStore.IncrScore(fingerprint, match.increment, match.hits)
 	if err != nil {
 		s.logger.Error("failed to update score: %v", err)
 		return &BanIssueResult{Issued: false, Score: 0}
 	}
 
-	// Sync score to Redis for multi-instance consistency (fire-and-forget)
+	if s.config.ScoreSource == ScoreSourceRedis && s.redisClient.IsConfigured() {
+		s.redisClient.IncrClusterScoreAsync(fingerprint, match.increment, s.config.ScoreDecay(), s.config.ScoreTTL,
+			func(clusterScore int, success bool) {
+				source := "redis"
+				if !success {
+					s.logger.Warn("cluster score unavailable for %s, using local score", fingerprint)
+					clusterScore, source = newScore, "local"
+				}
+				result := s.evaluateScore(fingerprint, match, clusterScore, source)
+				if s.onClusterScore != nil {
+					s.onClusterScore(result)
+				}
+			})
+		return &BanIssueResult{Issued: false, Score: newScore, Pending: true}
+	}
+
+	// Sync the increment to the cluster-wide score (fire-and-forget).
+	// Redis decays it server-side along the configured curve, the same way
+	// as with the Redis score source, so it decays even when no instance
+	// scores the client anymore and never drops below zero.
 	if s.redisClient.IsConfigured() {
-		s.redisClient.IncrScoreAsync(fingerprint, scoreIncrement, s.config.ScoreTTL,
+		s.redisClient.IncrClusterScoreAsync(fingerprint, match.increment, s.config.ScoreDecay(), s.config.ScoreTTL,
 			func(redisScore int, success bool) {
 				if success {
 					s.logger.Debug("score synced to Redis: fingerprint=%s, redis_score=%d", fingerprint, redisScore)
@@ -171,11 +412,19 @@ func (s *BanService) issueScoreBasedBan(fingerprint, ruleID, severity string) *B
 			})
 	}
 
-	s.logger.Info("score updated: fingerprint=%s, rule=%s, score=%d/%d",
-		fingerprint, ruleID, newScore, s.config.ScoreThreshold)
+	return s.evaluateScore(fingerprint, match, newScore, "local")
+}
+
+// evaluateScore records an updated score and bans if threshold exceeded.
+// source tells whether the score is the local or the cluster-wide score.
+func (s *BanService) evaluateScore(fingerprint string, match *ruleMatch, newScore int, source string) *BanIssueResult {
+	ruleID, severity := match.rule.RuleID, match.rule.Severity
+
+	s.logger.Info("score updated: fingerprint=%s, rule=%s, score=%d/%d, source=%s",
+		fingerprint, ruleID, newScore, s.config.ScoreThreshold, source)
 
 	// Emit score updated event
-	scoreEvent := NewBanEvent(BanEventScoreUpdated, fingerprint, ruleID, severity, "local")
+	scoreEvent := NewBanEvent(BanEventScoreUpdated, fingerprint, ruleID, severity, source)
 	scoreEvent.Score = newScore
 	scoreEvent.Threshold = s.config.ScoreThreshold
 	s.eventHandler.OnBanEvent(scoreEvent)
@@ -184,11 +433,15 @@ func (s *BanService) issueScoreBasedBan(fingerprint, ruleID, severity string) *B
 	if newScore >= s.config.ScoreThreshold {
 		s.logger.Info("score threshold exceeded, issuing ban")
 
-		ttl := s.config.GetBanTTL(severity)
+		ttl, offenses := s.banTTL(fingerprint, severity, match.rule.Tags)
 		reason := fmt.Sprintf("score-threshold:%d", newScore)
 
 		entry := NewBanEntry(fingerprint, reason, ruleID, severity, ttl)
+		entry.Scope = s.banScope(ruleID, severity)
+		entry.Tags = match.rule.Tags
+		entry.Rules = match.ruleIDs
 		entry.Score = newScore
+		entry.Offenses = offenses
 
 		if err := s.banStore.SetBan(entry); err != nil {
 			s.logger.Error("failed to store ban in local cache: %v", err)
@@ -197,20 +450,195 @@ func (s *BanService) issueScoreBasedBan(fingerprint, ruleID, severity string) *B
 
 		// Emit issued event
 		issuedEvent := NewBanEvent(BanEventIssued, fingerprint, ruleID, severity, "local")
+		issuedEvent.Scope = entry.Scope
 		issuedEvent.TTL = ttl
 		issuedEvent.Score = newScore
+		issuedEvent.Offenses = offenses
 		s.eventHandler.OnBanEvent(issuedEvent)
 
+		s.recordOffense(entry)
+
 		return &BanIssueResult{Issued: true, Entry: entry, Score: newScore}
 	}
 
 	return &BanIssueResult{Issued: false, Score: newScore}
 }
 
-// SyncBanFromRedis stores a ban entry received from Redis to local cache.
+// banScope returns the scope of a new ban. Without request scopes (e.g.,
+// manual bans) bans are global.
+func (s *BanService) banScope(ruleID, severity string) string {
+	if s.scopes == nil {
+		return ""
+	}
+	return s.scopes.Scope(s.config.GetBanScope(ruleID, severity))
+}
+
+// banTTL returns the TTL and offense count of a new ban, counting the ban
+// as an offense. The offense is only recorded by recordOffense once the ban
+// is stored. Without escalation the tag or severity TTL is used and
+// offenses are not counted.
+func (s *BanService) banTTL(fingerprint, severity string, tags []string) (int, int) {
+	baseTTL := s.config.GetBanTTL(severity, tags...)
+	if !s.config.Escalation.Enabled || s.offenseStore == nil {
+		return baseTTL, 0
+	}
+
+	offenses, err := s.offenseStore.GetOffenses(fingerprint)
+	if err != nil {
+		s.logger.Error("failed to read offenses for %s: %v", fingerprint, err)
+	}
+	offenses++
+
+	return s.config.Escalation.BanTTL(baseTTL, offenses), offenses
+}
+
+// recordOffense records the offense of a stored ban locally and in Redis.
+func (s *BanService) recordOffense(entry *BanEntry) {
+	if entry.Offenses == 0 {
+		return
+	}
+
+	if _, err := s.offenseStore.IncrOffenses(entry.Fingerprint); err != nil {
+		s.logger.Error("failed to record offense for %s: %v", entry.Fingerprint, err)
+	}
+
+	s.syncOffenses(entry)
+}
+
+// syncOffenses records the offense in Redis so that repeat offenders are
+// recognized across instances. When other instances have banned the client
+// more often, the local count is raised and the ban is escalated to match.
+func (s *BanService) syncOffenses(entry *BanEntry) {
+	if entry.Offenses == 0 || !s.redisClient.IsConfigured() {
+		return
+	}
+
+	fingerprint := entry.Fingerprint
+	s.redisClient.IncrOffensesAsync(fingerprint, s.config.Escalation.WindowSeconds, func(count int, ok bool) {
+		if !ok || count <= entry.Offenses {
+			return
+		}
+
+		if err := s.offenseStore.SyncOffenses(fingerprint, count); err != nil {
+			s.logger.Error("failed to sync offenses for %s: %v", fingerprint, err)
+		}
+
+		ttl := s.config.Escalation.BanTTL(s.config.GetBanTTL(entry.Severity, entry.Tags...), count)
+		if ttl <= entry.TTL {
+			return
+		}
+
+		entry.Offenses = count
+		entry.TTL = ttl
+		entry.ExpiresAt = entry.CreatedAt + int64(ttl)
+
+		if err := s.banStore.SetBan(entry); err != nil {
+			s.logger.Error("failed to store escalated ban in local cache: %v", err)
+			return
+		}
+		s.redisClient.SetBanAsync(entry, func(success bool) {
+			if !success {
+				s.logger.Warn("failed to store escalated ban in Redis for %s", fingerprint)
+			}
+		})
+
+		s.logger.Info("ban escalated with offenses from Redis: fingerprint=%s, offenses=%d, ttl=%d",
+			fingerprint, count, ttl)
+	})
+}
+
+// SyncBanFromRedis stores a ban entry received from Redis to local cache
+// and records its enforcement. The local copy is marked as synced so that
+// only the issuing instance reports its expiry.
 func (s *BanService) SyncBanFromRedis(entry *BanEntry) error {
 	if entry == nil {
 		return nil
 	}
-	return s.banStore.SetBan(entry)
+
+	event := NewBanEvent(BanEventEnforced, entry.Fingerprint, entry.RuleID, entry.Severity, "redis")
+	s.eventHandler.OnBanEvent(event)
+
+	synced := *entry
+	synced.Synced = true
+	return s.banStore.SetBan(&synced)
+}
+
+// IssueManualBan creates a ban requested by an operator rather than a WAF
+// decision. The ban is stored in the local cache; Redis sync is handled by
+// the caller.
+func (s *BanService) IssueManualBan(fingerprint, reason, severity string, ttl int) *BanIssueResult {
+	if fingerprint == "" {
+		s.logger.Warn("no fingerprint provided, cannot issue manual ban")
+		return &BanIssueResult{Issued: false}
+	}
+
+	entry := NewBanEntry(fingerprint, reason, "manual", severity, ttl)
+
+	if err := s.banStore.SetBan(entry); err != nil {
+		s.logger.Error("failed to store manual ban in local cache: %v", err)
+		return &BanIssueResult{Issued: false}
+	}
+
+	s.logger.Info("manual ban issued: fingerprint=%s, reason=%s, severity=%s, ttl=%d",
+		fingerprint, reason, severity, ttl)
+
+	event := NewBanEvent(BanEventIssued, fingerprint, entry.RuleID, severity, "admin")
+	event.TTL = ttl
+	s.eventHandler.OnBanEvent(event)
+
+	return &BanIssueResult{Issued: true, Entry: entry}
+}
+
+// LiftBan removes a ban from the local cache before it expires.
+// Returns false if no active ban existed for the ban ID.
+func (s *BanService) LiftBan(id string) (bool, error) {
+	entry, found := s.banStore.CheckBan(id)
+	if !found {
+		return false, nil
+	}
+
+	if err := s.banStore.DeleteBan(id); err != nil {
+		return true, err
+	}
+
+	s.logger.Info("ban lifted: id=%s", id)
+	s.eventHandler.OnBanEvent(NewBanEndEvent(BanEventLifted, entry, "local"))
+	return true, nil
+}
+
+// PassChallenge records that a client solved the challenge for its ban.
+// With lift the ban is removed locally and in Redis; otherwise it stays in
+// place and the caller lets the client through with a pass cookie.
+func (s *BanService) PassChallenge(entry *BanEntry, lift bool) {
+	action := ChallengeOnSuccessDowngrade
+	if lift {
+		action = ChallengeOnSuccessLift
+	}
+
+	s.logger.Info("challenge passed: fingerprint=%s, rule=%s, action=%s",
+		entry.Fingerprint, entry.RuleID, action)
+
+	event := NewBanEvent(BanEventChallengePassed, entry.Fingerprint, entry.RuleID, entry.Severity, "challenge")
+	event.Reason = action
+	s.eventHandler.OnBanEvent(event)
+
+	if !lift {
+		return
+	}
+
+	if err := s.banStore.DeleteBan(entry.ID()); err != nil {
+		s.logger.Error("failed to lift ban for %s: %v", entry.ID(), err)
+	}
+	if s.redisClient.IsConfigured() {
+		s.redisClient.DeleteBanAsync(entry.ID(), nil)
+	}
+	s.eventHandler.OnBanEvent(NewBanEndEvent(BanEventLifted, entry, "challenge"))
+}
+
+// LiftRemoteBan records the lifting of a ban that is not in the local
+// cache and is only deleted from Redis. The entry is not available
+// locally, so the event carries only the fingerprint.
+func (s *BanService) LiftRemoteBan(id string) {
+	s.logger.Info("ban lifted in Redis: id=%s", id)
+	s.eventHandler.OnBanEvent(NewBanEvent(BanEventLifted, BanIDFingerprint(id), "", "", "redis"))
 }
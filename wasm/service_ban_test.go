@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"testing"
+	"time"
 )
 
 func TestNewBanService(t *testing.T) {
@@ -286,9 +288,9 @@ func TestBanService_IssueBan_ScoringMode_RedisSyncCalled(t *testing.T) {
 
 	service.IssueBan("test-fingerprint", metadata)
 
-	// Should sync score to Redis
-	if redisClient.IncrScoreCalls != 1 {
-		t.Errorf("expected 1 IncrScoreAsync call, got %d", redisClient.IncrScoreCalls)
+	// Should sync the increment to the decayed cluster score
+	if redisClient.ClusterScores["test-fingerprint"] != config.GetScore("rule-789", "medium") {
+		t.Errorf("expected the increment in the cluster score, got %v", redisClient.ClusterScores)
 	}
 }
 
@@ -318,6 +320,12 @@ func TestBanService_SyncBanFromRedis(t *testing.T) {
 	if stored.RuleID != "rule-123" {
 		t.Errorf("expected rule-123, got %s", stored.RuleID)
 	}
+	if !stored.Synced {
+		t.Error("expected local copy to be marked as synced")
+	}
+	if entry.Synced {
+		t.Error("Redis entry should not be modified")
+	}
 }
 
 func TestBanService_SyncBanFromRedis_NilEntry(t *testing.T) {
@@ -372,3 +380,661 @@ func TestBanService_SetEventHandler_NilIgnored(t *testing.T) {
 	// Should not panic
 	service.SetEventHandler(nil)
 }
+
+func TestBanService_SkipAllowlisted(t *testing.T) {
+	config := DefaultConfig()
+	logger := NewMockLogger()
+	banStore := NewMockBanStore()
+	scoreStore := NewMockScoreStore()
+	eventHandler := NewMockEventHandler()
+
+	service := NewBanService(config, logger, banStore, scoreStore, nil)
+	service.SetEventHandler(eventHandler)
+
+	metadata := &CorazaMetadata{Action: "block", RuleID: "rule-123", Severity: "high"}
+	service.SkipAllowlisted("test-fingerprint", metadata, "cidr")
+
+	if banStore.SetCalls != 0 {
+		t.Error("allowlisted client should not be banned")
+	}
+	if len(eventHandler.Events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(eventHandler.Events))
+	}
+	event := eventHandler.Events[0]
+	if event.Type != BanEventAllowlisted {
+		t.Errorf("expected allowlisted event, got %s", event.Type)
+	}
+	if event.Reason != "cidr" || event.RuleID != "rule-123" {
+		t.Errorf("unexpected event fields: %+v", event)
+	}
+}
+
+func TestBanService_EnforceDenylist(t *testing.T) {
+	config := DefaultConfig()
+	logger := NewMockLogger()
+	banStore := NewMockBanStore()
+	scoreStore := NewMockScoreStore()
+	eventHandler := NewMockEventHandler()
+
+	service := NewBanService(config, logger, banStore, scoreStore, nil)
+	service.SetEventHandler(eventHandler)
+
+	rule := &DenylistRule{Match: "203.0.113.0/24", Reason: "botnet"}
+	service.EnforceDenylist("test-fingerprint", rule)
+
+	if banStore.SetCalls != 0 {
+		t.Error("denylist enforcement should not store a ban")
+	}
+	if len(eventHandler.Events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(eventHandler.Events))
+	}
+	event := eventHandler.Events[0]
+	if event.Type != BanEventEnforced || event.Source != "denylist" {
+		t.Errorf("expected enforced event from denylist, got %s/%s", event.Type, event.Source)
+	}
+	if event.RuleID != "denylist" || event.Reason != rule.Match {
+		t.Errorf("expected denylist rule and matched CIDR, got %s/%s", event.RuleID, event.Reason)
+	}
+}
+
+func TestBanService_LiftBan_EmitsLiftedEvent(t *testing.T) {
+	config := DefaultConfig()
+	logger := NewMockLogger()
+	banStore := NewMockBanStore()
+	scoreStore := NewMockScoreStore()
+	eventHandler := NewMockEventHandler()
+
+	service := NewBanService(config, logger, banStore, scoreStore, nil)
+	service.SetEventHandler(eventHandler)
+
+	entry := NewBanEntry("test-fingerprint", "waf-rule", "930120", "high", 600)
+	entry.CreatedAt -= 120
+	banStore.Bans[entry.Fingerprint] = entry
+
+	found, err := service.LiftBan("test-fingerprint")
+	if !found || err != nil {
+		t.Fatalf("expected ban to be lifted, got found=%v err=%v", found, err)
+	}
+	if len(eventHandler.Events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(eventHandler.Events))
+	}
+	event := eventHandler.Events[0]
+	if event.Type != BanEventLifted || event.RuleID != "930120" || event.Severity != "high" {
+		t.Errorf("unexpected lifted event: %+v", event)
+	}
+	if event.TTL != 600 || event.Duration != 120 {
+		t.Errorf("expected ttl=600 duration=120, got ttl=%d duration=%d", event.TTL, event.Duration)
+	}
+}
+
+func TestBanService_LiftBan_NotFound(t *testing.T) {
+	config := DefaultConfig()
+	logger := NewMockLogger()
+	eventHandler := NewMockEventHandler()
+
+	service := NewBanService(config, logger, NewMockBanStore(), NewMockScoreStore(), nil)
+	service.SetEventHandler(eventHandler)
+
+	found, err := service.LiftBan("unknown")
+	if found || err != nil {
+		t.Errorf("expected not found, got found=%v err=%v", found, err)
+	}
+	if len(eventHandler.Events) != 0 {
+		t.Errorf("expected no events, got %d", len(eventHandler.Events))
+	}
+}
+
+func TestBanService_IssueBan_Escalation(t *testing.T) {
+	config := DefaultConfig()
+	config.Escalation = EscalationConfig{Enabled: true, Ladder: []int{600, 3600, 86400}}
+	logger := NewMockLogger()
+	banStore := NewMockBanStore()
+	eventHandler := NewMockEventHandler()
+
+	service := NewBanService(config, logger, banStore, NewMockScoreStore(), nil)
+	service.SetOffenseStore(NewMockOffenseStore())
+	service.SetEventHandler(eventHandler)
+
+	metadata := &CorazaMetadata{Action: "deny", RuleID: "930120", Severity: "low"}
+	for i, expected := range []int{600, 3600, 86400, 86400} {
+		result := service.IssueBan("test-fingerprint", metadata)
+		if !result.Issued {
+			t.Fatalf("ban %d not issued", i+1)
+		}
+		if result.Entry.TTL != expected || result.Entry.Offenses != i+1 {
+			t.Errorf("ban %d: expected ttl=%d offenses=%d, got ttl=%d offenses=%d",
+				i+1, expected, i+1, result.Entry.TTL, result.Entry.Offenses)
+		}
+	}
+
+	event := eventHandler.Events[len(eventHandler.Events)-1]
+	if event.Type != BanEventIssued || event.Offenses != 4 {
+		t.Errorf("expected issued event with 4 offenses, got %s/%d", event.Type, event.Offenses)
+	}
+}
+
+func TestBanService_IssueBan_EscalationFailedBan(t *testing.T) {
+	config := DefaultConfig()
+	config.Escalation = EscalationConfig{Enabled: true, Ladder: []int{600, 3600, 86400}}
+	banStore := NewMockBanStore()
+	banStore.SetBanErr = errors.New("shared data full")
+	offenseStore := NewMockOffenseStore()
+
+	service := NewBanService(config, NewMockLogger(), banStore, NewMockScoreStore(), nil)
+	service.SetOffenseStore(offenseStore)
+
+	metadata := &CorazaMetadata{Action: "deny", RuleID: "930120", Severity: "low"}
+	if result := service.IssueBan("test-fingerprint", metadata); result.Issued {
+		t.Fatal("expected ban to fail")
+	}
+	if offenseStore.Counts["test-fingerprint"] != 0 {
+		t.Errorf("a ban that was not stored should not count as an offense, got %d",
+			offenseStore.Counts["test-fingerprint"])
+	}
+
+	banStore.SetBanErr = nil
+	result := service.IssueBan("test-fingerprint", metadata)
+	if !result.Issued || result.Entry.TTL != 600 || result.Entry.Offenses != 1 {
+		t.Errorf("expected first offense ban, got %+v", result.Entry)
+	}
+}
+
+func TestBanService_IssueBan_EscalationScoreBased(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoringEnabled = true
+	config.ScoreThreshold = 10
+	config.Escalation = EscalationConfig{Enabled: true, Multiplier: 2, MaxTTL: 86400}
+	logger := NewMockLogger()
+
+	offenses := NewMockOffenseStore()
+	offenses.Counts["test-fingerprint"] = 2
+
+	service := NewBanService(config, logger, NewMockBanStore(), NewMockScoreStore(), nil)
+	service.SetOffenseStore(offenses)
+
+	metadata := &CorazaMetadata{Action: "deny", RuleID: "930120", Severity: "critical"}
+	result := service.IssueBan("test-fingerprint", metadata)
+
+	if !result.Issued {
+		t.Fatal("expected score-based ban")
+	}
+	// Third offense: default TTL 600 doubled twice
+	if result.Entry.TTL != 2400 || result.Entry.Offenses != 3 {
+		t.Errorf("expected ttl=2400 offenses=3, got ttl=%d offenses=%d", result.Entry.TTL, result.Entry.Offenses)
+	}
+}
+
+func TestBanService_IssueBan_EscalationFromRedis(t *testing.T) {
+	config := DefaultConfig()
+	config.Escalation = EscalationConfig{Enabled: true, Ladder: []int{600, 3600, 86400}, WindowSeconds: 86400}
+	logger := NewMockLogger()
+	banStore := NewMockBanStore()
+	offenses := NewMockOffenseStore()
+
+	// Other instances already banned this client twice
+	redisClient := NewMockRedisClient(true)
+	redisClient.Offenses = map[string]int{"test-fingerprint": 2}
+
+	service := NewBanService(config, logger, banStore, NewMockScoreStore(), redisClient)
+	service.SetOffenseStore(offenses)
+
+	metadata := &CorazaMetadata{Action: "deny", RuleID: "930120", Severity: "high"}
+	result := service.IssueBan("test-fingerprint", metadata)
+
+	if result.Entry.TTL != 86400 || result.Entry.Offenses != 3 {
+		t.Errorf("expected ban escalated to ttl=86400 offenses=3, got ttl=%d offenses=%d",
+			result.Entry.TTL, result.Entry.Offenses)
+	}
+	if offenses.Counts["test-fingerprint"] != 3 {
+		t.Errorf("expected local offenses synced to 3, got %d", offenses.Counts["test-fingerprint"])
+	}
+	if banStore.Bans["test-fingerprint"].TTL != 86400 {
+		t.Error("escalated ban should be stored locally")
+	}
+	if redisClient.BannedEntries["test-fingerprint"] == nil {
+		t.Error("escalated ban should be stored in Redis")
+	}
+}
+
+func TestBanService_IssueBan_NoEscalationWhenDisabled(t *testing.T) {
+	config := DefaultConfig()
+	logger := NewMockLogger()
+	offenses := NewMockOffenseStore()
+
+	service := NewBanService(config, logger, NewMockBanStore(), NewMockScoreStore(), nil)
+	service.SetOffenseStore(offenses)
+
+	metadata := &CorazaMetadata{Action: "deny", RuleID: "930120", Severity: "high"}
+	result := service.IssueBan("test-fingerprint", metadata)
+
+	if result.Entry.TTL != config.BanTTLDefault || result.Entry.Offenses != 0 {
+		t.Errorf("expected default ttl without offenses, got ttl=%d offenses=%d", result.Entry.TTL, result.Entry.Offenses)
+	}
+	if len(offenses.Counts) != 0 {
+		t.Error("offenses should not be counted when escalation is disabled")
+	}
+}
+
+func TestBanService_PassChallenge_Downgrade(t *testing.T) {
+	config := DefaultConfig()
+	logger := NewMockLogger()
+	banStore := NewMockBanStore()
+	eventHandler := NewMockEventHandler()
+
+	service := NewBanService(config, logger, banStore, NewMockScoreStore(), nil)
+	service.SetEventHandler(eventHandler)
+
+	entry := NewBanEntry("test-fingerprint", "waf-rule", "930120", "medium", 600)
+	banStore.Bans[entry.Fingerprint] = entry
+
+	service.PassChallenge(entry, false)
+
+	if _, found := banStore.Bans[entry.Fingerprint]; !found {
+		t.Error("downgrade should keep the ban")
+	}
+	if len(eventHandler.Events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(eventHandler.Events))
+	}
+	event := eventHandler.Events[0]
+	if event.Type != BanEventChallengePassed || event.Reason != ChallengeOnSuccessDowngrade {
+		t.Errorf("expected challenge_passed/downgrade, got %s/%s", event.Type, event.Reason)
+	}
+}
+
+func TestBanService_PassChallenge_Lift(t *testing.T) {
+	config := DefaultConfig()
+	logger := NewMockLogger()
+	banStore := NewMockBanStore()
+	redisClient := NewMockRedisClient(true)
+	eventHandler := NewMockEventHandler()
+
+	service := NewBanService(config, logger, banStore, NewMockScoreStore(), redisClient)
+	service.SetEventHandler(eventHandler)
+
+	entry := NewBanEntry("test-fingerprint", "waf-rule", "930120", "low", 600)
+	banStore.Bans[entry.Fingerprint] = entry
+	redisClient.BannedEntries[entry.Fingerprint] = entry
+
+	service.PassChallenge(entry, true)
+
+	if _, found := banStore.Bans[entry.Fingerprint]; found {
+		t.Error("lift should remove the local ban")
+	}
+	if _, found := redisClient.BannedEntries[entry.Fingerprint]; found {
+		t.Error("lift should remove the Redis ban")
+	}
+	if len(eventHandler.Events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(eventHandler.Events))
+	}
+	if lifted := eventHandler.Events[1]; lifted.Type != BanEventLifted || lifted.Source != "challenge" {
+		t.Errorf("expected lifted event from challenge, got %s/%s", lifted.Type, lifted.Source)
+	}
+}
+
+func TestBanService_IssueBan_HostScope(t *testing.T) {
+	config := DefaultConfig()
+	config.BanScopeDefault = BanScopeHost
+	banStore := NewMockBanStore()
+
+	service := NewBanService(config, NewMockLogger(), banStore, NewMockScoreStore(), nil)
+	service.SetScopes(NewRequestScopes("a.example.com", "/api"))
+
+	result := service.IssueBan("test-fingerprint", &CorazaMetadata{Action: "block", RuleID: "930120", Severity: "high"})
+	if !result.Issued {
+		t.Fatal("expected ban to be issued")
+	}
+	if result.Entry.Scope != "host:a.example.com" {
+		t.Errorf("expected host scope, got %q", result.Entry.Scope)
+	}
+	if _, found := banStore.Bans[result.Entry.ID()]; !found {
+		t.Error("scoped ban should be stored under its ID")
+	}
+	if _, found := banStore.Bans["test-fingerprint"]; found {
+		t.Error("scoped ban should not be stored under the fingerprint")
+	}
+
+	if !service.CheckBan("test-fingerprint").IsBanned {
+		t.Error("ban should apply on the same host")
+	}
+
+	service.SetScopes(NewRequestScopes("b.example.com", "/api"))
+	if service.CheckBan("test-fingerprint").IsBanned {
+		t.Error("ban should not apply on another host")
+	}
+}
+
+func TestBanService_CheckBan_GlobalBanWithScopes(t *testing.T) {
+	config := DefaultConfig()
+	config.BanScopeBySeverity = map[string]string{"low": BanScopePath}
+	banStore := NewMockBanStore()
+	banStore.Bans["test-fingerprint"] = NewBanEntry("test-fingerprint", "reason", "rule-1", "critical", 600)
+
+	service := NewBanService(config, NewMockLogger(), banStore, NewMockScoreStore(), nil)
+	service.SetScopes(NewRequestScopes("a.example.com", "/api"))
+
+	if ids := service.BanIDs("test-fingerprint"); len(ids) != 3 {
+		t.Errorf("expected global, host and path IDs, got %v", ids)
+	}
+	if !service.CheckBan("test-fingerprint").IsBanned {
+		t.Error("global ban should apply on every host")
+	}
+}
+
+func TestBanService_BanIDs_GlobalOnly(t *testing.T) {
+	service := NewBanService(DefaultConfig(), NewMockLogger(), NewMockBanStore(), NewMockScoreStore(), nil)
+	service.SetScopes(NewRequestScopes("a.example.com", "/api"))
+
+	ids := service.BanIDs("test-fingerprint")
+	if len(ids) != 1 || ids[0] != "test-fingerprint" {
+		t.Errorf("expected only the global ID without scoped bans, got %v", ids)
+	}
+}
+
+func TestBanService_ScoreSignal(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoringEnabled = true
+	config.ScoreThreshold = 100
+	config.Signals.AuthFailure = SignalConfig{Threshold: 10, WindowSeconds: 60, Score: 60, Severity: "high"}
+	banStore := NewMockBanStore()
+	eventHandler := NewMockEventHandler()
+
+	service := NewBanService(config, NewMockLogger(), banStore, NewMockScoreStore(), nil)
+	service.SetEventHandler(eventHandler)
+
+	result := service.ScoreSignal("test-fingerprint", SignalAuthFailure)
+	if result.Issued || result.Score != 60 {
+		t.Fatalf("expected score 60 without ban, got issued=%v score=%d", result.Issued, result.Score)
+	}
+	if eventHandler.Events[0].RuleID != "signal:auth_failure" {
+		t.Errorf("expected signal rule ID, got %s", eventHandler.Events[0].RuleID)
+	}
+
+	result = service.ScoreSignal("test-fingerprint", SignalAuthFailure)
+	if !result.Issued {
+		t.Fatal("expected ban once the threshold is exceeded")
+	}
+	if result.Entry.Severity != "high" || result.Entry.RuleID != "signal:auth_failure" {
+		t.Errorf("unexpected ban entry: %+v", result.Entry)
+	}
+}
+
+func TestBanService_ScoreSignal_ScoringDisabled(t *testing.T) {
+	config := DefaultConfig()
+	config.Signals.NotFound = SignalConfig{Threshold: 10, WindowSeconds: 60, Score: 60, Severity: "medium"}
+	scoreStore := NewMockScoreStore()
+
+	service := NewBanService(config, NewMockLogger(), NewMockBanStore(), scoreStore, nil)
+
+	if result := service.ScoreSignal("test-fingerprint", SignalNotFound); result.Issued || result.Score != 0 {
+		t.Errorf("signals should not score without scoring, got %+v", result)
+	}
+}
+
+func TestBanService_IssueBan_RedisSyncDecaysServerSide(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoringEnabled = true
+	config.ScoreThreshold = 100
+	scoreStore := NewMockScoreStore()
+	scoreStore.Decay = config.ScoreDecay()
+	redisClient := NewMockRedisClient(true)
+
+	entry := NewScoreEntry("test-fingerprint")
+	entry.Score = 50
+	entry.LastUpdated = time.Now().Unix() - 120
+	scoreStore.Scores[entry.Fingerprint] = entry
+
+	service := NewBanService(config, NewMockLogger(), NewMockBanStore(), scoreStore, redisClient)
+
+	// 2 points of decay, then +20 for a medium rule
+	result := service.IssueBan("test-fingerprint", &CorazaMetadata{Action: "block", RuleID: "rule-789", Severity: "medium"})
+	if result.Score != 68 {
+		t.Errorf("expected local score 68, got %d", result.Score)
+	}
+	// Redis decays its own score, so only the increment is synced
+	if got := redisClient.ClusterScores["test-fingerprint"]; got != 20 {
+		t.Errorf("expected Redis score increment of 20, got %d", got)
+	}
+	if len(redisClient.Scores) != 0 {
+		t.Errorf("expected no undecayed score sync, got %v", redisClient.Scores)
+	}
+}
+
+func TestBanService_IssueBan_RedisScoreSource(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoringEnabled = true
+	config.ScoreThreshold = 50
+	config.ScoreSource = ScoreSourceRedis
+	redisClient := NewMockRedisClient(true)
+	redisClient.ClusterScores = map[string]int{"test-fingerprint": 40}
+	events := NewMockEventHandler()
+
+	service := NewBanService(config, NewMockLogger(), NewMockBanStore(), NewMockScoreStore(), redisClient)
+	service.SetEventHandler(events)
+	var decided *BanIssueResult
+	service.SetClusterScoreHandler(func(result *BanIssueResult) { decided = result })
+
+	// The local score (20) is below the threshold, the cluster score is not
+	result := service.IssueBan("test-fingerprint", &CorazaMetadata{Action: "block", RuleID: "rule-789", Severity: "medium"})
+	if !result.Pending {
+		t.Error("expected pending result")
+	}
+	if decided == nil || !decided.Issued || decided.Score != 60 {
+		t.Fatalf("expected ban on cluster score 60, got %+v", decided)
+	}
+	if events.Events[0].Source != "redis" {
+		t.Errorf("expected redis score source, got %s", events.Events[0].Source)
+	}
+	if len(redisClient.Scores) != 0 {
+		t.Error("local score changes should not be synced in redis mode")
+	}
+}
+
+func TestBanService_IssueBan_RedisScoreSourceFallback(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoringEnabled = true
+	config.ScoreThreshold = 50
+	config.ScoreSource = ScoreSourceRedis
+	redisClient := NewMockRedisClient(true)
+	redisClient.Fail = true
+
+	service := NewBanService(config, NewMockLogger(), NewMockBanStore(), NewMockScoreStore(), redisClient)
+	var decided *BanIssueResult
+	service.SetClusterScoreHandler(func(result *BanIssueResult) { decided = result })
+
+	service.IssueBan("test-fingerprint", &CorazaMetadata{Action: "block", RuleID: "rule-789", Severity: "medium"})
+	if decided == nil || decided.Issued || decided.Score != 20 {
+		t.Errorf("expected decision on local score 20, got %+v", decided)
+	}
+}
+
+func TestBanService_IssueBan_TagFilters(t *testing.T) {
+	config := DefaultConfig()
+	config.TagsExclude = []string{"attack-protocol"}
+	banStore := NewMockBanStore()
+
+	service := NewBanService(config, NewMockLogger(), banStore, NewMockScoreStore(), NewMockRedisClient(false))
+
+	result := service.IssueBan("test-fingerprint", &CorazaMetadata{
+		Action: "block", RuleID: "920100", Severity: "critical", Tags: []string{"OWASP_CRS", "attack-protocol"},
+	})
+	if result.Issued || banStore.SetCalls != 0 {
+		t.Error("blocks of excluded tags should not ban")
+	}
+}
+
+func TestBanService_IssueBan_TagsIncludeUntagged(t *testing.T) {
+	config := DefaultConfig()
+	config.TagsInclude = []string{"attack-sqli"}
+
+	service := NewBanService(config, NewMockLogger(), NewMockBanStore(), NewMockScoreStore(), NewMockRedisClient(false))
+
+	result := service.IssueBan("fp-1", &CorazaMetadata{
+		Action: "block", RuleID: "941100", Severity: "critical", Tags: []string{"attack-xss"},
+	})
+	if result.Issued {
+		t.Error("blocks of rules without an included tag should not ban")
+	}
+
+	// A block detected from the response status has no tags to filter
+	result = service.IssueBan("fp-2", config.WAFDetection.MarkBlocked(nil))
+	if !result.Issued || result.Entry.RuleID != DefaultWAFRuleID {
+		t.Errorf("expected untagged detected block to ban, got %+v", result)
+	}
+}
+
+func TestBanService_IssueBan_TagTTL(t *testing.T) {
+	config := DefaultConfig()
+	config.BanTTLByTag = map[string]int{"attack-rce": 86400}
+
+	service := NewBanService(config, NewMockLogger(), NewMockBanStore(), NewMockScoreStore(), NewMockRedisClient(false))
+
+	result := service.IssueBan("test-fingerprint", &CorazaMetadata{
+		Action: "block", RuleID: "932100", Severity: "low", Tags: []string{"attack-rce"},
+	})
+	if !result.Issued || result.Entry.TTL != 86400 {
+		t.Fatalf("expected tag TTL 86400, got %+v", result.Entry)
+	}
+	if len(result.Entry.Tags) != 1 || result.Entry.Tags[0] != "attack-rce" {
+		t.Errorf("expected ban to record rule tags, got %v", result.Entry.Tags)
+	}
+}
+
+func TestBanService_IssueBan_ScoreAggregation(t *testing.T) {
+	metadata := &CorazaMetadata{Action: "block", RuleID: "949110", Rules: []MatchedRule{
+		{RuleID: "942100", Severity: "critical", Tags: []string{"attack-sqli"}},
+		{RuleID: "942110", Severity: "high", Tags: []string{"attack-sqli"}},
+		{RuleID: "941100", Severity: "medium", Tags: []string{"attack-xss"}},
+		{RuleID: "949110", Severity: "critical"},
+	}}
+
+	tests := []struct {
+		aggregation string
+		expected    int
+	}{
+		{ScoreAggregationMax, 50},      // critical
+		{ScoreAggregationSum, 110},     // 50 + 40 + 20
+		{ScoreAggregationDistinct, 70}, // sqli 50 + xss 20
+	}
+
+	for _, tt := range tests {
+		config := DefaultConfig()
+		config.ScoringEnabled = true
+		config.ScoreThreshold = 1000
+		config.ScoreAggregation = tt.aggregation
+		scoreStore := NewMockScoreStore()
+
+		service := NewBanService(config, NewMockLogger(), NewMockBanStore(), scoreStore, NewMockRedisClient(false))
+
+		result := service.IssueBan("test-fingerprint", metadata)
+		if result.Score != tt.expected {
+			t.Errorf("%s: expected score %d, got %d", tt.aggregation, tt.expected, result.Score)
+		}
+		if hits := scoreStore.Scores["test-fingerprint"].RuleHits; len(hits) != 3 {
+			t.Errorf("%s: expected a hit per counted rule, got %+v", tt.aggregation, hits)
+		}
+	}
+}
+
+func TestBanService_IssueBan_ReportsMatchedRules(t *testing.T) {
+	config := DefaultConfig()
+	service := NewBanService(config, NewMockLogger(), NewMockBanStore(), NewMockScoreStore(), NewMockRedisClient(false))
+
+	result := service.IssueBan("test-fingerprint", &CorazaMetadata{Action: "block", RuleID: "949110", Rules: []MatchedRule{
+		{RuleID: "920350", Severity: "medium"},
+		{RuleID: "942100", Severity: "critical"},
+		{RuleID: "949110", Severity: "critical"},
+	}})
+	if !result.Issued {
+		t.Fatal("expected ban to be issued")
+	}
+	if result.Entry.RuleID != "942100" || result.Entry.Severity != "critical" {
+		t.Errorf("expected the highest scoring rule, got %s/%s", result.Entry.RuleID, result.Entry.Severity)
+	}
+	if len(result.Entry.Rules) != 2 {
+		t.Errorf("expected both matched rules, got %v", result.Entry.Rules)
+	}
+}
+
+func TestBanService_ScoreDetection_AnomalyMode(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoringEnabled = true
+	config.ScoreThreshold = 30
+	config.ScoreMode = ScoreModeAnomaly
+	config.AnomalyScoring.Multiplier = 2
+	config.ScoreActions = nil // every action scores in anomaly mode
+	config.validate()
+
+	service := NewBanService(config, NewMockLogger(), NewMockBanStore(), NewMockScoreStore(), NewMockRedisClient(false))
+
+	// Sub-threshold probing: logged only, anomaly score 3 each time
+	metadata := &CorazaMetadata{Action: "log", RuleID: "920350", Severity: "warning", InboundAnomalyScore: 3}
+	var result *BanIssueResult
+	for i := 0; i < 5; i++ {
+		result = service.ScoreDetection("test-fingerprint", metadata)
+	}
+	if !result.Issued || result.Score != 30 {
+		t.Errorf("expected ban at score 30, got %+v", result)
+	}
+}
+
+func TestBanService_ScoreDetection_RulesMode(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoringEnabled = true
+	scoreStore := NewMockScoreStore()
+
+	service := NewBanService(config, NewMockLogger(), NewMockBanStore(), scoreStore, NewMockRedisClient(false))
+
+	service.ScoreDetection("test-fingerprint", &CorazaMetadata{Action: "log", InboundAnomalyScore: 5})
+	if scoreStore.IncrCalls != 0 {
+		t.Error("detections should not be scored in rules mode")
+	}
+}
+
+func TestBanService_IssueBan_AnomalyMode(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoringEnabled = true
+	config.ScoreMode = ScoreModeAnomaly
+
+	service := NewBanService(config, NewMockLogger(), NewMockBanStore(), NewMockScoreStore(), NewMockRedisClient(false))
+
+	result := service.IssueBan("test-fingerprint", &CorazaMetadata{
+		Action: "block", RuleID: "949110", Severity: "critical", InboundAnomalyScore: 15, OutboundAnomalyScore: 4,
+	})
+	if result.Score != 19 {
+		t.Errorf("expected the anomaly score as increment, got %d", result.Score)
+	}
+
+	// Without anomaly score, the rule scores apply
+	result = service.IssueBan("other-fingerprint", &CorazaMetadata{Action: "block", RuleID: "942100", Severity: "critical"})
+	if result.Score != 50 {
+		t.Errorf("expected the rule score as increment, got %d", result.Score)
+	}
+}
+
+func TestBanService_ScoreDetection_ScoreActions(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoringEnabled = true
+	config.ScoreActions = map[string]float64{"block": 1, "log": 0.5}
+	scoreStore := NewMockScoreStore()
+
+	service := NewBanService(config, NewMockLogger(), NewMockBanStore(), scoreStore, NewMockRedisClient(false))
+
+	// A detection-only rule adds half its score
+	result := service.ScoreDetection("test-fingerprint", &CorazaMetadata{Action: "log", RuleID: "942100", Severity: "high"})
+	if result.Score != 20 {
+		t.Errorf("expected score 20, got %d", result.Score)
+	}
+
+	// Actions not listed do not add to the score
+	service.ScoreDetection("test-fingerprint", &CorazaMetadata{Action: "pass", RuleID: "942100", Severity: "high"})
+	service.IssueBan("test-fingerprint", &CorazaMetadata{Action: "deny", RuleID: "942100", Severity: "high"})
+	if scoreStore.IncrCalls != 1 {
+		t.Errorf("expected only the logged detection to be scored, got %d updates", scoreStore.IncrCalls)
+	}
+
+	// Metadata without a detection is not scored
+	service.ScoreDetection("test-fingerprint", &CorazaMetadata{Action: "log"})
+	if scoreStore.IncrCalls != 1 {
+		t.Error("expected metadata without rule or anomaly score to be ignored")
+	}
+}
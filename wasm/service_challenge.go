@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// challengeNonceTTL is how long a served challenge can be solved.
+const challengeNonceTTL = 5 * time.Minute
+
+// ChallengeStatus is the outcome of checking a request's challenge cookie.
+type ChallengeStatus int
+
+const (
+	// ChallengeRequired means the client must be served a challenge.
+	ChallengeRequired ChallengeStatus = iota
+	// ChallengeSolved means the request carries a valid proof-of-work solution.
+	ChallengeSolved
+	// ChallengePassed means the request carries a valid pass from an earlier solution.
+	ChallengePassed
+)
+
+// =============================================================================
+// Challenge Service
+// =============================================================================
+
+// ChallengeService serves proof-of-work challenges to clients with low
+// severity bans instead of denying them outright, so that legitimate users
+// sharing a fingerprint (e.g., behind a NAT) can prove they are browsers.
+//
+// The challenge page computes a SHA-256 proof of work over a signed nonce
+// and returns the solution in a cookie on the follow-up request:
+//
+//	nonce:    "<expiry>.<signature>"
+//	solution: "<expiry>.<signature>.<counter>"
+//	pass:     "<expiry>.<signature>"
+//
+// Signatures are HMAC-SHA256 over the fingerprint and the ban's creation
+// time, so tokens cannot be moved to another client and a new ban always
+// requires a new challenge. Signatures are verified statelessly; the nonce
+// store only records redeemed nonces, so that a solution is accepted once.
+type ChallengeService struct {
+	config     *ChallengeConfig
+	nonces     NonceStore
+	secret     []byte
+	severities map[string]bool
+	now        func() time.Time
+}
+
+// NewChallengeService creates a challenge service from the configuration.
+func NewChallengeService(config *ChallengeConfig, nonces NonceStore) *ChallengeService {
+	severities := make(map[string]bool, len(config.Severities))
+	for _, severity := range config.Severities {
+		severities[strings.ToLower(severity)] = true
+	}
+
+	return &ChallengeService{
+		config:     config,
+		nonces:     nonces,
+		secret:     []byte(config.Secret),
+		severities: severities,
+		now:        time.Now,
+	}
+}
+
+// Applies returns true if the ban is challenged rather than denied.
+func (s *ChallengeService) Applies(entry *BanEntry) bool {
+	return entry != nil && s.severities[strings.ToLower(entry.Severity)]
+}
+
+// Nonce returns a new signed challenge nonce for the client's ban.
+func (s *ChallengeService) Nonce(fingerprint string, entry *BanEntry) string {
+	expiry := strconv.FormatInt(s.now().Add(challengeNonceTTL).Unix(), 10)
+	return expiry + "." + s.sign("challenge", fingerprint, entry, expiry)
+}
+
+// Check verifies the challenge cookie of a request for the client's ban.
+// A solution is accepted once: its nonce is recorded as used until it
+// expires, and a nonce that cannot be recorded is rejected.
+func (s *ChallengeService) Check(fingerprint string, entry *BanEntry, cookie string) ChallengeStatus {
+	parts := strings.Split(cookie, ".")
+	switch len(parts) {
+	case 2:
+		if s.verify("pass", fingerprint, entry, parts[0], parts[1]) {
+			return ChallengePassed
+		}
+	case 3:
+		if s.verify("challenge", fingerprint, entry, parts[0], parts[1]) &&
+			leadingZeroBits(sha256.Sum256([]byte(cookie))) >= s.config.Difficulty &&
+			s.redeem(fingerprint, parts[0], parts[1]) {
+			return ChallengeSolved
+		}
+	}
+	return ChallengeRequired
+}
+
+// redeem records a verified nonce as used. Returns false if it was
+// already used or could not be recorded.
+func (s *ChallengeService) redeem(fingerprint, expiry, signature string) bool {
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return false
+	}
+	fresh, err := s.nonces.UseNonce(fingerprint, expiry+"."+signature, expiresAt)
+	return err == nil && fresh
+}
+
+// PassCookie returns the Set-Cookie value that lets a client which solved
+// the challenge through for the pass TTL while its ban stays in place. The
+// cookie is Secure: challenges are only served over HTTPS.
+func (s *ChallengeService) PassCookie(fingerprint string, entry *BanEntry) string {
+	expiry := strconv.FormatInt(s.now().Unix()+int64(s.config.PassTTLSeconds), 10)
+	return s.config.CookieName + "=" + expiry + "." + s.sign("pass", fingerprint, entry, expiry) +
+		"; Path=/; Max-Age=" + strconv.Itoa(s.config.PassTTLSeconds) + "; Secure; HttpOnly; SameSite=Lax"
+}
+
+// Page renders the challenge page for a nonce.
+func (s *ChallengeService) Page(nonce string) []byte {
+	return []byte(strings.NewReplacer(
+		"{{nonce}}", nonce,
+		"{{difficulty}}", strconv.Itoa(s.config.Difficulty),
+		"{{cookie}}", s.config.CookieName,
+		"{{max_age}}", strconv.Itoa(int(challengeNonceTTL.Seconds())),
+	).Replace(challengePage))
+}
+
+// verify checks the expiry and signature of a token.
+func (s *ChallengeService) verify(kind, fingerprint string, entry *BanEntry, expiry, signature string) bool {
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || s.now().Unix() > expiresAt {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(s.sign(kind, fingerprint, entry, expiry)))
+}
+
+// sign computes the hex HMAC-SHA256 of a token, truncated to 128 bits to
+// keep cookies short.
+func (s *ChallengeService) sign(kind, fingerprint string, entry *BanEntry, expiry string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(kind + "|" + fingerprint + "|" + strconv.FormatInt(entry.CreatedAt, 10) + "|" + expiry))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// leadingZeroBits counts the leading zero bits of a hash.
+func leadingZeroBits(hash [32]byte) int {
+	count := 0
+	for _, b := range hash {
+		if b != 0 {
+			return count + bits.LeadingZeros8(b)
+		}
+		count += 8
+	}
+	return count
+}
+
+// challengePage searches for a counter such that SHA-256 of
+// "<nonce>.<counter>" has the required number of leading zero bits,
+// stores the solution in the challenge cookie and reloads the page.
+// crypto.subtle is only available in secure contexts, so the page only
+// works over HTTPS (or on localhost).
+const challengePage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Checking your browser</title>
+</head>
+<body>
+<p>Checking your browser before accessing this site&hellip;</p>
+<noscript><p>Please enable JavaScript and reload the page.</p></noscript>
+<script>
+(async function () {
+  var nonce = "{{nonce}}", difficulty = {{difficulty}}, encoder = new TextEncoder();
+  function zeroBits(hash) {
+    var count = 0;
+    for (var i = 0; i < hash.length; i++) {
+      if (hash[i] !== 0) { return count + Math.clz32(hash[i]) - 24; }
+      count += 8;
+    }
+    return count;
+  }
+  for (var counter = 0; ; counter++) {
+    var solution = nonce + "." + counter;
+    var hash = new Uint8Array(await crypto.subtle.digest("SHA-256", encoder.encode(solution)));
+    if (zeroBits(hash) >= difficulty) {
+      document.cookie = "{{cookie}}=" + solution + "; path=/; max-age={{max_age}}; Secure; SameSite=Lax";
+      location.reload();
+      return;
+    }
+  }
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestChallengeService() *ChallengeService {
+	config := &ChallengeConfig{Enabled: true, Secret: "s3cr3t"}
+	config.setDefaults()
+	config.Difficulty = 8
+	return NewChallengeService(config, NewMockNonceStore())
+}
+
+// solveChallenge brute-forces the proof of work like the challenge page does.
+func solveChallenge(nonce string, difficulty int) string {
+	for counter := 0; ; counter++ {
+		solution := nonce + "." + strconv.Itoa(counter)
+		if leadingZeroBits(sha256.Sum256([]byte(solution))) >= difficulty {
+			return solution
+		}
+	}
+}
+
+func TestChallengeService_Applies(t *testing.T) {
+	service := newTestChallengeService()
+
+	tests := []struct {
+		severity string
+		expected bool
+	}{
+		{"low", true},
+		{"Medium", true},
+		{"high", false},
+		{"critical", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		entry := NewBanEntry("fp", "waf-rule", "930120", tt.severity, 600)
+		if got := service.Applies(entry); got != tt.expected {
+			t.Errorf("Applies(%q) = %v, want %v", tt.severity, got, tt.expected)
+		}
+	}
+	if service.Applies(nil) {
+		t.Error("fail-closed denials without an entry should not be challenged")
+	}
+}
+
+func TestChallengeService_Check_Solved(t *testing.T) {
+	service := newTestChallengeService()
+	entry := NewBanEntry("fp", "waf-rule", "930120", "medium", 600)
+
+	solution := solveChallenge(service.Nonce("fp", entry), 8)
+
+	if got := service.Check("fp", entry, solution); got != ChallengeSolved {
+		t.Errorf("expected solved, got %d", got)
+	}
+}
+
+func TestChallengeService_Check_Replayed(t *testing.T) {
+	service := newTestChallengeService()
+	entry := NewBanEntry("fp", "waf-rule", "930120", "medium", 600)
+	solution := solveChallenge(service.Nonce("fp", entry), 8)
+
+	if got := service.Check("fp", entry, solution); got != ChallengeSolved {
+		t.Fatalf("expected solved, got %d", got)
+	}
+	if got := service.Check("fp", entry, solution); got != ChallengeRequired {
+		t.Errorf("expected replayed solution to be rejected, got %d", got)
+	}
+}
+
+func TestChallengeService_Check_NonceStoreError(t *testing.T) {
+	config := &ChallengeConfig{Enabled: true, Secret: "s3cr3t", Difficulty: 8}
+	config.setDefaults()
+	nonces := NewMockNonceStore()
+	nonces.Err = errors.New("shared data unavailable")
+	service := NewChallengeService(config, nonces)
+	entry := NewBanEntry("fp", "waf-rule", "930120", "medium", 600)
+
+	solution := solveChallenge(service.Nonce("fp", entry), 8)
+	if got := service.Check("fp", entry, solution); got != ChallengeRequired {
+		t.Errorf("expected solution to be rejected when nonces cannot be recorded, got %d", got)
+	}
+}
+
+func TestChallengeService_Check_Rejected(t *testing.T) {
+	service := newTestChallengeService()
+	entry := NewBanEntry("fp", "waf-rule", "930120", "medium", 600)
+	solution := solveChallenge(service.Nonce("fp", entry), 8)
+
+	// A new ban for the same client requires a new challenge
+	reissued := *entry
+	reissued.CreatedAt += 60
+
+	// A solution whose hash does not meet the difficulty
+	weak := ""
+	for counter := 0; weak == ""; counter++ {
+		candidate := service.Nonce("fp", entry) + "." + strconv.Itoa(counter)
+		if leadingZeroBits(sha256.Sum256([]byte(candidate))) < 8 {
+			weak = candidate
+		}
+	}
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		entry       *BanEntry
+		cookie      string
+	}{
+		{"empty", "fp", entry, ""},
+		{"other client", "other-fp", entry, solution},
+		{"new ban", "fp", &reissued, solution},
+		{"insufficient work", "fp", entry, weak},
+		{"garbage", "fp", entry, "a.b.c"},
+	}
+
+	for _, tt := range tests {
+		if got := service.Check(tt.fingerprint, tt.entry, tt.cookie); got != ChallengeRequired {
+			t.Errorf("%s: expected challenge required, got %d", tt.name, got)
+		}
+	}
+}
+
+func TestChallengeService_Check_ExpiredNonce(t *testing.T) {
+	service := newTestChallengeService()
+	entry := NewBanEntry("fp", "waf-rule", "930120", "low", 600)
+	solution := solveChallenge(service.Nonce("fp", entry), 8)
+
+	service.now = func() time.Time { return time.Now().Add(challengeNonceTTL + time.Minute) }
+
+	if got := service.Check("fp", entry, solution); got != ChallengeRequired {
+		t.Errorf("expected expired solution to be rejected, got %d", got)
+	}
+}
+
+func TestChallengeService_PassCookie(t *testing.T) {
+	service := newTestChallengeService()
+	entry := NewBanEntry("fp", "waf-rule", "930120", "low", 600)
+
+	header := service.PassCookie("fp", entry)
+	if !strings.HasPrefix(header, DefaultChallengeName+"=") || !strings.Contains(header, "HttpOnly") ||
+		!strings.Contains(header, "Secure") {
+		t.Fatalf("unexpected pass cookie: %s", header)
+	}
+
+	value := parseCookie(strings.SplitN(header, ";", 2)[0], DefaultChallengeName)
+	if got := service.Check("fp", entry, value); got != ChallengePassed {
+		t.Errorf("expected pass to be accepted, got %d", got)
+	}
+	if got := service.Check("other-fp", entry, value); got != ChallengeRequired {
+		t.Errorf("pass should be bound to the fingerprint, got %d", got)
+	}
+
+	service.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if got := service.Check("fp", entry, value); got != ChallengeRequired {
+		t.Errorf("expected expired pass to be rejected, got %d", got)
+	}
+}
+
+func TestChallengeService_Page(t *testing.T) {
+	service := newTestChallengeService()
+	page := string(service.Page("123.abc"))
+
+	for _, expected := range []string{`nonce = "123.abc"`, "difficulty = 8", DefaultChallengeName + "="} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("page should contain %q", expected)
+		}
+	}
+	if strings.Contains(page, "{{") {
+		t.Error("page has unreplaced placeholders")
+	}
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	var hash [32]byte
+	if got := leadingZeroBits(hash); got != 256 {
+		t.Errorf("expected 256 for zero hash, got %d", got)
+	}
+
+	hash[1] = 0x10
+	if got := leadingZeroBits(hash); got != 11 {
+		t.Errorf("expected 11, got %d", got)
+	}
+}
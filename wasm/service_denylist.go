@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// =============================================================================
+// Denylist Service
+// =============================================================================
+
+// DenylistRule describes why a client matched the static denylist.
+type DenylistRule struct {
+	// Match is the CIDR or ASN that matched (e.g., "203.0.113.0/24", "AS64496")
+	Match string
+	// Reason is the operator-provided reason for the entry
+	Reason string
+}
+
+// DenylistService matches clients against statically configured networks.
+// CIDRs are compiled once at plugin start into a prefix trie and the
+// service is shared by all requests.
+type DenylistService struct {
+	trie    *prefixTrie
+	asns    map[uint32]*DenylistRule
+	trusted []netip.Prefix
+}
+
+// NewDenylistService compiles the denylist configuration.
+// Returns an error if a CIDR is invalid.
+func NewDenylistService(config *DenylistConfig) (*DenylistService, error) {
+	trie := newPrefixTrie()
+	for _, entry := range config.CIDRs {
+		prefixes, err := parsePrefixes([]string{entry.CIDR})
+		if err != nil {
+			return nil, err
+		}
+		trie.Insert(prefixes[0], &DenylistRule{
+			Match:  prefixes[0].String(),
+			Reason: entry.Reason,
+		})
+	}
+
+	asns := make(map[uint32]*DenylistRule, len(config.ASNs))
+	for _, entry := range config.ASNs {
+		asns[entry.ASN] = &DenylistRule{
+			Match:  "AS" + strconv.FormatUint(uint64(entry.ASN), 10),
+			Reason: entry.Reason,
+		}
+	}
+
+	trusted, err := parsePrefixes(config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DenylistService{
+		trie:    trie,
+		asns:    asns,
+		trusted: trusted,
+	}, nil
+}
+
+// ClientAddress returns the address a client is matched by. It is the
+// connection address, unless the connection comes from a trusted proxy:
+// then it is the rightmost X-Forwarded-For entry that is not a trusted
+// proxy, since entries left of it may be set by the client.
+func (s *DenylistService) ClientAddress(sourceIP, forwardedFor string) string {
+	if !s.isTrusted(sourceIP) || forwardedFor == "" {
+		return sourceIP
+	}
+
+	hops := strings.Split(forwardedFor, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if !s.isTrusted(hop) {
+			return hop
+		}
+	}
+	return sourceIP
+}
+
+// isTrusted returns true if the address belongs to a trusted proxy.
+func (s *DenylistService) isTrusted(ip string) bool {
+	addr, ok := parseClientAddr(ip)
+	if !ok {
+		return false
+	}
+	for _, prefix := range s.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsEmpty returns true if no denylist entries are configured.
+func (s *DenylistService) IsEmpty() bool {
+	return s.trie.Len() == 0 && len(s.asns) == 0
+}
+
+// Match returns the denylist rule matching the client, or nil.
+// The asn argument accepts both "64496" and "AS64496" forms.
+func (s *DenylistService) Match(clientIP, asn string) *DenylistRule {
+	if clientIP != "" && s.trie.Len() > 0 {
+		if addr, ok := parseClientAddr(clientIP); ok {
+			if rule := s.trie.Lookup(addr); rule != nil {
+				return rule
+			}
+		}
+	}
+
+	if asn != "" && len(s.asns) > 0 {
+		asn = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(asn)), "AS")
+		if number, err := strconv.ParseUint(asn, 10, 32); err == nil {
+			if rule, ok := s.asns[uint32(number)]; ok {
+				return rule
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNewDenylistService_InvalidCIDR(t *testing.T) {
+	_, err := NewDenylistService(&DenylistConfig{
+		CIDRs: []DenylistCIDR{{CIDR: "not-a-cidr"}},
+	})
+	if err == nil {
+		t.Error("expected error for invalid CIDR")
+	}
+}
+
+func TestDenylistService_Match(t *testing.T) {
+	service, err := NewDenylistService(&DenylistConfig{
+		CIDRs: []DenylistCIDR{
+			{CIDR: "203.0.113.0/24", Reason: "botnet"},
+			{CIDR: "2001:db8:bad::/48", Reason: "scanner"},
+		},
+		ASNs:      []DenylistASN{{ASN: 64496, Reason: "bulletproof hosting"}},
+		ASNHeader: "x-client-asn",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		clientIP string
+		asn      string
+		expected string
+	}{
+		{"ipv4 range", "203.0.113.50", "", "203.0.113.0/24"},
+		{"ipv6 range", "2001:db8:bad::1", "", "2001:db8:bad::/48"},
+		{"asn number", "198.51.100.1", "64496", "AS64496"},
+		{"asn prefixed", "", "AS64496", "AS64496"},
+		{"asn lowercase", "", "as64496", "AS64496"},
+		{"no match", "198.51.100.1", "64497", ""},
+		{"invalid input", "garbage", "not-an-asn", ""},
+	}
+
+	for _, tt := range tests {
+		rule := service.Match(tt.clientIP, tt.asn)
+		got := ""
+		if rule != nil {
+			got = rule.Match
+		}
+		if got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestDenylistService_ClientAddress(t *testing.T) {
+	service, err := NewDenylistService(&DenylistConfig{
+		CIDRs:          []DenylistCIDR{{CIDR: "203.0.113.0/24", Reason: "botnet"}},
+		TrustedProxies: []string{"10.0.0.0/8"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		sourceIP     string
+		forwardedFor string
+		expected     string
+	}{
+		{"no header", "203.0.113.50", "", "203.0.113.50"},
+		{"spoofed header", "203.0.113.50", "1.1.1.1", "203.0.113.50"},
+		{"trusted proxy", "10.0.0.1", "203.0.113.50", "203.0.113.50"},
+		{"spoofed behind proxy", "10.0.0.1", "1.1.1.1, 203.0.113.50", "203.0.113.50"},
+		{"proxy chain", "10.0.0.1", "203.0.113.50, 10.0.0.2", "203.0.113.50"},
+		{"only proxies", "10.0.0.1", "10.0.0.2", "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		got := service.ClientAddress(tt.sourceIP, tt.forwardedFor)
+		if got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, got)
+		}
+		if service.Match(got, "") == nil && tt.expected == "203.0.113.50" {
+			t.Errorf("%s: expected denylisted client to be denied", tt.name)
+		}
+	}
+}
+
+func TestDenylistService_IsEmpty(t *testing.T) {
+	service, _ := NewDenylistService(&DenylistConfig{})
+	if !service.IsEmpty() {
+		t.Error("empty config should produce empty denylist")
+	}
+}
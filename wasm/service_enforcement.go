@@ -0,0 +1,57 @@
+package main
+
+// =============================================================================
+// Enforcement Service
+// =============================================================================
+
+// EnforcementDecision describes how a request of a banned client is answered.
+type EnforcementDecision struct {
+	// Enforcement is the enforcement of the ban severity
+	*EnforcementConfig
+
+	// Allow is true if the request may proceed (log, rate limit not reached)
+	Allow bool
+}
+
+// EnforcementService decides how requests of banned clients are enforced,
+// based on the severity of their ban. Bans without an entry (denylist,
+// fail-closed) and severities without an enforcement are denied.
+type EnforcementService struct {
+	config    *PluginConfig
+	logger    Logger
+	rateStore RateStore
+}
+
+// NewEnforcementService creates a new enforcement service.
+func NewEnforcementService(config *PluginConfig, logger Logger, rateStore RateStore) *EnforcementService {
+	return &EnforcementService{
+		config:    config,
+		logger:    logger,
+		rateStore: rateStore,
+	}
+}
+
+// Decide returns the enforcement of a request of a banned client.
+func (s *EnforcementService) Decide(fingerprint string, entry *BanEntry) *EnforcementDecision {
+	severity := ""
+	if entry != nil {
+		severity = entry.Severity
+	}
+
+	decision := &EnforcementDecision{EnforcementConfig: s.config.GetEnforcement(severity)}
+
+	switch decision.Action {
+	case EnforcementLog:
+		decision.Allow = true
+	case EnforcementRateLimit:
+		count, err := s.rateStore.IncrRequests(fingerprint)
+		if err != nil {
+			s.logger.Error("failed to count requests for %s: %v", fingerprint, err)
+		}
+		decision.Allow = count <= decision.RequestsPerMinute
+		s.logger.Debug("rate-limited fingerprint %s: %d/%d requests this minute",
+			fingerprint, count, decision.RequestsPerMinute)
+	}
+
+	return decision
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEnforcementService_Decide_DefaultDeny(t *testing.T) {
+	config := DefaultConfig()
+	config.EnforcementBySeverity = map[string]EnforcementConfig{
+		"low": {Action: EnforcementLog},
+	}
+	config.validate()
+
+	service := NewEnforcementService(config, NewMockLogger(), NewMockRateStore())
+
+	tests := []struct {
+		name  string
+		entry *BanEntry
+	}{
+		{"unconfigured severity", NewBanEntry("fp", "waf-rule", "930120", "high", 600)},
+		{"no entry", nil},
+	}
+
+	for _, tt := range tests {
+		decision := service.Decide("fp", tt.entry)
+		if decision.Action != EnforcementDeny || decision.Allow {
+			t.Errorf("%s: expected deny, got %s (allow=%v)", tt.name, decision.Action, decision.Allow)
+		}
+		if decision.ResponseCode != 403 || decision.ResponseBody != "Forbidden" {
+			t.Errorf("%s: expected ban response, got %d %q", tt.name, decision.ResponseCode, decision.ResponseBody)
+		}
+	}
+}
+
+func TestEnforcementService_Decide_Actions(t *testing.T) {
+	config := DefaultConfig()
+	config.EnforcementBySeverity = map[string]EnforcementConfig{
+		"critical": {Action: EnforcementTarpit},
+		"high":     {ResponseCode: 429, ResponseBody: "Slow down"},
+		"Medium":   {Action: EnforcementRedirect, RedirectURL: "/blocked"},
+		"low":      {Action: EnforcementLog},
+	}
+	config.validate()
+
+	service := NewEnforcementService(config, NewMockLogger(), NewMockRateStore())
+
+	tests := []struct {
+		severity string
+		action   string
+		code     int
+		allow    bool
+	}{
+		{"critical", EnforcementTarpit, 403, false},
+		{"high", EnforcementDeny, 429, false},
+		{"medium", EnforcementRedirect, 302, false},
+		{"low", EnforcementLog, 403, true},
+	}
+
+	for _, tt := range tests {
+		decision := service.Decide("fp", NewBanEntry("fp", "waf-rule", "930120", tt.severity, 600))
+		if decision.Action != tt.action || decision.ResponseCode != tt.code || decision.Allow != tt.allow {
+			t.Errorf("%s: got %s/%d (allow=%v), want %s/%d (allow=%v)", tt.severity,
+				decision.Action, decision.ResponseCode, decision.Allow, tt.action, tt.code, tt.allow)
+		}
+	}
+
+	if decision := service.Decide("fp", NewBanEntry("fp", "waf-rule", "930120", "critical", 600)); decision.TarpitSeconds != DefaultTarpitSeconds {
+		t.Errorf("expected default tarpit of %ds, got %d", DefaultTarpitSeconds, decision.TarpitSeconds)
+	}
+}
+
+func TestEnforcementService_Decide_RateLimit(t *testing.T) {
+	config := DefaultConfig()
+	config.EnforcementBySeverity = map[string]EnforcementConfig{
+		"low": {Action: EnforcementRateLimit, RequestsPerMinute: 2},
+	}
+	config.validate()
+
+	rateStore := NewMockRateStore()
+	service := NewEnforcementService(config, NewMockLogger(), rateStore)
+	entry := NewBanEntry("fp", "waf-rule", "930120", "low", 600)
+
+	for i, expected := range []bool{true, true, false, false} {
+		if decision := service.Decide("fp", entry); decision.Allow != expected {
+			t.Errorf("request %d: allow=%v, want %v", i+1, decision.Allow, expected)
+		}
+	}
+	if rateStore.Counts["fp"] != 4 {
+		t.Errorf("expected 4 counted requests, got %d", rateStore.Counts["fp"])
+	}
+
+	// Other clients have their own budget
+	if decision := service.Decide("other-fp", entry); !decision.Allow {
+		t.Error("other client should be allowed")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"net/netip"
 	"strings"
 
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
@@ -35,6 +36,12 @@ func NewFingerprintService(config *PluginConfig, logger Logger) *FingerprintServ
 	}
 }
 
+// SetConfig replaces the configuration, e.g., with the effective
+// configuration of the policy matching the request.
+func (s *FingerprintService) SetConfig(config *PluginConfig) {
+	s.config = config
+}
+
 // Calculate computes a fingerprint for the current request.
 // Implements FingerprintCalculator interface.
 func (s *FingerprintService) Calculate() string {
@@ -220,6 +227,13 @@ func (s *FingerprintService) getClientIP() string {
 	}
 
 	// 5. Source address from connection properties
+	return s.SourceAddress()
+}
+
+// SourceAddress returns the IP of the downstream connection peer.
+// Unlike getClientIP it ignores forwarding headers, so it cannot be
+// spoofed by the client and is suitable for access control.
+func (s *FingerprintService) SourceAddress() string {
 	sourceAddrPaths := [][]string{
 		{"source", "address"},
 		{"connection", "source", "address"},
@@ -229,6 +243,9 @@ func (s *FingerprintService) getClientIP() string {
 	for _, path := range sourceAddrPaths {
 		if value, err := proxywasm.GetProperty(path); err == nil && len(value) > 0 {
 			addr := string(value)
+			if addrPort, err := netip.ParseAddrPort(addr); err == nil {
+				return addrPort.Addr().String()
+			}
 			if idx := strings.LastIndex(addr, ":"); idx > 0 {
 				if strings.Count(addr, ":") > 1 {
 					return addr // IPv6
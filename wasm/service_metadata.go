@@ -1,7 +1,10 @@
 package main
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
@@ -12,65 +15,267 @@ import (
 // =============================================================================
 
 // MetadataService implements MetadataExtractor interface.
-// It extracts Coraza WAF metadata from Envoy dynamic metadata or response headers.
+// It extracts Coraza WAF metadata from the configured metadata sources:
+// Envoy filter metadata and properties, or request/response headers.
 type MetadataService struct {
-	logger Logger
+	config  *PluginConfig
+	logger  Logger
+	sources []MetadataSourceConfig
 }
 
-// NewMetadataService creates a new metadata service.
-func NewMetadataService(logger Logger) *MetadataService {
+// NewMetadataService creates a new metadata service reading the metadata
+// sources of config.
+func NewMetadataService(config *PluginConfig, logger Logger) *MetadataService {
 	return &MetadataService{
-		logger: logger,
+		config:  config,
+		logger:  logger,
+		sources: config.GetMetadataSources(),
 	}
 }
 
 // Extract retrieves WAF metadata from the current request/response context.
+// Sources are tried in order; the first one carrying metadata wins.
 // Implements MetadataExtractor interface.
 func (s *MetadataService) Extract() *CorazaMetadata {
-	// Try multiple metadata paths where Coraza might store its decision
-	metadataPaths := [][]string{
-		{"metadata", "filter_metadata", "envoy.filters.http.wasm", "coraza"},
-		{"metadata", "filter_metadata", "coraza"},
-		{"metadata", "filter_metadata", "envoy.filters.http.coraza"},
+	for i := range s.sources {
+		if metadata := s.extractSource(&s.sources[i]); metadata != nil {
+			return metadata
+		}
 	}
+	return nil
+}
 
-	for _, path := range metadataPaths {
-		metadata := s.tryExtractMetadata(path)
-		if metadata != nil {
-			return metadata
+// extractSource reads the metadata of a single source.
+func (s *MetadataService) extractSource(source *MetadataSourceConfig) *CorazaMetadata {
+	switch source.Type {
+	case MetadataSourceFilterMetadata, MetadataSourceProperty:
+		path := source.Path
+		if source.Type == MetadataSourceFilterMetadata {
+			path = append([]string{"metadata", "filter_metadata"}, source.Path...)
+		}
+
+		value, err := proxywasm.GetProperty(path)
+		if err != nil {
+			s.logger.Debug("metadata not found at path %v: %v", path, err)
+			return nil
+		}
+		return decodeMetadata(value, source.Format, source.Fields)
+
+	case MetadataSourceRequestHeader, MetadataSourceResponseHeader:
+		var headers [][2]string
+		var err error
+		if source.Type == MetadataSourceRequestHeader {
+			headers, err = proxywasm.GetHttpRequestHeaders()
+		} else {
+			headers, err = proxywasm.GetHttpResponseHeaders()
 		}
+		if err != nil {
+			s.logger.Debug("failed to read %s headers: %v", source.Type, err)
+			return nil
+		}
+
+		if source.Header == "" {
+			return parseHeaderMetadata(headers, source.Fields)
+		}
+		return decodeHeaderMetadata(headers, source)
 	}
 
-	// Try reading from response headers as fallback
-	return s.extractFromHeaders()
+	return nil
 }
 
-// tryExtractMetadata attempts to extract metadata from a specific path.
-func (s *MetadataService) tryExtractMetadata(path []string) *CorazaMetadata {
-	value, err := proxywasm.GetProperty(path)
-	if err != nil {
-		s.logger.Debug("metadata not found at path %v: %v", path, err)
-		return nil
+// decodeHeaderMetadata decodes the metadata carried by the header of a
+// header source. Protobuf Struct values are base64-encoded.
+func decodeHeaderMetadata(headers [][2]string, source *MetadataSourceConfig) *CorazaMetadata {
+	for _, header := range headers {
+		if strings.ToLower(header[0]) != source.Header {
+			continue
+		}
+
+		value := []byte(header[1])
+		if source.Format == MetadataFormatStruct {
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header[1]))
+			if err != nil {
+				return nil
+			}
+			value = decoded
+		}
+		return decodeMetadata(value, source.Format, source.Fields)
 	}
+	return nil
+}
 
+// decodeMetadata decodes metadata in the given format, mapping its keys to
+// metadata fields. The "auto" format tries JSON, protobuf Struct and then
+// key=value pairs.
+func decodeMetadata(value []byte, format string, fields map[string]string) *CorazaMetadata {
 	if len(value) == 0 {
 		return nil
 	}
 
-	// Try to parse as JSON
-	var metadata CorazaMetadata
-	if err := json.Unmarshal(value, &metadata); err != nil {
-		// Try parsing as a simple string format
-		return s.parseStringMetadata(string(value))
+	switch format {
+	case MetadataFormatJSON:
+		var values map[string]any
+		if err := json.Unmarshal(value, &values); err != nil {
+			return nil
+		}
+		return metadataFromMap(values, fields)
+	case MetadataFormatStruct:
+		values, err := decodeStruct(value)
+		if err != nil {
+			return nil
+		}
+		return metadataFromMap(values, fields)
+	case MetadataFormatKV:
+		return parseKVMetadata(string(value), fields)
 	}
 
-	return &metadata
+	for _, format := range []string{MetadataFormatJSON, MetadataFormatStruct, MetadataFormatKV} {
+		if metadata := decodeMetadata(value, format, fields); metadata != nil {
+			return metadata
+		}
+	}
+	return nil
 }
 
-// parseStringMetadata parses metadata from a simple string format.
+// metadataFromMap builds metadata from decoded JSON or protobuf Struct
+// values. Fields are read from the keys they are mapped to, nested keys
+// being dot-separated; the items of the rules list are read with the
+// rule_id, severity, message and tags mappings.
+func metadataFromMap(values map[string]any, fields map[string]string) *CorazaMetadata {
+	get := func(values map[string]any, field string) any {
+		return lookupValue(values, fieldKey(fields, field))
+	}
+
+	metadata := &CorazaMetadata{
+		Action:               stringValue(get(values, "action")),
+		RuleID:               stringValue(get(values, "rule_id")),
+		Severity:             stringValue(get(values, "severity")),
+		Message:              stringValue(get(values, "message")),
+		MatchedData:          stringValue(get(values, "matched_data")),
+		Tags:                 listValue(get(values, "tags")),
+		InboundAnomalyScore:  intValue(get(values, "inbound_anomaly_score")),
+		OutboundAnomalyScore: intValue(get(values, "outbound_anomaly_score")),
+		ParanoiaLevel:        intValue(get(values, "paranoia_level")),
+	}
+
+	// Requests Coraza only logged may carry just the anomaly score
+	if metadata.Action == "" && metadata.AnomalyScore() == 0 {
+		return nil
+	}
+
+	items, _ := get(values, "rules").([]any)
+	var rules []MatchedRule
+	for _, item := range items {
+		rule, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		rules = append(rules, MatchedRule{
+			RuleID:   stringValue(get(rule, "rule_id")),
+			Severity: stringValue(get(rule, "severity")),
+			Message:  stringValue(get(rule, "message")),
+			Tags:     listValue(get(rule, "tags")),
+		})
+	}
+
+	if metadata.RuleID == "" {
+		metadata.setRules(rules)
+	} else if len(rules) > 0 {
+		metadata.Rules = rules
+	}
+
+	return metadata
+}
+
+// fieldKey returns the key a metadata field is mapped to.
+func fieldKey(fields map[string]string, field string) string {
+	if key, found := fields[field]; found {
+		return key
+	}
+	return field
+}
+
+// lookupValue returns the value at a dot-separated key. Keys nested
+// deeper than maxMetadataDepth are not found.
+func lookupValue(values map[string]any, key string) any {
+	for depth := 0; depth < maxMetadataDepth; depth++ {
+		if value, found := values[key]; found {
+			return value
+		}
+
+		head, rest, nested := strings.Cut(key, ".")
+		if !nested {
+			return nil
+		}
+		inner, ok := values[head].(map[string]any)
+		if !ok {
+			return nil
+		}
+		values, key = inner, rest
+	}
+	return nil
+}
+
+// stringValue converts a decoded value to a string.
+func stringValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
+
+// intValue converts a decoded number or numeric string to an int.
+func intValue(value any) int {
+	switch v := value.(type) {
+	case float64:
+		return int(v)
+	case string:
+		n, _ := strconv.Atoi(strings.TrimSpace(v))
+		return n
+	default:
+		return 0
+	}
+}
+
+// listValue converts a decoded list or comma-separated string to strings.
+func listValue(value any) []string {
+	switch v := value.(type) {
+	case []any:
+		var items []string
+		for _, item := range v {
+			if s := stringValue(item); s != "" {
+				items = append(items, s)
+			}
+		}
+		return items
+	case string:
+		return splitList(v)
+	default:
+		return nil
+	}
+}
+
+// parseKVMetadata parses metadata from a simple string format.
 // Format: "action=block;rule_id=930120;severity=high"
-func (s *MetadataService) parseStringMetadata(value string) *CorazaMetadata {
+// Matched rules are listed by repeating rule_id, each followed by its
+// severity, message and comma-separated tags:
+// "action=block;rule_id=942100;severity=critical;rule_id=949110;severity=critical"
+// The CRS anomaly score is read from inbound_anomaly_score,
+// outbound_anomaly_score and paranoia_level. Keys are renamed by fields.
+func parseKVMetadata(value string, fields map[string]string) *CorazaMetadata {
+	keys := make(map[string]string, len(metadataFields))
+	for _, field := range metadataFields {
+		keys[fieldKey(fields, field)] = field
+	}
+
 	metadata := &CorazaMetadata{}
+	var rules []MatchedRule
 
 	parts := strings.Split(value, ";")
 	for _, part := range parts {
@@ -79,51 +284,133 @@ func (s *MetadataService) parseStringMetadata(value string) *CorazaMetadata {
 			continue
 		}
 
-		key := strings.TrimSpace(kv[0])
+		key := keys[strings.TrimSpace(kv[0])]
 		val := strings.TrimSpace(kv[1])
 
 		switch key {
 		case "action":
 			metadata.Action = val
 		case "rule_id":
-			metadata.RuleID = val
-		case "severity":
-			metadata.Severity = val
-		case "message":
-			metadata.Message = val
+			rules = append(rules, MatchedRule{RuleID: val})
+		case "severity", "message", "tags":
+			if len(rules) == 0 {
+				rules = append(rules, MatchedRule{})
+			}
+			rule := &rules[len(rules)-1]
+			switch key {
+			case "severity":
+				rule.Severity = val
+			case "message":
+				rule.Message = val
+			default:
+				rule.Tags = splitList(val)
+			}
 		case "matched_data":
 			metadata.MatchedData = val
+		case "inbound_anomaly_score":
+			metadata.InboundAnomalyScore, _ = strconv.Atoi(val)
+		case "outbound_anomaly_score":
+			metadata.OutboundAnomalyScore, _ = strconv.Atoi(val)
+		case "paranoia_level":
+			metadata.ParanoiaLevel, _ = strconv.Atoi(val)
 		}
 	}
 
-	if metadata.Action == "" {
+	// Requests Coraza only logged may carry just the anomaly score
+	if metadata.Action == "" && metadata.AnomalyScore() == 0 {
 		return nil
 	}
 
+	metadata.setRules(rules)
 	return metadata
 }
 
-// extractFromHeaders extracts Coraza metadata from response headers.
-func (s *MetadataService) extractFromHeaders() *CorazaMetadata {
-	action, err := proxywasm.GetHttpResponseHeader("x-coraza-action")
-	if err != nil || action == "" {
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseHeaderMetadata parses Coraza metadata from one header per field,
+// as named by fields (e.g., x-coraza-rule-id for rule_id); fields without
+// a header are not read. Matched rules are listed by repeating the rule ID
+// header, or as a comma-separated list; severity and message values
+// belong to the rule at the same position.
+func parseHeaderMetadata(headers [][2]string, fields map[string]string) *CorazaMetadata {
+	names := make(map[string]string, len(fields))
+	for field, header := range fields {
+		names[strings.ToLower(header)] = field
+	}
+
+	var action, matchedData string
+	var ruleIDs, severities, messages, tags []string
+	var inbound, outbound, paranoiaLevel int
+
+	for _, header := range headers {
+		switch names[strings.ToLower(header[0])] {
+		case "action":
+			if action == "" {
+				action = header[1]
+			}
+		case "rule_id":
+			ruleIDs = append(ruleIDs, splitList(header[1])...)
+		case "severity":
+			severities = append(severities, splitList(header[1])...)
+		case "message":
+			messages = append(messages, header[1])
+		case "matched_data":
+			matchedData = header[1]
+		case "tags":
+			tags = append(tags, splitList(header[1])...)
+		case "inbound_anomaly_score":
+			inbound, _ = strconv.Atoi(strings.TrimSpace(header[1]))
+		case "outbound_anomaly_score":
+			outbound, _ = strconv.Atoi(strings.TrimSpace(header[1]))
+		case "paranoia_level":
+			paranoiaLevel, _ = strconv.Atoi(strings.TrimSpace(header[1]))
+		}
+	}
+
+	// Requests Coraza only logged may carry just the anomaly score
+	if action == "" && inbound+outbound == 0 {
 		return nil
 	}
 
 	metadata := &CorazaMetadata{
-		Action: action,
+		Action:               action,
+		MatchedData:          matchedData,
+		InboundAnomalyScore:  inbound,
+		OutboundAnomalyScore: outbound,
+		ParanoiaLevel:        paranoiaLevel,
 	}
 
-	if ruleID, err := proxywasm.GetHttpResponseHeader("x-coraza-rule-id"); err == nil {
-		metadata.RuleID = ruleID
+	count := len(ruleIDs)
+	if count == 0 && (len(severities) > 0 || len(messages) > 0) {
+		count = 1 // a rule without ID
 	}
 
-	if severity, err := proxywasm.GetHttpResponseHeader("x-coraza-severity"); err == nil {
-		metadata.Severity = severity
+	rules := make([]MatchedRule, count)
+	for i := range rules {
+		if i < len(ruleIDs) {
+			rules[i].RuleID = ruleIDs[i]
+		}
+		if i < len(severities) {
+			rules[i].Severity = severities[i]
+		}
+		if i < len(messages) {
+			rules[i].Message = messages[i]
+		}
 	}
+	metadata.setRules(rules)
 
-	if message, err := proxywasm.GetHttpResponseHeader("x-coraza-message"); err == nil {
-		metadata.Message = message
+	// Tags describe the deciding rule
+	if len(tags) > 0 {
+		metadata.Tags = tags
 	}
 
 	return metadata
@@ -148,22 +435,31 @@ func (s *MetadataService) GetStatusCode() int {
 
 // IsBlockedResponse checks if the response indicates a blocked request.
 // This is a fallback when Coraza metadata is not available.
-func (s *MetadataService) IsBlockedResponse() bool {
-	statusCode := s.GetStatusCode()
-
-	// Coraza typically returns 403 for blocked requests
-	if statusCode == 403 || statusCode == 406 || statusCode == 418 {
-		if server, err := proxywasm.GetHttpResponseHeader("server"); err == nil {
-			if strings.Contains(strings.ToLower(server), "coraza") {
-				return true
-			}
-		}
+func (s *MetadataService) IsBlockedResponse(statusCode int) bool {
+	headers, err := proxywasm.GetHttpResponseHeaders()
+	if err != nil {
+		s.logger.Debug("failed to read response headers: %v", err)
+	}
+	return isBlockedResponse(&s.config.WAFDetection, statusCode, headers)
+}
+
+// isBlockedResponse returns true if a response with one of the WAF block
+// status codes carries a block header or, with the status fallback,
+// always.
+func isBlockedResponse(detection *WAFDetectionConfig, statusCode int, headers [][2]string) bool {
+	if !slices.Contains(detection.StatusCodes, statusCode) {
+		return false
+	}
+	if detection.FallbackEnabled() {
+		return true
+	}
 
-		if _, err := proxywasm.GetHttpResponseHeader("x-waf-block"); err == nil {
+	for _, header := range headers {
+		value, found := detection.BlockHeaders[strings.ToLower(header[0])]
+		if found && strings.Contains(strings.ToLower(header[1]), strings.ToLower(value)) {
 			return true
 		}
 	}
-
 	return false
 }
 
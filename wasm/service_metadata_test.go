@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestParseKVMetadata(t *testing.T) {
+	metadata := parseKVMetadata("action=block;rule_id=930120;severity=high", nil)
+	if metadata == nil || metadata.RuleID != "930120" || metadata.Severity != "high" || metadata.Rules != nil {
+		t.Errorf("unexpected single rule metadata: %+v", metadata)
+	}
+
+	if parseKVMetadata("rule_id=930120", nil) != nil {
+		t.Error("expected nil metadata without action")
+	}
+}
+
+func TestParseKVMetadata_MultipleRules(t *testing.T) {
+	metadata := parseKVMetadata("action=block;"+
+		"rule_id=942100;severity=critical;tags=attack-sqli,OWASP_CRS;"+
+		"rule_id=941100;severity=high;"+
+		"rule_id=949110;severity=critical", nil)
+	if metadata == nil {
+		t.Fatal("expected metadata")
+	}
+	if len(metadata.Rules) != 3 {
+		t.Fatalf("expected 3 rules, got %+v", metadata.Rules)
+	}
+	if metadata.RuleID != "949110" {
+		t.Errorf("expected the last rule to decide, got %s", metadata.RuleID)
+	}
+	if tags := metadata.Rules[0].Tags; len(tags) != 2 || tags[0] != "attack-sqli" {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+	if metadata.Rules[1].Severity != "high" {
+		t.Errorf("expected severity of the second rule, got %s", metadata.Rules[1].Severity)
+	}
+}
+
+func TestParseHeaderMetadata(t *testing.T) {
+	metadata := parseHeaderMetadata([][2]string{
+		{":status", "403"},
+		{"x-coraza-action", "block"},
+		{"x-coraza-rule-id", "942100"},
+		{"x-coraza-severity", "critical"},
+		{"x-coraza-rule-id", "941100, 949110"},
+		{"x-coraza-severity", "high,critical"},
+	}, defaultHeaderFields)
+	if metadata == nil {
+		t.Fatal("expected metadata")
+	}
+	if len(metadata.Rules) != 3 || metadata.Rules[1].RuleID != "941100" || metadata.Rules[1].Severity != "high" {
+		t.Errorf("unexpected rules: %+v", metadata.Rules)
+	}
+
+	metadata = parseHeaderMetadata([][2]string{
+		{"x-coraza-action", "block"},
+		{"x-coraza-severity", "high"},
+	}, defaultHeaderFields)
+	if metadata == nil || metadata.Severity != "high" || metadata.Rules != nil {
+		t.Errorf("unexpected metadata without rule ID: %+v", metadata)
+	}
+
+	if parseHeaderMetadata([][2]string{{"x-coraza-rule-id", "942100"}}, defaultHeaderFields) != nil {
+		t.Error("expected nil metadata without action")
+	}
+}
+
+func TestParseKVMetadata_AnomalyScore(t *testing.T) {
+	metadata := parseKVMetadata("inbound_anomaly_score=8;outbound_anomaly_score=2;paranoia_level=3", nil)
+	if metadata == nil {
+		t.Fatal("expected metadata with only an anomaly score")
+	}
+	if metadata.AnomalyScore() != 10 || metadata.ParanoiaLevel != 3 || metadata.IsBlocked() {
+		t.Errorf("unexpected metadata: %+v", metadata)
+	}
+}
+
+func TestParseHeaderMetadata_AnomalyScore(t *testing.T) {
+	metadata := parseHeaderMetadata([][2]string{
+		{"x-coraza-action", "log"},
+		{"x-coraza-inbound-anomaly-score", "5"},
+		{"x-coraza-paranoia-level", "2"},
+	}, defaultHeaderFields)
+	if metadata == nil || metadata.AnomalyScore() != 5 || metadata.ParanoiaLevel != 2 {
+		t.Errorf("unexpected metadata: %+v", metadata)
+	}
+}
+
+func TestIsBlockedResponse(t *testing.T) {
+	fallback := false
+	detection := &WAFDetectionConfig{
+		BlockHeaders:   map[string]string{"x-waf-block": "", "server": "coraza"},
+		StatusCodes:    []int{403, 406},
+		StatusFallback: &fallback,
+	}
+
+	tests := []struct {
+		name       string
+		statusCode int
+		headers    [][2]string
+		expected   bool
+	}{
+		{"block header", 403, [][2]string{{"x-waf-block", "1"}}, true},
+		{"server header", 406, [][2]string{{"Server", "envoy/Coraza"}}, true},
+		{"upstream 403", 403, [][2]string{{"server", "nginx"}}, false},
+		{"other status", 401, [][2]string{{"x-waf-block", "1"}}, false},
+	}
+
+	for _, tt := range tests {
+		if got := isBlockedResponse(detection, tt.statusCode, tt.headers); got != tt.expected {
+			t.Errorf("%s: isBlockedResponse = %v, expected %v", tt.name, got, tt.expected)
+		}
+	}
+
+	// With the status fallback, the status code alone proves a block
+	detection.StatusFallback = nil
+	if !isBlockedResponse(detection, 403, nil) {
+		t.Error("expected status fallback to detect the block")
+	}
+}
+
+func TestParseKVMetadata_Fields(t *testing.T) {
+	metadata := parseKVMetadata("decision=deny;id=942100;level=critical;score=7",
+		map[string]string{"action": "decision", "rule_id": "id", "severity": "level", "inbound_anomaly_score": "score"})
+	if metadata == nil || metadata.Action != "deny" || metadata.RuleID != "942100" ||
+		metadata.Severity != "critical" || metadata.AnomalyScore() != 7 {
+		t.Errorf("unexpected mapped metadata: %+v", metadata)
+	}
+}
+
+func TestDecodeMetadata_JSON(t *testing.T) {
+	value := []byte(`{"decision": "block", "matched": {"id": 942100, "severity": "critical"},
+		"tags": ["attack-sqli"], "anomaly": {"inbound": 10}}`)
+	fields := map[string]string{
+		"action":                "decision",
+		"rule_id":               "matched.id",
+		"severity":              "matched.severity",
+		"inbound_anomaly_score": "anomaly.inbound",
+	}
+
+	metadata := decodeMetadata(value, MetadataFormatAuto, fields)
+	if metadata == nil {
+		t.Fatal("expected metadata")
+	}
+	if metadata.Action != "block" || metadata.RuleID != "942100" || metadata.Severity != "critical" {
+		t.Errorf("unexpected mapped metadata: %+v", metadata)
+	}
+	if len(metadata.Tags) != 1 || metadata.AnomalyScore() != 10 {
+		t.Errorf("unexpected tags or anomaly score: %+v", metadata)
+	}
+
+	// The default field names match the CorazaMetadata JSON encoding
+	metadata = decodeMetadata([]byte(`{"action": "block", "rules": [
+		{"rule_id": "942100", "severity": "critical"},
+		{"rule_id": "949110", "severity": "critical"}]}`), MetadataFormatJSON, nil)
+	if metadata == nil || metadata.RuleID != "949110" || len(metadata.Rules) != 2 {
+		t.Errorf("unexpected rules metadata: %+v", metadata)
+	}
+
+	if decodeMetadata([]byte(`{"rule_id": "942100"}`), MetadataFormatJSON, nil) != nil {
+		t.Error("expected nil metadata without action")
+	}
+	if decodeMetadata([]byte("action=block"), MetadataFormatJSON, nil) != nil {
+		t.Error("expected nil metadata for invalid JSON")
+	}
+}
+
+func TestLookupValue_Depth(t *testing.T) {
+	values := map[string]any{"action": "block"}
+	key := "action"
+	for depth := 1; depth < maxMetadataDepth; depth++ {
+		values, key = map[string]any{"inner": values}, "inner."+key
+	}
+
+	if got := lookupValue(values, key); got != "block" {
+		t.Errorf("expected value at the depth limit, got %v", got)
+	}
+	if got := lookupValue(map[string]any{"inner": values}, "inner."+key); got != nil {
+		t.Errorf("expected no value past the depth limit, got %v", got)
+	}
+	if got := lookupValue(map[string]any{"a.b": "dotted"}, "a.b"); got != "dotted" {
+		t.Errorf("expected dotted key to match first, got %v", got)
+	}
+}
+
+func TestDecodeMetadata_Struct(t *testing.T) {
+	value := encodeTestStruct(map[string]any{
+		"action":  "block",
+		"rule_id": "942100",
+		"tags":    []any{"attack-sqli", "OWASP_CRS"},
+	})
+
+	for _, format := range []string{MetadataFormatStruct, MetadataFormatAuto} {
+		metadata := decodeMetadata(value, format, nil)
+		if metadata == nil || metadata.Action != "block" || metadata.RuleID != "942100" || len(metadata.Tags) != 2 {
+			t.Errorf("%s: unexpected metadata: %+v", format, metadata)
+		}
+	}
+
+	// Auto falls back to key=value pairs
+	metadata := decodeMetadata([]byte("action=block;rule_id=930120"), MetadataFormatAuto, nil)
+	if metadata == nil || metadata.RuleID != "930120" {
+		t.Errorf("unexpected key=value metadata: %+v", metadata)
+	}
+}
+
+func TestDecodeHeaderMetadata(t *testing.T) {
+	headers := [][2]string{
+		{"X-WAF-Result", `{"action": "block", "rule_id": "942100"}`},
+		{"x-waf-struct", base64.StdEncoding.EncodeToString(encodeTestStruct(map[string]any{"action": "deny"}))},
+	}
+
+	metadata := decodeHeaderMetadata(headers, &MetadataSourceConfig{Header: "x-waf-result", Format: MetadataFormatAuto})
+	if metadata == nil || metadata.RuleID != "942100" {
+		t.Errorf("unexpected JSON header metadata: %+v", metadata)
+	}
+
+	metadata = decodeHeaderMetadata(headers, &MetadataSourceConfig{Header: "x-waf-struct", Format: MetadataFormatStruct})
+	if metadata == nil || metadata.Action != "deny" {
+		t.Errorf("unexpected Struct header metadata: %+v", metadata)
+	}
+
+	if decodeHeaderMetadata(headers, &MetadataSourceConfig{Header: "x-missing", Format: MetadataFormatAuto}) != nil {
+		t.Error("expected nil metadata without the header")
+	}
+}
+
+func TestParseHeaderMetadata_Fields(t *testing.T) {
+	metadata := parseHeaderMetadata([][2]string{
+		{"X-WAF-Decision", "block"},
+		{"x-waf-rule", "942100"},
+		{"x-coraza-rule-id", "930120"},
+	}, map[string]string{"action": "x-waf-decision", "rule_id": "x-waf-rule"})
+	if metadata == nil || metadata.Action != "block" || metadata.RuleID != "942100" {
+		t.Errorf("unexpected mapped header metadata: %+v", metadata)
+	}
+}
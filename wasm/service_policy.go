@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// =============================================================================
+// Policy Service
+// =============================================================================
+
+// Policy is a compiled policy with the effective configuration of the
+// requests it matches.
+type Policy struct {
+	// Name identifies the policy in logs and metrics
+	Name string
+	// Config is the global configuration with the policy overrides applied
+	Config *PluginConfig
+
+	hosts      []string
+	pathPrefix string
+	pathRegex  *regexp.Regexp
+	methods    map[string]bool
+}
+
+// PolicyService matches requests against the configured policies.
+// Policies are compiled once at plugin start, including their effective
+// configuration, and the service is shared by all requests.
+type PolicyService struct {
+	config   *PluginConfig
+	policies []*Policy
+}
+
+// NewPolicyService compiles the policies of the configuration.
+// Returns an error if a path regex is invalid.
+func NewPolicyService(config *PluginConfig) (*PolicyService, error) {
+	policies := make([]*Policy, 0, len(config.Policies))
+	for i := range config.Policies {
+		policyConfig := &config.Policies[i]
+
+		policy := &Policy{
+			Name:   policyConfig.Name,
+			Config: config.WithPolicy(policyConfig),
+			hosts:  policyConfig.Hosts,
+		}
+		if policyConfig.PathPrefix != "" {
+			policy.pathPrefix = config.canonicalPath(policyConfig.PathPrefix)
+		}
+
+		if policyConfig.PathRegex != "" {
+			re, err := regexp.Compile(policyConfig.PathRegex)
+			if err != nil {
+				return nil, fmt.Errorf("policy %s: invalid path regex %q: %w", policy.Name, policyConfig.PathRegex, err)
+			}
+			policy.pathRegex = re
+		}
+
+		if len(policyConfig.Methods) > 0 {
+			policy.methods = make(map[string]bool, len(policyConfig.Methods))
+			for _, method := range policyConfig.Methods {
+				policy.methods[strings.ToUpper(method)] = true
+			}
+		}
+
+		policies = append(policies, policy)
+	}
+
+	return &PolicyService{config: config, policies: policies}, nil
+}
+
+// IsEmpty returns true if no policies are configured.
+func (s *PolicyService) IsEmpty() bool {
+	return len(s.policies) == 0
+}
+
+// Match returns the first policy matching the request, or nil.
+// host may include a port and path may include a query string; paths are
+// matched in their canonical form, so "//login" or "/%6Cogin" cannot
+// evade a "/login" policy.
+func (s *PolicyService) Match(host, path, method string) *Policy {
+	host = strings.ToLower(stripPort(host))
+	path = s.config.canonicalPath(path)
+
+	for _, policy := range s.policies {
+		if policy.matches(host, path, method) {
+			return policy
+		}
+	}
+	return nil
+}
+
+// matches returns true if the request matches every configured matcher.
+func (p *Policy) matches(host, path, method string) bool {
+	if len(p.hosts) > 0 && !matchHost(p.hosts, host) {
+		return false
+	}
+	if p.pathPrefix != "" && !hasPathPrefix(path, p.pathPrefix) {
+		return false
+	}
+	if p.pathRegex != nil && !p.pathRegex.MatchString(path) {
+		return false
+	}
+	if p.methods != nil && !p.methods[strings.ToUpper(method)] {
+		return false
+	}
+	return true
+}
+
+// matchHost returns true if host equals a pattern or, for "*.example.com"
+// patterns, is a subdomain of it.
+func matchHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPolicyService_Match(t *testing.T) {
+	config := DefaultConfig()
+	config.Policies = []PolicyConfig{
+		{Name: "login", PathPrefix: "/login", Methods: []string{"post"}},
+		{Name: "admin", Hosts: []string{"App.example.com"}, PathRegex: "^/api/admin(/|$)"},
+		{Name: "tenants", Hosts: []string{"*.example.org"}},
+	}
+	config.validate()
+
+	service, err := NewPolicyService(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		host, path, method string
+		expected           string
+	}{
+		{"app.example.com", "/login?next=/", "POST", "login"},
+		{"app.example.com", "/login", "GET", ""},
+		{"app.example.com", "//login", "POST", "login"},
+		{"app.example.com", "/./login/", "POST", "login"},
+		{"app.example.com", "/%6Cogin", "POST", "login"},
+		{"app.example.com", "/static/../login", "POST", "login"},
+		{"app.example.com", "/login-help", "POST", ""},
+		{"app.example.com", "//api//admin/users", "GET", "admin"},
+		{"app.example.com:8443", "/api/admin/users", "GET", "admin"},
+		{"APP.example.com", "/api/admin", "DELETE", "admin"},
+		{"other.example.com", "/api/admin", "GET", ""},
+		{"app.example.com", "/api/administrator", "GET", ""},
+		{"a.example.org", "/static/app.js", "GET", "tenants"},
+		{"example.org", "/", "GET", ""},
+		{"app.example.com", "/static/app.js", "GET", ""},
+	}
+
+	for _, tt := range tests {
+		policy := service.Match(tt.host, tt.path, tt.method)
+		got := ""
+		if policy != nil {
+			got = policy.Name
+		}
+		if got != tt.expected {
+			t.Errorf("Match(%q, %q, %q) = %q, want %q", tt.host, tt.path, tt.method, got, tt.expected)
+		}
+	}
+}
+
+func TestPolicyService_FirstMatchWins(t *testing.T) {
+	config := DefaultConfig()
+	config.Policies = []PolicyConfig{
+		{PathPrefix: "/api/admin", ScoreThreshold: 20},
+		{PathPrefix: "/api", ScoreThreshold: 50},
+	}
+	config.validate()
+
+	service, err := NewPolicyService(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	policy := service.Match("example.com", "/api/admin/users", "GET")
+	if policy == nil || policy.Name != "policy-0" || policy.Config.ScoreThreshold != 20 {
+		t.Errorf("expected first policy, got %+v", policy)
+	}
+}
+
+func TestPolicyService_EffectiveConfig(t *testing.T) {
+	dryRun := true
+	config := DefaultConfig()
+	config.Policies = []PolicyConfig{{
+		PathPrefix:       "/login",
+		ScoreThreshold:   30,
+		BanTTLBySeverity: map[string]int{"medium": 3600},
+		ScoreRules:       map[string]int{"942100": 50},
+		FingerprintMode:  FingerprintModeIPOnly,
+		DryRun:           &dryRun,
+	}}
+	config.validate()
+
+	service, err := NewPolicyService(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config.BanTTLBySeverity["low"] = 60
+
+	policy := service.Match("example.com", "/login", "POST")
+	if policy == nil {
+		t.Fatal("expected a policy")
+	}
+
+	effective := policy.Config
+	if effective.ScoreThreshold != 30 || effective.FingerprintMode != FingerprintModeIPOnly || !effective.DryRun {
+		t.Errorf("overrides not applied: %+v", effective)
+	}
+	if effective.GetBanTTL("medium") != 3600 || effective.GetScore("942100", "low") != 50 {
+		t.Error("map overrides not applied")
+	}
+	if effective.BanTTLDefault != config.BanTTLDefault {
+		t.Error("settings without override should be inherited")
+	}
+
+	if config.ScoreThreshold != DefaultScoreThreshold || config.DryRun || config.GetBanTTL("medium") != DefaultBanTTL {
+		t.Error("global configuration should not be modified")
+	}
+}
+
+func TestPolicyService_CaseInsensitivePaths(t *testing.T) {
+	config := DefaultConfig()
+	config.Policies = []PolicyConfig{{PathPrefix: "/Login"}}
+	config.validate()
+
+	service, err := NewPolicyService(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if service.Match("example.com", "/LOGIN", "POST") != nil {
+		t.Error("paths should be case-sensitive by default")
+	}
+
+	config.CaseInsensitivePaths = true
+	service, err = NewPolicyService(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if service.Match("example.com", "/LOGIN", "POST") == nil {
+		t.Error("expected case-insensitive match")
+	}
+}
+
+func TestPolicyService_Empty(t *testing.T) {
+	service, err := NewPolicyService(DefaultConfig())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !service.IsEmpty() || service.Match("example.com", "/", "GET") != nil {
+		t.Error("expected no policies")
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ban response content types
+const (
+	contentTypeText    = "text/plain"
+	contentTypeHTML    = "text/html; charset=utf-8"
+	contentTypeProblem = "application/problem+json"
+)
+
+// supportReferenceLen is the number of fingerprint characters in a
+// support reference.
+const supportReferenceLen = 16
+
+// responsePlaceholder matches a template placeholder such as "{{rule_id}}".
+var responsePlaceholder = regexp.MustCompile(`\{\{\s*([a-z_]+)\s*\}\}`)
+
+// BanResponseData holds the values of the ban response placeholders.
+type BanResponseData struct {
+	Status      int
+	Entry       *BanEntry // nil for denylist and fail-closed denials
+	Fingerprint string
+	RequestID   string
+}
+
+// responseFormat is a ban response body offered to content negotiation.
+type responseFormat struct {
+	mediaType   string // matched against the Accept header
+	contentType string
+	template    string
+	escape      func(string) string
+}
+
+// =============================================================================
+// Response Renderer
+// =============================================================================
+
+// ResponseRenderer renders ban responses from the configured templates,
+// choosing between plain text, HTML and problem+json by the request
+// Accept header.
+type ResponseRenderer struct {
+	templates *ResponseTemplatesConfig
+	now       func() time.Time
+}
+
+// NewResponseRenderer creates a renderer for the configured templates.
+func NewResponseRenderer(templates *ResponseTemplatesConfig) *ResponseRenderer {
+	return &ResponseRenderer{
+		templates: templates,
+		now:       time.Now,
+	}
+}
+
+// Render returns the headers and body of a ban response. text is the
+// plain text template, offered alongside the configured HTML and JSON.
+// A Retry-After header is added while the ban has not expired.
+func (r *ResponseRenderer) Render(accept, text string, data *BanResponseData) ([][2]string, []byte) {
+	format := r.negotiate(accept, text)
+
+	headers := [][2]string{{"content-type", format.contentType}}
+	if retryAfter := r.retryAfter(data.Entry); retryAfter > 0 {
+		headers = append(headers, [2]string{"retry-after", strconv.FormatInt(retryAfter, 10)})
+	}
+
+	values := r.values(data)
+	body := responsePlaceholder.ReplaceAllStringFunc(format.template, func(placeholder string) string {
+		name := responsePlaceholder.FindStringSubmatch(placeholder)[1]
+		value, ok := values[name]
+		if !ok {
+			return placeholder
+		}
+		return format.escape(value)
+	})
+
+	return headers, []byte(body)
+}
+
+// negotiate picks the offered format the Accept header prefers. Formats
+// are ranked by quality, then by how specific the matching media range
+// is, then by its position in the header. Plain text wins ties and is
+// used when nothing matches.
+func (r *ResponseRenderer) negotiate(accept, text string) *responseFormat {
+	formats := []*responseFormat{
+		{mediaType: "text/plain", contentType: contentTypeText, template: text, escape: func(s string) string { return s }},
+	}
+	if r.templates.JSON != "" {
+		formats = append(formats,
+			&responseFormat{mediaType: "application/problem+json", contentType: contentTypeProblem, template: r.templates.JSON, escape: escapeJSON},
+			&responseFormat{mediaType: "application/json", contentType: contentTypeProblem, template: r.templates.JSON, escape: escapeJSON},
+		)
+	}
+	if r.templates.HTML != "" {
+		formats = append(formats,
+			&responseFormat{mediaType: "text/html", contentType: contentTypeHTML, template: r.templates.HTML, escape: html.EscapeString},
+		)
+	}
+
+	ranges := parseAccept(accept)
+	if len(ranges) == 0 {
+		return formats[0]
+	}
+
+	best, bestQ, bestSpecificity, bestPosition := formats[0], 0.0, -1, len(ranges)
+	for _, format := range formats {
+		q, specificity, position := matchAccept(ranges, format.mediaType)
+		if position < 0 {
+			continue
+		}
+		if q > bestQ ||
+			(q == bestQ && specificity > bestSpecificity) ||
+			(q == bestQ && specificity == bestSpecificity && position < bestPosition) {
+			best, bestQ, bestSpecificity, bestPosition = format, q, specificity, position
+		}
+	}
+	return best
+}
+
+// values returns the placeholder values of a ban response.
+func (r *ResponseRenderer) values(data *BanResponseData) map[string]string {
+	values := map[string]string{
+		"status":      strconv.Itoa(data.Status),
+		"reason":      "",
+		"rule_id":     "",
+		"severity":    "",
+		"expires_at":  "",
+		"retry_after": "0",
+		"reference":   supportReference(data.Fingerprint),
+		"request_id":  data.RequestID,
+	}
+
+	if entry := data.Entry; entry != nil {
+		values["reason"] = entry.Reason
+		values["rule_id"] = entry.RuleID
+		values["severity"] = entry.Severity
+		values["expires_at"] = time.Unix(entry.ExpiresAt, 0).UTC().Format(time.RFC3339)
+		if retryAfter := r.retryAfter(entry); retryAfter > 0 {
+			values["retry_after"] = strconv.FormatInt(retryAfter, 10)
+		}
+	}
+
+	return values
+}
+
+// retryAfter returns the seconds until the ban expires, or 0.
+func (r *ResponseRenderer) retryAfter(entry *BanEntry) int64 {
+	if entry == nil {
+		return 0
+	}
+	if remaining := entry.ExpiresAt - r.now().Unix(); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// validateJSONTemplate checks that a JSON template renders valid JSON
+// whatever the placeholder values. Placeholders must be inside string
+// literals, except {{status}} and {{retry_after}}, which are always
+// numbers.
+func validateJSONTemplate(template string) error {
+	var sample strings.Builder
+	inString, escaped := false, false
+
+	// scan appends template text to the sample, tracking string literals
+	scan := func(text string) {
+		for i := 0; i < len(text); i++ {
+			switch {
+			case escaped:
+				escaped = false
+			case inString && text[i] == '\\':
+				escaped = true
+			case text[i] == '"':
+				inString = !inString
+			}
+		}
+		sample.WriteString(text)
+	}
+
+	last := 0
+	for _, match := range responsePlaceholder.FindAllStringSubmatchIndex(template, -1) {
+		scan(template[last:match[0]])
+		last = match[1]
+
+		name := template[match[2]:match[3]]
+		switch {
+		case inString:
+			sample.WriteString("x")
+		case name == "status" || name == "retry_after":
+			sample.WriteString("0")
+		default:
+			return fmt.Errorf("placeholder {{%s}} must be inside a JSON string", name)
+		}
+	}
+	scan(template[last:])
+
+	if !json.Valid([]byte(sample.String())) {
+		return fmt.Errorf("must be valid JSON")
+	}
+	return nil
+}
+
+// supportReference returns the reference users quote to support. It is
+// the prefix of the fingerprint, so the ban can be found with the
+// reference filter of the admin API list without exposing the full
+// fingerprint.
+func supportReference(fingerprint string) string {
+	if len(fingerprint) > supportReferenceLen {
+		return fingerprint[:supportReferenceLen]
+	}
+	return fingerprint
+}
+
+// escapeJSON escapes a value for use inside a JSON string.
+func escapeJSON(value string) string {
+	encoded, _ := json.Marshal(value)
+	return string(encoded[1 : len(encoded)-1])
+}
+
+// acceptRange is a media range of an Accept header.
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept parses the media ranges of an Accept header.
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			name, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if found && strings.EqualFold(strings.TrimSpace(name), "q") {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+	}
+	return ranges
+}
+
+// matchAccept returns the quality, specificity and position of the most
+// specific media range matching mediaType. Position is -1 when no range
+// matches or the match has quality 0.
+func matchAccept(ranges []acceptRange, mediaType string) (float64, int, int) {
+	mainType, _, _ := strings.Cut(mediaType, "/")
+
+	q, specificity, position := 0.0, -1, -1
+	for i, r := range ranges {
+		s := -1
+		switch r.mediaType {
+		case mediaType:
+			s = 2
+		case mainType + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity, position = r.q, s, i
+		}
+	}
+
+	if q <= 0 {
+		return 0, -1, -1
+	}
+	return q, specificity, position
+}
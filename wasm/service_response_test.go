@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestResponseRenderer() *ResponseRenderer {
+	return NewResponseRenderer(&ResponseTemplatesConfig{
+		HTML: "<p>Blocked by {{rule_id}}, reference {{reference}}</p>",
+		JSON: `{"title": "Forbidden", "status": {{status}}, "detail": "{{reason}}", "request_id": "{{request_id}}"}`,
+	})
+}
+
+func headerValue(headers [][2]string, name string) string {
+	for _, header := range headers {
+		if header[0] == name {
+			return header[1]
+		}
+	}
+	return ""
+}
+
+func TestResponseRenderer_Negotiate(t *testing.T) {
+	renderer := newTestResponseRenderer()
+
+	tests := []struct {
+		accept      string
+		contentType string
+	}{
+		{"", contentTypeText},
+		{"*/*", contentTypeText},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", contentTypeHTML},
+		{"application/json", contentTypeProblem},
+		{"application/problem+json, text/html;q=0.5", contentTypeProblem},
+		{"text/html;q=0.5, application/json", contentTypeProblem},
+		{"application/json, text/html", contentTypeProblem},
+		{"text/*", contentTypeText},
+		{"text/html;q=0, */*", contentTypeText},
+		{"image/png", contentTypeText},
+	}
+
+	for _, tt := range tests {
+		headers, _ := renderer.Render(tt.accept, "Forbidden", &BanResponseData{Status: 403})
+		if got := headerValue(headers, "content-type"); got != tt.contentType {
+			t.Errorf("Accept %q: got %s, want %s", tt.accept, got, tt.contentType)
+		}
+	}
+}
+
+func TestResponseRenderer_NegotiateWithoutTemplates(t *testing.T) {
+	renderer := NewResponseRenderer(&ResponseTemplatesConfig{})
+
+	headers, body := renderer.Render("text/html", "Forbidden", &BanResponseData{Status: 403})
+	if got := headerValue(headers, "content-type"); got != contentTypeText || string(body) != "Forbidden" {
+		t.Errorf("expected plain text body, got %s %q", got, body)
+	}
+}
+
+func TestResponseRenderer_Placeholders(t *testing.T) {
+	renderer := newTestResponseRenderer()
+	now := time.Unix(1700000000, 0)
+	renderer.now = func() time.Time { return now }
+
+	entry := &BanEntry{Reason: `waf-rule "sqli"`, RuleID: "942100", Severity: "high", ExpiresAt: now.Unix() + 120}
+	data := &BanResponseData{
+		Status:      403,
+		Entry:       entry,
+		Fingerprint: "0123456789abcdef0123456789abcdef",
+		RequestID:   "req-1",
+	}
+
+	headers, body := renderer.Render("text/plain", "{{severity}} ban until {{expires_at}}, retry in {{retry_after}}s ({{ unknown }})", data)
+	expected := "high ban until 2023-11-14T22:15:20Z, retry in 120s ({{ unknown }})"
+	if string(body) != expected {
+		t.Errorf("got %q, want %q", body, expected)
+	}
+	if got := headerValue(headers, "retry-after"); got != "120" {
+		t.Errorf("expected retry-after 120, got %q", got)
+	}
+
+	_, body = renderer.Render("text/html", "", data)
+	if string(body) != "<p>Blocked by 942100, reference 0123456789abcdef</p>" {
+		t.Errorf("unexpected HTML body: %s", body)
+	}
+
+	_, body = renderer.Render("application/json", "", data)
+	var problem map[string]interface{}
+	if err := json.Unmarshal(body, &problem); err != nil {
+		t.Fatalf("invalid JSON body %s: %v", body, err)
+	}
+	if problem["detail"] != `waf-rule "sqli"` || problem["status"] != 403.0 || problem["request_id"] != "req-1" {
+		t.Errorf("unexpected JSON body: %s", body)
+	}
+}
+
+func TestResponseRenderer_NoEntry(t *testing.T) {
+	renderer := newTestResponseRenderer()
+
+	headers, body := renderer.Render("text/plain", "[{{rule_id}}] {{reference}} {{retry_after}}", &BanResponseData{Status: 403, Fingerprint: "abc"})
+	if string(body) != "[] abc 0" {
+		t.Errorf("unexpected body: %q", body)
+	}
+	if got := headerValue(headers, "retry-after"); got != "" {
+		t.Errorf("expected no retry-after without a ban entry, got %q", got)
+	}
+}
+
+func TestValidateJSONTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		valid    bool
+	}{
+		{`{"status": {{status}}, "retry_after": {{retry_after}}, "detail": "{{reason}}"}`, true},
+		{`{"detail": "rule \"{{rule_id}}\" matched", "reference": "{{reference}}"}`, true},
+		{`{"detail": "{{ unknown }}"}`, true},
+		{`{"rule": {{rule_id}}}`, false},
+		{`{"detail": "\\", "rule": {{rule_id}}}`, false},
+		{`{"status": {{status}}`, false},
+	}
+
+	for _, tt := range tests {
+		if err := validateJSONTemplate(tt.template); (err == nil) != tt.valid {
+			t.Errorf("validateJSONTemplate(%s) = %v, want valid=%v", tt.template, err, tt.valid)
+		}
+	}
+}
+
+func TestResponseRenderer_EscapesHTML(t *testing.T) {
+	renderer := newTestResponseRenderer()
+	entry := NewBanEntry("fp", "manual", "<script>", "low", 60)
+
+	_, body := renderer.Render("text/html", "", &BanResponseData{Status: 403, Entry: entry})
+	if strings.Contains(string(body), "<script>") {
+		t.Errorf("rule ID should be escaped: %s", body)
+	}
+}
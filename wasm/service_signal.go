@@ -0,0 +1,80 @@
+package main
+
+// =============================================================================
+// Signal Service
+// =============================================================================
+
+// SignalService counts the request rate and response codes of clients and
+// reports the signals that reached their threshold. Signals catch abuse
+// that rarely trips WAF rules, such as credential stuffing (401/403
+// bursts) and scraping (request rate, 404 bursts).
+type SignalService struct {
+	config *PluginConfig
+	logger Logger
+	store  SignalStore
+}
+
+// NewSignalService creates a new signal service.
+func NewSignalService(config *PluginConfig, logger Logger, store SignalStore) *SignalService {
+	return &SignalService{
+		config: config,
+		logger: logger,
+		store:  store,
+	}
+}
+
+// Observe counts a response to the client toward the enabled signals and
+// returns the signals it triggered. The counter of a triggered signal is
+// reset, so a signal triggers once per threshold events.
+func (s *SignalService) Observe(fingerprint string, statusCode int) []string {
+	if fingerprint == "" || !s.config.Signals.Enabled() {
+		return nil
+	}
+
+	var triggered []string
+	for _, name := range responseSignals(statusCode) {
+		signal := s.config.Signals.Get(name)
+		if !signal.Enabled() {
+			continue
+		}
+
+		count, err := s.store.IncrSignal(fingerprint, name, signal.WindowSeconds)
+		if err != nil {
+			s.logger.Error("failed to count %s signal for %s: %v", name, fingerprint, err)
+		}
+		if count < signal.Threshold {
+			continue
+		}
+
+		s.logger.Info("signal %s triggered for %s: %d events in %ds",
+			name, fingerprint, count, signal.WindowSeconds)
+		if err := s.store.ResetSignal(fingerprint, name); err != nil {
+			s.logger.Error("failed to reset %s signal for %s: %v", name, fingerprint, err)
+		}
+		triggered = append(triggered, name)
+	}
+
+	return triggered
+}
+
+// responseSignals returns the signals a response counts toward. With
+// waf_detection.status_fallback, statuses in waf_detection.status_codes
+// (403 by default) are banned as WAF blocks before signals are counted.
+func responseSignals(statusCode int) []string {
+	signals := []string{SignalRequestRate}
+	switch {
+	case statusCode == 404:
+		signals = append(signals, SignalNotFound)
+	case statusCode == 401 || statusCode == 403:
+		signals = append(signals, SignalAuthFailure)
+	case statusCode >= 500:
+		signals = append(signals, SignalServerError)
+	}
+	return signals
+}
+
+// SignalRuleID returns the rule ID recorded for the score of a signal
+// (e.g., "signal:not_found").
+func SignalRuleID(signal string) string {
+	return "signal:" + signal
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSignalService_Observe_Threshold(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoringEnabled = true
+	config.Signals.AuthFailure = SignalConfig{Threshold: 3, Score: 50}
+	config.validate()
+
+	store := NewMockSignalStore()
+	service := NewSignalService(config, NewMockLogger(), store)
+
+	for i := 1; i <= 2; i++ {
+		if triggered := service.Observe("fp", 401); len(triggered) != 0 {
+			t.Fatalf("event %d: expected no signal, got %v", i, triggered)
+		}
+	}
+
+	triggered := service.Observe("fp", 403)
+	if len(triggered) != 1 || triggered[0] != SignalAuthFailure {
+		t.Fatalf("expected auth_failure signal, got %v", triggered)
+	}
+	if _, found := store.Counts[SignalKey(SignalAuthFailure, "fp")]; found {
+		t.Error("triggered signal should be reset")
+	}
+}
+
+func TestSignalService_Observe_StatusCodes(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoringEnabled = true
+	config.Signals = SignalsConfig{
+		RequestRate: SignalConfig{Threshold: 100, Score: 10},
+		NotFound:    SignalConfig{Threshold: 100, Score: 10},
+		AuthFailure: SignalConfig{Threshold: 100, Score: 10},
+		ServerError: SignalConfig{Threshold: 100, Score: 10},
+	}
+	config.validate()
+
+	store := NewMockSignalStore()
+	service := NewSignalService(config, NewMockLogger(), store)
+
+	for _, status := range []int{200, 404, 404, 401, 403, 500, 503} {
+		service.Observe("fp", status)
+	}
+
+	expected := map[string]int{
+		SignalRequestRate: 7,
+		SignalNotFound:    2,
+		SignalAuthFailure: 2,
+		SignalServerError: 2,
+	}
+	for signal, count := range expected {
+		if got := store.Counts[SignalKey(signal, "fp")]; got != count {
+			t.Errorf("%s: expected %d events, got %d", signal, count, got)
+		}
+	}
+}
+
+func TestSignalService_Observe_Disabled(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoringEnabled = true
+	config.Signals.NotFound = SignalConfig{Threshold: 1, Score: 10}
+	config.validate()
+
+	store := NewMockSignalStore()
+	service := NewSignalService(config, NewMockLogger(), store)
+
+	if triggered := service.Observe("fp", 401); len(triggered) != 0 {
+		t.Errorf("disabled signals should not trigger, got %v", triggered)
+	}
+	if triggered := service.Observe("", 404); len(triggered) != 0 {
+		t.Errorf("empty fingerprint should not trigger, got %v", triggered)
+	}
+	if len(store.Counts) != 0 {
+		t.Errorf("expected no counted events, got %v", store.Counts)
+	}
+}
@@ -1,10 +1,19 @@
 package main
 
 import (
+	"encoding/json"
+	"slices"
+	"time"
+
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
 	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm/types"
 )
 
+// maxBanIndexSize caps the ban IDs tracked by the ban index, which is
+// rewritten as a whole on every change. Once full, the oldest bans are
+// untracked: they are still enforced, but no longer listed or swept.
+const maxBanIndexSize = 10000
+
 // =============================================================================
 // Local Ban Store
 // =============================================================================
@@ -12,51 +21,87 @@ import (
 // LocalBanStore implements BanStore using Envoy's shared-data mechanism.
 // This provides in-memory storage that is shared across all worker threads.
 type LocalBanStore struct {
-	logger Logger
+	logger   Logger
+	keys     *Keyspace
+	onExpire func(*BanEntry)
 }
 
 // NewLocalBanStore creates a new local ban store.
-func NewLocalBanStore(logger Logger) *LocalBanStore {
+func NewLocalBanStore(logger Logger, keys *Keyspace) *LocalBanStore {
 	return &LocalBanStore{
 		logger: logger,
+		keys:   keys,
 	}
 }
 
+// SetOnExpire registers a callback invoked once for every ban this store
+// removes because it expired, whether found by CheckBan or SweepExpired.
+// Bans synced from Redis are removed silently: every instance holds a copy,
+// and the instance that issued the ban reports its expiry.
+func (s *LocalBanStore) SetOnExpire(callback func(*BanEntry)) {
+	s.onExpire = callback
+}
+
 // CheckBan checks if a fingerprint is banned in the local shared-data cache.
 func (s *LocalBanStore) CheckBan(fingerprint string) (*BanEntry, bool) {
-	key := BanKey(fingerprint)
+	entry, cas := s.read(fingerprint)
+	if entry == nil {
+		return nil, false
+	}
 
-	data, _, err := proxywasm.GetSharedData(key)
+	// Check if ban has expired
+	if entry.IsExpired() {
+		s.expire(entry, cas)
+		return nil, false
+	}
+
+	return entry, true
+}
+
+// read loads a ban entry and its CAS value from shared data.
+// Returns nil if no entry exists or it cannot be parsed.
+func (s *LocalBanStore) read(fingerprint string) (*BanEntry, uint32) {
+	data, cas, err := proxywasm.GetSharedData(s.keys.Ban(fingerprint))
 	if err != nil {
 		if err != types.ErrorStatusNotFound {
 			s.logger.Error("failed to read ban cache for %s: %v", fingerprint, err)
 		}
-		return nil, false
+		return nil, 0
 	}
 
 	if len(data) == 0 {
-		return nil, false
+		return nil, cas
 	}
 
 	entry, err := BanEntryFromJSON(data)
 	if err != nil {
 		s.logger.Error("failed to parse ban entry for %s: %v", fingerprint, err)
-		return nil, false
+		return nil, cas
 	}
 
-	// Check if ban has expired
-	if entry.IsExpired() {
-		s.logger.Debug("ban expired for %s", fingerprint)
-		_ = s.DeleteBan(fingerprint)
-		return nil, false
+	return entry, cas
+}
+
+// expire removes an expired entry and reports it to the expiry callback.
+// The delete uses the CAS value from when the entry was read, so when
+// several workers notice the same expiry only one of them reports it.
+func (s *LocalBanStore) expire(entry *BanEntry, cas uint32) bool {
+	if err := proxywasm.SetSharedData(s.keys.Ban(entry.ID()), []byte{}, cas); err != nil {
+		s.logger.Debug("expired ban for %s already removed: %v", entry.ID(), err)
+		return false
 	}
+	s.removeFromIndex(entry.ID())
 
-	return entry, true
+	s.logger.Debug("ban expired for %s", entry.ID())
+	if s.onExpire != nil && !entry.Synced {
+		s.onExpire(entry)
+	}
+	return true
 }
 
 // SetBan stores a ban entry in the local shared-data cache.
 func (s *LocalBanStore) SetBan(entry *BanEntry) error {
-	key := BanKey(entry.Fingerprint)
+	key := s.keys.Ban(entry.ID())
 
 	data, err := entry.ToJSON()
 	if err != nil {
@@ -64,24 +109,41 @@ func (s *LocalBanStore) SetBan(entry *BanEntry) error {
 	}
 
 	// Get current CAS value for thread-safe update
-	_, cas, _ := proxywasm.GetSharedData(key)
+	previous, cas, _ := proxywasm.GetSharedData(key)
 
 	// Set with CAS (if cas is 0, it's a new entry)
 	if err := proxywasm.SetSharedData(key, data, cas); err != nil {
 		// If CAS mismatch, retry once with new CAS
-		if err == types.ErrorStatusCasMismatch {
-			_, newCas, _ := proxywasm.GetSharedData(key)
-			return proxywasm.SetSharedData(key, data, newCas)
+		if err != types.ErrorStatusCasMismatch {
+			return err
 		}
-		return err
+		_, newCas, _ := proxywasm.GetSharedData(key)
+		if err := proxywasm.SetSharedData(key, data, newCas); err != nil {
+			return err
+		}
+	}
+
+	// A ban that was already stored is already indexed, so refreshing it
+	// (e.g., on every sync from Redis) does not rewrite the index
+	if len(previous) > 0 {
+		return nil
 	}
 
+	id := entry.ID()
+	s.updateIndex(func(index []string) ([]string, bool) {
+		index, added, evicted := addToIndex(index, id, maxBanIndexSize)
+		if evicted > 0 {
+			s.logger.Warn("ban index full, %d oldest bans are no longer listed or swept", evicted)
+		}
+		return index, added
+	})
+
 	return nil
 }
 
 // DeleteBan removes a ban entry from the local cache.
 func (s *LocalBanStore) DeleteBan(fingerprint string) error {
-	key := BanKey(fingerprint)
+	key := s.keys.Ban(fingerprint)
 
 	// Set empty value to "delete" (shared-data doesn't have delete)
 	_, cas, _ := proxywasm.GetSharedData(key)
@@ -89,9 +151,136 @@ func (s *LocalBanStore) DeleteBan(fingerprint string) error {
 		s.logger.Debug("failed to delete local ban for %s: %v", fingerprint, err)
 		return err
 	}
+
+	s.removeFromIndex(fingerprint)
 	return nil
 }
 
+// ListBans returns all active bans tracked in the local ban index.
+// Expired entries encountered while listing are removed.
+func (s *LocalBanStore) ListBans() ([]*BanEntry, error) {
+	index, _, err := s.readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*BanEntry, 0, len(index))
+	for _, fingerprint := range index {
+		if entry, found := s.CheckBan(fingerprint); found {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// SweepExpired removes every expired ban tracked in the local ban index,
+// including bans of clients that never return. Stale index entries with
+// no ban behind them are pruned. Returns the number of bans expired.
+func (s *LocalBanStore) SweepExpired() int {
+	index, _, err := s.readIndex()
+	if err != nil {
+		s.logger.Error("failed to read ban index: %v", err)
+		return 0
+	}
+
+	expired := 0
+	for _, fingerprint := range index {
+		entry, cas := s.read(fingerprint)
+		switch {
+		case entry == nil:
+			s.removeFromIndex(fingerprint)
+		case entry.IsExpired():
+			if s.expire(entry, cas) {
+				expired++
+			}
+		}
+	}
+
+	return expired
+}
+
+// removeFromIndex drops a fingerprint from the ban index.
+func (s *LocalBanStore) removeFromIndex(fingerprint string) {
+	s.updateIndex(func(index []string) ([]string, bool) {
+		i := slices.Index(index, fingerprint)
+		if i < 0 {
+			return index, false
+		}
+		return slices.Delete(index, i, i+1), true
+	})
+}
+
+// addToIndex appends an ID to a ban index holding at most limit IDs,
+// evicting the oldest when full. Returns the index, whether it changed and
+// the number of evicted IDs.
+func addToIndex(index []string, id string, limit int) ([]string, bool, int) {
+	if slices.Contains(index, id) {
+		return index, false, 0
+	}
+
+	evicted := 0
+	if overflow := len(index) + 1 - limit; overflow > 0 {
+		evicted = overflow
+		index = index[overflow:]
+	}
+	return append(index, id), true, evicted
+}
+
+// readIndex reads the list of ban IDs from shared data.
+func (s *LocalBanStore) readIndex() ([]string, uint32, error) {
+	data, cas, err := proxywasm.GetSharedData(s.keys.BanIndex())
+	if err != nil {
+		if err == types.ErrorStatusNotFound {
+			return []string{}, 0, nil
+		}
+		return nil, 0, err
+	}
+
+	index := []string{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &index); err != nil {
+			s.logger.Error("failed to parse ban index: %v", err)
+			return []string{}, cas, nil
+		}
+	}
+	return index, cas, nil
+}
+
+// updateIndex applies a modification to the ban index using CAS. A CAS
+// mismatch means another worker updated the index, so the modification is
+// retried on the new index until it applies; modify returns false when
+// there is nothing to write.
+func (s *LocalBanStore) updateIndex(modify func([]string) ([]string, bool)) {
+	for {
+		index, cas, err := s.readIndex()
+		if err != nil {
+			s.logger.Error("ban index update dropped, failed to read ban index: %v", err)
+			return
+		}
+
+		index, changed := modify(index)
+		if !changed {
+			return
+		}
+
+		data, err := json.Marshal(index)
+		if err != nil {
+			s.logger.Error("ban index update dropped, failed to serialize ban index: %v", err)
+			return
+		}
+
+		err = proxywasm.SetSharedData(s.keys.BanIndex(), data, cas)
+		if err == nil {
+			return
+		}
+		if err != types.ErrorStatusCasMismatch {
+			s.logger.Error("ban index update dropped: %v", err)
+			return
+		}
+	}
+}
+
 // Compile-time interface verification
 var _ BanStore = (*LocalBanStore)(nil)
 
@@ -102,21 +291,23 @@ var _ BanStore = (*LocalBanStore)(nil)
 // LocalScoreStore implements ScoreStore using Envoy's shared-data mechanism.
 // It handles score storage, retrieval, and time-based decay.
 type LocalScoreStore struct {
-	logger       Logger
-	decaySeconds int
+	logger Logger
+	keys   *Keyspace
+	decay  *ScoreDecay
 }
 
-// NewLocalScoreStore creates a new local score store.
-func NewLocalScoreStore(logger Logger, decaySeconds int) *LocalScoreStore {
+// NewLocalScoreStore creates a new local score store with a decay curve.
+func NewLocalScoreStore(logger Logger, keys *Keyspace, decay *ScoreDecay) *LocalScoreStore {
 	return &LocalScoreStore{
-		logger:       logger,
-		decaySeconds: decaySeconds,
+		logger: logger,
+		keys:   keys,
+		decay:  decay,
 	}
 }
 
 // GetScore retrieves a score entry from local cache.
 func (s *LocalScoreStore) GetScore(fingerprint string) (*ScoreEntry, bool) {
-	key := ScoreKey(fingerprint)
+	key := s.keys.Score(fingerprint)
 
 	data, _, err := proxywasm.GetSharedData(key)
 	if err != nil {
@@ -141,7 +332,7 @@ func (s *LocalScoreStore) GetScore(fingerprint string) (*ScoreEntry, bool) {
 
 // SetScore stores a score entry in the local cache.
 func (s *LocalScoreStore) SetScore(entry *ScoreEntry) error {
-	key := ScoreKey(entry.Fingerprint)
+	key := s.keys.Score(entry.Fingerprint)
 
 	data, err := entry.ToJSON()
 	if err != nil {
@@ -162,19 +353,18 @@ func (s *LocalScoreStore) SetScore(entry *ScoreEntry) error {
 }
 
 // IncrScore atomically increments a score and returns the new value.
-// It also applies time-based decay before adding the increment.
-func (s *LocalScoreStore) IncrScore(fingerprint string, increment int) (int, error) {
+// It also applies time-based decay before adding the increment, and
+// records the rule hits.
+func (s *LocalScoreStore) IncrScore(fingerprint string, increment int, hits []RuleHit) (int, error) {
 	// Get existing score entry or create new one
 	entry, found := s.GetScore(fingerprint)
 	if !found {
 		entry = NewScoreEntry(fingerprint)
 	}
 
-	// Apply time-based decay
-	entry.DecayScore(s.decaySeconds)
-
-	// Add the increment
-	entry.Score += increment
+	// Apply time-based decay and add the increment
+	entry.Incr(increment, s.decay)
+	entry.RecordHits(hits)
 
 	// Save updated entry
 	if err := s.SetScore(entry); err != nil {
@@ -186,3 +376,361 @@ func (s *LocalScoreStore) IncrScore(fingerprint string, increment int) (int, err
 
 // Compile-time interface verification
 var _ ScoreStore = (*LocalScoreStore)(nil)
+
+// =============================================================================
+// Local Offense Store
+// =============================================================================
+
+// LocalOffenseStore implements OffenseStore using Envoy's shared-data
+// mechanism. Offense counts are forgotten once no ban has been issued
+// for the escalation window.
+type LocalOffenseStore struct {
+	logger        Logger
+	keys          *Keyspace
+	windowSeconds int
+}
+
+// NewLocalOffenseStore creates a new local offense store.
+func NewLocalOffenseStore(logger Logger, keys *Keyspace, windowSeconds int) *LocalOffenseStore {
+	return &LocalOffenseStore{
+		logger:        logger,
+		keys:          keys,
+		windowSeconds: windowSeconds,
+	}
+}
+
+// IncrOffenses records a new offense and returns the offense count.
+func (s *LocalOffenseStore) IncrOffenses(fingerprint string) (int, error) {
+	entry := s.get(fingerprint)
+	entry.Count++
+	return entry.Count, s.set(entry)
+}
+
+// GetOffenses returns the local offense count within the window.
+func (s *LocalOffenseStore) GetOffenses(fingerprint string) (int, error) {
+	return s.get(fingerprint).Count, nil
+}
+
+// SyncOffenses raises the local offense count to count if it is lower.
+func (s *LocalOffenseStore) SyncOffenses(fingerprint string, count int) error {
+	entry := s.get(fingerprint)
+	if entry.Count >= count {
+		return nil
+	}
+	entry.Count = count
+	return s.set(entry)
+}
+
+// get returns the current offense entry, or a fresh one if none exists
+// or the last offense is outside the window.
+func (s *LocalOffenseStore) get(fingerprint string) *OffenseEntry {
+	fresh := &OffenseEntry{Fingerprint: fingerprint}
+
+	data, _, err := proxywasm.GetSharedData(s.keys.Offense(fingerprint))
+	if err != nil {
+		if err != types.ErrorStatusNotFound {
+			s.logger.Error("failed to read offenses for %s: %v", fingerprint, err)
+		}
+		return fresh
+	}
+
+	if len(data) == 0 {
+		return fresh
+	}
+
+	entry, err := OffenseEntryFromJSON(data)
+	if err != nil {
+		s.logger.Error("failed to parse offense entry for %s: %v", fingerprint, err)
+		return fresh
+	}
+
+	if entry.IsExpired(s.windowSeconds) {
+		return fresh
+	}
+	return entry
+}
+
+// set stores an offense entry stamped with the current time.
+func (s *LocalOffenseStore) set(entry *OffenseEntry) error {
+	key := s.keys.Offense(entry.Fingerprint)
+	entry.LastOffense = time.Now().Unix()
+
+	data, err := entry.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	_, cas, _ := proxywasm.GetSharedData(key)
+
+	if err := proxywasm.SetSharedData(key, data, cas); err != nil {
+		if err == types.ErrorStatusCasMismatch {
+			_, newCas, _ := proxywasm.GetSharedData(key)
+			return proxywasm.SetSharedData(key, data, newCas)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Compile-time interface verification
+var _ OffenseStore = (*LocalOffenseStore)(nil)
+
+// =============================================================================
+// Local Rate Store
+// =============================================================================
+
+// LocalRateStore implements RateStore using Envoy's shared-data mechanism,
+// so that all workers share the request budget of a client.
+type LocalRateStore struct {
+	logger Logger
+	keys   *Keyspace
+}
+
+// NewLocalRateStore creates a new local rate store.
+func NewLocalRateStore(logger Logger, keys *Keyspace) *LocalRateStore {
+	return &LocalRateStore{
+		logger: logger,
+		keys:   keys,
+	}
+}
+
+// IncrRequests records a request and returns the request count of the
+// current window. A new window starts a minute after the previous one.
+func (s *LocalRateStore) IncrRequests(fingerprint string) (int, error) {
+	key := s.keys.Rate(fingerprint)
+	entry := &RateEntry{Fingerprint: fingerprint, WindowStart: time.Now().Unix()}
+
+	data, cas, err := proxywasm.GetSharedData(key)
+	if err != nil && err != types.ErrorStatusNotFound {
+		s.logger.Error("failed to read request rate for %s: %v", fingerprint, err)
+	}
+	if len(data) > 0 {
+		if current, err := RateEntryFromJSON(data); err != nil {
+			s.logger.Error("failed to parse rate entry for %s: %v", fingerprint, err)
+		} else if !current.IsExpired() {
+			entry = current
+		}
+	}
+
+	entry.Count++
+
+	data, err = entry.ToJSON()
+	if err != nil {
+		return entry.Count, err
+	}
+
+	if err := proxywasm.SetSharedData(key, data, cas); err != nil {
+		if err == types.ErrorStatusCasMismatch {
+			_, newCas, _ := proxywasm.GetSharedData(key)
+			return entry.Count, proxywasm.SetSharedData(key, data, newCas)
+		}
+		return entry.Count, err
+	}
+
+	return entry.Count, nil
+}
+
+// Compile-time interface verification
+var _ RateStore = (*LocalRateStore)(nil)
+
+// =============================================================================
+// Local Signal Store
+// =============================================================================
+
+// maxTrackedSignals caps the signal entries a worker tracks for the sweep.
+const maxTrackedSignals = 100000
+
+// LocalSignalStore implements SignalStore using Envoy's shared-data
+// mechanism, so that all workers count the signals of a client together.
+//
+// Shared data has no TTL or delete, so each worker tracks the entries it
+// wrote and SweepExpired, called from the plugin's OnTick, empties those
+// whose events no longer count.
+type LocalSignalStore struct {
+	logger  Logger
+	keys    *Keyspace
+	now     func() time.Time
+	tracked map[string]int // shared-data key -> window seconds
+}
+
+// NewLocalSignalStore creates a new local signal store.
+func NewLocalSignalStore(logger Logger, keys *Keyspace) *LocalSignalStore {
+	return &LocalSignalStore{
+		logger:  logger,
+		keys:    keys,
+		now:     time.Now,
+		tracked: make(map[string]int),
+	}
+}
+
+// IncrSignal records an event and returns the sliding-window event count.
+// A concurrent update from another worker is retried on the new entry, so
+// no event is lost.
+func (s *LocalSignalStore) IncrSignal(fingerprint, signal string, windowSeconds int) (int, error) {
+	key := s.keys.Signal(signal, fingerprint)
+	for {
+		entry, cas := s.get(key, fingerprint, signal)
+		count := entry.Add(s.now().Unix(), windowSeconds)
+
+		data, err := entry.ToJSON()
+		if err != nil {
+			return 0, err
+		}
+
+		err = proxywasm.SetSharedData(key, data, cas)
+		if err == nil {
+			s.track(key, windowSeconds)
+			return count, nil
+		}
+		if err != types.ErrorStatusCasMismatch {
+			return 0, err
+		}
+	}
+}
+
+// ResetSignal forgets the counted events by emptying the entry.
+func (s *LocalSignalStore) ResetSignal(fingerprint, signal string) error {
+	key := s.keys.Signal(signal, fingerprint)
+	for {
+		_, cas, err := proxywasm.GetSharedData(key)
+		if err == types.ErrorStatusNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = proxywasm.SetSharedData(key, []byte{}, cas)
+		if err == nil {
+			delete(s.tracked, key)
+			return nil
+		}
+		if err != types.ErrorStatusCasMismatch {
+			return err
+		}
+	}
+}
+
+// SweepExpired empties the tracked entries whose events no longer count.
+// Entries updated concurrently are left for the next sweep.
+func (s *LocalSignalStore) SweepExpired() int {
+	now := s.now().Unix()
+	swept := 0
+
+	for key, window := range s.tracked {
+		data, cas, err := proxywasm.GetSharedData(key)
+		if err != nil || len(data) == 0 {
+			delete(s.tracked, key)
+			continue
+		}
+
+		entry, err := SignalEntryFromJSON(data)
+		if err == nil && !entry.IsStale(now, window) {
+			continue
+		}
+
+		if err := proxywasm.SetSharedData(key, []byte{}, cas); err != nil {
+			continue
+		}
+		delete(s.tracked, key)
+		swept++
+	}
+
+	return swept
+}
+
+// track remembers an entry this worker wrote, for the sweep.
+func (s *LocalSignalStore) track(key string, windowSeconds int) {
+	if _, found := s.tracked[key]; !found && len(s.tracked) >= maxTrackedSignals {
+		s.logger.Warn("too many signal entries tracked, %s will not be swept", key)
+		return
+	}
+	s.tracked[key] = windowSeconds
+}
+
+// get returns the current signal entry and its CAS, or a fresh entry.
+func (s *LocalSignalStore) get(key, fingerprint, signal string) (*SignalEntry, uint32) {
+	fresh := &SignalEntry{Fingerprint: fingerprint, Signal: signal, WindowStart: s.now().Unix()}
+
+	data, cas, err := proxywasm.GetSharedData(key)
+	if err != nil && err != types.ErrorStatusNotFound {
+		s.logger.Error("failed to read %s signal for %s: %v", signal, fingerprint, err)
+	}
+	if len(data) == 0 {
+		return fresh, cas
+	}
+
+	entry, err := SignalEntryFromJSON(data)
+	if err != nil {
+		s.logger.Error("failed to parse %s signal entry for %s: %v", signal, fingerprint, err)
+		return fresh, cas
+	}
+	return entry, cas
+}
+
+// Compile-time interface verification
+var _ SignalStore = (*LocalSignalStore)(nil)
+
+// =============================================================================
+// Local Nonce Store
+// =============================================================================
+
+// LocalNonceStore implements NonceStore using Envoy's shared-data
+// mechanism, so that a nonce redeemed on one worker is rejected by all.
+// Nonces are kept per fingerprint and forgotten once expired.
+type LocalNonceStore struct {
+	logger Logger
+	keys   *Keyspace
+	now    func() time.Time
+}
+
+// NewLocalNonceStore creates a new local nonce store.
+func NewLocalNonceStore(logger Logger, keys *Keyspace) *LocalNonceStore {
+	return &LocalNonceStore{
+		logger: logger,
+		keys:   keys,
+		now:    time.Now,
+	}
+}
+
+// UseNonce records a nonce unless it was already used. A concurrent update
+// from another worker is retried on the new entry, so two workers cannot
+// both accept the same nonce.
+func (s *LocalNonceStore) UseNonce(fingerprint, nonce string, expiresAt int64) (bool, error) {
+	key := s.keys.Nonce(fingerprint)
+	for {
+		entry := &NonceEntry{Fingerprint: fingerprint}
+
+		data, cas, err := proxywasm.GetSharedData(key)
+		if err != nil && err != types.ErrorStatusNotFound {
+			return false, err
+		}
+		if len(data) > 0 {
+			if entry, err = NonceEntryFromJSON(data); err != nil {
+				s.logger.Error("failed to parse nonce entry for %s: %v", fingerprint, err)
+				entry = &NonceEntry{Fingerprint: fingerprint}
+			}
+		}
+
+		if !entry.Use(nonce, expiresAt, s.now().Unix()) {
+			return false, nil
+		}
+
+		data, err = entry.ToJSON()
+		if err != nil {
+			return false, err
+		}
+
+		err = proxywasm.SetSharedData(key, data, cas)
+		if err == nil {
+			return true, nil
+		}
+		if err != types.ErrorStatusCasMismatch {
+			return false, err
+		}
+	}
+}
+
+// Compile-time interface verification
+var _ NonceStore = (*LocalNonceStore)(nil)
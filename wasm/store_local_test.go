@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestAddToIndex(t *testing.T) {
+	index, added, evicted := addToIndex([]string{"a", "b"}, "c", 3)
+	if !added || evicted != 0 || len(index) != 3 || index[2] != "c" {
+		t.Errorf("unexpected index: %v added=%v evicted=%d", index, added, evicted)
+	}
+
+	// Indexed IDs are not written again
+	if _, added, _ := addToIndex(index, "b", 3); added {
+		t.Error("expected no change for an indexed ID")
+	}
+
+	// A full index evicts the oldest IDs
+	index, added, evicted = addToIndex(index, "d", 3)
+	if !added || evicted != 1 || len(index) != 3 || index[0] != "b" || index[2] != "d" {
+		t.Errorf("unexpected full index: %v added=%v evicted=%d", index, added, evicted)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"math"
 	"strings"
 	"time"
 )
@@ -10,10 +11,24 @@ import (
 // Ban Types
 // =============================================================================
 
+// Ban scope constants
+const (
+	BanScopeGlobal = "global"
+	BanScopeHost   = "host"
+	BanScopePath   = "path"
+)
+
+// banIDSeparator separates the fingerprint from the scope hash in the ID
+// of a scoped ban. Fingerprints are hex, so the separator is unambiguous.
+const banIDSeparator = "~"
+
 // BanEntry represents a ban record stored in cache or Redis.
 // It contains all information about why a client was banned and when the ban expires.
+// Scope limits a ban to one host ("host:<host>") or one path prefix of a
+// host ("path:<host><prefix>"); bans without a scope apply everywhere.
 type BanEntry struct {
 	Fingerprint string `json:"fingerprint"`
+	Scope       string `json:"scope,omitempty"`
 	Reason      string `json:"reason"`
 	RuleID      string `json:"rule_id"`
 	Severity    string `json:"severity"`
@@ -21,6 +36,18 @@ type BanEntry struct {
 	ExpiresAt   int64  `json:"expires_at"`
 	TTL         int    `json:"ttl"`
 	Score       int    `json:"score,omitempty"`
+	Offenses    int    `json:"offenses,omitempty"`
+
+	// Tags are the tags of the rule, which may set the ban TTL
+	Tags []string `json:"tags,omitempty"`
+
+	// Rules lists every rule matched by the request that caused the ban,
+	// when it matched several
+	Rules []string `json:"rules,omitempty"`
+
+	// Synced marks a local copy of a ban read from Redis; its expiry is
+	// reported by the instance that issued it
+	Synced bool `json:"synced,omitempty"`
 }
 
 // NewBanEntry creates a new ban entry with the given parameters.
@@ -37,6 +64,11 @@ func NewBanEntry(fingerprint, reason, ruleID, severity string, ttl int) *BanEntr
 	}
 }
 
+// ID returns the ID the ban is stored under.
+func (b *BanEntry) ID() string {
+	return BanID(b.Fingerprint, b.Scope)
+}
+
 // IsExpired returns true if the ban has expired.
 func (b *BanEntry) IsExpired() bool {
 	return time.Now().Unix() > b.ExpiresAt
@@ -56,6 +88,51 @@ func BanEntryFromJSON(data []byte) (*BanEntry, error) {
 	return &entry, nil
 }
 
+// BanID returns the ID of a ban: the fingerprint for global bans, or the
+// fingerprint followed by a hash of the scope, so that the IDs of scoped
+// bans stay short and URL-safe for the admin API.
+func BanID(fingerprint, scope string) string {
+	if scope == "" {
+		return fingerprint
+	}
+	return fingerprint + banIDSeparator + sha256Hash(scope)[:16]
+}
+
+// BanIDFingerprint returns the fingerprint of a ban ID.
+func BanIDFingerprint(id string) string {
+	fingerprint, _, _ := strings.Cut(id, banIDSeparator)
+	return fingerprint
+}
+
+// RequestScopes holds the scopes a request falls into besides global.
+type RequestScopes struct {
+	// Host is the host scope (e.g., "host:app.example.com")
+	Host string
+	// Path is the path scope (e.g., "path:app.example.com/api")
+	Path string
+}
+
+// NewRequestScopes builds the scopes of a request from its host and the
+// path prefix bans are scoped to.
+func NewRequestScopes(host, pathPrefix string) *RequestScopes {
+	return &RequestScopes{
+		Host: BanScopeHost + ":" + host,
+		Path: BanScopePath + ":" + host + pathPrefix,
+	}
+}
+
+// Scope returns the scope of a request for a scope type ("" for global).
+func (r *RequestScopes) Scope(scopeType string) string {
+	switch scopeType {
+	case BanScopeHost:
+		return r.Host
+	case BanScopePath:
+		return r.Path
+	default:
+		return ""
+	}
+}
+
 // =============================================================================
 // Score Types
 // =============================================================================
@@ -77,6 +154,9 @@ type RuleHit struct {
 	Timestamp int64  `json:"timestamp"`
 }
 
+// MaxRuleHits is the number of most recent rule hits kept per score entry.
+const MaxRuleHits = 20
+
 // NewScoreEntry creates a new score entry for a fingerprint.
 func NewScoreEntry(fingerprint string) *ScoreEntry {
 	return &ScoreEntry{
@@ -100,24 +180,45 @@ func (s *ScoreEntry) AddScore(ruleID, severity string, score int) {
 	})
 }
 
+// RecordHits records rule hits, keeping the MaxRuleHits most recent.
+func (s *ScoreEntry) RecordHits(hits []RuleHit) {
+	s.RuleHits = append(s.RuleHits, hits...)
+	if len(s.RuleHits) > MaxRuleHits {
+		s.RuleHits = s.RuleHits[len(s.RuleHits)-MaxRuleHits:]
+	}
+}
+
 // DecayScore applies time-based score decay.
 // The score decreases by 1 point for each decay interval that has passed.
 func (s *ScoreEntry) DecayScore(decaySeconds int) {
-	if decaySeconds <= 0 {
+	s.ApplyDecay(&ScoreDecay{Strategy: ScoreDecayLinear, IntervalSeconds: decaySeconds, Rate: 1})
+}
+
+// ApplyDecay decays the score along a decay curve up to now.
+// LastUpdated only advances by the time the decay accounts for, so that
+// frequent updates do not lose the progress toward the next point.
+func (s *ScoreEntry) ApplyDecay(decay *ScoreDecay) {
+	now := time.Now().Unix()
+	score, consumed := decay.Decay(s.Score, now-s.LastUpdated)
+	if consumed == 0 {
 		return
 	}
 
-	now := time.Now().Unix()
-	elapsed := now - s.LastUpdated
-
-	// Decay 1 point per decaySeconds interval
-	decay := int(elapsed / int64(decaySeconds))
-	if decay > 0 {
-		s.Score -= decay
-		if s.Score < 0 {
-			s.Score = 0
-		}
+	s.Score = score
+	if score == 0 {
 		s.LastUpdated = now
+	} else {
+		s.LastUpdated += consumed
+	}
+}
+
+// Incr decays the score up to now and adds an increment. With step decay
+// the increment restarts the quiet period.
+func (s *ScoreEntry) Incr(increment int, decay *ScoreDecay) {
+	s.ApplyDecay(decay)
+	s.Score += increment
+	if decay.Strategy == ScoreDecayStep {
+		s.LastUpdated = time.Now().Unix()
 	}
 }
 
@@ -135,6 +236,203 @@ func ScoreEntryFromJSON(data []byte) (*ScoreEntry, error) {
 	return &entry, nil
 }
 
+// Score decay strategy constants
+const (
+	ScoreDecayLinear      = "linear"
+	ScoreDecayExponential = "exponential"
+	ScoreDecayStep        = "step"
+)
+
+// ScoreDecay is a decay curve for behavioral scores.
+//
+//	"linear"      = lose Rate points per IntervalSeconds
+//	"exponential" = lose half the score per HalfLifeSeconds
+//	"step"        = keep the score until IntervalSeconds without activity,
+//	                then drop it to 0
+type ScoreDecay struct {
+	Strategy        string
+	IntervalSeconds int
+	Rate            int
+	HalfLifeSeconds int
+}
+
+// Decay returns a score after elapsed seconds, and the seconds the decay
+// accounts for: the decay of whole points may leave part of the elapsed
+// time unused. Scores are whole points; an exponential score is dropped
+// once it falls below half a point.
+func (d *ScoreDecay) Decay(score int, elapsed int64) (int, int64) {
+	if elapsed <= 0 {
+		return score, 0
+	}
+	if score <= 0 {
+		return 0, elapsed
+	}
+
+	switch d.Strategy {
+	case ScoreDecayExponential:
+		if d.HalfLifeSeconds <= 0 {
+			return score, 0
+		}
+		halfLife := float64(d.HalfLifeSeconds)
+		exact := float64(score) * math.Exp2(-float64(elapsed)/halfLife)
+		if exact < 0.5 {
+			return 0, elapsed
+		}
+		decayed := int(math.Ceil(exact))
+		if decayed >= score {
+			return score, 0
+		}
+		// Time at which the curve reached the decayed score
+		return decayed, int64(halfLife * math.Log2(float64(score)/float64(decayed)))
+
+	case ScoreDecayStep:
+		if d.IntervalSeconds <= 0 || elapsed < int64(d.IntervalSeconds) {
+			return score, 0
+		}
+		return 0, elapsed
+
+	default:
+		if d.IntervalSeconds <= 0 || d.Rate <= 0 {
+			return score, 0
+		}
+		intervals := elapsed / int64(d.IntervalSeconds)
+		decayed := score - int(intervals)*d.Rate
+		if decayed <= 0 {
+			return 0, elapsed
+		}
+		return decayed, intervals * int64(d.IntervalSeconds)
+	}
+}
+
+// =============================================================================
+// Offense Types
+// =============================================================================
+
+// OffenseEntry counts how many times a fingerprint has been banned.
+// The count is forgotten once no ban has been issued for the window.
+type OffenseEntry struct {
+	Fingerprint string `json:"fingerprint"`
+	Count       int    `json:"count"`
+	LastOffense int64  `json:"last_offense"`
+}
+
+// IsExpired returns true if the last offense is older than the window.
+func (o *OffenseEntry) IsExpired(windowSeconds int) bool {
+	return time.Now().Unix()-o.LastOffense > int64(windowSeconds)
+}
+
+// ToJSON serializes the offense entry to JSON.
+func (o *OffenseEntry) ToJSON() ([]byte, error) {
+	return json.Marshal(o)
+}
+
+// OffenseEntryFromJSON deserializes an offense entry from JSON.
+func OffenseEntryFromJSON(data []byte) (*OffenseEntry, error) {
+	var entry OffenseEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// =============================================================================
+// Rate Types
+// =============================================================================
+
+// rateWindowSeconds is the length of a rate-limit window.
+const rateWindowSeconds = 60
+
+// RateEntry counts the requests of a rate-limited client in the current
+// one-minute window.
+type RateEntry struct {
+	Fingerprint string `json:"fingerprint"`
+	Count       int    `json:"count"`
+	WindowStart int64  `json:"window_start"`
+}
+
+// IsExpired returns true if the entry belongs to a past window.
+func (r *RateEntry) IsExpired() bool {
+	return time.Now().Unix()-r.WindowStart >= rateWindowSeconds
+}
+
+// ToJSON serializes the rate entry to JSON.
+func (r *RateEntry) ToJSON() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// RateEntryFromJSON deserializes a rate entry from JSON.
+func RateEntryFromJSON(data []byte) (*RateEntry, error) {
+	var entry RateEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// =============================================================================
+// Signal Types
+// =============================================================================
+
+// SignalEntry counts the events of a signal for a fingerprint. Counts are
+// kept for the current and the previous window to estimate the count over
+// a sliding window.
+type SignalEntry struct {
+	Fingerprint string `json:"fingerprint"`
+	Signal      string `json:"signal"`
+	Count       int    `json:"count"`
+	PrevCount   int    `json:"prev_count"`
+	WindowStart int64  `json:"window_start"`
+}
+
+// Add records an event at now and returns the event count over the last
+// windowSeconds. The previous window counts in proportion to its overlap
+// with the sliding window.
+func (e *SignalEntry) Add(now int64, windowSeconds int) int {
+	window := int64(windowSeconds)
+	elapsed := now - e.WindowStart
+
+	switch {
+	case window <= 0 || elapsed >= 2*window || elapsed < 0:
+		e.Count, e.PrevCount, e.WindowStart, elapsed = 0, 0, now, 0
+	case elapsed >= window:
+		e.PrevCount, e.Count = e.Count, 0
+		e.WindowStart += window
+		elapsed -= window
+	}
+
+	e.Count++
+
+	if window <= 0 {
+		return e.Count
+	}
+	return e.Count + int(int64(e.PrevCount)*(window-elapsed)/window)
+}
+
+// Reset forgets the counted events, starting a new window at now.
+func (e *SignalEntry) Reset(now int64) {
+	e.Count, e.PrevCount, e.WindowStart = 0, 0, now
+}
+
+// IsStale returns true once the counted events no longer count over a
+// sliding window of windowSeconds, so the entry can be dropped.
+func (e *SignalEntry) IsStale(now int64, windowSeconds int) bool {
+	return windowSeconds <= 0 || now-e.WindowStart >= 2*int64(windowSeconds)
+}
+
+// ToJSON serializes the signal entry to JSON.
+func (e *SignalEntry) ToJSON() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// SignalEntryFromJSON deserializes a signal entry from JSON.
+func SignalEntryFromJSON(data []byte) (*SignalEntry, error) {
+	var entry SignalEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
 // =============================================================================
 // WAF Metadata Types
 // =============================================================================
@@ -159,6 +457,103 @@ type CorazaMetadata struct {
 
 	// Tags contains rule tags (e.g., ["OWASP_CRS", "attack-sqli"])
 	Tags []string `json:"tags"`
+
+	// Rules lists every rule matched by the request, when available
+	// The fields above then describe the rule that decided the action
+	Rules []MatchedRule `json:"rules"`
+
+	// InboundAnomalyScore is the CRS anomaly score of the request
+	InboundAnomalyScore int `json:"inbound_anomaly_score"`
+
+	// OutboundAnomalyScore is the CRS anomaly score of the response
+	OutboundAnomalyScore int `json:"outbound_anomaly_score"`
+
+	// ParanoiaLevel is the CRS paranoia level the request was evaluated at
+	ParanoiaLevel int `json:"paranoia_level"`
+}
+
+// HasDetection returns true if the WAF reported a rule match or an
+// anomaly score.
+func (m *CorazaMetadata) HasDetection() bool {
+	return m.RuleID != "" || len(m.Rules) > 0 || m.AnomalyScore() > 0
+}
+
+// AnomalyScore returns the CRS anomaly score of the transaction.
+func (m *CorazaMetadata) AnomalyScore() int {
+	return m.InboundAnomalyScore + m.OutboundAnomalyScore
+}
+
+// MatchedRule is a WAF rule matched by a request.
+type MatchedRule struct {
+	RuleID   string   `json:"rule_id"`
+	Severity string   `json:"severity"`
+	Message  string   `json:"message"`
+	Tags     []string `json:"tags"`
+}
+
+// MatchedRules returns the rules matched by the request: the rules list
+// or, without one, the single rule of the metadata. The CRS anomaly
+// evaluation rules (949xxx, 959xxx, 980xxx), which only report that the
+// anomaly threshold was reached, are left out when other rules matched.
+func (m *CorazaMetadata) MatchedRules() []MatchedRule {
+	if len(m.Rules) == 0 {
+		return []MatchedRule{{RuleID: m.RuleID, Severity: m.Severity, Message: m.Message, Tags: m.Tags}}
+	}
+
+	rules := make([]MatchedRule, 0, len(m.Rules))
+	for _, rule := range m.Rules {
+		if !isEvaluationRule(rule.RuleID) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return m.Rules
+	}
+	return rules
+}
+
+// setRules sets the matched rules. A single rule is set as the rule of
+// the metadata; with several rules, the last one (e.g., the CRS anomaly
+// evaluation rule) is assumed to have decided the action.
+func (m *CorazaMetadata) setRules(rules []MatchedRule) {
+	if len(rules) == 0 {
+		return
+	}
+
+	last := rules[len(rules)-1]
+	m.RuleID, m.Severity, m.Message, m.Tags = last.RuleID, last.Severity, last.Message, last.Tags
+	if len(rules) > 1 {
+		m.Rules = rules
+	}
+}
+
+// isEvaluationRule returns true for the rule IDs of the CRS blocking
+// evaluation and correlation rule files.
+func isEvaluationRule(ruleID string) bool {
+	if len(ruleID) != 6 {
+		return false
+	}
+	switch ruleID[:3] {
+	case "949", "959", "980":
+		return true
+	default:
+		return false
+	}
+}
+
+// Category returns the attack category of the rule: its first "attack-*"
+// tag, else the CRS rule file of its ID (e.g., "942" for SQL injection),
+// else the rule ID itself.
+func (r *MatchedRule) Category() string {
+	for _, tag := range r.Tags {
+		if strings.HasPrefix(tag, "attack-") {
+			return tag
+		}
+	}
+	if len(r.RuleID) == 6 && strings.Trim(r.RuleID, "0123456789") == "" {
+		return r.RuleID[:3]
+	}
+	return r.RuleID
 }
 
 // IsBlocked returns true if the WAF action indicates a blocked request.
@@ -171,22 +566,161 @@ func (m *CorazaMetadata) IsBlocked() bool {
 	}
 }
 
+// =============================================================================
+// Nonce Entry
+// =============================================================================
+
+// maxNoncesPerFingerprint caps the unexpired nonces recorded for a client.
+const maxNoncesPerFingerprint = 100
+
+// NonceEntry records the challenge nonces a client has redeemed, so that a
+// solved challenge cannot be replayed before its nonce expires.
+type NonceEntry struct {
+	Fingerprint string           `json:"fingerprint"`
+	Used        map[string]int64 `json:"used"` // nonce -> expiry
+}
+
+// Use records a nonce expiring at expiresAt and forgets expired ones.
+// Returns false if the nonce was already used, or if the client has too
+// many unexpired nonces to record another.
+func (n *NonceEntry) Use(nonce string, expiresAt, now int64) bool {
+	if n.Used == nil {
+		n.Used = make(map[string]int64)
+	}
+	for used, expiry := range n.Used {
+		if now > expiry {
+			delete(n.Used, used)
+		}
+	}
+
+	if _, found := n.Used[nonce]; found || len(n.Used) >= maxNoncesPerFingerprint {
+		return false
+	}
+	n.Used[nonce] = expiresAt
+	return true
+}
+
+// ToJSON serializes the nonce entry to JSON.
+func (n *NonceEntry) ToJSON() ([]byte, error) {
+	return json.Marshal(n)
+}
+
+// NonceEntryFromJSON deserializes a nonce entry from JSON.
+func NonceEntryFromJSON(data []byte) (*NonceEntry, error) {
+	var entry NonceEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
 // =============================================================================
 // Key Helpers
 // =============================================================================
 
 // Key prefixes for shared data and Redis storage
 const (
-	banKeyPrefix   = "ban:"
-	scoreKeyPrefix = "score:"
+	banKeyPrefix     = "ban:"
+	scoreKeyPrefix   = "score:"
+	offenseKeyPrefix = "offense:"
+	rateKeyPrefix    = "rate:"
+	signalKeyPrefix  = "signal:"
+	nonceKeyPrefix   = "nonce:"
+
+	// clusterScoreKeyPrefix holds the cluster-wide scores decayed in
+	// Redis, a hash of the score and its last update
+	clusterScoreKeyPrefix = "cluster-score:"
+
+	// banIndexKey holds the list of banned fingerprints in shared data,
+	// since shared data cannot be enumerated.
+	banIndexKey = "ban-index"
 )
 
-// BanKey returns the storage key for a fingerprint ban.
-func BanKey(fingerprint string) string {
-	return banKeyPrefix + fingerprint
+// BanKey returns the storage key for a ban ID (see BanID). The key of a
+// global ban is the fingerprint key; scoped bans include the scope hash.
+func BanKey(id string) string {
+	return banKeyPrefix + id
 }
 
 // ScoreKey returns the storage key for a fingerprint score.
 func ScoreKey(fingerprint string) string {
 	return scoreKeyPrefix + fingerprint
 }
+
+// OffenseKey returns the storage key for a fingerprint offense counter.
+func OffenseKey(fingerprint string) string {
+	return offenseKeyPrefix + fingerprint
+}
+
+// RateKey returns the storage key for a fingerprint request counter.
+func RateKey(fingerprint string) string {
+	return rateKeyPrefix + fingerprint
+}
+
+// ClusterScoreKey returns the storage key for a fingerprint cluster-wide score.
+func ClusterScoreKey(fingerprint string) string {
+	return clusterScoreKeyPrefix + fingerprint
+}
+
+// SignalKey returns the storage key for a fingerprint signal counter.
+func SignalKey(signal, fingerprint string) string {
+	return signalKeyPrefix + signal + ":" + fingerprint
+}
+
+// Keyspace builds namespaced storage keys so that several gateways or
+// tenants can share one Redis (or one Envoy VM's shared data) without
+// colliding. The prefix is prepended to every ban and score key.
+type Keyspace struct {
+	prefix string
+}
+
+// NewKeyspace creates a keyspace with the given prefix (e.g., "cbw:prod:gw1:").
+func NewKeyspace(prefix string) *Keyspace {
+	return &Keyspace{prefix: prefix}
+}
+
+// Ban returns the namespaced key for a ban ID.
+func (k *Keyspace) Ban(id string) string {
+	return k.prefix + BanKey(id)
+}
+
+// Score returns the namespaced key for a fingerprint score.
+func (k *Keyspace) Score(fingerprint string) string {
+	return k.prefix + ScoreKey(fingerprint)
+}
+
+// ClusterScore returns the namespaced key for a fingerprint cluster-wide score.
+func (k *Keyspace) ClusterScore(fingerprint string) string {
+	return k.prefix + ClusterScoreKey(fingerprint)
+}
+
+// Offense returns the namespaced key for a fingerprint offense counter.
+func (k *Keyspace) Offense(fingerprint string) string {
+	return k.prefix + OffenseKey(fingerprint)
+}
+
+// Rate returns the namespaced key for a fingerprint request counter.
+func (k *Keyspace) Rate(fingerprint string) string {
+	return k.prefix + RateKey(fingerprint)
+}
+
+// Signal returns the namespaced key for a fingerprint signal counter.
+func (k *Keyspace) Signal(signal, fingerprint string) string {
+	return k.prefix + SignalKey(signal, fingerprint)
+}
+
+// Nonce returns the namespaced key for the redeemed challenge nonces of a
+// fingerprint.
+func (k *Keyspace) Nonce(fingerprint string) string {
+	return k.prefix + nonceKeyPrefix + fingerprint
+}
+
+// Stream returns the namespaced key of a Redis stream.
+func (k *Keyspace) Stream(name string) string {
+	return k.prefix + name
+}
+
+// BanIndex returns the namespaced key of the local ban index.
+func (k *Keyspace) BanIndex() string {
+	return k.prefix + banIndexKey
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -347,3 +349,206 @@ func TestRuleHit_Struct(t *testing.T) {
 		t.Errorf("expected Score=50, got %d", hit.Score)
 	}
 }
+
+func TestBanID(t *testing.T) {
+	if id := BanID("abc123", ""); id != "abc123" {
+		t.Errorf("global ban ID should be the fingerprint, got %s", id)
+	}
+
+	hostID := BanID("abc123", "host:a.example.com")
+	if hostID == "abc123" || !strings.HasPrefix(hostID, "abc123"+banIDSeparator) {
+		t.Errorf("unexpected scoped ban ID %s", hostID)
+	}
+	if hostID == BanID("abc123", "host:b.example.com") {
+		t.Error("scopes should produce distinct IDs")
+	}
+	if fingerprint := BanIDFingerprint(hostID); fingerprint != "abc123" {
+		t.Errorf("expected fingerprint abc123, got %s", fingerprint)
+	}
+
+	entry := NewBanEntry("abc123", "reason", "rule", "high", 600)
+	entry.Scope = "host:a.example.com"
+	if entry.ID() != hostID {
+		t.Errorf("entry ID %s should match %s", entry.ID(), hostID)
+	}
+}
+
+func TestRequestScopes_Scope(t *testing.T) {
+	scopes := NewRequestScopes("a.example.com", "/api")
+
+	tests := map[string]string{
+		BanScopeGlobal: "",
+		BanScopeHost:   "host:a.example.com",
+		BanScopePath:   "path:a.example.com/api",
+	}
+	for scopeType, expected := range tests {
+		if got := scopes.Scope(scopeType); got != expected {
+			t.Errorf("Scope(%s) = %q, want %q", scopeType, got, expected)
+		}
+	}
+}
+
+func TestSignalEntry_Add_SlidingWindow(t *testing.T) {
+	entry := &SignalEntry{Fingerprint: "fp", Signal: SignalNotFound, WindowStart: 1000}
+
+	for i := 0; i < 10; i++ {
+		entry.Add(1010, 60)
+	}
+	if count := entry.Add(1030, 60); count != 11 {
+		t.Errorf("expected 11 events in the current window, got %d", count)
+	}
+
+	// Halfway through the next window, half the previous events count
+	if count := entry.Add(1090, 60); count != 1+11/2 {
+		t.Errorf("expected %d events over the sliding window, got %d", 1+11/2, count)
+	}
+
+	// Two windows later, everything is forgotten
+	if count := entry.Add(1300, 60); count != 1 {
+		t.Errorf("expected the window to restart, got %d", count)
+	}
+
+	entry.Reset(1300)
+	if entry.Count != 0 || entry.PrevCount != 0 {
+		t.Errorf("reset should forget events, got %+v", entry)
+	}
+
+	if entry.IsStale(1419, 60) || !entry.IsStale(1420, 60) {
+		t.Error("entry should be stale two windows after it started")
+	}
+}
+
+func TestNonceEntry_Use(t *testing.T) {
+	entry := &NonceEntry{Fingerprint: "fp"}
+
+	if !entry.Use("1300.abc", 1300, 1000) {
+		t.Fatal("expected a new nonce to be accepted")
+	}
+	if entry.Use("1300.abc", 1300, 1100) {
+		t.Error("expected a used nonce to be rejected")
+	}
+
+	// Expired nonces are forgotten
+	entry.Use("1400.def", 1400, 1100)
+	if !entry.Use("1500.ghi", 1500, 1350) || len(entry.Used) != 2 {
+		t.Errorf("expected the expired nonce to be forgotten, got %v", entry.Used)
+	}
+
+	for i := len(entry.Used); i < maxNoncesPerFingerprint; i++ {
+		entry.Use(strconv.Itoa(i), 2000, 1350)
+	}
+	if entry.Use("full", 2000, 1350) {
+		t.Error("expected a nonce to be rejected once the entry is full")
+	}
+}
+
+func TestScoreDecay_Decay(t *testing.T) {
+	tests := []struct {
+		name             string
+		decay            ScoreDecay
+		score            int
+		elapsed          int64
+		expectedScore    int
+		expectedConsumed int64
+	}{
+		{"linear", ScoreDecay{Strategy: ScoreDecayLinear, IntervalSeconds: 60, Rate: 5}, 100, 150, 90, 120},
+		{"linear to zero", ScoreDecay{Strategy: ScoreDecayLinear, IntervalSeconds: 60, Rate: 5}, 8, 150, 0, 150},
+		{"linear before interval", ScoreDecay{Strategy: ScoreDecayLinear, IntervalSeconds: 60, Rate: 5}, 100, 59, 100, 0},
+		{"exponential half-life", ScoreDecay{Strategy: ScoreDecayExponential, HalfLifeSeconds: 600}, 500, 600, 250, 600},
+		{"exponential two half-lives", ScoreDecay{Strategy: ScoreDecayExponential, HalfLifeSeconds: 600}, 500, 1200, 125, 1200},
+		{"exponential below a point", ScoreDecay{Strategy: ScoreDecayExponential, HalfLifeSeconds: 600}, 5, 3000, 0, 3000},
+		{"exponential partial point", ScoreDecay{Strategy: ScoreDecayExponential, HalfLifeSeconds: 600}, 5, 1, 5, 0},
+		{"step quiet period", ScoreDecay{Strategy: ScoreDecayStep, IntervalSeconds: 3600}, 500, 3599, 500, 0},
+		{"step reset", ScoreDecay{Strategy: ScoreDecayStep, IntervalSeconds: 3600}, 500, 3600, 0, 3600},
+		{"zero score", ScoreDecay{Strategy: ScoreDecayLinear, IntervalSeconds: 60, Rate: 1}, 0, 3600, 0, 3600},
+	}
+
+	for _, tt := range tests {
+		score, consumed := tt.decay.Decay(tt.score, tt.elapsed)
+		if score != tt.expectedScore || consumed != tt.expectedConsumed {
+			t.Errorf("%s: expected (%d, %d), got (%d, %d)",
+				tt.name, tt.expectedScore, tt.expectedConsumed, score, consumed)
+		}
+	}
+}
+
+func TestScoreEntry_Incr_KeepsDecayProgress(t *testing.T) {
+	decay := &ScoreDecay{Strategy: ScoreDecayLinear, IntervalSeconds: 60, Rate: 1}
+	start := time.Now().Unix() - 90
+
+	entry := &ScoreEntry{Fingerprint: "test-fp", Score: 100, LastUpdated: start}
+	entry.Incr(10, decay)
+
+	if entry.Score != 109 {
+		t.Errorf("expected Score=109, got %d", entry.Score)
+	}
+	// The 30 seconds past the last whole interval count toward the next one
+	if entry.LastUpdated != start+60 {
+		t.Errorf("expected LastUpdated to advance by one interval, got %d", entry.LastUpdated-start)
+	}
+}
+
+func TestScoreEntry_Incr_StepRestartsQuietPeriod(t *testing.T) {
+	decay := &ScoreDecay{Strategy: ScoreDecayStep, IntervalSeconds: 3600}
+	now := time.Now().Unix()
+
+	entry := &ScoreEntry{Fingerprint: "test-fp", Score: 100, LastUpdated: now - 1800}
+	entry.Incr(10, decay)
+
+	if entry.Score != 110 {
+		t.Errorf("expected Score=110 within the quiet period, got %d", entry.Score)
+	}
+	if entry.LastUpdated < now {
+		t.Error("activity should restart the quiet period")
+	}
+}
+
+func TestCorazaMetadata_MatchedRules(t *testing.T) {
+	single := &CorazaMetadata{Action: "block", RuleID: "930120", Severity: "high"}
+	if rules := single.MatchedRules(); len(rules) != 1 || rules[0].RuleID != "930120" {
+		t.Errorf("expected the metadata rule, got %+v", rules)
+	}
+
+	multiple := &CorazaMetadata{Action: "block", Rules: []MatchedRule{
+		{RuleID: "942100"}, {RuleID: "941100"}, {RuleID: "949110"}, {RuleID: "980130"},
+	}}
+	if rules := multiple.MatchedRules(); len(rules) != 2 || rules[1].RuleID != "941100" {
+		t.Errorf("expected evaluation rules to be left out, got %+v", rules)
+	}
+
+	evaluationOnly := &CorazaMetadata{Action: "block", Rules: []MatchedRule{{RuleID: "949110"}, {RuleID: "980130"}}}
+	if rules := evaluationOnly.MatchedRules(); len(rules) != 2 {
+		t.Errorf("expected evaluation rules without other rules, got %+v", rules)
+	}
+}
+
+func TestMatchedRule_Category(t *testing.T) {
+	tests := []struct {
+		rule     MatchedRule
+		expected string
+	}{
+		{MatchedRule{RuleID: "942100", Tags: []string{"OWASP_CRS", "attack-sqli"}}, "attack-sqli"},
+		{MatchedRule{RuleID: "942100"}, "942"},
+		{MatchedRule{RuleID: "custom-1"}, "custom-1"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.rule.Category(); got != tt.expected {
+			t.Errorf("Category(%+v) = %q, expected %q", tt.rule, got, tt.expected)
+		}
+	}
+}
+
+func TestScoreEntry_RecordHits(t *testing.T) {
+	entry := NewScoreEntry("test-fingerprint")
+	for i := 0; i < MaxRuleHits+5; i++ {
+		entry.RecordHits([]RuleHit{{RuleID: strconv.Itoa(i)}})
+	}
+
+	if len(entry.RuleHits) != MaxRuleHits {
+		t.Fatalf("expected %d rule hits, got %d", MaxRuleHits, len(entry.RuleHits))
+	}
+	if entry.RuleHits[0].RuleID != "5" {
+		t.Errorf("expected oldest hits to be dropped, got %s", entry.RuleHits[0].RuleID)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"net/netip"
+	"path"
 	"strings"
 	"time"
 )
@@ -81,3 +83,150 @@ func generateCookieValue() string {
 	input := fmt.Sprintf("%d-%d-%d", timestamp, timestamp%1000000007, timestamp%999999937)
 	return sha256Hash(input)[:16] // Use first 16 chars
 }
+
+// parsePrefixes parses a list of CIDR strings into network prefixes.
+// Bare IP addresses are accepted and treated as single-host prefixes
+// (/32 for IPv4, /128 for IPv6).
+func parsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP %q", cidr)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", cidr)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// parseClientAddr parses a client IP string, unmapping IPv4-mapped IPv6
+// addresses so they match IPv4 prefixes.
+func parseClientAddr(ip string) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// prefixesContain returns true if the IP address falls within any of the prefixes.
+func prefixesContain(prefixes []netip.Prefix, ip string) bool {
+	addr, ok := parseClientAddr(ip)
+	if !ok {
+		return false
+	}
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripPort removes the port from a host header value, keeping IPv6
+// brackets intact.
+func stripPort(host string) string {
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.HasSuffix(host, "]") {
+		if strings.HasPrefix(host, "[") || strings.Count(host, ":") == 1 {
+			return host[:i]
+		}
+	}
+	return host
+}
+
+// pathScopePrefix returns the first segment of a canonical request path,
+// which is the prefix path-scoped bans apply to
+// (e.g., "/api/v1/users" -> "/api").
+func pathScopePrefix(path string) string {
+	if i := strings.IndexByte(strings.TrimPrefix(path, "/"), '/'); i >= 0 {
+		return path[:i+1]
+	}
+	return path
+}
+
+// normalizePath returns the canonical form of a request path, so that
+// equivalent spellings of a path match the same policies and ban scopes:
+// the query string is dropped, percent-encoded unreserved characters are
+// decoded, repeated slashes collapsed and dot segments resolved
+// (e.g., "//a/./%62/../c?x" -> "/a/c"). A trailing slash is kept.
+func normalizePath(p string) string {
+	p = decodeUnreserved(stripQuery(p))
+	if p == "" {
+		return "/"
+	}
+
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// decodeUnreserved decodes the percent-encoded unreserved characters
+// (RFC 3986 section 2.3) of a path. Other escapes, such as "%2F", are kept,
+// as decoding them would change the path segments.
+func decodeUnreserved(p string) string {
+	if !strings.Contains(p, "%") {
+		return p
+	}
+
+	var b strings.Builder
+	b.Grow(len(p))
+	for i := 0; i < len(p); i++ {
+		if p[i] == '%' && i+2 < len(p) {
+			if c, ok := unhex(p[i+1], p[i+2]); ok && isUnreserved(c) {
+				b.WriteByte(c)
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(p[i])
+	}
+	return b.String()
+}
+
+// unhex decodes two hex digits.
+func unhex(hi, lo byte) (byte, bool) {
+	h, ok1 := hexDigit(hi)
+	l, ok2 := hexDigit(lo)
+	return h<<4 | l, ok1 && ok2
+}
+
+// hexDigit returns the value of a hex digit.
+func hexDigit(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// isUnreserved returns true for the unreserved URI characters.
+func isUnreserved(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// hasPathPrefix returns true if path starts with prefix at a segment
+// boundary: "/login" matches "/login" and "/login/x", not "/login-help".
+func hasPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
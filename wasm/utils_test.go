@@ -168,3 +168,171 @@ func TestScoreKey(t *testing.T) {
 		t.Errorf("expected 'score:test-fingerprint', got %s", result)
 	}
 }
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := parsePrefixes([]string{"10.0.0.0/8", "192.168.1.10", "2001:db8::/32", "::1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(prefixes) != 4 {
+		t.Fatalf("expected 4 prefixes, got %d", len(prefixes))
+	}
+	if prefixes[1].Bits() != 32 {
+		t.Errorf("bare IPv4 should be /32, got /%d", prefixes[1].Bits())
+	}
+	if prefixes[3].Bits() != 128 {
+		t.Errorf("bare IPv6 should be /128, got /%d", prefixes[3].Bits())
+	}
+
+	if _, err := parsePrefixes([]string{"not-a-cidr"}); err == nil {
+		t.Error("expected error for invalid CIDR")
+	}
+	if _, err := parsePrefixes([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("expected error for invalid prefix length")
+	}
+}
+
+func TestPrefixesContain(t *testing.T) {
+	prefixes, _ := parsePrefixes([]string{"10.0.0.0/8", "2001:db8::/32"})
+
+	tests := []struct {
+		ip       string
+		expected bool
+	}{
+		{"10.1.2.3", true},
+		{"::ffff:10.1.2.3", true},
+		{"11.0.0.1", false},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+		{"", false},
+		{"garbage", false},
+	}
+
+	for _, tt := range tests {
+		if result := prefixesContain(prefixes, tt.ip); result != tt.expected {
+			t.Errorf("prefixesContain(%q) = %v, expected %v", tt.ip, result, tt.expected)
+		}
+	}
+}
+
+func TestKeyspace(t *testing.T) {
+	keys := NewKeyspace("cbw:prod:gw1:")
+
+	if keys.Ban("abc") != "cbw:prod:gw1:ban:abc" {
+		t.Errorf("unexpected ban key: %s", keys.Ban("abc"))
+	}
+	if keys.Score("abc") != "cbw:prod:gw1:score:abc" {
+		t.Errorf("unexpected score key: %s", keys.Score("abc"))
+	}
+	if keys.BanIndex() != "cbw:prod:gw1:ban-index" {
+		t.Errorf("unexpected index key: %s", keys.BanIndex())
+	}
+
+	unprefixed := NewKeyspace("")
+	if unprefixed.Ban("abc") != BanKey("abc") {
+		t.Error("empty prefix should produce legacy keys")
+	}
+}
+
+func TestStripPort(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"example.com", "example.com"},
+		{"example.com:8080", "example.com"},
+		{"192.168.1.1:443", "192.168.1.1"},
+		{"[2001:db8::1]:443", "[2001:db8::1]"},
+		{"[2001:db8::1]", "[2001:db8::1]"},
+		{"2001:db8::1", "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		if got := stripPort(tt.input); got != tt.expected {
+			t.Errorf("stripPort(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"/api/v1", "/api/v1"},
+		{"//api//v1", "/api/v1"},
+		{"/./api/../login", "/login"},
+		{"/../../etc", "/etc"},
+		{"/%61pi/%7Euser", "/api/~user"},
+		{"/a%2Fb", "/a%2Fb"},
+		{"/a%2", "/a%2"},
+		{"/static/", "/static/"},
+		{"/login?next=//x", "/login"},
+		{"", "/"},
+		{"api", "/api"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizePath(tt.input); got != tt.expected {
+			t.Errorf("normalizePath(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestHasPathPrefix(t *testing.T) {
+	tests := []struct {
+		path, prefix string
+		expected     bool
+	}{
+		{"/login", "/login", true},
+		{"/login/reset", "/login", true},
+		{"/login-help", "/login", false},
+		{"/static/app.js", "/static/", true},
+		{"/", "/", true},
+		{"/api", "/", true},
+	}
+
+	for _, tt := range tests {
+		if got := hasPathPrefix(tt.path, tt.prefix); got != tt.expected {
+			t.Errorf("hasPathPrefix(%q, %q) = %v, want %v", tt.path, tt.prefix, got, tt.expected)
+		}
+	}
+}
+
+func TestPathScopePrefix(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"/api/v1/users", "/api"},
+		{"/api", "/api"},
+		{"/", "/"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := pathScopePrefix(tt.input); got != tt.expected {
+			t.Errorf("pathScopePrefix(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestPathScopePrefix_CanonicalPath(t *testing.T) {
+	config := DefaultConfig()
+
+	// Spellings of a path under /api all derive the /api scope
+	for _, path := range []string{"/api/x", "//api/x", "/./api/x", "/%61pi/x", "/x/../api/x", "/api?next=/"} {
+		if got := pathScopePrefix(config.canonicalPath(path)); got != "/api" {
+			t.Errorf("pathScopePrefix(%q) = %q, want /api", path, got)
+		}
+	}
+
+	// Case is kept unless routes are case-insensitive
+	if got := pathScopePrefix(config.canonicalPath("/API/x")); got != "/API" {
+		t.Errorf("expected case to be kept, got %q", got)
+	}
+	config.CaseInsensitivePaths = true
+	if got := pathScopePrefix(config.canonicalPath("/API/x")); got != "/api" {
+		t.Errorf("expected case to be folded, got %q", got)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/proxy-wasm-go-sdk/proxywasm"
+)
+
+// maxWebhookBackoff caps the exponential retry delay.
+const maxWebhookBackoff = time.Minute
+
+// webhookPayload is the JSON body of a webhook request.
+type webhookPayload struct {
+	Source string      `json:"source"`
+	Events []*BanEvent `json:"events"`
+}
+
+// =============================================================================
+// Webhook Event Handler
+// =============================================================================
+
+// WebhookEventHandler buffers ban events and POSTs them as JSON batches.
+// Failed batches are retried with exponential backoff and dropped after
+// MaxRetries attempts. Only one request is in flight at a time, so events
+// are delivered in order.
+//
+// The handler is shared by all requests of a worker. Batches are only
+// dispatched from Flush, which must be called periodically from the
+// plugin's OnTick: HTTP calls dispatched from a request context are
+// cancelled by Envoy when the request completes.
+type WebhookEventHandler struct {
+	config    *WebhookConfig
+	transport WebhookTransport
+	logger    Logger
+	filter    *EventFilter
+	now       func() time.Time
+
+	buffer    []*BanEvent
+	lastFlush time.Time
+	inFlight  bool
+
+	// Pending batch awaiting retry
+	retryBody []byte
+	attempts  int
+	retryAt   time.Time
+}
+
+// NewWebhookEventHandler creates a webhook sink using the given transport.
+func NewWebhookEventHandler(config *WebhookConfig, transport WebhookTransport, logger Logger) *WebhookEventHandler {
+	h := &WebhookEventHandler{
+		config:    config,
+		transport: transport,
+		logger:    logger,
+		filter:    NewEventFilter(config.EventTypes, ""),
+		now:       time.Now,
+	}
+	h.lastFlush = h.now()
+	return h
+}
+
+// OnBanEvent queues the event for the next flush.
+func (h *WebhookEventHandler) OnBanEvent(event *BanEvent) {
+	if !h.filter.Allows(event) {
+		return
+	}
+
+	h.buffer = append(h.buffer, event)
+	if overflow := len(h.buffer) - h.config.MaxBuffer; overflow > 0 {
+		h.logger.Warn("webhook buffer full, dropping %d oldest events", overflow)
+		h.buffer = h.buffer[overflow:]
+	}
+}
+
+// Flush retries a failed batch once its backoff has elapsed, or sends the
+// next batch once it is full or the flush interval has elapsed.
+func (h *WebhookEventHandler) Flush() {
+	if h.inFlight {
+		return
+	}
+
+	if h.retryBody != nil {
+		if !h.now().Before(h.retryAt) {
+			h.dispatch(h.retryBody)
+		}
+		return
+	}
+
+	interval := time.Duration(h.config.FlushIntervalMs) * time.Millisecond
+	if len(h.buffer) >= h.config.BatchSize ||
+		(len(h.buffer) > 0 && h.now().Sub(h.lastFlush) >= interval) {
+		h.send()
+	}
+}
+
+// Pending returns the number of buffered events not yet sent.
+func (h *WebhookEventHandler) Pending() int {
+	return len(h.buffer)
+}
+
+// send takes the next batch from the buffer and dispatches it.
+func (h *WebhookEventHandler) send() {
+	size := len(h.buffer)
+	if size > h.config.BatchSize {
+		size = h.config.BatchSize
+	}
+	batch := h.buffer[:size]
+	h.buffer = h.buffer[size:]
+	h.lastFlush = h.now()
+
+	body, err := json.Marshal(&webhookPayload{Source: "coraza-ban-wasm", Events: batch})
+	if err != nil {
+		h.logger.Error("failed to serialize webhook batch: %v", err)
+		return
+	}
+
+	h.attempts = 0
+	h.dispatch(body)
+}
+
+// dispatch signs and sends a batch body.
+func (h *WebhookEventHandler) dispatch(body []byte) {
+	h.inFlight = true
+	err := h.transport.Send(h.headers(body), body, func(ok bool) {
+		h.inFlight = false
+		h.complete(body, ok)
+	})
+	if err != nil {
+		h.logger.Error("failed to dispatch webhook: %v", err)
+		h.inFlight = false
+		h.complete(body, false)
+	}
+}
+
+// complete records the outcome of a dispatch and schedules a retry on failure.
+func (h *WebhookEventHandler) complete(body []byte, ok bool) {
+	if ok {
+		h.retryBody = nil
+		h.attempts = 0
+		// Drain batches that filled up while this one was in flight
+		if len(h.buffer) >= h.config.BatchSize {
+			h.send()
+		}
+		return
+	}
+
+	h.attempts++
+	if h.attempts > h.config.MaxRetries {
+		h.logger.Error("webhook batch dropped after %d attempts", h.attempts)
+		h.retryBody = nil
+		h.attempts = 0
+		return
+	}
+
+	backoff := time.Duration(h.config.RetryBackoffMs) * time.Millisecond << (h.attempts - 1)
+	if backoff > maxWebhookBackoff {
+		backoff = maxWebhookBackoff
+	}
+	h.logger.Warn("webhook delivery failed, retry %d/%d in %s", h.attempts, h.config.MaxRetries, backoff)
+	h.retryBody = body
+	h.retryAt = h.now().Add(backoff)
+}
+
+// headers builds the request headers, including the signature when a
+// secret is configured.
+func (h *WebhookEventHandler) headers(body []byte) [][2]string {
+	headers := [][2]string{
+		{"content-type", "application/json"},
+	}
+	if h.config.Secret != "" {
+		timestamp := strconv.FormatInt(h.now().Unix(), 10)
+		headers = append(headers, [2]string{
+			h.config.SignatureHeader,
+			"t=" + timestamp + ",sha256=" + signWebhookPayload([]byte(h.config.Secret), timestamp, body),
+		})
+	}
+	return headers
+}
+
+// signWebhookPayload computes the hex HMAC-SHA256 of "<timestamp>.<body>".
+// Including the timestamp lets receivers reject replayed requests.
+func signWebhookPayload(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// =============================================================================
+// HTTP Webhook Transport
+// =============================================================================
+
+// HTTPWebhookTransport implements WebhookTransport by POSTing to an Envoy
+// cluster using proxywasm.DispatchHttpCall.
+type HTTPWebhookTransport struct {
+	cluster string
+	path    string
+	timeout uint32
+}
+
+// NewHTTPWebhookTransport creates a transport for the given cluster and path.
+func NewHTTPWebhookTransport(cluster, path string, timeout uint32) *HTTPWebhookTransport {
+	return &HTTPWebhookTransport{
+		cluster: cluster,
+		path:    path,
+		timeout: timeout,
+	}
+}
+
+// Send dispatches the batch and reports whether a 2xx status was returned.
+func (t *HTTPWebhookTransport) Send(headers [][2]string, body []byte, callback func(bool)) error {
+	headers = append([][2]string{
+		{":method", "POST"},
+		{":path", t.path},
+		{":authority", t.cluster},
+	}, headers...)
+
+	_, err := proxywasm.DispatchHttpCall(
+		t.cluster,
+		headers,
+		body,
+		nil,
+		t.timeout,
+		func(numHeaders, bodySize, numTrailers int) {
+			callback(strings.HasPrefix(getHttpCallResponseStatus(), "2"))
+		},
+	)
+	return err
+}
+
+// =============================================================================
+// Compile-Time Interface Verification
+// =============================================================================
+
+var (
+	_ EventHandler     = (*WebhookEventHandler)(nil)
+	_ WebhookTransport = (*HTTPWebhookTransport)(nil)
+)
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestWebhook returns a webhook handler with a controllable clock.
+func newTestWebhook(config *WebhookConfig) (*WebhookEventHandler, *MockWebhookTransport, *time.Time) {
+	config.setDefaults()
+	transport := &MockWebhookTransport{}
+	handler := NewWebhookEventHandler(config, transport, NewMockLogger())
+	now := time.Unix(1700000000, 0)
+	handler.now = func() time.Time { return now }
+	handler.lastFlush = now
+	return handler, transport, &now
+}
+
+func TestWebhookEventHandler_FlushesFullBatch(t *testing.T) {
+	handler, transport, _ := newTestWebhook(&WebhookConfig{BatchSize: 2})
+
+	handler.OnBanEvent(NewBanEvent(BanEventIssued, "fp1", "930120", "critical", "local"))
+	handler.Flush()
+	if len(transport.Requests) != 0 {
+		t.Fatal("partial batch should wait for the flush interval")
+	}
+
+	handler.OnBanEvent(NewBanEvent(BanEventIssued, "fp2", "930120", "critical", "local"))
+	handler.OnBanEvent(NewBanEvent(BanEventIssued, "fp3", "930120", "critical", "local"))
+	handler.Flush()
+
+	if len(transport.Requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(transport.Requests))
+	}
+	var payload webhookPayload
+	if err := json.Unmarshal(transport.Requests[0], &payload); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	if len(payload.Events) != 2 || payload.Events[0].Fingerprint != "fp1" {
+		t.Errorf("expected first two events in order, got %+v", payload.Events)
+	}
+	if handler.Pending() != 1 {
+		t.Errorf("expected 1 pending event, got %d", handler.Pending())
+	}
+
+	// Next batch waits for the in-flight request
+	handler.Flush()
+	if len(transport.Requests) != 1 {
+		t.Error("only one request should be in flight")
+	}
+}
+
+func TestWebhookEventHandler_FlushInterval(t *testing.T) {
+	handler, transport, now := newTestWebhook(&WebhookConfig{FlushIntervalMs: 5000})
+
+	handler.OnBanEvent(NewBanEvent(BanEventEnforced, "fp", "", "", "local"))
+	*now = now.Add(4 * time.Second)
+	handler.Flush()
+	if len(transport.Requests) != 0 {
+		t.Fatal("should not flush before the interval")
+	}
+
+	*now = now.Add(time.Second)
+	handler.Flush()
+	if len(transport.Requests) != 1 {
+		t.Errorf("expected flush after the interval, got %d requests", len(transport.Requests))
+	}
+}
+
+func TestWebhookEventHandler_EventTypeFilter(t *testing.T) {
+	handler, _, _ := newTestWebhook(&WebhookConfig{EventTypes: []string{"issued"}})
+
+	handler.OnBanEvent(NewBanEvent(BanEventIssued, "fp", "", "", "local"))
+	handler.OnBanEvent(NewBanEvent(BanEventEnforced, "fp", "", "", "local"))
+
+	if handler.Pending() != 1 {
+		t.Errorf("expected only issued events to be queued, got %d", handler.Pending())
+	}
+}
+
+func TestWebhookEventHandler_RetryWithBackoff(t *testing.T) {
+	handler, transport, now := newTestWebhook(&WebhookConfig{
+		BatchSize:      1,
+		MaxRetries:     2,
+		RetryBackoffMs: 1000,
+	})
+
+	handler.OnBanEvent(NewBanEvent(BanEventIssued, "fp", "", "", "local"))
+	handler.Flush()
+	transport.Complete(false)
+
+	// First retry after 1s
+	handler.Flush()
+	if len(transport.Requests) != 1 {
+		t.Fatal("retry should wait for the backoff")
+	}
+	*now = now.Add(time.Second)
+	handler.Flush()
+	if len(transport.Requests) != 2 {
+		t.Fatalf("expected retry after backoff, got %d requests", len(transport.Requests))
+	}
+	if string(transport.Requests[1]) != string(transport.Requests[0]) {
+		t.Error("retry should resend the same batch")
+	}
+	transport.Complete(false)
+
+	// Second retry after 2s
+	*now = now.Add(time.Second)
+	handler.Flush()
+	if len(transport.Requests) != 2 {
+		t.Fatal("backoff should double")
+	}
+	*now = now.Add(time.Second)
+	handler.Flush()
+	transport.Complete(false)
+
+	// Retries exhausted: batch dropped
+	*now = now.Add(time.Hour)
+	handler.Flush()
+	if len(transport.Requests) != 3 {
+		t.Errorf("batch should be dropped after max retries, got %d requests", len(transport.Requests))
+	}
+}
+
+func TestWebhookEventHandler_DispatchError(t *testing.T) {
+	handler, transport, _ := newTestWebhook(&WebhookConfig{BatchSize: 1, MaxRetries: 0})
+	transport.Err = errors.New("cluster not found")
+
+	handler.OnBanEvent(NewBanEvent(BanEventIssued, "fp", "", "", "local"))
+	handler.Flush()
+
+	if handler.inFlight {
+		t.Error("dispatch error should not leave a request in flight")
+	}
+	if handler.retryBody != nil {
+		t.Error("batch should be dropped with max_retries=0")
+	}
+}
+
+func TestWebhookEventHandler_BufferLimit(t *testing.T) {
+	handler, _, _ := newTestWebhook(&WebhookConfig{BatchSize: 2, MaxBuffer: 3})
+
+	for _, fp := range []string{"fp1", "fp2", "fp3", "fp4"} {
+		handler.OnBanEvent(NewBanEvent(BanEventIssued, fp, "", "", "local"))
+	}
+
+	if handler.Pending() != 3 || handler.buffer[0].Fingerprint != "fp2" {
+		t.Errorf("expected oldest event dropped, got %d pending", handler.Pending())
+	}
+}
+
+func TestWebhookEventHandler_Signature(t *testing.T) {
+	handler, transport, _ := newTestWebhook(&WebhookConfig{BatchSize: 1, Secret: "s3cr3t"})
+
+	handler.OnBanEvent(NewBanEvent(BanEventIssued, "fp", "", "", "local"))
+	handler.Flush()
+
+	var signature string
+	for _, header := range transport.Headers[0] {
+		if header[0] == DefaultWebhookSigHdr {
+			signature = header[1]
+		}
+	}
+
+	expected := "t=1700000000,sha256=" + signWebhookPayload([]byte("s3cr3t"), "1700000000", transport.Requests[0])
+	if signature != expected {
+		t.Errorf("expected signature %s, got %s", expected, signature)
+	}
+	if !strings.Contains(signature, "sha256=") || len(signature) != len("t=1700000000,sha256=")+64 {
+		t.Errorf("unexpected signature format: %s", signature)
+	}
+}